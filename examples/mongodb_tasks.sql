@@ -1,4 +1,5 @@
 -- 示例：MongoDB 存储任务配置
+-- MongoDB 连接在 Worker 配置的 storage.mongodb 中设置；table 为集合名，keys 为 upsert 主键
 
 -- 1. API 采集 + MongoDB 存储
 INSERT INTO collection_tasks (
@@ -48,12 +49,7 @@ INSERT INTO collection_tasks (
         "storage": {
             "target": "mongodb",
             "database": "datafusion",
-            "collection": "api_data",
-            "config": {
-                "uri": "mongodb://localhost:27017",
-                "timeout": 30,
-                "max_pool_size": 100
-            }
+            "table": "api_data"
         }
     }',
     NOW(),
@@ -117,11 +113,8 @@ INSERT INTO collection_tasks (
         "storage": {
             "target": "mongodb",
             "database": "datafusion",
-            "collection": "users",
-            "config": {
-                "uri": "mongodb://localhost:27017",
-                "timeout": 30
-            }
+            "table": "users",
+            "keys": ["id"]
         }
     }',
     NOW(),
@@ -188,10 +181,8 @@ INSERT INTO collection_tasks (
         "storage": {
             "target": "mongodb",
             "database": "datafusion",
-            "collection": "news",
-            "config": {
-                "uri": "mongodb://localhost:27017"
-            }
+            "table": "news",
+            "keys": ["title"]
         }
     }',
     NOW(),
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/datafusion/worker/internal/database"
+	"github.com/datafusion/worker/internal/logger"
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/schedule"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// minBackfillInterval 补数窗口的最小长度
+const minBackfillInterval = time.Minute
+
+type BackfillHandler struct {
+	db  *sql.DB
+	log *logger.Logger
+}
+
+func NewBackfillHandler(db *sql.DB, log *logger.Logger) *BackfillHandler {
+	return &BackfillHandler{db: db, log: log}
+}
+
+// backfillRequest 创建补数的请求
+type backfillRequest struct {
+	TaskID      int64     `json:"task_id" binding:"required"`
+	Start       time.Time `json:"start" binding:"required"` // RFC3339
+	End         time.Time `json:"end" binding:"required"`
+	Interval    string    `json:"interval"`    // 窗口长度，如 1h、24h，默认 24h
+	Concurrency int       `json:"concurrency"` // 同时执行的窗口数，默认 1
+}
+
+// backfillColumns 补数字段及各状态的窗口数，与 scanBackfill 的扫描顺序对应
+const backfillColumns = `b.id, b.task_id, COALESCE(t.name, ''), b.start_time, b.end_time, b.interval_seconds, b.concurrency,
+	b.status, COALESCE(b.created_by, ''), COALESCE(b.cancelled_by, ''), b.created_at, b.finished_at,
+	COUNT(w.id), COUNT(w.id) FILTER (WHERE w.status = 'pending'), COUNT(w.id) FILTER (WHERE w.status = 'running'),
+	COUNT(w.id) FILTER (WHERE w.status = 'success'), COUNT(w.id) FILTER (WHERE w.status = 'failed'),
+	COUNT(w.id) FILTER (WHERE w.status = 'cancelled')`
+
+// backfillFrom 补数查询的表和分组，WHERE 条件插入在 %s 处
+const backfillFrom = `FROM backfills b
+	LEFT JOIN collection_tasks t ON t.id = b.task_id
+	LEFT JOIN backfill_windows w ON w.backfill_id = b.id
+	%s
+	GROUP BY b.id, t.name`
+
+// scanBackfill 扫描一行补数数据
+func scanBackfill(scanner interface{ Scan(...interface{}) error }) (*models.Backfill, error) {
+	var b models.Backfill
+	p := &b.Progress
+	if err := scanner.Scan(&b.ID, &b.TaskID, &b.TaskName, &b.StartTime, &b.EndTime, &b.IntervalSeconds, &b.Concurrency,
+		&b.Status, &b.CreatedBy, &b.CancelledBy, &b.CreatedAt, &b.FinishedAt,
+		&p.Total, &p.Pending, &p.Running, &p.Success, &p.Failed, &p.Cancelled); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// List 获取补数列表，支持按 task_id、status 过滤
+func (h *BackfillHandler) List(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	taskID := c.Query("task_id")
+	status := c.Query("status")
+
+	offset := (page - 1) * pageSize
+
+	where := `WHERE ($1 = '' OR b.task_id::text = $1) AND ($2 = '' OR b.status = $2)`
+	rows, err := h.db.Query(`SELECT `+backfillColumns+` `+fmt.Sprintf(backfillFrom, where)+`
+	    ORDER BY b.created_at DESC LIMIT $3 OFFSET $4`, taskID, status, pageSize, offset)
+	if err != nil {
+		h.log.Error("查询补数列表失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+	defer rows.Close()
+
+	backfills := []models.Backfill{}
+	for rows.Next() {
+		b, err := scanBackfill(rows)
+		if err != nil {
+			h.log.Error("扫描补数数据失败", zap.Error(err))
+			continue
+		}
+		backfills = append(backfills, *b)
+	}
+
+	var total int
+	h.db.QueryRow(`SELECT COUNT(*) FROM backfills b `+where, taskID, status).Scan(&total)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      backfills,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// Get 获取补数详情及各窗口的状态
+func (h *BackfillHandler) Get(c *gin.Context) {
+	id := c.Param("id")
+
+	b, err := scanBackfill(h.db.QueryRow(`SELECT `+backfillColumns+` `+fmt.Sprintf(backfillFrom, "WHERE b.id = $1"), id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "补数不存在"})
+		return
+	}
+	if err != nil {
+		h.log.Error("查询补数失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	rows, err := h.db.Query(`SELECT id, backfill_id, window_start, window_end, status, execution_id, COALESCE(worker_pod, ''),
+	    COALESCE(records_collected, 0), COALESCE(error, ''), started_at, finished_at
+	    FROM backfill_windows WHERE backfill_id = $1 ORDER BY window_start`, b.ID)
+	if err != nil {
+		h.log.Error("查询补数窗口失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+	defer rows.Close()
+
+	b.Windows = []models.BackfillWindow{}
+	for rows.Next() {
+		var w models.BackfillWindow
+		if err := rows.Scan(&w.ID, &w.BackfillID, &w.WindowStart, &w.WindowEnd, &w.Status, &w.ExecutionID,
+			&w.WorkerPod, &w.RecordsCollected, &w.Error, &w.StartedAt, &w.FinishedAt); err != nil {
+			h.log.Error("扫描补数窗口数据失败", zap.Error(err))
+			continue
+		}
+		b.Windows = append(b.Windows, w)
+	}
+
+	c.JSON(http.StatusOK, b)
+}
+
+// planBackfill 校验补数请求并切分时间窗口
+func planBackfill(req *backfillRequest) ([]schedule.Window, time.Duration, string) {
+	interval := schedule.DefaultWindow
+	if req.Interval != "" {
+		d, err := time.ParseDuration(req.Interval)
+		if err != nil {
+			return nil, 0, "无效的 interval: " + err.Error()
+		}
+		interval = d
+	}
+	if interval < minBackfillInterval || interval%time.Second != 0 {
+		return nil, 0, fmt.Sprintf("interval 不能小于 %v，且必须为整秒", minBackfillInterval)
+	}
+	if !req.Start.Before(req.End) {
+		return nil, 0, "start 必须早于 end"
+	}
+	if req.End.After(time.Now()) {
+		return nil, 0, "end 不能晚于当前时间"
+	}
+	if req.Concurrency < 0 {
+		return nil, 0, "concurrency 不能为负数"
+	}
+
+	// 先计算窗口数，超过上限时不生成窗口
+	if n := schedule.CountWindows(req.Start.UTC(), req.End.UTC(), interval); n > models.MaxBackfillWindows {
+		return nil, 0, fmt.Sprintf("时间窗口数 %d 超过上限 %d，请增大 interval 或缩小时间范围", n, models.MaxBackfillWindows)
+	}
+	return schedule.SplitWindows(req.Start.UTC(), req.End.UTC(), interval), interval, ""
+}
+
+// Create 创建补数：将 [start, end) 按 interval 切分为窗口，每个窗口由 Worker 执行一次任务，
+// 执行时数据源中的 {{.WindowStart}}、{{.WindowEnd}} 替换为窗口的起止时间
+func (h *BackfillHandler) Create(c *gin.Context) {
+	var req backfillRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	windows, interval, msg := planBackfill(&req)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	// 任务和数据源配置，用于提示没有使用时间窗口参数的任务
+	var config string
+	err := h.db.QueryRow(`SELECT COALESCE(t.config::text, '') || COALESCE(d.config::text, '')
+	    FROM collection_tasks t LEFT JOIN data_sources d ON d.id = t.data_source_id
+	    WHERE t.id = $1`, req.TaskID).Scan(&config)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("任务 %d 不存在", req.TaskID)})
+		return
+	}
+	if err != nil {
+		h.log.Error("查询任务失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	concurrency := req.Concurrency
+	if concurrency == 0 {
+		concurrency = 1
+	}
+	backfill := &models.Backfill{
+		TaskID:          req.TaskID,
+		StartTime:       req.Start.UTC(),
+		EndTime:         req.End.UTC(),
+		IntervalSeconds: int(interval / time.Second),
+		Concurrency:     concurrency,
+		CreatedBy:       c.GetString("username"),
+	}
+	if err := (&database.PostgresDB{DB: h.db}).CreateBackfill(c.Request.Context(), backfill, windows); err != nil {
+		h.log.Error("创建补数失败", zap.Int64("task_id", req.TaskID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败"})
+		return
+	}
+
+	h.log.Info("创建补数", zap.Int64("backfill_id", backfill.ID), zap.Int64("task_id", req.TaskID),
+		zap.Int("windows", len(windows)), zap.Int("concurrency", concurrency),
+		zap.String("username", backfill.CreatedBy))
+	if !schedule.HasWindowParams(config) {
+		c.JSON(http.StatusCreated, gin.H{
+			"backfill": backfill,
+			"warning":  "任务配置中没有 {{.WindowStart}}、{{.WindowEnd}} 参数，每个窗口将采集相同的数据",
+		})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"backfill": backfill})
+}
+
+// Cancel 取消补数：未开始的窗口不再执行，执行中的窗口请求取消
+func (h *BackfillHandler) Cancel(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的补数ID"})
+		return
+	}
+
+	var status string
+	err = h.db.QueryRow("SELECT status FROM backfills WHERE id = $1", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "补数不存在"})
+		return
+	}
+	if err != nil {
+		h.log.Error("查询补数失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	username := c.GetString("username")
+	ok, executionIDs, err := (&database.PostgresDB{DB: h.db}).CancelBackfill(c.Request.Context(), id, username)
+	if err != nil {
+		h.log.Error("取消补数失败", zap.Int64("backfill_id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消失败"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "补数已结束，无法取消", "status": status})
+		return
+	}
+
+	cancelling := 0
+	for _, executionID := range executionIDs {
+		statuses, err := cancelExecutions(h.db, "e.id = $1", executionID, username)
+		if err != nil {
+			h.log.Error("取消补数窗口的执行失败", zap.Int64("backfill_id", id), zap.Int64("execution_id", executionID), zap.Error(err))
+			continue
+		}
+		if statuses[executionID] == models.ExecutionStatusCancelling {
+			cancelling++
+		}
+	}
+
+	h.log.Info("取消补数", zap.Int64("backfill_id", id), zap.String("username", username),
+		zap.Int("running_windows", len(executionIDs)))
+	c.JSON(http.StatusAccepted, gin.H{"message": "已取消补数", "cancelling": cancelling})
+}
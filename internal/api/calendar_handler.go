@@ -0,0 +1,191 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/datafusion/worker/internal/logger"
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/schedule"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+type CalendarHandler struct {
+	db  *sql.DB
+	log *logger.Logger
+}
+
+func NewCalendarHandler(db *sql.DB, log *logger.Logger) *CalendarHandler {
+	return &CalendarHandler{db: db, log: log}
+}
+
+const calendarColumns = `name, COALESCE(description, ''), COALESCE(weekdays, '{}'), COALESCE(holidays, '{}'),
+	COALESCE(workdays, '{}'), created_at, updated_at`
+
+// scanCalendar 扫描一行日历数据
+func scanCalendar(scanner interface{ Scan(...interface{}) error }) (*models.Calendar, error) {
+	var cal models.Calendar
+	if err := scanner.Scan(&cal.Name, &cal.Description, pq.Array(&cal.Weekdays), pq.Array(&cal.Holidays),
+		pq.Array(&cal.Workdays), &cal.CreatedAt, &cal.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &cal, nil
+}
+
+// List 获取日历列表
+func (h *CalendarHandler) List(c *gin.Context) {
+	rows, err := h.db.Query(`SELECT ` + calendarColumns + ` FROM calendars ORDER BY name`)
+	if err != nil {
+		h.log.Error("查询日历失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+	defer rows.Close()
+
+	calendars := []models.Calendar{}
+	for rows.Next() {
+		cal, err := scanCalendar(rows)
+		if err != nil {
+			h.log.Error("扫描日历数据失败", zap.Error(err))
+			continue
+		}
+		calendars = append(calendars, *cal)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": calendars, "total": len(calendars)})
+}
+
+// Get 获取单个日历
+func (h *CalendarHandler) Get(c *gin.Context) {
+	cal, err := scanCalendar(h.db.QueryRow(`SELECT `+calendarColumns+` FROM calendars WHERE name = $1`, c.Param("name")))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "日历不存在"})
+		return
+	}
+	if err != nil {
+		h.log.Error("查询日历失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, cal)
+}
+
+// validateCalendar 校验日历配置，设置默认工作日
+func validateCalendar(cal *models.Calendar) string {
+	if strings.TrimSpace(cal.Name) == "" {
+		return "日历名称不能为空"
+	}
+	if len(cal.Weekdays) == 0 {
+		cal.Weekdays = []int64{1, 2, 3, 4, 5}
+	}
+	if cal.Holidays == nil {
+		cal.Holidays = []string{}
+	}
+	if cal.Workdays == nil {
+		cal.Workdays = []string{}
+	}
+	if _, err := schedule.NewCalendar(cal.Weekdays, cal.Holidays, cal.Workdays); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// Create 创建日历
+func (h *CalendarHandler) Create(c *gin.Context) {
+	var cal models.Calendar
+	if err := c.ShouldBindJSON(&cal); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateCalendar(&cal); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	err := h.db.QueryRow(`INSERT INTO calendars (name, description, weekdays, holidays, workdays)
+	    VALUES ($1, $2, $3, $4, $5) ON CONFLICT (name) DO NOTHING RETURNING created_at, updated_at`,
+		cal.Name, cal.Description, pq.Array(cal.Weekdays), pq.Array(cal.Holidays), pq.Array(cal.Workdays),
+	).Scan(&cal.CreatedAt, &cal.UpdatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusConflict, gin.H{"error": "日历已存在"})
+		return
+	}
+	if err != nil {
+		h.log.Error("创建日历失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败"})
+		return
+	}
+
+	h.log.Info("创建日历成功", zap.String("calendar", cal.Name))
+	c.JSON(http.StatusCreated, cal)
+}
+
+// Update 更新日历的描述、工作日和节假日，引用该日历的任务下次计算执行时间时生效
+func (h *CalendarHandler) Update(c *gin.Context) {
+	name := c.Param("name")
+
+	var cal models.Calendar
+	if err := c.ShouldBindJSON(&cal); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cal.Name = name
+	if msg := validateCalendar(&cal); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	result, err := h.db.Exec(`UPDATE calendars SET description=$1, weekdays=$2, holidays=$3, workdays=$4, updated_at=NOW()
+	    WHERE name=$5`, cal.Description, pq.Array(cal.Weekdays), pq.Array(cal.Holidays), pq.Array(cal.Workdays), name)
+	if err != nil {
+		h.log.Error("更新日历失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+		return
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "日历不存在"})
+		return
+	}
+
+	h.log.Info("更新日历成功", zap.String("calendar", name),
+		zap.Int("holidays", len(cal.Holidays)), zap.Int("workdays", len(cal.Workdays)))
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功"})
+}
+
+// Delete 删除日历，仍被任务引用的日历不能删除
+func (h *CalendarHandler) Delete(c *gin.Context) {
+	name := c.Param("name")
+
+	var tasks int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM collection_tasks WHERE calendar = $1", name).Scan(&tasks); err != nil {
+		h.log.Error("查询引用日历的任务数失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+	if tasks > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "日历仍被任务引用，请先修改这些任务", "tasks": tasks})
+		return
+	}
+
+	result, err := h.db.Exec("DELETE FROM calendars WHERE name=$1", name)
+	if err != nil {
+		h.log.Error("删除日历失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "日历不存在"})
+		return
+	}
+
+	h.log.Info("删除日历成功", zap.String("calendar", name))
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
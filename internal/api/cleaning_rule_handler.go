@@ -26,6 +26,7 @@ type CleaningRule struct {
 	Description string    `json:"description"`
 	RuleType    string    `json:"rule_type"` // trim, remove_html, regex, etc.
 	Config      string    `json:"config"`    // JSON配置
+	Version     int       `json:"version"`   // 规则版本，每次修改递增
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -37,7 +38,7 @@ func (h *CleaningRuleHandler) List(c *gin.Context) {
 
 	offset := (page - 1) * pageSize
 
-	rows, err := h.db.Query(`SELECT id, name, description, rule_type, config, created_at, updated_at 
+	rows, err := h.db.Query(`SELECT id, name, description, rule_type, config, COALESCE(version, 1), created_at, updated_at 
 	                         FROM cleaning_rules ORDER BY created_at DESC LIMIT $1 OFFSET $2`,
 		pageSize, offset)
 	if err != nil {
@@ -51,7 +52,7 @@ func (h *CleaningRuleHandler) List(c *gin.Context) {
 	for rows.Next() {
 		var rule CleaningRule
 		err := rows.Scan(&rule.ID, &rule.Name, &rule.Description, &rule.RuleType,
-			&rule.Config, &rule.CreatedAt, &rule.UpdatedAt)
+			&rule.Config, &rule.Version, &rule.CreatedAt, &rule.UpdatedAt)
 		if err != nil {
 			h.log.Error("扫描清洗规则数据失败", zap.Error(err))
 			continue
@@ -75,10 +76,10 @@ func (h *CleaningRuleHandler) Get(c *gin.Context) {
 	id := c.Param("id")
 
 	var rule CleaningRule
-	err := h.db.QueryRow(`SELECT id, name, description, rule_type, config, created_at, updated_at 
+	err := h.db.QueryRow(`SELECT id, name, description, rule_type, config, COALESCE(version, 1), created_at, updated_at 
 	                      FROM cleaning_rules WHERE id = $1`, id).
 		Scan(&rule.ID, &rule.Name, &rule.Description, &rule.RuleType,
-			&rule.Config, &rule.CreatedAt, &rule.UpdatedAt)
+			&rule.Config, &rule.Version, &rule.CreatedAt, &rule.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "清洗规则不存在"})
@@ -93,7 +94,7 @@ func (h *CleaningRuleHandler) Get(c *gin.Context) {
 	c.JSON(http.StatusOK, rule)
 }
 
-// Create 创建清洗规则
+// Create 创建清洗规则（版本 1）
 func (h *CleaningRuleHandler) Create(c *gin.Context) {
 	var rule CleaningRule
 	if err := c.ShouldBindJSON(&rule); err != nil {
@@ -101,9 +102,24 @@ func (h *CleaningRuleHandler) Create(c *gin.Context) {
 		return
 	}
 
-	err := h.db.QueryRow(`INSERT INTO cleaning_rules (name, description, rule_type, config) 
-	    VALUES ($1, $2, $3, $4) RETURNING id`,
-		rule.Name, rule.Description, rule.RuleType, rule.Config).Scan(&rule.ID)
+	tx, err := h.db.Begin()
+	if err != nil {
+		h.log.Error("开始事务失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败"})
+		return
+	}
+	defer tx.Rollback()
+
+	rule.Version = 1
+	err = tx.QueryRow(`INSERT INTO cleaning_rules (name, description, rule_type, config, version) 
+	    VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		rule.Name, rule.Description, rule.RuleType, rule.Config, rule.Version).Scan(&rule.ID)
+	if err == nil {
+		err = saveCleaningRuleVersion(tx, &rule)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 
 	if err != nil {
 		h.log.Error("创建清洗规则失败", zap.Error(err))
@@ -115,7 +131,7 @@ func (h *CleaningRuleHandler) Create(c *gin.Context) {
 	c.JSON(http.StatusCreated, rule)
 }
 
-// Update 更新清洗规则
+// Update 更新清洗规则，版本号加 1 并保存新版本
 func (h *CleaningRuleHandler) Update(c *gin.Context) {
 	id := c.Param("id")
 
@@ -125,10 +141,28 @@ func (h *CleaningRuleHandler) Update(c *gin.Context) {
 		return
 	}
 
-	result, err := h.db.Exec(`UPDATE cleaning_rules SET 
-	    name=$1, description=$2, rule_type=$3, config=$4, updated_at=NOW() 
-	    WHERE id=$5`,
-		rule.Name, rule.Description, rule.RuleType, rule.Config, id)
+	tx, err := h.db.Begin()
+	if err != nil {
+		h.log.Error("开始事务失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`UPDATE cleaning_rules SET 
+	    name=$1, description=$2, rule_type=$3, config=$4, version=COALESCE(version, 1) + 1, updated_at=NOW() 
+	    WHERE id=$5 RETURNING id, version`,
+		rule.Name, rule.Description, rule.RuleType, rule.Config, id).Scan(&rule.ID, &rule.Version)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "清洗规则不存在"})
+		return
+	}
+	if err == nil {
+		err = saveCleaningRuleVersion(tx, &rule)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 
 	if err != nil {
 		h.log.Error("更新清洗规则失败", zap.Error(err))
@@ -136,13 +170,139 @@ func (h *CleaningRuleHandler) Update(c *gin.Context) {
 		return
 	}
 
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "清洗规则不存在"})
+	h.log.Info("更新清洗规则成功", zap.String("rule_id", id), zap.Int("version", rule.Version))
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功", "version": rule.Version})
+}
+
+// saveCleaningRuleVersion 保存清洗规则的一个版本
+func saveCleaningRuleVersion(tx *sql.Tx, rule *CleaningRule) error {
+	_, err := tx.Exec(`INSERT INTO cleaning_rule_versions (rule_id, version, name, description, rule_type, config)
+	    VALUES ($1, $2, $3, $4, $5, $6)`,
+		rule.ID, rule.Version, rule.Name, rule.Description, rule.RuleType, rule.Config)
+	return err
+}
+
+// ListVersions 获取清洗规则的历史版本（新版本在前）
+func (h *CleaningRuleHandler) ListVersions(c *gin.Context) {
+	id := c.Param("id")
+
+	rows, err := h.db.Query(`SELECT rule_id, version, name, COALESCE(description, ''), rule_type, config, created_at
+	                         FROM cleaning_rule_versions WHERE rule_id = $1 ORDER BY version DESC`, id)
+	if err != nil {
+		h.log.Error("查询清洗规则版本失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+	defer rows.Close()
+
+	versions := []CleaningRule{}
+	for rows.Next() {
+		var rule CleaningRule
+		if err := rows.Scan(&rule.ID, &rule.Version, &rule.Name, &rule.Description, &rule.RuleType,
+			&rule.Config, &rule.CreatedAt); err != nil {
+			h.log.Error("扫描清洗规则版本失败", zap.Error(err))
+			continue
+		}
+		rule.UpdatedAt = rule.CreatedAt
+		versions = append(versions, rule)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": versions})
+}
+
+// TaskCleaningRule 任务绑定的清洗规则
+type TaskCleaningRule struct {
+	CleaningRuleID int64  `json:"cleaning_rule_id" binding:"required"`
+	FieldName      string `json:"field_name" binding:"required"` // 应用规则的字段，支持嵌套路径
+	OrderIndex     int    `json:"order_index"`                   // 执行顺序，从小到大
+	Name           string `json:"name,omitempty"`
+	RuleType       string `json:"rule_type,omitempty"`
+	Version        int    `json:"version,omitempty"`
+}
+
+// ListTaskRules 获取任务绑定的清洗规则（按执行顺序）
+func (h *CleaningRuleHandler) ListTaskRules(c *gin.Context) {
+	taskID := c.Param("id")
+
+	rows, err := h.db.Query(`SELECT t.cleaning_rule_id, COALESCE(t.field_name, ''), t.order_index, r.name, r.rule_type, COALESCE(r.version, 1)
+	                         FROM task_cleaning_rules t JOIN cleaning_rules r ON r.id = t.cleaning_rule_id
+	                         WHERE t.task_id = $1 ORDER BY t.order_index, t.id`, taskID)
+	if err != nil {
+		h.log.Error("查询任务清洗规则失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+	defer rows.Close()
+
+	bindings := []TaskCleaningRule{}
+	for rows.Next() {
+		var b TaskCleaningRule
+		if err := rows.Scan(&b.CleaningRuleID, &b.FieldName, &b.OrderIndex, &b.Name, &b.RuleType, &b.Version); err != nil {
+			h.log.Error("扫描任务清洗规则失败", zap.Error(err))
+			continue
+		}
+		bindings = append(bindings, b)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": bindings})
+}
+
+// SetTaskRules 替换任务绑定的清洗规则，未指定 order_index 时按数组顺序执行
+func (h *CleaningRuleHandler) SetTaskRules(c *gin.Context) {
+	taskID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的任务ID"})
+		return
+	}
+
+	var req struct {
+		Rules []TaskCleaningRule `json:"rules" binding:"dive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		h.log.Error("开始事务失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM collection_tasks WHERE id = $1)", taskID).Scan(&exists); err != nil || !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "任务不存在"})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM task_cleaning_rules WHERE task_id = $1", taskID); err != nil {
+		h.log.Error("删除任务清洗规则失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+		return
+	}
+
+	for i, b := range req.Rules {
+		order := b.OrderIndex
+		if order == 0 {
+			order = i + 1
+		}
+		if _, err := tx.Exec(`INSERT INTO task_cleaning_rules (task_id, cleaning_rule_id, field_name, order_index)
+		    VALUES ($1, $2, $3, $4)`, taskID, b.CleaningRuleID, b.FieldName, order); err != nil {
+			h.log.Error("绑定清洗规则失败", zap.Error(err), zap.Int64("rule_id", b.CleaningRuleID))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "绑定清洗规则失败，请检查规则是否存在或重复"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		h.log.Error("提交事务失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
 		return
 	}
 
-	h.log.Info("更新清洗规则成功", zap.String("rule_id", id))
+	h.log.Info("更新任务清洗规则成功", zap.Int64("task_id", taskID), zap.Int("count", len(req.Rules)))
 	c.JSON(http.StatusOK, gin.H{"message": "更新成功"})
 }
 
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/datafusion/worker/internal/logger"
+	"github.com/datafusion/worker/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// DeadLetterHandler 死信队列管理
+// 重放只是将记录标记为 replay_requested，由 Worker 在下一次轮询时按任务当前配置重新处理
+type DeadLetterHandler struct {
+	db  *sql.DB
+	log *logger.Logger
+}
+
+func NewDeadLetterHandler(db *sql.DB, log *logger.Logger) *DeadLetterHandler {
+	return &DeadLetterHandler{db: db, log: log}
+}
+
+type DeadLetter struct {
+	ID           int64           `json:"id"`
+	TaskID       int64           `json:"task_id"`
+	TaskName     *string         `json:"task_name"`
+	ExecutionID  *int64          `json:"execution_id"`
+	Stage        string          `json:"stage"`      // clean, transform, storage
+	StageName    *string         `json:"stage_name"` // 拒绝记录的处理阶段名称
+	Rule         *string         `json:"rule"`
+	Target       *string         `json:"target"`
+	Error        *string         `json:"error"`
+	Record       json.RawMessage `json:"record"`
+	Status       string          `json:"status"` // pending, replay_requested, replaying, replayed, discarded
+	ReplayCount  int             `json:"replay_count"`
+	PIIProtected bool            `json:"pii_protected"` // 记录是否已按 PII 策略脱敏
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+	ReplayedAt   *time.Time      `json:"replayed_at"`
+}
+
+const deadLetterColumns = `d.id, d.task_id, t.name as task_name, d.execution_id, d.stage, d.stage_name, d.rule, d.target,
+	          d.error, d.record, d.status, d.replay_count, COALESCE(d.pii_protected, FALSE), d.created_at, d.updated_at, d.replayed_at`
+
+// scanDeadLetter 扫描一行死信记录
+func scanDeadLetter(row interface{ Scan(...any) error }, dl *DeadLetter) error {
+	return row.Scan(&dl.ID, &dl.TaskID, &dl.TaskName, &dl.ExecutionID, &dl.Stage, &dl.StageName, &dl.Rule, &dl.Target,
+		&dl.Error, &dl.Record, &dl.Status, &dl.ReplayCount, &dl.PIIProtected, &dl.CreatedAt, &dl.UpdatedAt, &dl.ReplayedAt)
+}
+
+// List 获取死信记录列表，支持按 task_id、execution_id、stage、status 过滤
+func (h *DeadLetterHandler) List(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	offset := (page - 1) * pageSize
+
+	where := " WHERE 1=1"
+	args := []any{}
+	for _, filter := range []string{"task_id", "execution_id", "stage", "status"} {
+		if value := c.Query(filter); value != "" {
+			args = append(args, value)
+			where += " AND d." + filter + " = $" + strconv.Itoa(len(args))
+		}
+	}
+
+	var total int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM dead_letter_records d"+where, args...).Scan(&total); err != nil {
+		h.log.Error("统计死信记录失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	query := `SELECT ` + deadLetterColumns + `
+	          FROM dead_letter_records d
+	          LEFT JOIN collection_tasks t ON d.task_id = t.id` + where +
+		" ORDER BY d.id DESC LIMIT $" + strconv.Itoa(len(args)+1) + " OFFSET $" + strconv.Itoa(len(args)+2)
+	rows, err := h.db.Query(query, append(args, pageSize, offset)...)
+	if err != nil {
+		h.log.Error("查询死信记录失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+	defer rows.Close()
+
+	items := []DeadLetter{}
+	for rows.Next() {
+		var dl DeadLetter
+		if err := scanDeadLetter(rows, &dl); err != nil {
+			h.log.Error("扫描死信记录失败", zap.Error(err))
+			continue
+		}
+		items = append(items, dl)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": items,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": pageSize,
+			"total": total,
+		},
+	})
+}
+
+// Get 获取单条死信记录
+func (h *DeadLetterHandler) Get(c *gin.Context) {
+	id := c.Param("id")
+
+	var dl DeadLetter
+	err := scanDeadLetter(h.db.QueryRow(`SELECT `+deadLetterColumns+`
+	          FROM dead_letter_records d
+	          LEFT JOIN collection_tasks t ON d.task_id = t.id
+	          WHERE d.id = $1`, id), &dl)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "死信记录不存在"})
+		return
+	}
+	if err != nil {
+		h.log.Error("查询死信记录失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dl)
+}
+
+// Update 修改死信记录的数据内容，修改后可重新重放
+func (h *DeadLetterHandler) Update(c *gin.Context) {
+	id := c.Param("id")
+
+	var req struct {
+		Record map[string]interface{} `json:"record" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	record, err := json.Marshal(req.Record)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 正在重放或已重放成功的记录不允许修改；修改后的内容可能包含明文 PII，重放时重新经过 PII 阶段
+	result, err := h.db.Exec(`UPDATE dead_letter_records SET record = $1, status = $2, pii_protected = FALSE
+	    WHERE id = $3 AND status IN ($2, $4)`,
+		string(record), models.DeadLetterStatusPending, id, models.DeadLetterStatusDiscarded)
+	if err != nil {
+		h.log.Error("更新死信记录失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+		return
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "死信记录不存在或当前状态不允许修改"})
+		return
+	}
+
+	h.log.Info("更新死信记录成功", zap.String("id", id))
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功"})
+}
+
+// Replay 请求重放单条死信记录
+func (h *DeadLetterHandler) Replay(c *gin.Context) {
+	id := c.Param("id")
+
+	result, err := h.db.Exec(`UPDATE dead_letter_records SET status = $1
+	    WHERE id = $2 AND status IN ($3, $4)`,
+		models.DeadLetterStatusReplayRequested, id, models.DeadLetterStatusPending, models.DeadLetterStatusDiscarded)
+	if err != nil {
+		h.log.Error("请求重放死信记录失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "请求重放失败"})
+		return
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "死信记录不存在或当前状态不允许重放"})
+		return
+	}
+
+	h.log.Info("已请求重放死信记录", zap.String("id", id))
+	c.JSON(http.StatusOK, gin.H{"message": "已加入重放队列"})
+}
+
+// ReplayBatch 批量请求重放，按 ids 或 task_id / execution_id 选择待处理的记录
+func (h *DeadLetterHandler) ReplayBatch(c *gin.Context) {
+	var req struct {
+		IDs         []int64 `json:"ids"`
+		TaskID      int64   `json:"task_id"`
+		ExecutionID int64   `json:"execution_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.IDs) == 0 && req.TaskID == 0 && req.ExecutionID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "必须指定 ids、task_id 或 execution_id"})
+		return
+	}
+
+	query := "UPDATE dead_letter_records SET status = $1 WHERE status = $2"
+	args := []any{models.DeadLetterStatusReplayRequested, models.DeadLetterStatusPending}
+	if len(req.IDs) > 0 {
+		args = append(args, pq.Array(req.IDs))
+		query += " AND id = ANY($" + strconv.Itoa(len(args)) + ")"
+	}
+	if req.TaskID > 0 {
+		args = append(args, req.TaskID)
+		query += " AND task_id = $" + strconv.Itoa(len(args))
+	}
+	if req.ExecutionID > 0 {
+		args = append(args, req.ExecutionID)
+		query += " AND execution_id = $" + strconv.Itoa(len(args))
+	}
+
+	result, err := h.db.Exec(query, args...)
+	if err != nil {
+		h.log.Error("批量请求重放死信记录失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "请求重放失败"})
+		return
+	}
+
+	rows, _ := result.RowsAffected()
+	h.log.Info("已批量请求重放死信记录", zap.Int64("count", rows))
+	c.JSON(http.StatusOK, gin.H{"message": "已加入重放队列", "count": rows})
+}
+
+// Discard 丢弃死信记录（保留记录但不再重放）
+func (h *DeadLetterHandler) Discard(c *gin.Context) {
+	id := c.Param("id")
+
+	result, err := h.db.Exec(`UPDATE dead_letter_records SET status = $1
+	    WHERE id = $2 AND status IN ($3, $4)`,
+		models.DeadLetterStatusDiscarded, id, models.DeadLetterStatusPending, models.DeadLetterStatusReplayRequested)
+	if err != nil {
+		h.log.Error("丢弃死信记录失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "丢弃失败"})
+		return
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "死信记录不存在或当前状态不允许丢弃"})
+		return
+	}
+
+	h.log.Info("已丢弃死信记录", zap.String("id", id))
+	c.JSON(http.StatusOK, gin.H{"message": "已丢弃"})
+}
@@ -2,11 +2,13 @@ package api
 
 import (
 	"database/sql"
+	"encoding/json"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/datafusion/worker/internal/logger"
+	"github.com/datafusion/worker/internal/models"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
@@ -21,16 +23,24 @@ func NewExecutionHandler(db *sql.DB, log *logger.Logger) *ExecutionHandler {
 }
 
 type Execution struct {
-	ID               int64      `json:"id"`
-	TaskID           int64      `json:"task_id"`
-	TaskName         *string    `json:"task_name"`
-	WorkerPod        *string    `json:"worker_pod"`
-	Status           string     `json:"status"` // running, success, failed
-	StartTime        *time.Time `json:"start_time"`
-	EndTime          *time.Time `json:"end_time"`
-	RecordsCollected int        `json:"records_collected"`
-	ErrorMessage     *string    `json:"error_message"`
-	RetryCount       int        `json:"retry_count"`
+	ID                int64            `json:"id"`
+	TaskID            int64            `json:"task_id"`
+	TaskName          *string          `json:"task_name"`
+	WorkerPod         *string          `json:"worker_pod"`
+	Status            string           `json:"status"` // running, cancelling, success, failed, cancelled
+	StartTime         *time.Time       `json:"start_time"`
+	EndTime           *time.Time       `json:"end_time"`
+	RecordsCollected  int              `json:"records_collected"`
+	ErrorMessage      *string          `json:"error_message"`
+	RetryCount        int              `json:"retry_count"`
+	StorageResults    *json.RawMessage `json:"storage_results"`     // 各存储目标的写入结果
+	RecordsRejected   int              `json:"records_rejected"`    // 进入死信队列的记录数
+	ValidationResults *json.RawMessage `json:"validation_results"`  // 各校验规则的通过/失败数
+	PIIResults        *json.RawMessage `json:"pii_results"`         // 各字段 PII 的处理方式和个数
+	CleaningRules     *json.RawMessage `json:"cleaning_rules"`      // 应用的已保存清洗规则版本
+	CancelRequestedAt *time.Time       `json:"cancel_requested_at"` // 请求取消的时间
+	CancelRequestedBy *string          `json:"cancel_requested_by"` // 请求取消的用户
+	Attempts          *json.RawMessage `json:"attempts"`            // 每次尝试的起止时间、错误及错误分类
 }
 
 // List 获取执行历史列表
@@ -49,7 +59,7 @@ func (h *ExecutionHandler) List(c *gin.Context) {
 	offset := (page - 1) * pageSize
 
 	query := `SELECT e.id, e.task_id, t.name as task_name, e.worker_pod, e.status,
-	          e.start_time, e.end_time, e.records_collected, e.error_message, e.retry_count
+	          e.start_time, e.end_time, e.records_collected, e.error_message, e.retry_count, e.storage_results, COALESCE(e.records_rejected, 0), e.validation_results, e.pii_results, e.cleaning_rule_versions, e.cancel_requested_at, e.cancel_requested_by, e.attempts
 	          FROM task_executions e
 	          LEFT JOIN collection_tasks t ON e.task_id = t.id
 	          WHERE 1=1`
@@ -81,7 +91,7 @@ func (h *ExecutionHandler) List(c *gin.Context) {
 	for rows.Next() {
 		var exec Execution
 		err := rows.Scan(&exec.ID, &exec.TaskID, &exec.TaskName, &exec.WorkerPod, &exec.Status,
-			&exec.StartTime, &exec.EndTime, &exec.RecordsCollected, &exec.ErrorMessage, &exec.RetryCount)
+			&exec.StartTime, &exec.EndTime, &exec.RecordsCollected, &exec.ErrorMessage, &exec.RetryCount, &exec.StorageResults, &exec.RecordsRejected, &exec.ValidationResults, &exec.PIIResults, &exec.CleaningRules, &exec.CancelRequestedAt, &exec.CancelRequestedBy, &exec.Attempts)
 		if err != nil {
 			h.log.Error("扫描执行历史数据失败", zap.Error(err))
 			continue
@@ -108,12 +118,12 @@ func (h *ExecutionHandler) Get(c *gin.Context) {
 
 	var exec Execution
 	err := h.db.QueryRow(`SELECT e.id, e.task_id, t.name as task_name, e.worker_pod, e.status,
-	                      e.start_time, e.end_time, e.records_collected, e.error_message, e.retry_count
+	                      e.start_time, e.end_time, e.records_collected, e.error_message, e.retry_count, e.storage_results, COALESCE(e.records_rejected, 0), e.validation_results, e.pii_results, e.cleaning_rule_versions, e.cancel_requested_at, e.cancel_requested_by, e.attempts
 	                      FROM task_executions e
 	                      LEFT JOIN collection_tasks t ON e.task_id = t.id
 	                      WHERE e.id = $1`, id).
 		Scan(&exec.ID, &exec.TaskID, &exec.TaskName, &exec.WorkerPod, &exec.Status,
-			&exec.StartTime, &exec.EndTime, &exec.RecordsCollected, &exec.ErrorMessage, &exec.RetryCount)
+			&exec.StartTime, &exec.EndTime, &exec.RecordsCollected, &exec.ErrorMessage, &exec.RetryCount, &exec.StorageResults, &exec.RecordsRejected, &exec.ValidationResults, &exec.PIIResults, &exec.CleaningRules, &exec.CancelRequestedAt, &exec.CancelRequestedBy, &exec.Attempts)
 
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "执行记录不存在"})
@@ -144,7 +154,7 @@ func (h *ExecutionHandler) ListByTask(c *gin.Context) {
 	offset := (page - 1) * pageSize
 
 	rows, err := h.db.Query(`SELECT e.id, e.task_id, t.name as task_name, e.worker_pod, e.status,
-	                         e.start_time, e.end_time, e.records_collected, e.error_message, e.retry_count
+	                         e.start_time, e.end_time, e.records_collected, e.error_message, e.retry_count, e.storage_results, COALESCE(e.records_rejected, 0), e.validation_results, e.pii_results, e.cleaning_rule_versions, e.cancel_requested_at, e.cancel_requested_by, e.attempts
 	                         FROM task_executions e
 	                         LEFT JOIN collection_tasks t ON e.task_id = t.id
 	                         WHERE e.task_id = $1
@@ -161,7 +171,7 @@ func (h *ExecutionHandler) ListByTask(c *gin.Context) {
 	for rows.Next() {
 		var exec Execution
 		err := rows.Scan(&exec.ID, &exec.TaskID, &exec.TaskName, &exec.WorkerPod, &exec.Status,
-			&exec.StartTime, &exec.EndTime, &exec.RecordsCollected, &exec.ErrorMessage, &exec.RetryCount)
+			&exec.StartTime, &exec.EndTime, &exec.RecordsCollected, &exec.ErrorMessage, &exec.RetryCount, &exec.StorageResults, &exec.RecordsRejected, &exec.ValidationResults, &exec.PIIResults, &exec.CleaningRules, &exec.CancelRequestedAt, &exec.CancelRequestedBy, &exec.Attempts)
 		if err != nil {
 			h.log.Error("扫描执行历史数据失败", zap.Error(err))
 			continue
@@ -181,3 +191,113 @@ func (h *ExecutionHandler) ListByTask(c *gin.Context) {
 		},
 	})
 }
+
+// Cancel 请求取消正在进行的执行，持有该执行的 Worker 停止执行后记录为 cancelled
+func (h *ExecutionHandler) Cancel(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的执行ID"})
+		return
+	}
+
+	var status string
+	err = h.db.QueryRow("SELECT status FROM task_executions WHERE id = $1", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "执行记录不存在"})
+		return
+	}
+	if err != nil {
+		h.log.Error("查询执行记录失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	username := c.GetString("username")
+	statuses, err := cancelExecutions(h.db, "e.id = $1", id, username)
+	if err != nil {
+		h.log.Error("取消执行失败", zap.Int64("execution_id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消失败"})
+		return
+	}
+	newStatus, ok := statuses[id]
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "执行已结束，无法取消", "status": status})
+		return
+	}
+
+	h.log.Info("请求取消执行", zap.Int64("execution_id", id), zap.String("username", username), zap.String("status", newStatus))
+	c.JSON(http.StatusAccepted, gin.H{"message": "已请求取消执行", "status": newStatus})
+}
+
+// cancelExecutions 请求取消符合 filter 条件且仍在进行中的执行，返回每条执行取消后的状态
+// Worker 持有任务租约（补数窗口为窗口租约）的执行标记为 cancelling 并通知 Worker 停止；
+// 租约已不存在（Worker 已退出）的执行直接标记为 cancelled
+func cancelExecutions(db *sql.DB, filter string, arg any, username string) (map[int64]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT e.id, COALESCE(e.worker_pod, ''),
+	                       EXISTS (SELECT 1 FROM task_leases l
+	                               WHERE l.task_id = e.task_id AND l.worker_pod = e.worker_pod AND l.expires_at > NOW())
+	                       OR EXISTS (SELECT 1 FROM backfill_windows w
+	                               WHERE w.execution_id = e.id AND w.worker_pod = e.worker_pod AND w.lease_expires_at > NOW())
+	                       FROM task_executions e
+	                       WHERE `+filter+` AND e.status IN ($2, $3)
+	                       FOR UPDATE OF e`,
+		arg, models.ExecutionStatusRunning, models.ExecutionStatusCancelling)
+	if err != nil {
+		return nil, err
+	}
+	type target struct {
+		id        int64
+		workerPod string
+		leased    bool
+	}
+	var targets []target
+	for rows.Next() {
+		var t target
+		if err := rows.Scan(&t.id, &t.workerPod, &t.leased); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make(map[int64]string, len(targets))
+	for _, t := range targets {
+		if !t.leased {
+			if _, err := tx.Exec(`UPDATE task_executions
+			                      SET status = $2, end_time = NOW(), error_message = '执行已取消（Worker 已不在运行）',
+			                          cancel_requested_at = COALESCE(cancel_requested_at, NOW()), cancel_requested_by = $3
+			                      WHERE id = $1`, t.id, models.ExecutionStatusCancelled, username); err != nil {
+				return nil, err
+			}
+			statuses[t.id] = models.ExecutionStatusCancelled
+			continue
+		}
+
+		if _, err := tx.Exec(`UPDATE task_executions
+		                      SET status = $2, cancel_requested_at = COALESCE(cancel_requested_at, NOW()), cancel_requested_by = $3
+		                      WHERE id = $1`, t.id, models.ExecutionStatusCancelling, username); err != nil {
+			return nil, err
+		}
+		// 通知在事务提交后送达
+		notice, _ := json.Marshal(models.ExecutionCancelNotice{ExecutionID: t.id, WorkerPod: t.workerPod})
+		if _, err := tx.Exec("SELECT pg_notify($1, $2)", models.ExecutionCancelChannel, string(notice)); err != nil {
+			return nil, err
+		}
+		statuses[t.id] = models.ExecutionStatusCancelling
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
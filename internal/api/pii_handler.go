@@ -0,0 +1,128 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/datafusion/worker/internal/auth"
+	"github.com/datafusion/worker/internal/config"
+	"github.com/datafusion/worker/internal/logger"
+	"github.com/datafusion/worker/internal/processor"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// maxDetokenizeTokens 单次还原的令牌数上限
+const maxDetokenizeTokens = 100
+
+// PIIHandler PII 令牌还原，每次还原都写入 pii_vault_access 审计表
+type PIIHandler struct {
+	db     *sql.DB
+	log    *logger.Logger
+	cipher *processor.VaultCipher // 未配置令牌库密钥时为 nil
+}
+
+func NewPIIHandler(db *sql.DB, log *logger.Logger, cfg config.PIIVaultConfig) *PIIHandler {
+	h := &PIIHandler{db: db, log: log}
+	encoded, err := config.ResolveSecret(cfg.VaultKey, cfg.VaultKeyFile, "DATAFUSION_PII_VAULT_KEY")
+	if err != nil {
+		log.Warn("读取 PII 令牌库密钥失败", zap.Error(err))
+		return h
+	}
+	if encoded == "" {
+		return h
+	}
+	key, err := processor.ParseVaultKey(encoded)
+	if err != nil {
+		log.Warn("PII 令牌库密钥无效", zap.Error(err))
+		return h
+	}
+	if h.cipher, err = processor.NewVaultCipher(key); err != nil {
+		log.Warn("创建 PII 令牌库失败", zap.Error(err))
+	}
+	return h
+}
+
+// DetokenizeRequest 令牌还原请求
+type DetokenizeRequest struct {
+	Tokens []string `json:"tokens" binding:"required"`
+	Reason string   `json:"reason" binding:"required"` // 还原原因，记录到审计日志
+}
+
+// DetokenizedValue 还原结果
+type DetokenizedValue struct {
+	Token string `json:"token"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Detokenize 还原令牌对应的原值，不存在的令牌返回在 not_found 中
+func (h *PIIHandler) Detokenize(c *gin.Context) {
+	if h.cipher == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "未配置 PII 令牌库密钥"})
+		return
+	}
+
+	var req DetokenizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Tokens) == 0 || len(req.Tokens) > maxDetokenizeTokens {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tokens 数量必须在 1 到 100 之间"})
+		return
+	}
+
+	// 先写审计记录，审计失败时不返回原值
+	var userID *int64
+	if id, ok := auth.GetCurrentUserID(c); ok {
+		userID = &id
+	}
+	username := c.GetString("username")
+	if _, err := h.db.Exec(`INSERT INTO pii_vault_access (user_id, username, tokens, reason) VALUES ($1, $2, $3, $4)`,
+		userID, username, pq.Array(req.Tokens), req.Reason); err != nil {
+		h.log.Error("写入令牌还原审计记录失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "写入审计记录失败"})
+		return
+	}
+
+	rows, err := h.db.Query(`SELECT token, pii_type, ciphertext FROM pii_vault WHERE token = ANY($1)`, pq.Array(req.Tokens))
+	if err != nil {
+		h.log.Error("查询令牌库失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+	defer rows.Close()
+
+	values := []DetokenizedValue{}
+	found := make(map[string]bool)
+	for rows.Next() {
+		var token, piiType, sealed string
+		if err := rows.Scan(&token, &piiType, &sealed); err != nil {
+			h.log.Error("扫描令牌库数据失败", zap.Error(err))
+			continue
+		}
+		value, err := h.cipher.Open(sealed)
+		if err != nil {
+			h.log.Error("解密令牌失败", zap.String("token", token), zap.Error(err))
+			continue
+		}
+		found[token] = true
+		values = append(values, DetokenizedValue{Token: token, Type: piiType, Value: value})
+	}
+
+	notFound := []string{}
+	for _, token := range req.Tokens {
+		if !found[token] {
+			notFound = append(notFound, token)
+		}
+	}
+
+	h.log.Info("PII 令牌已还原",
+		zap.String("username", username),
+		zap.Int("tokens", len(values)),
+		zap.String("reason", req.Reason))
+
+	c.JSON(http.StatusOK, gin.H{"values": values, "not_found": notFound})
+}
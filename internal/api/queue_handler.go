@@ -0,0 +1,179 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/datafusion/worker/internal/database"
+	"github.com/datafusion/worker/internal/logger"
+	"github.com/datafusion/worker/internal/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type QueueHandler struct {
+	db  *sql.DB
+	log *logger.Logger
+}
+
+func NewQueueHandler(db *sql.DB, log *logger.Logger) *QueueHandler {
+	return &QueueHandler{db: db, log: log}
+}
+
+// queueWithStats 任务队列及其当前的等待和执行情况
+type queueWithStats struct {
+	models.TaskQueue
+	Pending     int     `json:"pending"`
+	Running     int     `json:"running"`
+	WaitSeconds float64 `json:"wait_seconds"`
+}
+
+// List 获取任务队列列表及各队列等待领取、正在执行的任务数
+func (h *QueueHandler) List(c *gin.Context) {
+	rows, err := h.db.Query(`SELECT name, COALESCE(description, ''), priority, max_concurrency, created_at, updated_at
+	                         FROM task_queues ORDER BY priority DESC, name`)
+	if err != nil {
+		h.log.Error("查询任务队列失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+	defer rows.Close()
+
+	queues := []queueWithStats{}
+	for rows.Next() {
+		var q queueWithStats
+		if err := rows.Scan(&q.Name, &q.Description, &q.Priority, &q.MaxConcurrency, &q.CreatedAt, &q.UpdatedAt); err != nil {
+			h.log.Error("扫描任务队列数据失败", zap.Error(err))
+			continue
+		}
+		queues = append(queues, q)
+	}
+
+	stats, err := (&database.PostgresDB{DB: h.db}).QueueStats(c.Request.Context())
+	if err != nil {
+		h.log.Error("统计任务队列失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+	byName := make(map[string]models.QueueStats, len(stats))
+	for _, s := range stats {
+		byName[s.Queue] = s
+	}
+	for i := range queues {
+		s := byName[queues[i].Name]
+		queues[i].Pending, queues[i].Running, queues[i].WaitSeconds = s.Pending, s.Running, s.WaitSeconds
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": queues, "total": len(queues)})
+}
+
+// validateQueue 校验队列配置
+func validateQueue(queue *models.TaskQueue) string {
+	if strings.TrimSpace(queue.Name) == "" {
+		return "队列名称不能为空"
+	}
+	if queue.MaxConcurrency < 0 {
+		return "max_concurrency 不能为负数"
+	}
+	return ""
+}
+
+// Create 创建任务队列
+func (h *QueueHandler) Create(c *gin.Context) {
+	var queue models.TaskQueue
+	if err := c.ShouldBindJSON(&queue); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateQueue(&queue); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	err := h.db.QueryRow(`INSERT INTO task_queues (name, description, priority, max_concurrency)
+	    VALUES ($1, $2, $3, $4) ON CONFLICT (name) DO NOTHING RETURNING created_at, updated_at`,
+		queue.Name, queue.Description, queue.Priority, queue.MaxConcurrency).Scan(&queue.CreatedAt, &queue.UpdatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusConflict, gin.H{"error": "任务队列已存在"})
+		return
+	}
+	if err != nil {
+		h.log.Error("创建任务队列失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败"})
+		return
+	}
+
+	h.log.Info("创建任务队列成功", zap.String("queue", queue.Name))
+	c.JSON(http.StatusCreated, queue)
+}
+
+// Update 更新任务队列的描述、优先级和并发上限
+func (h *QueueHandler) Update(c *gin.Context) {
+	name := c.Param("name")
+
+	var queue models.TaskQueue
+	if err := c.ShouldBindJSON(&queue); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	queue.Name = name
+	if msg := validateQueue(&queue); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	result, err := h.db.Exec(`UPDATE task_queues SET description=$1, priority=$2, max_concurrency=$3, updated_at=NOW()
+	    WHERE name=$4`, queue.Description, queue.Priority, queue.MaxConcurrency, name)
+	if err != nil {
+		h.log.Error("更新任务队列失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+		return
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "任务队列不存在"})
+		return
+	}
+
+	h.log.Info("更新任务队列成功", zap.String("queue", name),
+		zap.Int("priority", queue.Priority), zap.Int("max_concurrency", queue.MaxConcurrency))
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功"})
+}
+
+// Delete 删除任务队列，默认队列和仍有任务的队列不能删除
+func (h *QueueHandler) Delete(c *gin.Context) {
+	name := c.Param("name")
+	if name == models.DefaultQueue {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "默认队列不能删除"})
+		return
+	}
+
+	var tasks int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM collection_tasks WHERE queue = $1", name).Scan(&tasks); err != nil {
+		h.log.Error("查询队列任务数失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+	if tasks > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "队列中还有任务，请先将任务移到其他队列", "tasks": tasks})
+		return
+	}
+
+	result, err := h.db.Exec("DELETE FROM task_queues WHERE name=$1", name)
+	if err != nil {
+		h.log.Error("删除任务队列失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "任务队列不存在"})
+		return
+	}
+
+	h.log.Info("删除任务队列成功", zap.String("queue", name))
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
@@ -96,9 +96,11 @@ func RegisterRoutes(r *gin.Engine, db *sql.DB, log *logger.Logger, cfg *config.A
 			tasks.Use(auth.RequirePermission(rbac, "tasks", "read"))
 			{
 				taskHandler := NewTaskHandler(db, dataDB, log)
+				taskRuleHandler := NewCleaningRuleHandler(db, log)
 				tasks.GET("", taskHandler.List)
 				tasks.GET("/:id", taskHandler.Get)
 				tasks.GET("/:id/data", taskHandler.PreviewData)
+				tasks.GET("/:id/cleaning-rules", taskRuleHandler.ListTaskRules)
 
 				// 写操作需要写权限
 				writeGroup := tasks.Group("")
@@ -109,6 +111,7 @@ func RegisterRoutes(r *gin.Engine, db *sql.DB, log *logger.Logger, cfg *config.A
 					writeGroup.POST("/:id/run", taskHandler.Run)
 					writeGroup.POST("/:id/stop", taskHandler.Stop)
 					writeGroup.POST("/:id/execute", taskHandler.Execute)
+					writeGroup.PUT("/:id/cleaning-rules", taskRuleHandler.SetTaskRules)
 				}
 
 				// 删除操作需要删除权限
@@ -152,6 +155,7 @@ func RegisterRoutes(r *gin.Engine, db *sql.DB, log *logger.Logger, cfg *config.A
 				ruleHandler := NewCleaningRuleHandler(db, log)
 				rules.GET("", ruleHandler.List)
 				rules.GET("/:id", ruleHandler.Get)
+				rules.GET("/:id/versions", ruleHandler.ListVersions)
 
 				// 写操作需要写权限
 				writeGroup := rules.Group("")
@@ -177,6 +181,131 @@ func RegisterRoutes(r *gin.Engine, db *sql.DB, log *logger.Logger, cfg *config.A
 				executions.GET("", execHandler.List)
 				executions.GET("/:id", execHandler.Get)
 				executions.GET("/task/:task_id", execHandler.ListByTask)
+
+				// 取消执行需要写权限
+				writeGroup := executions.Group("")
+				writeGroup.Use(auth.RequirePermission(rbac, "executions", "write"))
+				{
+					writeGroup.POST("/:id/cancel", execHandler.Cancel)
+				}
+			}
+
+			// 任务队列
+			queues := authenticated.Group("/queues")
+			queues.Use(auth.RequirePermission(rbac, "queues", "read"))
+			{
+				queueHandler := NewQueueHandler(db, log)
+				queues.GET("", queueHandler.List)
+
+				// 写操作需要写权限
+				writeGroup := queues.Group("")
+				writeGroup.Use(auth.RequirePermission(rbac, "queues", "write"))
+				{
+					writeGroup.POST("", queueHandler.Create)
+					writeGroup.PUT("/:name", queueHandler.Update)
+				}
+
+				// 删除操作需要删除权限
+				deleteGroup := queues.Group("")
+				deleteGroup.Use(auth.RequirePermission(rbac, "queues", "delete"))
+				{
+					deleteGroup.DELETE("/:name", queueHandler.Delete)
+				}
+			}
+
+			// 日历
+			calendars := authenticated.Group("/calendars")
+			calendars.Use(auth.RequirePermission(rbac, "calendars", "read"))
+			{
+				calendarHandler := NewCalendarHandler(db, log)
+				calendars.GET("", calendarHandler.List)
+				calendars.GET("/:name", calendarHandler.Get)
+
+				// 写操作需要写权限
+				writeGroup := calendars.Group("")
+				writeGroup.Use(auth.RequirePermission(rbac, "calendars", "write"))
+				{
+					writeGroup.POST("", calendarHandler.Create)
+					writeGroup.PUT("/:name", calendarHandler.Update)
+				}
+
+				// 删除操作需要删除权限
+				deleteGroup := calendars.Group("")
+				deleteGroup.Use(auth.RequirePermission(rbac, "calendars", "delete"))
+				{
+					deleteGroup.DELETE("/:name", calendarHandler.Delete)
+				}
+			}
+
+			// 补数
+			backfills := authenticated.Group("/backfills")
+			backfills.Use(auth.RequirePermission(rbac, "backfills", "read"))
+			{
+				backfillHandler := NewBackfillHandler(db, log)
+				backfills.GET("", backfillHandler.List)
+				backfills.GET("/:id", backfillHandler.Get)
+
+				// 写操作需要写权限
+				writeGroup := backfills.Group("")
+				writeGroup.Use(auth.RequirePermission(rbac, "backfills", "write"))
+				{
+					writeGroup.POST("", backfillHandler.Create)
+					writeGroup.POST("/:id/cancel", backfillHandler.Cancel)
+				}
+			}
+
+			// 工作流
+			workflows := authenticated.Group("/workflows")
+			workflows.Use(auth.RequirePermission(rbac, "workflows", "read"))
+			{
+				wfHandler := NewWorkflowHandler(db, log)
+				workflows.GET("", wfHandler.List)
+				workflows.GET("/:id", wfHandler.Get)
+				workflows.GET("/:id/runs", wfHandler.ListRuns)
+				workflows.GET("/:id/runs/:run_id", wfHandler.GetRun)
+
+				// 写操作需要写权限
+				writeGroup := workflows.Group("")
+				writeGroup.Use(auth.RequirePermission(rbac, "workflows", "write"))
+				{
+					writeGroup.POST("", wfHandler.Create)
+					writeGroup.PUT("/:id", wfHandler.Update)
+					writeGroup.POST("/:id/run", wfHandler.Run)
+				}
+
+				// 删除操作需要删除权限
+				deleteGroup := workflows.Group("")
+				deleteGroup.Use(auth.RequirePermission(rbac, "workflows", "delete"))
+				{
+					deleteGroup.DELETE("/:id", wfHandler.Delete)
+				}
+			}
+
+			// 死信队列
+			deadLetters := authenticated.Group("/dead-letters")
+			deadLetters.Use(auth.RequirePermission(rbac, "dead-letters", "read"))
+			{
+				dlHandler := NewDeadLetterHandler(db, log)
+				deadLetters.GET("", dlHandler.List)
+				deadLetters.GET("/:id", dlHandler.Get)
+
+				// 写操作需要写权限
+				writeGroup := deadLetters.Group("")
+				writeGroup.Use(auth.RequirePermission(rbac, "dead-letters", "write"))
+				{
+					writeGroup.PUT("/:id", dlHandler.Update)
+					writeGroup.POST("/:id/replay", dlHandler.Replay)
+					writeGroup.POST("/:id/discard", dlHandler.Discard)
+					writeGroup.POST("/replay", dlHandler.ReplayBatch)
+				}
+			}
+
+			// PII 令牌还原
+			piiHandler := NewPIIHandler(db, log, cfg.PII)
+			pii := authenticated.Group("/pii")
+			pii.Use(auth.RequirePermission(rbac, "pii", "detokenize"))
+			{
+				pii.POST("/detokenize", piiHandler.Detokenize)
 			}
 
 			// 统计信息
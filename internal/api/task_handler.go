@@ -1,15 +1,23 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/datafusion/worker/internal/database"
 	"github.com/datafusion/worker/internal/logger"
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/processor"
+	"github.com/datafusion/worker/internal/schedule"
+	"github.com/datafusion/worker/internal/storage"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
@@ -39,6 +47,33 @@ type Task struct {
 	Config           *json.RawMessage `json:"config"` // JSON配置
 	CreatedAt        time.Time       `json:"created_at"`
 	UpdatedAt        time.Time       `json:"updated_at"`
+
+	Queue    string           `json:"queue"`    // 所属队列，默认 default
+	Priority int              `json:"priority"` // 队列内的优先级，越大越先执行
+	Tenant   string           `json:"tenant"`   // 租户，默认 default
+	Selector *json.RawMessage `json:"selector"` // Worker 必须具有的标签，如 {"chrome": "true"}
+
+	Timezone      string `json:"timezone"`       // Cron 表达式的时区，如 Asia/Shanghai，为空时为 Worker 本地时区
+	CatchUp       string `json:"catch_up"`       // 错过执行的补执行策略：skip, once（默认）, all
+	JitterSeconds int    `json:"jitter_seconds"` // 下次执行时间随机推迟的最大秒数
+	Calendar      string `json:"calendar"`       // 引用的日历，只在日历的工作日执行
+
+	RetryPolicy *json.RawMessage `json:"retry_policy"` // 重试策略，如 {"max_attempts": 5, "initial_delay_seconds": 10}
+}
+
+const taskColumns = `id, name, description, type, data_source_id, cron, next_run_time, status,
+	          replicas, execution_timeout, max_retries, config, created_at, updated_at,
+	          COALESCE(queue, 'default'), COALESCE(priority, 0), COALESCE(tenant, 'default'), selector,
+	          COALESCE(timezone, ''), COALESCE(catch_up, 'once'), COALESCE(jitter_seconds, 0), COALESCE(calendar, ''),
+	          retry_policy`
+
+// scanTask 按 taskColumns 扫描一行任务
+func scanTask(scanner interface{ Scan(...interface{}) error }, task *Task) error {
+	return scanner.Scan(&task.ID, &task.Name, &task.Description, &task.Type, &task.DataSourceID,
+		&task.Cron, &task.NextRunTime, &task.Status, &task.Replicas, &task.ExecutionTimeout, &task.MaxRetries,
+		&task.Config, &task.CreatedAt, &task.UpdatedAt,
+		&task.Queue, &task.Priority, &task.Tenant, &task.Selector,
+		&task.Timezone, &task.CatchUp, &task.JitterSeconds, &task.Calendar, &task.RetryPolicy)
 }
 
 // List 获取任务列表
@@ -58,9 +93,7 @@ func (h *TaskHandler) List(c *gin.Context) {
 
 	offset := (page - 1) * pageSize
 
-	query := `SELECT id, name, description, type, data_source_id, cron, next_run_time, status,
-	          replicas, execution_timeout, max_retries, config, created_at, updated_at
-	          FROM collection_tasks WHERE 1=1`
+	query := `SELECT ` + taskColumns + ` FROM collection_tasks WHERE 1=1`
 	countQuery := "SELECT COUNT(*) FROM collection_tasks WHERE 1=1"
 	args := []interface{}{}
 	countArgs := []interface{}{}
@@ -74,6 +107,14 @@ func (h *TaskHandler) List(c *gin.Context) {
 		argIdx++
 	}
 
+	if queue := c.Query("queue"); queue != "" {
+		query += " AND COALESCE(queue, 'default') = $" + strconv.Itoa(argIdx)
+		countQuery += " AND COALESCE(queue, 'default') = $" + strconv.Itoa(argIdx)
+		args = append(args, queue)
+		countArgs = append(countArgs, queue)
+		argIdx++
+	}
+
 	if search != "" {
 		query += " AND (name ILIKE $" + strconv.Itoa(argIdx) + " OR description ILIKE $" + strconv.Itoa(argIdx) + ")"
 		countQuery += " AND (name ILIKE $" + strconv.Itoa(argIdx) + " OR description ILIKE $" + strconv.Itoa(argIdx) + ")"
@@ -97,10 +138,7 @@ func (h *TaskHandler) List(c *gin.Context) {
 	tasks := []Task{}
 	for rows.Next() {
 		var task Task
-		err := rows.Scan(&task.ID, &task.Name, &task.Description, &task.Type, &task.DataSourceID,
-			&task.Cron, &task.NextRunTime, &task.Status, &task.Replicas, &task.ExecutionTimeout, &task.MaxRetries,
-			&task.Config, &task.CreatedAt, &task.UpdatedAt)
-		if err != nil {
+		if err := scanTask(rows, &task); err != nil {
 			h.log.Error("扫描任务数据失败", zap.Error(err))
 			continue
 		}
@@ -126,12 +164,7 @@ func (h *TaskHandler) Get(c *gin.Context) {
 	id := c.Param("id")
 
 	var task Task
-	err := h.db.QueryRow(`SELECT id, name, description, type, data_source_id, cron, next_run_time, status,
-	                      replicas, execution_timeout, max_retries, config, created_at, updated_at
-	                      FROM collection_tasks WHERE id = $1`, id).
-		Scan(&task.ID, &task.Name, &task.Description, &task.Type, &task.DataSourceID,
-			&task.Cron, &task.NextRunTime, &task.Status, &task.Replicas, &task.ExecutionTimeout, &task.MaxRetries,
-			&task.Config, &task.CreatedAt, &task.UpdatedAt)
+	err := scanTask(h.db.QueryRow(`SELECT `+taskColumns+` FROM collection_tasks WHERE id = $1`, id), &task)
 
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "任务不存在"})
@@ -167,20 +200,41 @@ func (h *TaskHandler) Create(c *gin.Context) {
 	if task.MaxRetries == 0 {
 		task.MaxRetries = 3
 	}
+	selector, err := h.validateRouting(&task)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.validateSchedule(c.Request.Context(), &task); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	retryPolicy, err := validateRetryPolicy(&task)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// 处理空config的情况
 	var configData interface{}
 	if task.Config == nil || len(*task.Config) == 0 || string(*task.Config) == "null" {
 		configData = nil
 	} else {
+		if err := validateTaskConfig(*task.Config); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		configData = *task.Config
 	}
 
-	err := h.db.QueryRow(`INSERT INTO collection_tasks
-	    (name, description, type, data_source_id, cron, status, replicas, execution_timeout, max_retries, config)
-	    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`,
+	err = h.db.QueryRow(`INSERT INTO collection_tasks
+	    (name, description, type, data_source_id, cron, status, replicas, execution_timeout, max_retries, config,
+	     queue, priority, tenant, selector, timezone, catch_up, jitter_seconds, calendar, retry_policy)
+	    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19) RETURNING id`,
 		task.Name, task.Description, task.Type, task.DataSourceID, task.Cron, task.Status,
-		task.Replicas, task.ExecutionTimeout, task.MaxRetries, configData).Scan(&task.ID)
+		task.Replicas, task.ExecutionTimeout, task.MaxRetries, configData,
+		task.Queue, task.Priority, task.Tenant, selector,
+		nullIfEmpty(task.Timezone), task.CatchUp, task.JitterSeconds, nullIfEmpty(task.Calendar), retryPolicy).Scan(&task.ID)
 
 	if err != nil {
 		h.log.Error("创建任务失败", zap.Error(err))
@@ -192,6 +246,151 @@ func (h *TaskHandler) Create(c *gin.Context) {
 	c.JSON(http.StatusCreated, task)
 }
 
+// validateTaskConfig 校验任务配置，转换规则、校验规则（包括表达式、正则）、处理阶段（包括脚本）或去重配置有误时返回错误
+func validateTaskConfig(raw json.RawMessage) error {
+	var config models.TaskConfig
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return fmt.Errorf("任务配置格式错误: %w", err)
+	}
+	if err := processor.ValidateTransformRules(config.Processor.TransformRules); err != nil {
+		return fmt.Errorf("转换规则无效: %w", err)
+	}
+	if err := processor.ValidateValidationRules(config.Processor.ValidationRules); err != nil {
+		return fmt.Errorf("校验规则无效: %w", err)
+	}
+	if err := processor.ValidateStages(&config.Processor); err != nil {
+		return fmt.Errorf("处理阶段无效: %w", err)
+	}
+	if err := processor.ValidateEnrichments(config.Processor.Enrichments); err != nil {
+		return fmt.Errorf("关联补充配置无效: %w", err)
+	}
+	if err := processor.ValidatePIIConfig(config.Processor.PII); err != nil {
+		return fmt.Errorf("PII 配置无效: %w", err)
+	}
+	if err := processor.ValidateDeduplicationConfig(config.Processor.Deduplication); err != nil {
+		return fmt.Errorf("去重配置无效: %w", err)
+	}
+	if err := storage.ValidateStoragePolicy(&config); err != nil {
+		return fmt.Errorf("存储配置无效: %w", err)
+	}
+	return nil
+}
+
+// validateRouting 校验任务的队列和 selector，设置默认队列和租户，返回写入数据库的 selector
+func (h *TaskHandler) validateRouting(task *Task) (interface{}, error) {
+	if task.Queue == "" {
+		task.Queue = models.DefaultQueue
+	}
+	if task.Tenant == "" {
+		task.Tenant = models.DefaultTenant
+	}
+
+	var exists bool
+	if err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM task_queues WHERE name = $1)", task.Queue).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("查询任务队列失败: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("任务队列 %s 不存在", task.Queue)
+	}
+
+	if task.Selector == nil || len(*task.Selector) == 0 || string(*task.Selector) == "null" {
+		task.Selector = nil
+		return nil, nil
+	}
+	var labels map[string]string
+	if err := json.Unmarshal(*task.Selector, &labels); err != nil {
+		return nil, fmt.Errorf("selector 格式错误，应为字符串键值对: %w", err)
+	}
+	if len(labels) == 0 {
+		task.Selector = nil
+		return nil, nil
+	}
+	return []byte(*task.Selector), nil
+}
+
+// validateSchedule 校验任务的时区、补执行策略、抖动和日历，设置默认补执行策略
+func (h *TaskHandler) validateSchedule(ctx context.Context, task *Task) error {
+	if task.CatchUp == "" {
+		task.CatchUp = schedule.CatchUpOnce
+	}
+	if !schedule.ValidCatchUp(task.CatchUp) {
+		return fmt.Errorf("无效的 catch_up: %s，可选 skip、once、all", task.CatchUp)
+	}
+	if task.JitterSeconds < 0 {
+		return fmt.Errorf("jitter_seconds 不能为负数")
+	}
+
+	spec := schedule.Spec{CatchUp: task.CatchUp}
+	if task.Timezone != "" {
+		loc, err := time.LoadLocation(task.Timezone)
+		if err != nil {
+			return fmt.Errorf("无效的时区 %s: %w", task.Timezone, err)
+		}
+		spec.Location = loc
+	}
+	if task.Calendar != "" {
+		cal, err := (&database.PostgresDB{DB: h.db}).GetCalendar(ctx, task.Calendar)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("日历 %s 不存在", task.Calendar)
+		}
+		if err != nil {
+			return err
+		}
+		if spec.Calendar, err = schedule.NewCalendar(cal.Weekdays, cal.Holidays, cal.Workdays); err != nil {
+			return fmt.Errorf("日历 %s 无效: %w", task.Calendar, err)
+		}
+	}
+
+	if task.Cron == nil || *task.Cron == "" {
+		return nil
+	}
+	spec.Cron = *task.Cron
+	if _, err := spec.Next(time.Now()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateRetryPolicy 校验任务的重试策略，返回写入数据库的 retry_policy，未配置时为 nil
+func validateRetryPolicy(task *Task) (interface{}, error) {
+	if task.RetryPolicy == nil || len(*task.RetryPolicy) == 0 || string(*task.RetryPolicy) == "null" {
+		task.RetryPolicy = nil
+		return nil, nil
+	}
+
+	var policy models.RetryPolicy
+	decoder := json.NewDecoder(bytes.NewReader(*task.RetryPolicy))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("retry_policy 格式错误: %w", err)
+	}
+	switch {
+	case policy.MaxAttempts < 0:
+		return nil, fmt.Errorf("retry_policy.max_attempts 不能为负数")
+	case policy.InitialDelaySeconds < 0 || policy.MaxDelaySeconds < 0 || policy.MaxElapsedSeconds < 0:
+		return nil, fmt.Errorf("retry_policy 的延迟和最长重试时间不能为负数")
+	case policy.MaxDelaySeconds > 0 && policy.InitialDelaySeconds > policy.MaxDelaySeconds:
+		return nil, fmt.Errorf("retry_policy.initial_delay_seconds 不能大于 max_delay_seconds")
+	case policy.BackoffFactor != 0 && policy.BackoffFactor < 1:
+		return nil, fmt.Errorf("retry_policy.backoff_factor 不能小于 1")
+	case policy.Jitter < 0 || policy.Jitter > 1:
+		return nil, fmt.Errorf("retry_policy.jitter 必须在 0~1 之间")
+	}
+
+	data, _ := json.Marshal(policy)
+	normalized := json.RawMessage(data)
+	task.RetryPolicy = &normalized
+	return string(data), nil
+}
+
+// nullIfEmpty 空字符串写入数据库时为 NULL
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
 // Update 更新任务
 func (h *TaskHandler) Update(c *gin.Context) {
 	id := c.Param("id")
@@ -202,20 +401,43 @@ func (h *TaskHandler) Update(c *gin.Context) {
 		return
 	}
 
+	selector, err := h.validateRouting(&task)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.validateSchedule(c.Request.Context(), &task); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	retryPolicy, err := validateRetryPolicy(&task)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// 处理空config的情况
 	var configData interface{}
 	if task.Config == nil || len(*task.Config) == 0 || string(*task.Config) == "null" {
 		configData = nil
 	} else {
+		if err := validateTaskConfig(*task.Config); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		configData = *task.Config
 	}
 
 	result, err := h.db.Exec(`UPDATE collection_tasks SET
 	    name=$1, description=$2, type=$3, data_source_id=$4, cron=$5, status=$6,
-	    replicas=$7, execution_timeout=$8, max_retries=$9, config=$10, updated_at=NOW()
-	    WHERE id=$11`,
+	    replicas=$7, execution_timeout=$8, max_retries=$9, config=$10,
+	    queue=$11, priority=$12, tenant=$13, selector=$14,
+	    timezone=$15, catch_up=$16, jitter_seconds=$17, calendar=$18, retry_policy=$19, updated_at=NOW()
+	    WHERE id=$20`,
 		task.Name, task.Description, task.Type, task.DataSourceID, task.Cron, task.Status,
-		task.Replicas, task.ExecutionTimeout, task.MaxRetries, configData, id)
+		task.Replicas, task.ExecutionTimeout, task.MaxRetries, configData,
+		task.Queue, task.Priority, task.Tenant, selector,
+		nullIfEmpty(task.Timezone), task.CatchUp, task.JitterSeconds, nullIfEmpty(task.Calendar), retryPolicy, id)
 
 	if err != nil {
 		h.log.Error("更新任务失败", zap.Error(err))
@@ -440,6 +662,14 @@ func (h *TaskHandler) Stop(c *gin.Context) {
 		return
 	}
 
-	h.log.Info("停止任务", zap.String("task_id", id))
-	c.JSON(http.StatusOK, gin.H{"message": "任务已停止"})
+	// 同时取消该任务正在进行的执行
+	cancelled, err := cancelExecutions(h.db, "e.task_id = $1", id, c.GetString("username"))
+	if err != nil {
+		h.log.Error("取消任务执行失败", zap.String("task_id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "任务已停止，但取消正在进行的执行失败"})
+		return
+	}
+
+	h.log.Info("停止任务", zap.String("task_id", id), zap.Int("cancelled_executions", len(cancelled)))
+	c.JSON(http.StatusOK, gin.H{"message": "任务已停止", "cancelled_executions": len(cancelled)})
 }
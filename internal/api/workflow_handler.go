@@ -0,0 +1,376 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/datafusion/worker/internal/database"
+	"github.com/datafusion/worker/internal/logger"
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/schedule"
+	"github.com/datafusion/worker/internal/workflow"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+type WorkflowHandler struct {
+	db  *sql.DB
+	log *logger.Logger
+}
+
+func NewWorkflowHandler(db *sql.DB, log *logger.Logger) *WorkflowHandler {
+	return &WorkflowHandler{db: db, log: log}
+}
+
+const workflowColumns = `id, name, COALESCE(description, ''), cron, next_run_time, status, definition, created_at, updated_at`
+
+// scanWorkflow 扫描一行工作流数据
+func scanWorkflow(scanner interface{ Scan(...interface{}) error }) (*models.Workflow, error) {
+	var wf models.Workflow
+	var definition []byte
+	if err := scanner.Scan(&wf.ID, &wf.Name, &wf.Description, &wf.Cron, &wf.NextRunTime,
+		&wf.Status, &definition, &wf.CreatedAt, &wf.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(definition, &wf.Definition); err != nil {
+		return nil, fmt.Errorf("解析工作流定义失败: %w", err)
+	}
+	return &wf, nil
+}
+
+// List 获取工作流列表
+func (h *WorkflowHandler) List(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	offset := (page - 1) * pageSize
+
+	rows, err := h.db.Query(`SELECT `+workflowColumns+` FROM workflows ORDER BY created_at DESC LIMIT $1 OFFSET $2`,
+		pageSize, offset)
+	if err != nil {
+		h.log.Error("查询工作流列表失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+	defer rows.Close()
+
+	workflows := []models.Workflow{}
+	for rows.Next() {
+		wf, err := scanWorkflow(rows)
+		if err != nil {
+			h.log.Error("扫描工作流数据失败", zap.Error(err))
+			continue
+		}
+		workflows = append(workflows, *wf)
+	}
+
+	var total int
+	h.db.QueryRow("SELECT COUNT(*) FROM workflows").Scan(&total)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      workflows,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// Get 获取单个工作流
+func (h *WorkflowHandler) Get(c *gin.Context) {
+	id := c.Param("id")
+
+	wf, err := scanWorkflow(h.db.QueryRow(`SELECT `+workflowColumns+` FROM workflows WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "工作流不存在"})
+		return
+	}
+	if err != nil {
+		h.log.Error("查询工作流失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, wf)
+}
+
+// validateWorkflow 校验工作流：定义是合法的有向无环图、引用的任务存在、Cron 表达式有效，
+// 返回启用定时调度时的下次执行时间
+func (h *WorkflowHandler) validateWorkflow(wf *models.Workflow) (*time.Time, error) {
+	if strings.TrimSpace(wf.Name) == "" {
+		return nil, fmt.Errorf("工作流名称不能为空")
+	}
+	switch wf.Status {
+	case "":
+		wf.Status = "enabled"
+	case "enabled", "disabled":
+	default:
+		return nil, fmt.Errorf("工作流状态 %s 无效（可选 enabled, disabled）", wf.Status)
+	}
+	if err := workflow.Validate(wf.Definition); err != nil {
+		return nil, err
+	}
+
+	taskIDs := make([]int64, 0, len(wf.Definition.Nodes))
+	for _, node := range wf.Definition.Nodes {
+		taskIDs = append(taskIDs, node.TaskID)
+	}
+	rows, err := h.db.Query("SELECT id FROM collection_tasks WHERE id = ANY($1)", pq.Array(taskIDs))
+	if err != nil {
+		return nil, fmt.Errorf("查询任务失败: %w", err)
+	}
+	defer rows.Close()
+	existing := make(map[int64]bool, len(taskIDs))
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("扫描任务失败: %w", err)
+		}
+		existing[id] = true
+	}
+	for _, node := range wf.Definition.Nodes {
+		if !existing[node.TaskID] {
+			return nil, fmt.Errorf("节点 %s 引用的任务 %d 不存在", node.Name, node.TaskID)
+		}
+	}
+
+	if wf.Cron == nil || strings.TrimSpace(*wf.Cron) == "" {
+		wf.Cron = nil
+		return nil, nil
+	}
+	next, err := schedule.NextRun(*wf.Cron, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if wf.Status != "enabled" {
+		return nil, nil
+	}
+	return &next, nil
+}
+
+// Create 创建工作流
+func (h *WorkflowHandler) Create(c *gin.Context) {
+	var wf models.Workflow
+	if err := c.ShouldBindJSON(&wf); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	nextRun, err := h.validateWorkflow(&wf)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	definition, _ := json.Marshal(wf.Definition)
+
+	err = h.db.QueryRow(`INSERT INTO workflows (name, description, cron, next_run_time, status, definition)
+	    VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, next_run_time, created_at, updated_at`,
+		wf.Name, wf.Description, wf.Cron, nextRun, wf.Status, definition).
+		Scan(&wf.ID, &wf.NextRunTime, &wf.CreatedAt, &wf.UpdatedAt)
+	if err != nil {
+		h.log.Error("创建工作流失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败"})
+		return
+	}
+
+	h.log.Info("创建工作流成功", zap.Int64("workflow_id", wf.ID), zap.String("name", wf.Name))
+	c.JSON(http.StatusCreated, wf)
+}
+
+// Update 更新工作流，已开始的运行继续使用运行开始时的定义
+func (h *WorkflowHandler) Update(c *gin.Context) {
+	id := c.Param("id")
+
+	var wf models.Workflow
+	if err := c.ShouldBindJSON(&wf); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	nextRun, err := h.validateWorkflow(&wf)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	definition, _ := json.Marshal(wf.Definition)
+
+	result, err := h.db.Exec(`UPDATE workflows SET
+	    name=$1, description=$2, cron=$3, next_run_time=$4, status=$5, definition=$6, updated_at=NOW()
+	    WHERE id=$7`,
+		wf.Name, wf.Description, wf.Cron, nextRun, wf.Status, definition, id)
+	if err != nil {
+		h.log.Error("更新工作流失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+		return
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "工作流不存在"})
+		return
+	}
+
+	h.log.Info("更新工作流成功", zap.String("workflow_id", id))
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功"})
+}
+
+// Delete 删除工作流及其运行记录
+func (h *WorkflowHandler) Delete(c *gin.Context) {
+	id := c.Param("id")
+
+	result, err := h.db.Exec("DELETE FROM workflows WHERE id=$1", id)
+	if err != nil {
+		h.log.Error("删除工作流失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "工作流不存在"})
+		return
+	}
+
+	h.log.Info("删除工作流成功", zap.String("workflow_id", id))
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// Run 手动触发一次工作流运行，没有上游的节点由 Worker 在下次轮询时领取
+func (h *WorkflowHandler) Run(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的工作流ID"})
+		return
+	}
+
+	var exists bool
+	if err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM workflows WHERE id = $1)", id).Scan(&exists); err != nil {
+		h.log.Error("查询工作流失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "工作流不存在"})
+		return
+	}
+
+	runID, err := (&database.PostgresDB{DB: h.db}).StartWorkflowRun(c.Request.Context(), id, "manual")
+	if err != nil {
+		h.log.Error("触发工作流失败", zap.Int64("workflow_id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "触发失败"})
+		return
+	}
+
+	h.log.Info("手动触发工作流", zap.Int64("workflow_id", id), zap.Int64("run_id", runID),
+		zap.String("username", c.GetString("username")))
+	c.JSON(http.StatusAccepted, gin.H{"message": "工作流已触发", "run_id": runID})
+}
+
+// scanWorkflowRun 扫描一行工作流运行数据
+func scanWorkflowRun(scanner interface{ Scan(...interface{}) error }) (*models.WorkflowRun, error) {
+	var run models.WorkflowRun
+	var definition []byte
+	if err := scanner.Scan(&run.ID, &run.WorkflowID, &run.Status, &run.Trigger, &definition,
+		&run.StartTime, &run.EndTime); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(definition, &run.Definition); err != nil {
+		return nil, fmt.Errorf("解析工作流定义失败: %w", err)
+	}
+	return &run, nil
+}
+
+// ListRuns 获取工作流的运行记录
+func (h *WorkflowHandler) ListRuns(c *gin.Context) {
+	id := c.Param("id")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	offset := (page - 1) * pageSize
+
+	rows, err := h.db.Query(`SELECT id, workflow_id, status, trigger, definition, start_time, end_time
+	    FROM workflow_runs WHERE workflow_id = $1 ORDER BY start_time DESC LIMIT $2 OFFSET $3`,
+		id, pageSize, offset)
+	if err != nil {
+		h.log.Error("查询工作流运行记录失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+	defer rows.Close()
+
+	runs := []models.WorkflowRun{}
+	for rows.Next() {
+		run, err := scanWorkflowRun(rows)
+		if err != nil {
+			h.log.Error("扫描工作流运行数据失败", zap.Error(err))
+			continue
+		}
+		runs = append(runs, *run)
+	}
+
+	var total int
+	h.db.QueryRow("SELECT COUNT(*) FROM workflow_runs WHERE workflow_id = $1", id).Scan(&total)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      runs,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// GetRun 获取单次工作流运行及各节点的状态
+func (h *WorkflowHandler) GetRun(c *gin.Context) {
+	id := c.Param("id")
+	runID := c.Param("run_id")
+
+	run, err := scanWorkflowRun(h.db.QueryRow(`SELECT id, workflow_id, status, trigger, definition, start_time, end_time
+	    FROM workflow_runs WHERE id = $1 AND workflow_id = $2`, runID, id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "工作流运行记录不存在"})
+		return
+	}
+	if err != nil {
+		h.log.Error("查询工作流运行记录失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	rows, err := h.db.Query(`SELECT id, run_id, node, task_id, status, execution_id, COALESCE(worker_pod, ''),
+	    COALESCE(output_records, 0), COALESCE(error, ''), started_at, finished_at
+	    FROM workflow_run_nodes WHERE run_id = $1 ORDER BY id`, run.ID)
+	if err != nil {
+		h.log.Error("查询工作流节点状态失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+	defer rows.Close()
+
+	run.Nodes = []models.WorkflowRunNode{}
+	for rows.Next() {
+		var node models.WorkflowRunNode
+		if err := rows.Scan(&node.ID, &node.RunID, &node.Node, &node.TaskID, &node.Status, &node.ExecutionID,
+			&node.WorkerPod, &node.OutputRecords, &node.Error, &node.StartedAt, &node.FinishedAt); err != nil {
+			h.log.Error("扫描工作流节点数据失败", zap.Error(err))
+			continue
+		}
+		run.Nodes = append(run.Nodes, node)
+	}
+
+	c.JSON(http.StatusOK, run)
+}
@@ -57,12 +57,26 @@ func (r *RBAC) initDefaultRoles() {
 			{"tasks", "read"},
 			{"tasks", "write"},
 			{"tasks", "delete"},
+			{"queues", "read"},
+			{"queues", "write"},
+			{"queues", "delete"},
+			{"calendars", "read"},
+			{"calendars", "write"},
+			{"calendars", "delete"},
 			{"datasources", "read"},
 			{"datasources", "write"},
 			{"datasources", "delete"},
 			{"executions", "read"},
+			{"executions", "write"},
+			{"workflows", "read"},
+			{"workflows", "write"},
+			{"workflows", "delete"},
+			{"backfills", "read"},
+			{"backfills", "write"},
 			{"cleaning-rules", "read"},
 			{"cleaning-rules", "write"},
+			{"dead-letters", "read"},
+			{"dead-letters", "write"},
 			{"stats", "read"},
 		},
 	}
@@ -74,9 +88,14 @@ func (r *RBAC) initDefaultRoles() {
 		Description: "查看者，只能查看信息",
 		Permissions: []Permission{
 			{"tasks", "read"},
+			{"queues", "read"},
+			{"calendars", "read"},
 			{"datasources", "read"},
 			{"executions", "read"},
+			{"workflows", "read"},
+			{"backfills", "read"},
 			{"cleaning-rules", "read"},
+			{"dead-letters", "read"},
 			{"stats", "read"},
 		},
 	}
@@ -89,10 +108,24 @@ func (r *RBAC) initDefaultRoles() {
 		Permissions: []Permission{
 			{"tasks", "read"},
 			{"executions", "read"},
+			{"workflows", "read"},
+			{"backfills", "read"},
 			{"stats", "read"},
 		},
 	}
 	r.roles["user"] = userRole
+
+	// 隐私审计员角色 - 可以查看执行记录并还原 PII 令牌（每次还原都会记录审计日志）
+	privacyOfficerRole := &Role{
+		Name:        "privacy_officer",
+		Description: "隐私审计员，可以还原 PII 令牌",
+		Permissions: []Permission{
+			{"executions", "read"},
+			{"dead-letters", "read"},
+			{"pii", "detokenize"},
+		},
+	}
+	r.roles["privacy_officer"] = privacyOfficerRole
 }
 
 // AddRole 添加角色
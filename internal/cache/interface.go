@@ -22,6 +22,7 @@ type Cache interface {
 	// TTL操作
 	SetWithTTL(key string, value interface{}, ttl time.Duration) error
 	GetTTL(key string) (time.Duration, error)
+	Expire(key string, expiration time.Duration) error // 设置已有键的过期时间，键不存在时不做处理
 
 	// 计数器操作
 	Increment(key string) (int64, error)
@@ -130,6 +131,10 @@ func (cm *CacheManager) GetTTL(key string) (time.Duration, error) {
 	return cm.primary.GetTTL(key)
 }
 
+func (cm *CacheManager) Expire(key string, expiration time.Duration) error {
+	return cm.primary.Expire(key, expiration)
+}
+
 func (cm *CacheManager) Increment(key string) (int64, error) {
 	return cm.primary.Increment(key)
 }
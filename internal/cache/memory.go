@@ -148,6 +148,23 @@ func (mc *MemoryCache) GetTTL(key string) (time.Duration, error) {
 	return remaining, nil
 }
 
+// Expire 设置已有键的过期时间
+func (mc *MemoryCache) Expire(key string, expiration time.Duration) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	item, found := mc.items[key]
+	if !found || item.IsExpired() {
+		return nil
+	}
+
+	item.Expiration = 0
+	if expiration > 0 {
+		item.Expiration = time.Now().Add(expiration).UnixNano()
+	}
+	return nil
+}
+
 // Increment 递增计数器
 func (mc *MemoryCache) Increment(key string) (int64, error) {
 	mc.mu.Lock()
@@ -115,6 +115,16 @@ func (r *RedisCache) GetTTL(key string) (time.Duration, error) {
 	return ttl, nil
 }
 
+// Expire 设置已有键的过期时间
+func (r *RedisCache) Expire(key string, expiration time.Duration) error {
+	if err := r.client.Expire(r.ctx, key, expiration).Err(); err != nil {
+		r.log.WithError(err).Error("设置Redis缓存过期时间失败")
+		return fmt.Errorf("设置缓存过期时间失败: %w", err)
+	}
+
+	return nil
+}
+
 // Increment 递增计数器
 func (r *RedisCache) Increment(key string) (int64, error) {
 	val, err := r.client.Incr(r.ctx, key).Result()
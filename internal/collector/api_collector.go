@@ -8,6 +8,7 @@ import (
 
 	"github.com/go-resty/resty/v2"
 	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/retry"
 	"github.com/tidwall/gjson"
 )
 
@@ -54,11 +55,13 @@ func (a *APICollector) Collect(ctx context.Context, config *models.DataSourceCon
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("API 请求失败: %w", err)
+		return nil, retry.Transient(fmt.Errorf("API 请求失败: %w", err))
 	}
 
+	// 按状态码区分认证错误、限流、临时错误和配置错误，决定是否重试
 	if resp.StatusCode() != 200 {
-		return nil, fmt.Errorf("API 返回错误状态码: %d", resp.StatusCode())
+		return nil, retry.HTTPStatus(resp.StatusCode(), resp.Header().Get("Retry-After"),
+			fmt.Errorf("API 返回错误状态码: %d", resp.StatusCode()))
 	}
 
 	log.Printf("API 请求成功，状态码: %d，响应大小: %d bytes", resp.StatusCode(), len(resp.Body()))
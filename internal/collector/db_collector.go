@@ -10,6 +10,7 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
 	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/retry"
 )
 
 // DBCollector 数据库采集器
@@ -36,13 +37,13 @@ func (d *DBCollector) Collect(ctx context.Context, config *models.DataSourceConf
 	// 解析数据库配置
 	dbConfig := config.DBConfig
 	if dbConfig == nil {
-		return nil, fmt.Errorf("数据库配置为空")
+		return nil, retry.Config(fmt.Errorf("数据库配置为空"))
 	}
 
 	// 建立数据库连接
 	db, err := d.connectDB(dbConfig)
 	if err != nil {
-		return nil, fmt.Errorf("连接数据库失败: %w", err)
+		return nil, fmt.Errorf("连接数据库失败: %w", retry.SQL(err))
 	}
 	defer db.Close()
 
@@ -53,7 +54,7 @@ func (d *DBCollector) Collect(ctx context.Context, config *models.DataSourceConf
 	// 执行查询
 	rows, err := db.QueryContext(ctx, dbConfig.Query)
 	if err != nil {
-		return nil, fmt.Errorf("执行查询失败: %w", err)
+		return nil, fmt.Errorf("执行查询失败: %w", retry.SQL(err))
 	}
 	defer rows.Close()
 
@@ -85,7 +86,7 @@ func (d *DBCollector) connectDB(config *models.DBConfig) (*sql.DB, error) {
 		dsn = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
 			config.Host, config.Port, config.User, config.Password, config.Database)
 	default:
-		return nil, fmt.Errorf("不支持的数据库端口: %d", config.Port)
+		return nil, retry.Config(fmt.Errorf("不支持的数据库端口: %d", config.Port))
 	}
 
 	// 打开数据库连接
@@ -9,11 +9,18 @@ import (
 
 // APIServerConfig API服务器配置
 type APIServerConfig struct {
-	Server   ServerConfig `yaml:"server"`
-	Auth     AuthConfig   `yaml:"auth"`
-	Database DBConfig     `yaml:"database"`
-	Cache    CacheConfig  `yaml:"cache"`
-	Log      LogConfig    `yaml:"log"`
+	Server   ServerConfig   `yaml:"server"`
+	Auth     AuthConfig     `yaml:"auth"`
+	Database DBConfig       `yaml:"database"`
+	Cache    CacheConfig    `yaml:"cache"`
+	Log      LogConfig      `yaml:"log"`
+	PII      PIIVaultConfig `yaml:"pii"`
+}
+
+// PIIVaultConfig PII 令牌库配置，用于还原令牌
+type PIIVaultConfig struct {
+	VaultKey     string `yaml:"vault_key"` // 与 Worker 相同的令牌库主密钥，环境变量 DATAFUSION_PII_VAULT_KEY
+	VaultKeyFile string `yaml:"vault_key_file"`
 }
 
 // ServerConfig 服务器配置
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -9,11 +11,61 @@ import (
 
 // Config Worker 配置
 type Config struct {
-	WorkerType   string        `yaml:"worker_type"`   // rpa-collector, api-collector, db-collector
-	PollInterval time.Duration `yaml:"poll_interval"` // 轮询间隔
-	Database     DatabaseConfig `yaml:"database"`
-	Collector    CollectorConfig `yaml:"collector"`
-	Storage      StorageConfig `yaml:"storage"`
+	WorkerType   string           `yaml:"worker_type"`   // rpa-collector, api-collector, db-collector
+	PollInterval time.Duration    `yaml:"poll_interval"` // 轮询间隔
+	Scheduler    SchedulerConfig  `yaml:"scheduler"`     // 任务领取与并发执行
+	Database     DatabaseConfig   `yaml:"database"`
+	Collector    CollectorConfig  `yaml:"collector"`
+	Storage      StorageConfig    `yaml:"storage"`
+	Dedup        DedupConfig      `yaml:"dedup"`      // 去重键存储
+	PII          PIIConfig        `yaml:"pii"`        // PII 哈希盐和令牌库密钥
+	Enrichment   EnrichmentConfig `yaml:"enrichment"` // 关联补充的参考数据
+}
+
+// SchedulerConfig 任务调度配置
+type SchedulerConfig struct {
+	Slots             int           `yaml:"slots"`              // 同时执行的任务数，默认 4
+	LeaseDuration     time.Duration `yaml:"lease_duration"`     // 任务租约时长，默认 60s
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval"` // 租约续期间隔，默认为租约时长的 1/3
+
+	Queues []string          `yaml:"queues"` // 消费的任务队列，为空时消费所有队列
+	Labels map[string]string `yaml:"labels"` // Worker 标签，只领取 selector 匹配的任务
+}
+
+// EnrichmentConfig 关联补充参考数据配置
+type EnrichmentConfig struct {
+	ReferenceDir string      `yaml:"reference_dir"` // csv 数据源的目录，默认 ./data/reference
+	QueryTimeout int         `yaml:"query_timeout"` // sql 数据源的查询超时（秒），默认 60
+	Redis        RedisConfig `yaml:"redis"`         // cache 数据源使用的 Redis，未配置 host 时不可用
+	// sql 数据源使用的数据库连接，建议使用只能读取参考数据表或视图的专用账号；未配置 host 时使用 storage.database
+	Database DatabaseConfig `yaml:"database"`
+}
+
+// PIIConfig PII 脱敏配置，密钥按 文件 > 配置值 > 环境变量 的顺序读取
+type PIIConfig struct {
+	HashSalt     string `yaml:"hash_salt"` // hash 使用的盐，环境变量 DATAFUSION_PII_SALT
+	HashSaltFile string `yaml:"hash_salt_file"`
+	VaultKey     string `yaml:"vault_key"` // 令牌库主密钥（32 字节 base64/十六进制），环境变量 DATAFUSION_PII_VAULT_KEY
+	VaultKeyFile string `yaml:"vault_key_file"`
+}
+
+// Secrets 解析 PII 哈希盐和令牌库主密钥
+func (c PIIConfig) Secrets() (salt, vaultKey string, err error) {
+	salt, err = ResolveSecret(c.HashSalt, c.HashSaltFile, "DATAFUSION_PII_SALT")
+	if err != nil {
+		return "", "", err
+	}
+	vaultKey, err = ResolveSecret(c.VaultKey, c.VaultKeyFile, "DATAFUSION_PII_VAULT_KEY")
+	if err != nil {
+		return "", "", err
+	}
+	return salt, vaultKey, nil
+}
+
+// DedupConfig 去重键存储配置
+type DedupConfig struct {
+	Store string      `yaml:"store"` // database（默认，控制数据库 dedup_keys 表）, redis
+	Redis RedisConfig `yaml:"redis"`
 }
 
 // DatabaseConfig 数据库配置（PostgreSQL）
@@ -46,8 +98,79 @@ type APIConfig struct {
 
 // StorageConfig 存储配置
 type StorageConfig struct {
-	Type     string         `yaml:"type"` // postgresql, mongodb, file
-	Database DatabaseConfig `yaml:"database"`
+	Type          string              `yaml:"type"` // postgresql, mongodb, file, s3, elasticsearch, webhook
+	Database      DatabaseConfig      `yaml:"database"`
+	MongoDB       MongoDBConfig       `yaml:"mongodb"`
+	S3            S3Config            `yaml:"s3"`
+	Elasticsearch ElasticsearchConfig `yaml:"elasticsearch"`
+}
+
+// MongoDBConfig MongoDB 存储配置（配置了 uri 即注册 mongodb 存储）
+type MongoDBConfig struct {
+	URI         string `yaml:"uri"`
+	Database    string `yaml:"database"`
+	Collection  string `yaml:"collection"` // 任务未指定 table 时使用的默认集合
+	Timeout     int    `yaml:"timeout"`    // 秒
+	MaxPoolSize uint64 `yaml:"max_pool_size"`
+	MinPoolSize uint64 `yaml:"min_pool_size"`
+}
+
+// S3Config S3 兼容对象存储配置（配置了 endpoint 即注册 s3 存储）
+// 凭证优先读取 *_file 指向的文件（如 Kubernetes Secret 挂载），其次是配置值，最后是 AWS_* 环境变量
+type S3Config struct {
+	Endpoint      string `yaml:"endpoint"`
+	Region        string `yaml:"region"`
+	Bucket        string `yaml:"bucket"`
+	Prefix        string `yaml:"prefix"`
+	UseSSL        bool   `yaml:"use_ssl"`
+	PathStyle     bool   `yaml:"path_style"`
+	AccessKey     string `yaml:"access_key"`
+	SecretKey     string `yaml:"secret_key"`
+	AccessKeyFile string `yaml:"access_key_file"`
+	SecretKeyFile string `yaml:"secret_key_file"`
+	SSE           string `yaml:"sse"` // sse-s3, sse-kms
+	SSEKMSKeyID   string `yaml:"sse_kms_key_id"`
+	PartSizeMB    int    `yaml:"part_size_mb"`
+}
+
+// Credentials 解析 S3 访问凭证
+func (c S3Config) Credentials() (accessKey, secretKey string, err error) {
+	accessKey, err = ResolveSecret(c.AccessKey, c.AccessKeyFile, "AWS_ACCESS_KEY_ID")
+	if err != nil {
+		return "", "", err
+	}
+	secretKey, err = ResolveSecret(c.SecretKey, c.SecretKeyFile, "AWS_SECRET_ACCESS_KEY")
+	if err != nil {
+		return "", "", err
+	}
+	return accessKey, secretKey, nil
+}
+
+// ResolveSecret 按 文件 > 配置值 > 环境变量 的顺序读取密钥
+func ResolveSecret(value, file, envKey string) (string, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("读取密钥文件 %s 失败: %w", file, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	if value != "" {
+		return value, nil
+	}
+	return os.Getenv(envKey), nil
+}
+
+// ElasticsearchConfig Elasticsearch / OpenSearch 存储配置（配置了 address 即注册 elasticsearch 存储）
+type ElasticsearchConfig struct {
+	Address      string `yaml:"address"`
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"password_file"`
+	APIKey       string `yaml:"api_key"`
+	APIKeyFile   string `yaml:"api_key_file"`
+	BulkSize     int    `yaml:"bulk_size"`
+	Timeout      int    `yaml:"timeout"` // 秒
 }
 
 // LoadConfig 加载配置文件
@@ -66,6 +189,27 @@ func LoadConfig(path string) (*Config, error) {
 	if cfg.PollInterval == 0 {
 		cfg.PollInterval = 30 * time.Second
 	}
+	if cfg.Scheduler.Slots <= 0 {
+		cfg.Scheduler.Slots = 4
+	}
+	if cfg.Scheduler.LeaseDuration <= 0 {
+		cfg.Scheduler.LeaseDuration = 60 * time.Second
+	}
+	if cfg.Scheduler.HeartbeatInterval <= 0 || cfg.Scheduler.HeartbeatInterval >= cfg.Scheduler.LeaseDuration {
+		cfg.Scheduler.HeartbeatInterval = cfg.Scheduler.LeaseDuration / 3
+	}
+	// 队列和标签可以由环境变量覆盖，同一份配置文件可以用于不同的 Worker 池
+	env := NewEnvConfig("DATAFUSION")
+	if queues := env.GetString("WORKER_QUEUES", ""); queues != "" {
+		cfg.Scheduler.Queues = splitList(queues)
+	}
+	if labels := env.GetString("WORKER_LABELS", ""); labels != "" {
+		parsed, err := ParseLabels(labels)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Scheduler.Labels = parsed
+	}
 	if cfg.Collector.RPA.Timeout == 0 {
 		cfg.Collector.RPA.Timeout = 30
 	}
@@ -75,3 +219,28 @@ func LoadConfig(path string) (*Config, error) {
 
 	return &cfg, nil
 }
+
+// ParseLabels 解析 "chrome=true,region=cn" 格式的 Worker 标签
+func ParseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, item := range splitList(s) {
+		key, value, ok := strings.Cut(item, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("Worker 标签 %q 格式错误，应为 key=value", item)
+		}
+		labels[key] = strings.TrimSpace(value)
+	}
+	return labels, nil
+}
+
+// splitList 按逗号拆分并去掉空白项
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,416 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/schedule"
+	"github.com/lib/pq"
+)
+
+// ClaimedBackfillWindow Worker 领取的补数窗口
+type ClaimedBackfillWindow struct {
+	Window models.BackfillWindow
+	Task   models.CollectionTask
+}
+
+// CreateBackfill 创建补数记录和 windows 对应的窗口，窗口初始为 pending 等待 Worker 领取
+func (db *PostgresDB) CreateBackfill(ctx context.Context, backfill *models.Backfill, windows []schedule.Window) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO backfills (task_id, start_time, end_time, interval_seconds, concurrency, status, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`, backfill.TaskID, backfill.StartTime.UTC(), backfill.EndTime.UTC(), backfill.IntervalSeconds,
+		backfill.Concurrency, models.BackfillRunning, backfill.CreatedBy).Scan(&backfill.ID, &backfill.CreatedAt); err != nil {
+		return fmt.Errorf("创建补数记录失败: %w", err)
+	}
+
+	starts := make([]time.Time, len(windows))
+	ends := make([]time.Time, len(windows))
+	for i, w := range windows {
+		starts[i], ends[i] = w.Start.UTC(), w.End.UTC()
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO backfill_windows (backfill_id, window_start, window_end, status)
+		SELECT $1, s, e, $4 FROM unnest($2::timestamp[], $3::timestamp[]) AS w(s, e)
+	`, backfill.ID, pq.Array(starts), pq.Array(ends), models.BackfillWindowPending); err != nil {
+		return fmt.Errorf("创建补数窗口失败: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	backfill.Status = models.BackfillRunning
+	backfill.Progress = models.BackfillProgress{Total: len(windows), Pending: len(windows)}
+	return nil
+}
+
+// ClaimBackfillWindows 按路由条件领取最多 limit 个 pending 状态的补数窗口，并写入 lease 时长的窗口租约
+// 补数行使用 FOR UPDATE SKIP LOCKED 锁定，同一补数同时只有一个 Worker 领取，执行中的窗口数不超过补数的并发上限；
+// 窗口遵守任务的队列和 selector，但只受补数自身的并发上限约束，不占用队列的并发数，也不需要任务租约
+func (db *PostgresDB) ClaimBackfillWindows(ctx context.Context, filter ClaimFilter, limit int, lease time.Duration) ([]ClaimedBackfillWindow, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	workerType := filter.WorkerType
+	if workerType == "all" {
+		workerType = ""
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT b.id, b.concurrency - (
+			SELECT COUNT(*) FROM backfill_windows w WHERE w.backfill_id = b.id AND w.status = $2
+		)
+		FROM backfills b
+		WHERE b.status = $1
+		ORDER BY b.id
+		FOR UPDATE SKIP LOCKED
+	`, models.BackfillRunning, models.BackfillWindowRunning)
+	if err != nil {
+		return nil, fmt.Errorf("锁定补数记录失败: %w", err)
+	}
+	// 以补数 ID 作为 schedule.Pick 的队列，剩余并发数即为队列容量
+	free := make(map[string]int)
+	var backfillIDs []int64
+	for rows.Next() {
+		var id int64
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("扫描补数记录失败: %w", err)
+		}
+		if n > 0 {
+			free[strconv.FormatInt(id, 10)] = n
+			backfillIDs = append(backfillIDs, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("锁定补数记录失败: %w", err)
+	}
+	if len(backfillIDs) == 0 {
+		return nil, nil
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		SELECT w.id, w.backfill_id, w.window_start, w.window_end, COALESCE(q.priority, 0), `+taskColumns+`
+		FROM backfill_windows w
+		JOIN backfills b ON b.id = w.backfill_id
+		JOIN collection_tasks t ON t.id = b.task_id
+		LEFT JOIN task_queues q ON q.name = t.queue
+		WHERE w.backfill_id = ANY($1) AND w.status = $2
+		AND ($3 = '' OR t.type = $3)
+		AND (cardinality($4::text[]) = 0 OR COALESCE(t.queue, 'default') = ANY($4))
+		AND (t.selector IS NULL OR t.selector <@ $5::jsonb)
+		ORDER BY w.backfill_id, w.window_start
+		LIMIT $6
+		FOR UPDATE OF w SKIP LOCKED
+	`, pq.Array(backfillIDs), models.BackfillWindowPending, workerType, pq.Array(filter.Queues),
+		labelsJSON(filter.Labels), limit*claimCandidateFactor)
+	if err != nil {
+		return nil, fmt.Errorf("查询待执行的补数窗口失败: %w", err)
+	}
+
+	windows := make(map[int64]ClaimedBackfillWindow)
+	var candidates []schedule.Candidate
+	for rows.Next() {
+		var claimed ClaimedBackfillWindow
+		var queuePriority int
+		if err := scanTask(rows, &claimed.Task,
+			&claimed.Window.ID, &claimed.Window.BackfillID, &claimed.Window.WindowStart, &claimed.Window.WindowEnd,
+			&queuePriority,
+		); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("扫描补数窗口失败: %w", err)
+		}
+		// 数据库中按 UTC 保存
+		claimed.Window.WindowStart = asUTC(claimed.Window.WindowStart)
+		claimed.Window.WindowEnd = asUTC(claimed.Window.WindowEnd)
+
+		c := taskCandidate(claimed.Task, queuePriority)
+		c.ID = claimed.Window.ID
+		c.Queue = strconv.FormatInt(claimed.Window.BackfillID, 10)
+		c.Due = claimed.Window.WindowStart
+		candidates = append(candidates, c)
+		windows[claimed.Window.ID] = claimed
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("查询待执行的补数窗口失败: %w", err)
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	// 补数之间按租户公平挑选，各补数不超过剩余并发数
+	picked := schedule.Pick(candidates, limit, free, nil)
+	ids := make([]int64, len(picked))
+	for i, c := range picked {
+		ids[i] = c.ID
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE backfill_windows
+		SET status = $2, worker_pod = $3, lease_expires_at = NOW() + make_interval(secs => $4),
+		    started_at = NOW(), error = NULL
+		WHERE id = ANY($1)
+	`, pq.Array(ids), models.BackfillWindowRunning, filter.WorkerPod, lease.Seconds()); err != nil {
+		return nil, fmt.Errorf("更新补数窗口状态失败: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %w", err)
+	}
+
+	claimed := make([]ClaimedBackfillWindow, 0, len(ids))
+	for _, id := range ids {
+		c := windows[id]
+		c.Window.Status = models.BackfillWindowRunning
+		c.Window.WorkerPod = filter.WorkerPod
+		claimed = append(claimed, c)
+	}
+	return claimed, nil
+}
+
+// asUTC 将不带时区的 TIMESTAMP 读出的时间视为 UTC
+func asUTC(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// SetBackfillWindowExecution 记录补数窗口的执行 ID，API 取消补数时据此取消执行；补数已取消时返回 true，
+// 调用方应取消本次执行。补数行加共享锁：与 CancelBackfill 并发时，要么取消时已能读到执行 ID，
+// 要么这里读到 cancelled，执行 ID 写入前已取消的窗口不会被漏掉
+func (db *PostgresDB) SetBackfillWindowExecution(ctx context.Context, windowID, executionID int64) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	var status string
+	if err := tx.QueryRowContext(ctx, `
+		SELECT b.status FROM backfills b
+		JOIN backfill_windows w ON w.backfill_id = b.id
+		WHERE w.id = $1
+		FOR SHARE OF b
+	`, windowID).Scan(&status); err != nil {
+		return false, fmt.Errorf("查询补数状态失败: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE backfill_windows SET execution_id = $2 WHERE id = $1
+	`, windowID, executionID); err != nil {
+		return false, fmt.Errorf("更新补数窗口执行记录失败: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return status == models.BackfillCancelled, nil
+}
+
+// RenewBackfillLeases 为 workerPod 执行中的补数窗口续期，返回续期成功的窗口 ID
+// 未返回的窗口说明租约已过期被回收
+func (db *PostgresDB) RenewBackfillLeases(ctx context.Context, workerPod string, windowIDs []int64, lease time.Duration) (map[int64]bool, error) {
+	renewed := make(map[int64]bool, len(windowIDs))
+	if len(windowIDs) == 0 {
+		return renewed, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		UPDATE backfill_windows
+		SET lease_expires_at = NOW() + make_interval(secs => $3)
+		WHERE worker_pod = $1 AND id = ANY($2) AND status = $4
+		RETURNING id
+	`, workerPod, pq.Array(windowIDs), lease.Seconds(), models.BackfillWindowRunning)
+	if err != nil {
+		return nil, fmt.Errorf("续期补数窗口租约失败: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("扫描补数窗口租约失败: %w", err)
+		}
+		renewed[id] = true
+	}
+	return renewed, rows.Err()
+}
+
+// FinishBackfillWindow 记录补数窗口的执行结果，所有窗口结束后更新补数状态
+// 窗口不再由 workerPod 执行（已被回收）时返回 false
+func (db *PostgresDB) FinishBackfillWindow(ctx context.Context, windowID int64, workerPod, status string, executionID int64, records int, errMsg string) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	var backfillID int64
+	err = tx.QueryRowContext(ctx, `
+		UPDATE backfill_windows
+		SET status = $3, execution_id = COALESCE(NULLIF($4, 0), execution_id), records_collected = $5,
+		    error = NULLIF($6, ''), lease_expires_at = NULL, finished_at = NOW()
+		WHERE id = $1 AND worker_pod = $2 AND status = $7
+		RETURNING backfill_id
+	`, windowID, workerPod, status, executionID, records, errMsg, models.BackfillWindowRunning).Scan(&backfillID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("更新补数窗口状态失败: %w", err)
+	}
+
+	if err := finishBackfill(ctx, tx, backfillID); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return true, nil
+}
+
+// RecoverBackfillWindows 将租约已过期（Worker 崩溃或失联）的执行中窗口及其执行记录标记为失败，返回回收的窗口数
+func (db *PostgresDB) RecoverBackfillWindows(ctx context.Context) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		WITH expired AS (
+			UPDATE backfill_windows
+			SET status = $2, error = 'Worker ' || worker_pod || ' 租约过期，执行中断',
+			    lease_expires_at = NULL, finished_at = NOW()
+			WHERE id IN (
+				SELECT id FROM backfill_windows
+				WHERE status = $1 AND lease_expires_at <= NOW()
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING backfill_id, execution_id
+		), interrupted AS (
+			UPDATE task_executions e
+			SET status = 'failed', end_time = NOW(), error_message = '补数窗口租约过期，执行中断'
+			FROM expired x
+			WHERE e.id = x.execution_id AND e.status IN ('running', 'cancelling')
+		)
+		SELECT DISTINCT backfill_id FROM expired
+	`, models.BackfillWindowRunning, models.BackfillWindowFailed)
+	if err != nil {
+		return 0, fmt.Errorf("回收补数窗口失败: %w", err)
+	}
+	var backfillIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("扫描补数记录失败: %w", err)
+		}
+		backfillIDs = append(backfillIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("回收补数窗口失败: %w", err)
+	}
+
+	for _, id := range backfillIDs {
+		if err := finishBackfill(ctx, tx, id); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return len(backfillIDs), nil
+}
+
+// CancelBackfill 取消补数：未开始的窗口标记为 cancelled，返回执行中窗口的执行 ID，由调用方请求取消这些执行
+// 补数已结束时返回 false
+func (db *PostgresDB) CancelBackfill(ctx context.Context, backfillID int64, username string) (bool, []int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, nil, fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE backfills SET status = $2, cancelled_by = $3 WHERE id = $1 AND status = $4
+	`, backfillID, models.BackfillCancelled, username, models.BackfillRunning)
+	if err != nil {
+		return false, nil, fmt.Errorf("更新补数状态失败: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return false, nil, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE backfill_windows SET status = $2, finished_at = NOW() WHERE backfill_id = $1 AND status = $3
+	`, backfillID, models.BackfillWindowCancelled, models.BackfillWindowPending); err != nil {
+		return false, nil, fmt.Errorf("取消补数窗口失败: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT execution_id FROM backfill_windows
+		WHERE backfill_id = $1 AND status = $2 AND execution_id IS NOT NULL
+	`, backfillID, models.BackfillWindowRunning)
+	if err != nil {
+		return false, nil, fmt.Errorf("查询执行中的补数窗口失败: %w", err)
+	}
+	var executionIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return false, nil, fmt.Errorf("扫描补数窗口失败: %w", err)
+		}
+		executionIDs = append(executionIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, nil, fmt.Errorf("查询执行中的补数窗口失败: %w", err)
+	}
+
+	// 没有执行中的窗口时补数直接结束
+	if err := finishBackfill(ctx, tx, backfillID); err != nil {
+		return false, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, nil, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return true, executionIDs, nil
+}
+
+// finishBackfill 所有窗口都已结束时更新补数的最终状态：已取消的保持 cancelled，有失败窗口时为 failed，否则为 success
+func finishBackfill(ctx context.Context, tx *sql.Tx, backfillID int64) error {
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE backfills b
+		SET status = CASE
+		        WHEN b.status = $2 THEN b.status
+		        WHEN EXISTS (SELECT 1 FROM backfill_windows w WHERE w.backfill_id = b.id AND w.status IN ($3, $4)) THEN $5
+		        ELSE $6
+		    END,
+		    finished_at = NOW()
+		WHERE b.id = $1 AND b.finished_at IS NULL
+		AND NOT EXISTS (SELECT 1 FROM backfill_windows w WHERE w.backfill_id = b.id AND w.status IN ($7, $8))
+	`, backfillID, models.BackfillCancelled, models.BackfillWindowFailed, models.BackfillWindowCancelled,
+		models.BackfillFailed, models.BackfillSuccess, models.BackfillWindowPending, models.BackfillWindowRunning); err != nil {
+		return fmt.Errorf("更新补数状态失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/lib/pq"
+)
+
+// GetCalendar 查询日历
+func (db *PostgresDB) GetCalendar(ctx context.Context, name string) (*models.Calendar, error) {
+	var c models.Calendar
+	err := db.QueryRowContext(ctx, `
+		SELECT name, COALESCE(description, ''), COALESCE(weekdays, '{}'), COALESCE(holidays, '{}'), COALESCE(workdays, '{}'),
+		       created_at, updated_at
+		FROM calendars WHERE name = $1
+	`, name).Scan(&c.Name, &c.Description, pq.Array(&c.Weekdays), pq.Array(&c.Holidays), pq.Array(&c.Workdays),
+		&c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("查询日历 %s 失败: %w", name, err)
+	}
+	return &c, nil
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/datafusion/worker/internal/config"
+	"github.com/datafusion/worker/internal/models"
+	"github.com/lib/pq"
+)
+
+// cancelListenerPing 监听连接空闲时的探活间隔
+const cancelListenerPing = 90 * time.Second
+
+// CancellingExecutions 返回 workerPod 上已请求取消的执行 ID（取消通知丢失时的兜底）
+func (db *PostgresDB) CancellingExecutions(ctx context.Context, workerPod string) ([]int64, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id FROM task_executions WHERE worker_pod = $1 AND status = $2
+	`, workerPod, models.ExecutionStatusCancelling)
+	if err != nil {
+		return nil, fmt.Errorf("查询待取消的执行记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("扫描执行记录失败: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ListenExecutionCancels 通过 LISTEN 接收取消执行通知并调用 handle，直到 ctx 结束
+// 连接断开后自动重连，重连期间丢失的通知由 CancellingExecutions 兜底
+func ListenExecutionCancels(ctx context.Context, cfg config.DatabaseConfig, handle func(notice models.ExecutionCancelNotice)) error {
+	dsn := postgresDSN(cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Database, cfg.SSLMode)
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("取消通知监听连接异常: %v", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(models.ExecutionCancelChannel); err != nil {
+		return fmt.Errorf("监听取消通知失败: %w", err)
+	}
+
+	ticker := time.NewTicker(cancelListenerPing)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// 重连后会收到 nil
+			if n == nil {
+				continue
+			}
+			var notice models.ExecutionCancelNotice
+			if err := json.Unmarshal([]byte(n.Extra), &notice); err != nil {
+				log.Printf("解析取消通知失败: %v", err)
+				continue
+			}
+			handle(notice)
+		case <-ticker.C:
+			go listener.Ping()
+		}
+	}
+}
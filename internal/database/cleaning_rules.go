@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/datafusion/worker/internal/models"
+)
+
+// cleaningRuleConfig cleaning_rules.config 中的规则参数
+type cleaningRuleConfig struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+	Format      string `json:"format"`       // date_format 的目标格式，等同于 pattern
+	TargetField string `json:"target_field"` // 结果写入的字段，为空时写回绑定的字段
+	Locale      string `json:"locale"`
+	Timezone    string `json:"timezone"`
+}
+
+// GetTaskCleaningRules 按 order_index 顺序获取任务绑定的清洗规则（当前版本）
+func (db *PostgresDB) GetTaskCleaningRules(ctx context.Context, taskID int64) ([]models.CleaningRule, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT r.id, r.name, r.rule_type, r.config, COALESCE(r.version, 1), COALESCE(t.field_name, '')
+		FROM task_cleaning_rules t
+		JOIN cleaning_rules r ON r.id = t.cleaning_rule_id
+		WHERE t.task_id = $1
+		ORDER BY t.order_index, t.id
+	`, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("查询任务清洗规则失败: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []models.CleaningRule
+	for rows.Next() {
+		var rule models.CleaningRule
+		var configJSON string
+		if err := rows.Scan(&rule.RuleID, &rule.Name, &rule.Type, &configJSON, &rule.Version, &rule.Field); err != nil {
+			return nil, fmt.Errorf("扫描任务清洗规则失败: %w", err)
+		}
+		if rule.Field == "" {
+			log.Printf("警告: 任务 %d 绑定的清洗规则 %s 未指定字段，已跳过", taskID, rule.Name)
+			continue
+		}
+		if err := ApplyCleaningRuleConfig(&rule, configJSON); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// ApplyCleaningRuleConfig 将 cleaning_rules.config 中的规则参数填入清洗规则
+func ApplyCleaningRuleConfig(rule *models.CleaningRule, configJSON string) error {
+	var config cleaningRuleConfig
+	if err := json.Unmarshal([]byte(configJSON), &config); err != nil {
+		return fmt.Errorf("解析清洗规则 %s 的配置失败: %w", rule.Name, err)
+	}
+	rule.Pattern = config.Pattern
+	if rule.Pattern == "" {
+		rule.Pattern = config.Format
+	}
+	rule.Replacement = config.Replacement
+	rule.TargetField = config.TargetField
+	rule.Locale = config.Locale
+	rule.Timezone = config.Timezone
+	return nil
+}
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/lib/pq"
+)
+
+// SaveDeadLetters 批量写入死信记录
+func (db *PostgresDB) SaveDeadLetters(ctx context.Context, records []models.DeadLetterRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO dead_letter_records (task_id, execution_id, stage, stage_name, stage_index, rule, target, error, record, status, pii_protected)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`)
+	if err != nil {
+		return fmt.Errorf("准备语句失败: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, record := range records {
+		data, err := json.Marshal(record.Record)
+		if err != nil {
+			return fmt.Errorf("序列化死信记录失败: %w", err)
+		}
+		var executionID interface{}
+		if record.ExecutionID > 0 {
+			executionID = record.ExecutionID
+		}
+		var stageName interface{}
+		if record.StageName != "" {
+			stageName = record.StageName
+		}
+		if _, err := stmt.ExecContext(ctx, record.TaskID, executionID, record.Stage, stageName, record.StageIndex, record.Rule,
+			record.Target, record.Error, string(data), models.DeadLetterStatusPending, record.PIIProtected); err != nil {
+			return fmt.Errorf("写入死信记录失败: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
+}
+
+// ClaimReplayDeadLetters 领取等待重放的死信记录并标记为 replaying，同时写入 lease 时长的租约
+// 使用 FOR UPDATE SKIP LOCKED，多个 Worker 不会领取到同一条记录；
+// Worker 中断后租约过期的记录由 RecoverDeadLetterReplays 回收
+func (db *PostgresDB) ClaimReplayDeadLetters(ctx context.Context, workerPod string, limit int, lease time.Duration) ([]models.DeadLetterRecord, error) {
+	rows, err := db.QueryContext(ctx, `
+		UPDATE dead_letter_records
+		SET status = $1, worker_pod = $4, lease_expires_at = NOW() + make_interval(secs => $5)
+		WHERE id IN (
+			SELECT id FROM dead_letter_records
+			WHERE status = $2
+			ORDER BY id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, task_id, COALESCE(execution_id, 0), stage, COALESCE(stage_name, ''), COALESCE(stage_index, 0),
+		          COALESCE(rule, ''), COALESCE(target, ''),
+		          COALESCE(error, ''), record, replay_count, COALESCE(pii_protected, FALSE), created_at
+	`, models.DeadLetterStatusReplaying, models.DeadLetterStatusReplayRequested, limit, workerPod, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("领取重放记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	var records []models.DeadLetterRecord
+	for rows.Next() {
+		var record models.DeadLetterRecord
+		var data []byte
+		if err := rows.Scan(&record.ID, &record.TaskID, &record.ExecutionID, &record.Stage, &record.StageName, &record.StageIndex, &record.Rule,
+			&record.Target, &record.Error, &data, &record.ReplayCount, &record.PIIProtected, &record.CreatedAt); err != nil {
+			return nil, fmt.Errorf("扫描死信记录失败: %w", err)
+		}
+		if err := json.Unmarshal(data, &record.Record); err != nil {
+			return nil, fmt.Errorf("解析死信记录失败: %w", err)
+		}
+		record.Status = models.DeadLetterStatusReplaying
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// RenewDeadLetterLeases 续期 Worker 正在重放的死信记录的租约，返回续期成功的记录 ID
+// 租约已被回收的记录不会续期，调用方应停止重放这些记录
+func (db *PostgresDB) RenewDeadLetterLeases(ctx context.Context, workerPod string, ids []int64, lease time.Duration) (map[int64]bool, error) {
+	renewed := make(map[int64]bool)
+	if len(ids) == 0 {
+		return renewed, nil
+	}
+	rows, err := db.QueryContext(ctx, `
+		UPDATE dead_letter_records
+		SET lease_expires_at = NOW() + make_interval(secs => $4)
+		WHERE id = ANY($1) AND status = $2 AND worker_pod = $3
+		RETURNING id
+	`, pq.Array(ids), models.DeadLetterStatusReplaying, workerPod, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("续期死信重放租约失败: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("扫描死信记录失败: %w", err)
+		}
+		renewed[id] = true
+	}
+	return renewed, rows.Err()
+}
+
+// FinishDeadLetterReplay 记录重放结果：成功标记为 replayed，失败退回 pending 并更新错误信息
+// 只更新 workerPod 持有租约的记录，租约已被回收时返回 false
+func (db *PostgresDB) FinishDeadLetterReplay(ctx context.Context, id int64, workerPod string, replayErr error) (bool, error) {
+	var result sql.Result
+	var err error
+	if replayErr == nil {
+		result, err = db.ExecContext(ctx, `
+			UPDATE dead_letter_records
+			SET status = $1, replay_count = replay_count + 1, replayed_at = NOW(),
+			    worker_pod = NULL, lease_expires_at = NULL
+			WHERE id = $2 AND status = $3 AND worker_pod = $4
+		`, models.DeadLetterStatusReplayed, id, models.DeadLetterStatusReplaying, workerPod)
+	} else {
+		result, err = db.ExecContext(ctx, `
+			UPDATE dead_letter_records
+			SET status = $1, replay_count = replay_count + 1, error = $2,
+			    worker_pod = NULL, lease_expires_at = NULL
+			WHERE id = $3 AND status = $4 AND worker_pod = $5
+		`, models.DeadLetterStatusPending, replayErr.Error(), id, models.DeadLetterStatusReplaying, workerPod)
+	}
+	if err != nil {
+		return false, fmt.Errorf("更新死信记录失败: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("更新死信记录失败: %w", err)
+	}
+	return n > 0, nil
+}
+
+// RecoverDeadLetterReplays 回收租约过期的重放记录（Worker 在重放过程中退出），
+// 退回 pending 并记录中断原因，需要重新请求重放；返回回收的记录数
+func (db *PostgresDB) RecoverDeadLetterReplays(ctx context.Context) (int, error) {
+	result, err := db.ExecContext(ctx, `
+		UPDATE dead_letter_records
+		SET status = $2, replay_count = replay_count + 1,
+		    error = 'Worker ' || COALESCE(worker_pod, '') || ' 租约过期，重放中断',
+		    worker_pod = NULL, lease_expires_at = NULL
+		WHERE id IN (
+			SELECT id FROM dead_letter_records
+			WHERE status = $1 AND (lease_expires_at IS NULL OR lease_expires_at <= NOW())
+			FOR UPDATE SKIP LOCKED
+		)
+	`, models.DeadLetterStatusReplaying, models.DeadLetterStatusPending)
+	if err != nil {
+		return 0, fmt.Errorf("回收死信重放记录失败: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("回收死信重放记录失败: %w", err)
+	}
+	return int(n), nil
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SeenDedupKeys 返回 keys 中已记录且未过期的去重键
+func (db *PostgresDB) SeenDedupKeys(ctx context.Context, scope string, keys []string) (map[string]bool, error) {
+	seen := make(map[string]bool)
+	if len(keys) == 0 {
+		return seen, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT key FROM dedup_keys
+		WHERE scope = $1 AND key = ANY($2) AND (expires_at IS NULL OR expires_at > NOW())
+	`, scope, pq.Array(keys))
+	if err != nil {
+		return nil, fmt.Errorf("查询去重键失败: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("扫描去重键失败: %w", err)
+		}
+		seen[key] = true
+	}
+	return seen, rows.Err()
+}
+
+// MarkDedupKeys 记录去重键，已存在的键刷新过期时间；ttl 为 0 时永久保留
+// 同时清理该范围内已过期的键
+func (db *PostgresDB) MarkDedupKeys(ctx context.Context, scope string, keys []string, ttl time.Duration) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	var expiresAt interface{}
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO dedup_keys (scope, key, expires_at)
+		SELECT $1, k, $3 FROM unnest($2::text[]) AS k
+		ON CONFLICT (scope, key) DO UPDATE SET expires_at = EXCLUDED.expires_at
+	`, scope, pq.Array(keys), expiresAt); err != nil {
+		return fmt.Errorf("写入去重键失败: %w", err)
+	}
+
+	if _, err := db.ExecContext(ctx, `
+		DELETE FROM dedup_keys WHERE scope = $1 AND expires_at < NOW()
+	`, scope); err != nil {
+		return fmt.Errorf("清理过期去重键失败: %w", err)
+	}
+	return nil
+}
+
+// DedupFingerprint 近似去重的文本指纹
+type DedupFingerprint struct {
+	Hash     uint64
+	RecordID string
+	Bands    []string
+}
+
+// FindDedupFingerprints 返回与 bands 中任一分段相同且未过期的指纹
+func (db *PostgresDB) FindDedupFingerprints(ctx context.Context, scope string, bands []string) ([]DedupFingerprint, error) {
+	if len(bands) == 0 {
+		return nil, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT DISTINCT fingerprint, COALESCE(record_id, '') FROM dedup_fingerprints
+		WHERE scope = $1 AND band = ANY($2) AND (expires_at IS NULL OR expires_at > NOW())
+	`, scope, pq.Array(bands))
+	if err != nil {
+		return nil, fmt.Errorf("查询指纹失败: %w", err)
+	}
+	defer rows.Close()
+
+	var fingerprints []DedupFingerprint
+	for rows.Next() {
+		var hash int64
+		var fp DedupFingerprint
+		if err := rows.Scan(&hash, &fp.RecordID); err != nil {
+			return nil, fmt.Errorf("扫描指纹失败: %w", err)
+		}
+		fp.Hash = uint64(hash)
+		fingerprints = append(fingerprints, fp)
+	}
+	return fingerprints, rows.Err()
+}
+
+// AddDedupFingerprints 按分段记录指纹，每个分段一行；ttl 为 0 时永久保留
+// 同时清理该范围内已过期的指纹
+func (db *PostgresDB) AddDedupFingerprints(ctx context.Context, scope string, fingerprints []DedupFingerprint, ttl time.Duration) error {
+	var bands, ids []string
+	var hashes []int64
+	for _, fp := range fingerprints {
+		for _, band := range fp.Bands {
+			bands = append(bands, band)
+			hashes = append(hashes, int64(fp.Hash))
+			ids = append(ids, fp.RecordID)
+		}
+	}
+	if len(bands) == 0 {
+		return nil
+	}
+
+	var expiresAt interface{}
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO dedup_fingerprints (scope, band, fingerprint, record_id, expires_at)
+		SELECT $1, b, f, r, $5 FROM unnest($2::text[], $3::bigint[], $4::text[]) AS t(b, f, r)
+		ON CONFLICT (scope, band, fingerprint) DO UPDATE
+		SET record_id = EXCLUDED.record_id, expires_at = EXCLUDED.expires_at
+	`, scope, pq.Array(bands), pq.Array(hashes), pq.Array(ids), expiresAt); err != nil {
+		return fmt.Errorf("写入指纹失败: %w", err)
+	}
+
+	if _, err := db.ExecContext(ctx, `
+		DELETE FROM dedup_fingerprints WHERE scope = $1 AND expires_at < NOW()
+	`, scope); err != nil {
+		return fmt.Errorf("清理过期指纹失败: %w", err)
+	}
+	return nil
+}
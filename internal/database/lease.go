@@ -0,0 +1,214 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/schedule"
+	"github.com/lib/pq"
+)
+
+// ClaimTasks 按路由条件领取最多 limit 个到期任务，并为每个任务写入 lease 时长的租约
+// 任务行使用 FOR UPDATE SKIP LOCKED 锁定，多个 Worker 同时领取时互不阻塞；
+// 租约按 task_id 唯一，写入时只覆盖已过期的租约，持有有效租约的任务不会被重复领取。
+// 候选任务按队列优先级、任务优先级排序后由 schedule.Pick 在租户之间公平挑选，并遵守队列的并发上限
+func (db *PostgresDB) ClaimTasks(ctx context.Context, filter ClaimFilter, limit int, lease time.Duration) ([]models.CollectionTask, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	workerType := filter.WorkerType
+	if workerType == "all" {
+		workerType = ""
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	free, tenantRunning, err := queueCapacity(ctx, tx, filter.Queues)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT COALESCE(q.priority, 0), `+taskColumns+`
+		FROM collection_tasks t
+		LEFT JOIN task_queues q ON q.name = t.queue
+		WHERE t.status = 'enabled'
+		AND ($1 = '' OR t.type = $1)
+		AND (t.next_run_time IS NULL OR t.next_run_time <= NOW())
+		AND (cardinality($2::text[]) = 0 OR COALESCE(t.queue, 'default') = ANY($2))
+		AND NOT (COALESCE(t.queue, 'default') = ANY($3::text[]))
+		AND (t.selector IS NULL OR t.selector <@ $4::jsonb)
+		AND NOT EXISTS (SELECT 1 FROM task_leases l WHERE l.task_id = t.id AND l.expires_at > NOW())
+		ORDER BY COALESCE(q.priority, 0) DESC, COALESCE(t.priority, 0) DESC, t.next_run_time ASC NULLS FIRST
+		LIMIT $5
+		FOR UPDATE OF t SKIP LOCKED
+	`, workerType, pq.Array(filter.Queues), pq.Array(fullQueues(free)), labelsJSON(filter.Labels), limit*claimCandidateFactor)
+	if err != nil {
+		return nil, fmt.Errorf("查询待执行任务失败: %w", err)
+	}
+
+	tasks := make(map[int64]models.CollectionTask)
+	var candidates []schedule.Candidate
+	for rows.Next() {
+		var task models.CollectionTask
+		var queuePriority int
+		if err := scanTask(rows, &task, &queuePriority); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("扫描任务数据失败: %w", err)
+		}
+		tasks[task.ID] = task
+		candidates = append(candidates, taskCandidate(task, queuePriority))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("查询待执行任务失败: %w", err)
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	picked := schedule.Pick(candidates, limit, free, tenantRunning)
+	ids := make([]int64, len(picked))
+	for i, c := range picked {
+		ids[i] = c.ID
+	}
+
+	acquired, err := acquireTaskLeases(ctx, tx, ids, filter.WorkerPod, lease)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %w", err)
+	}
+
+	var claimed []models.CollectionTask
+	for _, id := range ids {
+		if acquired[id] {
+			claimed = append(claimed, tasks[id])
+		}
+	}
+	return claimed, nil
+}
+
+// taskCandidate 将任务转换为公平调度的候选项
+func taskCandidate(task models.CollectionTask, queuePriority int) schedule.Candidate {
+	c := schedule.Candidate{
+		ID:            task.ID,
+		Queue:         task.Queue,
+		Tenant:        task.Tenant,
+		QueuePriority: queuePriority,
+		Priority:      task.Priority,
+	}
+	if task.NextRunTime != nil {
+		c.Due = *task.NextRunTime
+	}
+	return c
+}
+
+// acquireTaskLeases 在事务中为任务写入租约，返回成功获得租约的任务 ID
+// 查询快照可能早于其他 Worker 提交的租约，以写入结果为准；ids 不能重复
+func acquireTaskLeases(ctx context.Context, tx *sql.Tx, ids []int64, workerPod string, lease time.Duration) (map[int64]bool, error) {
+	rows, err := tx.QueryContext(ctx, `
+		INSERT INTO task_leases (task_id, worker_pod, acquired_at, heartbeat_at, expires_at)
+		SELECT id, $2, NOW(), NOW(), NOW() + make_interval(secs => $3) FROM unnest($1::bigint[]) AS id
+		ON CONFLICT (task_id) DO UPDATE
+		SET worker_pod = EXCLUDED.worker_pod, acquired_at = EXCLUDED.acquired_at,
+		    heartbeat_at = EXCLUDED.heartbeat_at, expires_at = EXCLUDED.expires_at
+		WHERE task_leases.expires_at <= NOW()
+		RETURNING task_id
+	`, pq.Array(ids), workerPod, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("写入任务租约失败: %w", err)
+	}
+	defer rows.Close()
+
+	acquired := make(map[int64]bool, len(ids))
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("扫描任务租约失败: %w", err)
+		}
+		acquired[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("写入任务租约失败: %w", err)
+	}
+	return acquired, nil
+}
+
+// RenewTaskLeases 为 workerPod 持有的租约续期，返回续期成功的任务 ID
+// 未返回的任务说明租约已过期被回收或被其他 Worker 领取
+func (db *PostgresDB) RenewTaskLeases(ctx context.Context, workerPod string, taskIDs []int64, lease time.Duration) (map[int64]bool, error) {
+	renewed := make(map[int64]bool, len(taskIDs))
+	if len(taskIDs) == 0 {
+		return renewed, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		UPDATE task_leases
+		SET heartbeat_at = NOW(), expires_at = NOW() + make_interval(secs => $3)
+		WHERE worker_pod = $1 AND task_id = ANY($2)
+		RETURNING task_id
+	`, workerPod, pq.Array(taskIDs), lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("续期任务租约失败: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("扫描任务租约失败: %w", err)
+		}
+		renewed[id] = true
+	}
+	return renewed, rows.Err()
+}
+
+// ReleaseTaskLease 释放 workerPod 持有的任务租约
+func (db *PostgresDB) ReleaseTaskLease(ctx context.Context, taskID int64, workerPod string) error {
+	if _, err := db.ExecContext(ctx, `
+		DELETE FROM task_leases WHERE task_id = $1 AND worker_pod = $2
+	`, taskID, workerPod); err != nil {
+		return fmt.Errorf("释放任务租约失败: %w", err)
+	}
+	return nil
+}
+
+// RecoverExpiredLeases 回收已过期的租约（持有的 Worker 崩溃或失联），
+// 租约期间仍处于 running / cancelling 状态的执行记录标记为 failed（补数窗口的执行由窗口租约管理），返回回收的租约数和中断的执行数
+func (db *PostgresDB) RecoverExpiredLeases(ctx context.Context) (leases int, executions int, err error) {
+	err = db.QueryRowContext(ctx, `
+		WITH expired AS (
+			DELETE FROM task_leases
+			WHERE task_id IN (
+				SELECT task_id FROM task_leases
+				WHERE expires_at <= NOW()
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING task_id, worker_pod, acquired_at
+		), interrupted AS (
+			UPDATE task_executions e
+			SET status = $1, end_time = NOW(),
+			    error_message = 'Worker ' || x.worker_pod || ' 租约过期，执行中断'
+			FROM expired x
+			WHERE e.task_id = x.task_id AND e.worker_pod = x.worker_pod
+			AND e.status IN ($2, $3) AND e.start_time >= x.acquired_at
+			AND NOT EXISTS (SELECT 1 FROM backfill_windows w WHERE w.execution_id = e.id)
+			RETURNING e.id
+		)
+		SELECT (SELECT COUNT(*) FROM expired), (SELECT COUNT(*) FROM interrupted)
+	`, models.ExecutionStatusFailed, models.ExecutionStatusRunning, models.ExecutionStatusCancelling).Scan(&leases, &executions)
+	if err != nil {
+		return 0, 0, fmt.Errorf("回收过期租约失败: %w", err)
+	}
+	return leases, executions, nil
+}
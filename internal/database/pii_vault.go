@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// PIIVaultEntry 令牌库中的一条记录
+type PIIVaultEntry struct {
+	Token      string
+	Type       string
+	ValueHash  string // HMAC(类型:原值)，相同的值复用同一个令牌
+	Ciphertext string // 加密后的原值
+}
+
+// TokenizePII 写入令牌库，value_hash 已存在时保留原有令牌
+// 返回 value_hash 到令牌的映射（包括已存在的令牌）
+func (db *PostgresDB) TokenizePII(ctx context.Context, entries []PIIVaultEntry) (map[string]string, error) {
+	tokens := make(map[string]string)
+	if len(entries) == 0 {
+		return tokens, nil
+	}
+
+	var tokenList, types, hashes, ciphertexts []string
+	for _, e := range entries {
+		tokenList = append(tokenList, e.Token)
+		types = append(types, e.Type)
+		hashes = append(hashes, e.ValueHash)
+		ciphertexts = append(ciphertexts, e.Ciphertext)
+	}
+
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO pii_vault (token, pii_type, value_hash, ciphertext)
+		SELECT * FROM unnest($1::text[], $2::text[], $3::text[], $4::text[])
+		ON CONFLICT (value_hash) DO NOTHING
+	`, pq.Array(tokenList), pq.Array(types), pq.Array(hashes), pq.Array(ciphertexts)); err != nil {
+		return nil, fmt.Errorf("写入令牌库失败: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT value_hash, token FROM pii_vault WHERE value_hash = ANY($1)
+	`, pq.Array(hashes))
+	if err != nil {
+		return nil, fmt.Errorf("查询令牌失败: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash, token string
+		if err := rows.Scan(&hash, &token); err != nil {
+			return nil, fmt.Errorf("扫描令牌失败: %w", err)
+		}
+		tokens[hash] = token
+	}
+	return tokens, rows.Err()
+}
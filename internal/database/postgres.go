@@ -11,8 +11,7 @@ import (
 
 // NewPostgresDB 创建PostgreSQL数据库连接
 func NewPostgresDB(cfg config.PostgreSQLConfig) (*sql.DB, error) {
-	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Database, cfg.SSLMode)
+	dsn := postgresDSN(cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Database, cfg.SSLMode)
 
 	db, err := sql.Open("postgres", dsn)
 	if err != nil {
@@ -37,3 +36,9 @@ func NewPostgresDB(cfg config.PostgreSQLConfig) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// postgresDSN 构建 PostgreSQL 连接字符串
+func postgresDSN(host string, port int, user, password, database, sslMode string) string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		host, port, user, password, database, sslMode)
+}
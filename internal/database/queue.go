@@ -0,0 +1,174 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/lib/pq"
+)
+
+// ClaimFilter Worker 领取任务的路由条件
+type ClaimFilter struct {
+	WorkerType string
+	WorkerPod  string
+	Queues     []string          // 只领取这些队列的任务，为空时领取所有队列
+	Labels     map[string]string // Worker 标签，任务的 selector 必须是它的子集
+}
+
+// claimCandidateFactor 领取时查询的候选任务数为槽位数的倍数，供公平调度挑选
+const claimCandidateFactor = 5
+
+// taskColumns 采集任务字段（表别名 t），与 scanTask 的扫描顺序对应
+const taskColumns = `t.id, t.name, t.type, t.status, t.data_source_id, t.cron, t.next_run_time, t.replicas,
+		       t.execution_timeout, t.max_retries, t.config, t.created_at, t.updated_at,
+		       COALESCE(t.queue, 'default'), COALESCE(t.priority, 0), COALESCE(t.tenant, 'default'), t.selector,
+		       COALESCE(t.timezone, ''), COALESCE(t.catch_up, 'once'), COALESCE(t.jitter_seconds, 0), COALESCE(t.calendar, ''),
+		       t.retry_policy`
+
+// scanTask 按 taskColumns 扫描一行任务，prefix 为查询中位于任务字段之前的列
+func scanTask(scanner interface{ Scan(...interface{}) error }, task *models.CollectionTask, prefix ...interface{}) error {
+	var selector, retryPolicy []byte
+	dest := append(prefix,
+		&task.ID, &task.Name, &task.Type, &task.Status, &task.DataSourceID, &task.Cron,
+		&task.NextRunTime, &task.Replicas, &task.ExecutionTimeout,
+		&task.MaxRetries, &task.Config, &task.CreatedAt, &task.UpdatedAt,
+		&task.Queue, &task.Priority, &task.Tenant, &selector,
+		&task.Timezone, &task.CatchUp, &task.JitterSeconds, &task.Calendar,
+		&retryPolicy,
+	)
+	if err := scanner.Scan(dest...); err != nil {
+		return err
+	}
+	if len(selector) > 0 {
+		if err := json.Unmarshal(selector, &task.Selector); err != nil {
+			return fmt.Errorf("解析任务 %d 的 selector 失败: %w", task.ID, err)
+		}
+	}
+	if len(retryPolicy) > 0 {
+		if err := json.Unmarshal(retryPolicy, &task.RetryPolicy); err != nil {
+			return fmt.Errorf("解析任务 %d 的 retry_policy 失败: %w", task.ID, err)
+		}
+	}
+	return nil
+}
+
+// labelsJSON 将 Worker 标签编码为 JSONB 参数，用于 selector <@ labels 判断
+func labelsJSON(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "{}"
+	}
+	data, _ := json.Marshal(labels)
+	return string(data)
+}
+
+// queueCapacity 锁定 Worker 消费的、设置了并发上限的队列，返回这些队列剩余的并发数和各租户正在执行的任务数
+// 队列行在事务结束前保持锁定，多个 Worker 同时领取同一受限队列时依次进行，不会超过上限
+func queueCapacity(ctx context.Context, tx *sql.Tx, queues []string) (free map[string]int, tenantRunning map[string]int, err error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT name, max_concurrency FROM task_queues
+		WHERE max_concurrency > 0 AND (cardinality($1::text[]) = 0 OR name = ANY($1))
+		ORDER BY name
+		FOR UPDATE
+	`, pq.Array(queues))
+	if err != nil {
+		return nil, nil, fmt.Errorf("锁定任务队列失败: %w", err)
+	}
+	free = make(map[string]int)
+	for rows.Next() {
+		var name string
+		var limit int
+		if err := rows.Scan(&name, &limit); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("扫描任务队列失败: %w", err)
+		}
+		free[name] = limit
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("锁定任务队列失败: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		SELECT COALESCE(t.queue, 'default'), COALESCE(t.tenant, 'default'), COUNT(*)
+		FROM task_leases l
+		JOIN collection_tasks t ON t.id = l.task_id
+		WHERE l.expires_at > NOW()
+		GROUP BY 1, 2
+	`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("统计正在执行的任务失败: %w", err)
+	}
+	defer rows.Close()
+
+	tenantRunning = make(map[string]int)
+	for rows.Next() {
+		var queue, tenant string
+		var n int
+		if err := rows.Scan(&queue, &tenant, &n); err != nil {
+			return nil, nil, fmt.Errorf("扫描正在执行的任务失败: %w", err)
+		}
+		if _, capped := free[queue]; capped {
+			free[queue] -= n
+		}
+		tenantRunning[tenant] += n
+	}
+	return free, tenantRunning, rows.Err()
+}
+
+// fullQueues 返回没有剩余并发数的队列
+func fullQueues(free map[string]int) []string {
+	var full []string
+	for queue, n := range free {
+		if n <= 0 {
+			full = append(full, queue)
+		}
+	}
+	return full
+}
+
+// QueueStats 统计各队列已到期、尚未被领取的任务数和等待最久的时长，以及正在执行的任务数
+func (db *PostgresDB) QueueStats(ctx context.Context) ([]models.QueueStats, error) {
+	rows, err := db.QueryContext(ctx, `
+		WITH pending AS (
+			SELECT COALESCE(t.queue, 'default') AS queue, COUNT(*) AS pending,
+			       COALESCE(EXTRACT(EPOCH FROM NOW() - MIN(t.next_run_time)), 0) AS wait_seconds
+			FROM collection_tasks t
+			WHERE t.status = 'enabled'
+			AND (t.next_run_time IS NULL OR t.next_run_time <= NOW())
+			AND NOT EXISTS (SELECT 1 FROM task_leases l WHERE l.task_id = t.id AND l.expires_at > NOW())
+			GROUP BY 1
+		), running AS (
+			SELECT COALESCE(t.queue, 'default') AS queue, COUNT(*) AS running
+			FROM task_leases l
+			JOIN collection_tasks t ON t.id = l.task_id
+			WHERE l.expires_at > NOW()
+			GROUP BY 1
+		), queues AS (
+			SELECT name AS queue FROM task_queues
+			UNION SELECT queue FROM pending
+			UNION SELECT queue FROM running
+		)
+		SELECT q.queue, COALESCE(p.pending, 0), COALESCE(r.running, 0), COALESCE(p.wait_seconds, 0)
+		FROM queues q
+		LEFT JOIN pending p ON p.queue = q.queue
+		LEFT JOIN running r ON r.queue = q.queue
+		ORDER BY q.queue
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("统计任务队列失败: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []models.QueueStats
+	for rows.Next() {
+		var s models.QueueStats
+		if err := rows.Scan(&s.Queue, &s.Pending, &s.Running, &s.WaitSeconds); err != nil {
+			return nil, fmt.Errorf("扫描任务队列统计失败: %w", err)
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// QueryReference 在只读事务中执行参考数据查询，返回每行列名到值的映射
+// 查询超过 maxRows 行时返回错误，避免把大表整体加载到内存
+func (db *PostgresDB) QueryReference(ctx context.Context, query string, maxRows int) ([]map[string]interface{}, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("开始只读事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("执行参考数据查询失败: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("读取查询列失败: %w", err)
+	}
+
+	var result []map[string]interface{}
+	for rows.Next() {
+		if len(result) >= maxRows {
+			return nil, fmt.Errorf("参考数据超过 %d 行", maxRows)
+		}
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("扫描参考数据失败: %w", err)
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				row[column] = string(b)
+			} else {
+				row[column] = values[i]
+			}
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
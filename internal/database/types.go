@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"context"
+	"time"
 
 	"github.com/datafusion/worker/internal/config"
 	"github.com/datafusion/worker/internal/models"
@@ -46,83 +47,59 @@ func ParseTaskConfig(configJSON string) (*models.TaskConfig, error) {
 	return &config, nil
 }
 
-// GetPendingTasks 获取待执行的任务
+// GetPendingTasks 获取待执行的任务，按队列优先级、任务优先级、下次执行时间排序
 func (db *PostgresDB) GetPendingTasks(workerType string) ([]models.CollectionTask, error) {
-	var rows *sql.Rows
-	var err error
-
-	if workerType == "" || workerType == "all" {
-		query := `
-			SELECT id, name, type, status, data_source_id, cron, next_run_time, replicas,
-			       execution_timeout, max_retries, config, created_at, updated_at
-			FROM collection_tasks
-			WHERE status = 'enabled'
-			AND (next_run_time IS NULL OR next_run_time <= NOW())
-			ORDER BY next_run_time ASC
-			LIMIT 10
-		`
-		rows, err = db.Query(query)
-	} else {
-		query := `
-			SELECT id, name, type, status, data_source_id, cron, next_run_time, replicas,
-			       execution_timeout, max_retries, config, created_at, updated_at
-			FROM collection_tasks
-			WHERE status = 'enabled'
-			AND type = $1
-			AND (next_run_time IS NULL OR next_run_time <= NOW())
-			ORDER BY next_run_time ASC
-			LIMIT 10
-		`
-		rows, err = db.Query(query, workerType)
+	if workerType == "all" {
+		workerType = ""
 	}
+
+	rows, err := db.Query(`
+		SELECT `+taskColumns+`
+		FROM collection_tasks t
+		LEFT JOIN task_queues q ON q.name = t.queue
+		WHERE t.status = 'enabled'
+		AND ($1 = '' OR t.type = $1)
+		AND (t.next_run_time IS NULL OR t.next_run_time <= NOW())
+		ORDER BY COALESCE(q.priority, 0) DESC, COALESCE(t.priority, 0) DESC, t.next_run_time ASC
+		LIMIT 10
+	`, workerType)
 	if err != nil {
 		return nil, fmt.Errorf("查询待执行任务失败: %w", err)
 	}
 	defer rows.Close()
-	
+
 	var tasks []models.CollectionTask
 	for rows.Next() {
 		var task models.CollectionTask
-		err := rows.Scan(
-			&task.ID, &task.Name, &task.Type, &task.Status, &task.DataSourceID, &task.Cron,
-			&task.NextRunTime, &task.Replicas, &task.ExecutionTimeout,
-			&task.MaxRetries, &task.Config, &task.CreatedAt, &task.UpdatedAt,
-		)
-		if err != nil {
+		if err := scanTask(rows, &task); err != nil {
 			return nil, fmt.Errorf("扫描任务数据失败: %w", err)
 		}
 		tasks = append(tasks, task)
 	}
-	
+
 	return tasks, nil
 }
 
-// LockTask 锁定任务
-func (db *PostgresDB) LockTask(taskID int64, workerPod string) error {
-	query := `
-		UPDATE collection_tasks 
-		SET next_run_time = NOW() + INTERVAL '1 hour'
-		WHERE id = $1 AND status = 'enabled'
-	`
-	
-	_, err := db.Exec(query, taskID)
-	if err != nil {
-		return fmt.Errorf("锁定任务失败: %w", err)
+// GetTask 按 ID 获取任务
+func (db *PostgresDB) GetTask(ctx context.Context, taskID int64) (*models.CollectionTask, error) {
+	var task models.CollectionTask
+	row := db.QueryRowContext(ctx, `SELECT `+taskColumns+` FROM collection_tasks t WHERE t.id = $1`, taskID)
+	if err := scanTask(row, &task); err != nil {
+		return nil, fmt.Errorf("查询任务失败: %w", err)
 	}
-	
-	return nil
+	return &task, nil
 }
 
 // CreateExecution 创建执行记录
 func (db *PostgresDB) CreateExecution(taskID int64, workerPod string) (int64, error) {
 	query := `
 		INSERT INTO task_executions (task_id, worker_pod, status, start_time)
-		VALUES ($1, $2, 'running', NOW())
+		VALUES ($1, $2, $3, NOW())
 		RETURNING id
 	`
 	
 	var executionID int64
-	err := db.QueryRow(query, taskID, workerPod).Scan(&executionID)
+	err := db.QueryRow(query, taskID, workerPod, models.ExecutionStatusRunning).Scan(&executionID)
 	if err != nil {
 		return 0, fmt.Errorf("创建执行记录失败: %w", err)
 	}
@@ -130,43 +107,6 @@ func (db *PostgresDB) CreateExecution(taskID int64, workerPod string) (int64, er
 	return executionID, nil
 }
 
-// TryLockTask 尝试锁定任务
-func (db *PostgresDB) TryLockTask(taskID int64, workerPod string) (bool, error) {
-	query := `
-		UPDATE collection_tasks 
-		SET next_run_time = NOW() + INTERVAL '1 hour'
-		WHERE id = $1 AND status = 'enabled' AND (next_run_time IS NULL OR next_run_time <= NOW())
-	`
-	
-	result, err := db.Exec(query, taskID)
-	if err != nil {
-		return false, fmt.Errorf("锁定任务失败: %w", err)
-	}
-	
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return false, fmt.Errorf("获取影响行数失败: %w", err)
-	}
-	
-	return rowsAffected > 0, nil
-}
-
-// UnlockTask 解锁任务
-func (db *PostgresDB) UnlockTask(taskID int64) error {
-	query := `
-		UPDATE collection_tasks 
-		SET next_run_time = NOW()
-		WHERE id = $1
-	`
-	
-	_, err := db.Exec(query, taskID)
-	if err != nil {
-		return fmt.Errorf("解锁任务失败: %w", err)
-	}
-	
-	return nil
-}
-
 // ClearTaskNextRunTime 清空任务下次执行时间（一次性任务执行后调用）
 func (db *PostgresDB) ClearTaskNextRunTime(taskID int64) error {
 	_, err := db.Exec("UPDATE collection_tasks SET next_run_time = NULL WHERE id = $1", taskID)
@@ -185,15 +125,15 @@ func (db *PostgresDB) GetDataSourceConfig(dataSourceID int64) (dsType string, co
 	return dsType, config, nil
 }
 
-// UpdateTaskNextRunTime 更新任务下次执行时间
-func (db *PostgresDB) UpdateTaskNextRunTime(taskID int64, nextRunTime string) error {
+// UpdateTaskNextRunTime 更新任务下次执行时间，按 UTC 写入
+func (db *PostgresDB) UpdateTaskNextRunTime(taskID int64, nextRunTime time.Time) error {
 	query := `
 		UPDATE collection_tasks 
 		SET next_run_time = $1
 		WHERE id = $2
 	`
 	
-	_, err := db.Exec(query, nextRunTime, taskID)
+	_, err := db.Exec(query, nextRunTime.UTC(), taskID)
 	if err != nil {
 		return fmt.Errorf("更新任务执行时间失败: %w", err)
 	}
@@ -201,9 +141,76 @@ func (db *PostgresDB) UpdateTaskNextRunTime(taskID int64, nextRunTime string) er
 	return nil
 }
 
-// UpdateExecutionWithContext 更新执行记录（兼容旧接口）
+// UpdateExecution 更新执行记录（状态、记录数、错误信息、拒绝记录数、校验结果、PII 处理结果、清洗规则版本及各存储目标结果）
 func (db *PostgresDB) UpdateExecution(ctx context.Context, execution *models.TaskExecution) error {
-	return db.UpdateExecutionStatus(execution.ID, execution.Status, execution.RecordsCollected, execution.ErrorMessage)
+	if err := db.UpdateExecutionStatus(execution.ID, execution.Status, execution.RecordsCollected, execution.ErrorMessage); err != nil {
+		return err
+	}
+
+	if execution.RecordsRejected > 0 {
+		_, err := db.ExecContext(ctx, "UPDATE task_executions SET records_rejected = $1 WHERE id = $2", execution.RecordsRejected, execution.ID)
+		if err != nil {
+			return fmt.Errorf("更新拒绝记录数失败: %w", err)
+		}
+	}
+
+	if len(execution.ValidationResults) > 0 {
+		results, err := json.Marshal(execution.ValidationResults)
+		if err != nil {
+			return fmt.Errorf("序列化校验结果失败: %w", err)
+		}
+		_, err = db.ExecContext(ctx, "UPDATE task_executions SET validation_results = $1 WHERE id = $2", string(results), execution.ID)
+		if err != nil {
+			return fmt.Errorf("更新校验结果失败: %w", err)
+		}
+	}
+
+	if len(execution.PIIResults) > 0 {
+		results, err := json.Marshal(execution.PIIResults)
+		if err != nil {
+			return fmt.Errorf("序列化 PII 处理结果失败: %w", err)
+		}
+		_, err = db.ExecContext(ctx, "UPDATE task_executions SET pii_results = $1 WHERE id = $2", string(results), execution.ID)
+		if err != nil {
+			return fmt.Errorf("更新 PII 处理结果失败: %w", err)
+		}
+	}
+
+	if len(execution.CleaningRules) > 0 {
+		revisions, err := json.Marshal(execution.CleaningRules)
+		if err != nil {
+			return fmt.Errorf("序列化清洗规则版本失败: %w", err)
+		}
+		_, err = db.ExecContext(ctx, "UPDATE task_executions SET cleaning_rule_versions = $1 WHERE id = $2", string(revisions), execution.ID)
+		if err != nil {
+			return fmt.Errorf("更新清洗规则版本失败: %w", err)
+		}
+	}
+
+	if len(execution.Attempts) > 0 {
+		attempts, err := json.Marshal(execution.Attempts)
+		if err != nil {
+			return fmt.Errorf("序列化尝试记录失败: %w", err)
+		}
+		_, err = db.ExecContext(ctx, "UPDATE task_executions SET attempts = $1 WHERE id = $2", string(attempts), execution.ID)
+		if err != nil {
+			return fmt.Errorf("更新尝试记录失败: %w", err)
+		}
+	}
+
+	if len(execution.StorageResults) == 0 {
+		return nil
+	}
+
+	results, err := json.Marshal(execution.StorageResults)
+	if err != nil {
+		return fmt.Errorf("序列化存储结果失败: %w", err)
+	}
+	_, err = db.ExecContext(ctx, "UPDATE task_executions SET storage_results = $1 WHERE id = $2", string(results), execution.ID)
+	if err != nil {
+		return fmt.Errorf("更新存储结果失败: %w", err)
+	}
+	return nil
 }
 
 // UpdateExecutionStatus 更新执行记录状态
@@ -0,0 +1,456 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/schedule"
+	"github.com/datafusion/worker/internal/workflow"
+	"github.com/lib/pq"
+)
+
+// ClaimedWorkflowNode Worker 领取的工作流节点
+type ClaimedWorkflowNode struct {
+	Node       models.WorkflowRunNode
+	Task       models.CollectionTask
+	Definition models.WorkflowDefinition // 运行开始时的工作流定义
+}
+
+// StartWorkflowRun 创建工作流运行记录，没有上游的节点进入 queued 等待 Worker 领取
+func (db *PostgresDB) StartWorkflowRun(ctx context.Context, workflowID int64, trigger string) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	var data []byte
+	if err := tx.QueryRowContext(ctx, "SELECT definition FROM workflows WHERE id = $1", workflowID).Scan(&data); err != nil {
+		return 0, fmt.Errorf("查询工作流失败: %w", err)
+	}
+	var def models.WorkflowDefinition
+	if err := json.Unmarshal(data, &def); err != nil {
+		return 0, fmt.Errorf("解析工作流定义失败: %w", err)
+	}
+
+	runID, err := startWorkflowRun(ctx, tx, workflowID, def, trigger)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return runID, nil
+}
+
+// ScheduleDueWorkflows 为到期的定时工作流创建运行记录并更新下次执行时间，返回创建的运行 ID
+// 工作流行使用 FOR UPDATE SKIP LOCKED 锁定，多个 Worker 不会重复触发
+func (db *PostgresDB) ScheduleDueWorkflows(ctx context.Context, limit int) ([]int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, name, cron, definition FROM workflows
+		WHERE status = 'enabled' AND COALESCE(cron, '') <> ''
+		AND (next_run_time IS NULL OR next_run_time <= NOW())
+		ORDER BY next_run_time ASC NULLS FIRST
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询到期工作流失败: %w", err)
+	}
+
+	type dueWorkflow struct {
+		id   int64
+		name string
+		cron string
+		def  models.WorkflowDefinition
+	}
+	var due []dueWorkflow
+	for rows.Next() {
+		var w dueWorkflow
+		var data []byte
+		if err := rows.Scan(&w.id, &w.name, &w.cron, &data); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("扫描工作流失败: %w", err)
+		}
+		if err := json.Unmarshal(data, &w.def); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("解析工作流 %s 的定义失败: %w", w.name, err)
+		}
+		due = append(due, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("查询到期工作流失败: %w", err)
+	}
+
+	var runIDs []int64
+	for _, w := range due {
+		next, err := schedule.NextRun(w.cron, time.Now())
+		if err != nil {
+			// 表达式无效时停止调度，避免每轮重复触发
+			log.Printf("工作流 %s 的 Cron 表达式无效，已停止定时调度: %v", w.name, err)
+			if _, err := tx.ExecContext(ctx, "UPDATE workflows SET status = 'disabled' WHERE id = $1", w.id); err != nil {
+				return nil, fmt.Errorf("禁用工作流失败: %w", err)
+			}
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE workflows SET next_run_time = $2 WHERE id = $1", w.id, next); err != nil {
+			return nil, fmt.Errorf("更新工作流执行时间失败: %w", err)
+		}
+		runID, err := startWorkflowRun(ctx, tx, w.id, w.def, "cron")
+		if err != nil {
+			return nil, err
+		}
+		runIDs = append(runIDs, runID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return runIDs, nil
+}
+
+// startWorkflowRun 在事务中创建运行记录和节点状态，并推进可以执行的节点
+func startWorkflowRun(ctx context.Context, tx *sql.Tx, workflowID int64, def models.WorkflowDefinition, trigger string) (int64, error) {
+	data, err := json.Marshal(def)
+	if err != nil {
+		return 0, fmt.Errorf("序列化工作流定义失败: %w", err)
+	}
+
+	var runID int64
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO workflow_runs (workflow_id, status, trigger, definition, start_time)
+		VALUES ($1, $2, $3, $4, NOW())
+		RETURNING id
+	`, workflowID, models.WorkflowRunRunning, trigger, data).Scan(&runID); err != nil {
+		return 0, fmt.Errorf("创建工作流运行记录失败: %w", err)
+	}
+
+	names := make([]string, len(def.Nodes))
+	taskIDs := make([]int64, len(def.Nodes))
+	for i, node := range def.Nodes {
+		names[i] = node.Name
+		taskIDs[i] = node.TaskID
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO workflow_run_nodes (run_id, node, task_id, status)
+		SELECT $1, n.node, n.task_id, $4 FROM unnest($2::text[], $3::bigint[]) AS n(node, task_id)
+	`, runID, pq.Array(names), pq.Array(taskIDs), models.WorkflowNodePending); err != nil {
+		return 0, fmt.Errorf("创建工作流节点状态失败: %w", err)
+	}
+
+	if err := advanceWorkflowRun(ctx, tx, runID, def); err != nil {
+		return 0, err
+	}
+	return runID, nil
+}
+
+// advanceWorkflowRun 根据节点状态推进工作流：上游结束的节点进入 queued 或被跳过，所有节点结束后更新运行状态
+func advanceWorkflowRun(ctx context.Context, tx *sql.Tx, runID int64, def models.WorkflowDefinition) error {
+	rows, err := tx.QueryContext(ctx, "SELECT node, status FROM workflow_run_nodes WHERE run_id = $1", runID)
+	if err != nil {
+		return fmt.Errorf("查询工作流节点状态失败: %w", err)
+	}
+	statuses := make(map[string]string)
+	for rows.Next() {
+		var node, status string
+		if err := rows.Scan(&node, &status); err != nil {
+			rows.Close()
+			return fmt.Errorf("扫描工作流节点状态失败: %w", err)
+		}
+		statuses[node] = status
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("查询工作流节点状态失败: %w", err)
+	}
+
+	queue, skip := workflow.Advance(def, statuses)
+	if len(queue) > 0 {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE workflow_run_nodes SET status = $3 WHERE run_id = $1 AND node = ANY($2)
+		`, runID, pq.Array(queue), models.WorkflowNodeQueued); err != nil {
+			return fmt.Errorf("更新工作流节点状态失败: %w", err)
+		}
+	}
+	if len(skip) > 0 {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE workflow_run_nodes SET status = $3, finished_at = NOW() WHERE run_id = $1 AND node = ANY($2)
+		`, runID, pq.Array(skip), models.WorkflowNodeSkipped); err != nil {
+			return fmt.Errorf("更新工作流节点状态失败: %w", err)
+		}
+	}
+	for _, node := range queue {
+		statuses[node] = models.WorkflowNodeQueued
+	}
+	for _, node := range skip {
+		statuses[node] = models.WorkflowNodeSkipped
+	}
+
+	if status := workflow.RunStatus(def, statuses); status != models.WorkflowRunRunning {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE workflow_runs SET status = $2, end_time = NOW() WHERE id = $1
+		`, runID, status); err != nil {
+			return fmt.Errorf("更新工作流运行状态失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// ClaimWorkflowNodes 按路由条件领取最多 limit 个 queued 状态的工作流节点并为节点的任务写入租约
+// 同一任务的租约同时只有一个持有者，任务正在执行（定时执行或其他工作流）时节点继续等待；
+// 节点与普通任务一样遵守任务的队列、selector 和队列并发上限
+func (db *PostgresDB) ClaimWorkflowNodes(ctx context.Context, filter ClaimFilter, limit int, lease time.Duration) ([]ClaimedWorkflowNode, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	workerType := filter.WorkerType
+	if workerType == "all" {
+		workerType = ""
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	free, tenantRunning, err := queueCapacity(ctx, tx, filter.Queues)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT n.id, n.run_id, n.node, n.task_id, r.definition, COALESCE(q.priority, 0), r.start_time,
+		       `+taskColumns+`
+		FROM workflow_run_nodes n
+		JOIN workflow_runs r ON r.id = n.run_id
+		JOIN collection_tasks t ON t.id = n.task_id
+		LEFT JOIN task_queues q ON q.name = t.queue
+		WHERE n.status = $1
+		AND ($2 = '' OR t.type = $2)
+		AND (cardinality($3::text[]) = 0 OR COALESCE(t.queue, 'default') = ANY($3))
+		AND NOT (COALESCE(t.queue, 'default') = ANY($4::text[]))
+		AND (t.selector IS NULL OR t.selector <@ $5::jsonb)
+		AND NOT EXISTS (SELECT 1 FROM task_leases l WHERE l.task_id = n.task_id AND l.expires_at > NOW())
+		ORDER BY n.id
+		LIMIT $6
+		FOR UPDATE OF n SKIP LOCKED
+	`, models.WorkflowNodeQueued, workerType, pq.Array(filter.Queues), pq.Array(fullQueues(free)),
+		labelsJSON(filter.Labels), limit*claimCandidateFactor)
+	if err != nil {
+		return nil, fmt.Errorf("查询待执行的工作流节点失败: %w", err)
+	}
+
+	nodes := make(map[int64]ClaimedWorkflowNode)
+	var candidates []schedule.Candidate
+	seen := make(map[int64]bool)
+	for rows.Next() {
+		var claimed ClaimedWorkflowNode
+		var data []byte
+		var queuePriority int
+		var runStart time.Time
+		if err := scanTask(rows, &claimed.Task,
+			&claimed.Node.ID, &claimed.Node.RunID, &claimed.Node.Node, &claimed.Node.TaskID, &data,
+			&queuePriority, &runStart,
+		); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("扫描工作流节点失败: %w", err)
+		}
+		if err := json.Unmarshal(data, &claimed.Definition); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("解析工作流定义失败: %w", err)
+		}
+		// 同一任务的多个节点本轮只领取第一个
+		if seen[claimed.Task.ID] {
+			continue
+		}
+		seen[claimed.Task.ID] = true
+
+		// 节点以任务 ID 参与挑选，按运行开始时间排先后
+		c := taskCandidate(claimed.Task, queuePriority)
+		c.Due = runStart
+		candidates = append(candidates, c)
+		nodes[claimed.Task.ID] = claimed
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("查询待执行的工作流节点失败: %w", err)
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	picked := schedule.Pick(candidates, limit, free, tenantRunning)
+	ids := make([]int64, len(picked))
+	for i, c := range picked {
+		ids[i] = c.ID
+	}
+
+	acquired, err := acquireTaskLeases(ctx, tx, ids, filter.WorkerPod, lease)
+	if err != nil {
+		return nil, err
+	}
+
+	var claimed []ClaimedWorkflowNode
+	for _, id := range ids {
+		if !acquired[id] {
+			continue
+		}
+		c := nodes[id]
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE workflow_run_nodes SET status = $2, worker_pod = $3, started_at = NOW() WHERE id = $1
+		`, c.Node.ID, models.WorkflowNodeRunning, filter.WorkerPod); err != nil {
+			return nil, fmt.Errorf("更新工作流节点状态失败: %w", err)
+		}
+		c.Node.Status = models.WorkflowNodeRunning
+		c.Node.WorkerPod = filter.WorkerPod
+		claimed = append(claimed, c)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return claimed, nil
+}
+
+// FinishWorkflowNode 记录节点执行结果并推进工作流，output 不为 nil 时保存为传给下游的数据
+// 节点不再由 workerPod 执行（已被回收）时返回 false
+func (db *PostgresDB) FinishWorkflowNode(ctx context.Context, nodeID int64, workerPod, status string, executionID int64, errMsg string, output []map[string]interface{}) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 锁定运行记录，同一运行的节点依次推进
+	var runID int64
+	var data []byte
+	if err := tx.QueryRowContext(ctx, `
+		SELECT r.id, r.definition FROM workflow_runs r
+		JOIN workflow_run_nodes n ON n.run_id = r.id
+		WHERE n.id = $1
+		FOR UPDATE OF r
+	`, nodeID).Scan(&runID, &data); err != nil {
+		return false, fmt.Errorf("查询工作流运行记录失败: %w", err)
+	}
+	var def models.WorkflowDefinition
+	if err := json.Unmarshal(data, &def); err != nil {
+		return false, fmt.Errorf("解析工作流定义失败: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE workflow_run_nodes
+		SET status = $3, execution_id = NULLIF($4, 0), error = NULLIF($5, ''), output_records = $6, finished_at = NOW()
+		WHERE id = $1 AND worker_pod = $2 AND status = $7
+	`, nodeID, workerPod, status, executionID, errMsg, len(output), models.WorkflowNodeRunning)
+	if err != nil {
+		return false, fmt.Errorf("更新工作流节点状态失败: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return false, nil
+	}
+
+	if output != nil {
+		records, err := json.Marshal(output)
+		if err != nil {
+			return false, fmt.Errorf("序列化节点输出失败: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO workflow_node_outputs (run_node_id, records) VALUES ($1, $2)
+			ON CONFLICT (run_node_id) DO UPDATE SET records = EXCLUDED.records, created_at = NOW()
+		`, nodeID, records); err != nil {
+			return false, fmt.Errorf("保存节点输出失败: %w", err)
+		}
+	}
+
+	if err := advanceWorkflowRun(ctx, tx, runID, def); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return true, nil
+}
+
+// RecoverWorkflowNodes 将执行中但任务租约已不存在（Worker 崩溃或失联）的节点标记为失败并推进工作流，返回回收的节点数
+func (db *PostgresDB) RecoverWorkflowNodes(ctx context.Context) (int, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT n.id, n.worker_pod FROM workflow_run_nodes n
+		WHERE n.status = $1
+		AND NOT EXISTS (SELECT 1 FROM task_leases l WHERE l.task_id = n.task_id AND l.worker_pod = n.worker_pod)
+	`, models.WorkflowNodeRunning)
+	if err != nil {
+		return 0, fmt.Errorf("查询中断的工作流节点失败: %w", err)
+	}
+
+	type orphan struct {
+		id        int64
+		workerPod string
+	}
+	var orphans []orphan
+	for rows.Next() {
+		var o orphan
+		if err := rows.Scan(&o.id, &o.workerPod); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("扫描工作流节点失败: %w", err)
+		}
+		orphans = append(orphans, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("查询中断的工作流节点失败: %w", err)
+	}
+
+	recovered := 0
+	for _, o := range orphans {
+		ok, err := db.FinishWorkflowNode(ctx, o.id, o.workerPod, models.WorkflowNodeFailed, 0,
+			fmt.Sprintf("Worker %s 租约过期，执行中断", o.workerPod), nil)
+		if err != nil {
+			return recovered, err
+		}
+		if ok {
+			recovered++
+		}
+	}
+	return recovered, nil
+}
+
+// WorkflowNodeOutputs 按 nodes 的顺序读取同一运行中上游节点保存的输出
+func (db *PostgresDB) WorkflowNodeOutputs(ctx context.Context, runID int64, nodes []string) ([]map[string]interface{}, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT o.records FROM workflow_node_outputs o
+		JOIN workflow_run_nodes n ON n.id = o.run_node_id
+		WHERE n.run_id = $1 AND n.node = ANY($2)
+		ORDER BY array_position($2, n.node::text)
+	`, runID, pq.Array(nodes))
+	if err != nil {
+		return nil, fmt.Errorf("查询上游节点输出失败: %w", err)
+	}
+	defer rows.Close()
+
+	var records []map[string]interface{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("扫描上游节点输出失败: %w", err)
+		}
+		var batch []map[string]interface{}
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return nil, fmt.Errorf("解析上游节点输出失败: %w", err)
+		}
+		records = append(records, batch...)
+	}
+	return records, rows.Err()
+}
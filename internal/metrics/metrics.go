@@ -3,6 +3,7 @@ package metrics
 import (
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -28,6 +29,7 @@ type Metrics struct {
 	DataCleaningDuration *prometheus.HistogramVec
 	DataDeduplicationTotal *prometheus.CounterVec
 	DataDuplicatesRemoved  *prometheus.CounterVec
+	DataValidationTotal    *prometheus.CounterVec
 
 	// 存储指标
 	StorageOperationTotal    *prometheus.CounterVec
@@ -38,7 +40,9 @@ type Metrics struct {
 	RunningTasks      prometheus.Gauge
 	WorkerStartTime   prometheus.Gauge
 	WorkerUptime      prometheus.Gauge
-	TaskQueueLength   prometheus.Gauge
+	TaskQueueLength   *prometheus.GaugeVec     // 各队列已到期、等待领取的任务数
+	TaskQueueWait     *prometheus.GaugeVec     // 各队列等待最久的任务已等待的秒数
+	TaskWaitDuration  *prometheus.HistogramVec // 任务从到期到被领取的等待时长
 
 	// 数据库连接池指标
 	DBConnectionsActive prometheus.Gauge
@@ -57,32 +61,46 @@ type Metrics struct {
 	RetryExhausted   *prometheus.CounterVec
 }
 
-// NewMetrics 创建指标收集器
-func NewMetrics() *Metrics {
+var (
+	defaultMetrics     *Metrics
+	defaultMetricsOnce sync.Once
+)
+
+// Default 返回注册在全局注册表上的指标收集器，进程内只创建一次，多个 Worker 共享
+func Default() *Metrics {
+	defaultMetricsOnce.Do(func() {
+		defaultMetrics = NewMetrics(prometheus.DefaultRegisterer)
+	})
+	return defaultMetrics
+}
+
+// NewMetrics 创建指标收集器并注册到 reg，同一注册表上重复创建会因指标重名而 panic
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	factory := promauto.With(reg)
 	m := &Metrics{
 		// 任务执行指标
-		TaskExecutionTotal: promauto.NewCounterVec(
+		TaskExecutionTotal: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "datafusion_task_execution_total",
 				Help: "Total number of task executions",
 			},
 			[]string{"task_name", "task_type", "worker"},
 		),
-		TaskExecutionSuccess: promauto.NewCounterVec(
+		TaskExecutionSuccess: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "datafusion_task_execution_success_total",
 				Help: "Total number of successful task executions",
 			},
 			[]string{"task_name", "task_type", "worker"},
 		),
-		TaskExecutionFailure: promauto.NewCounterVec(
+		TaskExecutionFailure: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "datafusion_task_execution_failure_total",
 				Help: "Total number of failed task executions",
 			},
 			[]string{"task_name", "task_type", "worker"},
 		),
-		TaskDuration: promauto.NewHistogramVec(
+		TaskDuration: factory.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name:    "datafusion_task_duration_seconds",
 				Help:    "Task execution duration in seconds",
@@ -92,21 +110,21 @@ func NewMetrics() *Metrics {
 		),
 
 		// 数据采集指标
-		DataRecordsCollected: promauto.NewCounterVec(
+		DataRecordsCollected: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "datafusion_data_records_collected_total",
 				Help: "Total number of data records collected",
 			},
 			[]string{"task_name", "task_type", "source_type", "worker"},
 		),
-		DataRecordsStored: promauto.NewCounterVec(
+		DataRecordsStored: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "datafusion_data_records_stored_total",
 				Help: "Total number of data records stored",
 			},
 			[]string{"task_name", "storage_type", "worker"},
 		),
-		DataRecordsFailed: promauto.NewCounterVec(
+		DataRecordsFailed: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "datafusion_data_records_failed_total",
 				Help: "Total number of data records failed to store",
@@ -115,14 +133,14 @@ func NewMetrics() *Metrics {
 		),
 
 		// 数据处理指标
-		DataCleaningTotal: promauto.NewCounterVec(
+		DataCleaningTotal: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "datafusion_data_cleaning_total",
 				Help: "Total number of data cleaning operations",
 			},
 			[]string{"task_name", "rule_type", "worker"},
 		),
-		DataCleaningDuration: promauto.NewHistogramVec(
+		DataCleaningDuration: factory.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name:    "datafusion_data_cleaning_duration_seconds",
 				Help:    "Data cleaning duration in seconds",
@@ -130,30 +148,37 @@ func NewMetrics() *Metrics {
 			},
 			[]string{"task_name", "worker"},
 		),
-		DataDeduplicationTotal: promauto.NewCounterVec(
+		DataDeduplicationTotal: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "datafusion_data_deduplication_total",
 				Help: "Total number of data deduplication operations",
 			},
 			[]string{"task_name", "strategy", "worker"},
 		),
-		DataDuplicatesRemoved: promauto.NewCounterVec(
+		DataDuplicatesRemoved: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "datafusion_data_duplicates_removed_total",
 				Help: "Total number of duplicate records removed",
 			},
 			[]string{"task_name", "strategy", "worker"},
 		),
+		DataValidationTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "datafusion_data_validation_total",
+				Help: "Total number of records checked by validation rules",
+			},
+			[]string{"task_name", "rule", "action", "result", "worker"},
+		),
 
 		// 存储指标
-		StorageOperationTotal: promauto.NewCounterVec(
+		StorageOperationTotal: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "datafusion_storage_operation_total",
 				Help: "Total number of storage operations",
 			},
 			[]string{"operation", "storage_type", "worker"},
 		),
-		StorageOperationDuration: promauto.NewHistogramVec(
+		StorageOperationDuration: factory.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name:    "datafusion_storage_operation_duration_seconds",
 				Help:    "Storage operation duration in seconds",
@@ -161,7 +186,7 @@ func NewMetrics() *Metrics {
 			},
 			[]string{"operation", "storage_type", "worker"},
 		),
-		StorageErrors: promauto.NewCounterVec(
+		StorageErrors: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "datafusion_storage_errors_total",
 				Help: "Total number of storage errors",
@@ -170,45 +195,61 @@ func NewMetrics() *Metrics {
 		),
 
 		// Worker 状态指标
-		RunningTasks: promauto.NewGauge(
+		RunningTasks: factory.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "datafusion_running_tasks",
 				Help: "Number of currently running tasks",
 			},
 		),
-		WorkerStartTime: promauto.NewGauge(
+		WorkerStartTime: factory.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "datafusion_worker_start_time_seconds",
 				Help: "Unix timestamp when the worker started",
 			},
 		),
-		WorkerUptime: promauto.NewGauge(
+		WorkerUptime: factory.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "datafusion_worker_uptime_seconds",
 				Help: "Worker uptime in seconds",
 			},
 		),
-		TaskQueueLength: promauto.NewGauge(
+		TaskQueueLength: factory.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "datafusion_task_queue_length",
-				Help: "Number of tasks in the queue",
+				Help: "Number of due tasks waiting to be claimed in the queue",
+			},
+			[]string{"queue"},
+		),
+		TaskQueueWait: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "datafusion_task_queue_wait_seconds",
+				Help: "Seconds the oldest due task in the queue has been waiting",
 			},
+			[]string{"queue"},
+		),
+		TaskWaitDuration: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "datafusion_task_wait_duration_seconds",
+				Help:    "Time from a task becoming due until it is claimed",
+				Buckets: []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600},
+			},
+			[]string{"queue", "worker"},
 		),
 
 		// 数据库连接池指标
-		DBConnectionsActive: promauto.NewGauge(
+		DBConnectionsActive: factory.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "datafusion_db_connections_active",
 				Help: "Number of active database connections",
 			},
 		),
-		DBConnectionsIdle: promauto.NewGauge(
+		DBConnectionsIdle: factory.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "datafusion_db_connections_idle",
 				Help: "Number of idle database connections",
 			},
 		),
-		DBConnectionsTotal: promauto.NewGauge(
+		DBConnectionsTotal: factory.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "datafusion_db_connections_total",
 				Help: "Total number of database connections",
@@ -216,21 +257,21 @@ func NewMetrics() *Metrics {
 		),
 
 		// 缓存指标
-		CacheHits: promauto.NewCounterVec(
+		CacheHits: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "datafusion_cache_hits_total",
 				Help: "Total number of cache hits",
 			},
 			[]string{"cache_type", "worker"},
 		),
-		CacheMisses: promauto.NewCounterVec(
+		CacheMisses: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "datafusion_cache_misses_total",
 				Help: "Total number of cache misses",
 			},
 			[]string{"cache_type", "worker"},
 		),
-		CacheSize: promauto.NewGaugeVec(
+		CacheSize: factory.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "datafusion_cache_size",
 				Help: "Current cache size",
@@ -239,28 +280,28 @@ func NewMetrics() *Metrics {
 		),
 
 		// 错误和重试指标
-		ErrorTotal: promauto.NewCounterVec(
+		ErrorTotal: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "datafusion_errors_total",
 				Help: "Total number of errors",
 			},
 			[]string{"error_type", "component", "worker"},
 		),
-		RetryTotal: promauto.NewCounterVec(
+		RetryTotal: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "datafusion_retry_total",
 				Help: "Total number of retry attempts",
 			},
 			[]string{"task_name", "worker"},
 		),
-		RetrySuccess: promauto.NewCounterVec(
+		RetrySuccess: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "datafusion_retry_success_total",
 				Help: "Total number of successful retries",
 			},
 			[]string{"task_name", "worker"},
 		),
-		RetryExhausted: promauto.NewCounterVec(
+		RetryExhausted: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "datafusion_retry_exhausted_total",
 				Help: "Total number of exhausted retries",
@@ -324,6 +365,12 @@ func (m *Metrics) RecordDeduplication(taskName, strategy, worker string, totalRe
 	m.DataDuplicatesRemoved.WithLabelValues(taskName, strategy, worker).Add(float64(duplicates))
 }
 
+// RecordValidation 记录校验规则的通过/失败数
+func (m *Metrics) RecordValidation(taskName, rule, action, worker string, passed, failed int) {
+	m.DataValidationTotal.WithLabelValues(taskName, rule, action, "passed", worker).Add(float64(passed))
+	m.DataValidationTotal.WithLabelValues(taskName, rule, action, "failed", worker).Add(float64(failed))
+}
+
 // RecordError 记录错误
 func (m *Metrics) RecordError(errorType, component, worker string) {
 	m.ErrorTotal.WithLabelValues(errorType, component, worker).Inc()
@@ -342,6 +389,17 @@ func (m *Metrics) SetRunningTasks(count int) {
 	m.RunningTasks.Set(float64(count))
 }
 
+// SetQueueLength 设置队列中等待领取的任务数和等待最久的时长
+func (m *Metrics) SetQueueLength(queue string, pending int, waitSeconds float64) {
+	m.TaskQueueLength.WithLabelValues(queue).Set(float64(pending))
+	m.TaskQueueWait.WithLabelValues(queue).Set(waitSeconds)
+}
+
+// RecordTaskWait 记录任务从到期到被领取的等待时长
+func (m *Metrics) RecordTaskWait(queue, worker string, wait time.Duration) {
+	m.TaskWaitDuration.WithLabelValues(queue, worker).Observe(wait.Seconds())
+}
+
 // StartMetricsServer 启动指标服务器
 func StartMetricsServer(port int) error {
 	http.Handle("/metrics", promhttp.Handler())
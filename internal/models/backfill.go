@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// 补数状态
+const (
+	BackfillRunning   = "running"
+	BackfillSuccess   = "success"
+	BackfillFailed    = "failed"
+	BackfillCancelled = "cancelled"
+)
+
+// 补数窗口状态
+const (
+	BackfillWindowPending   = "pending"
+	BackfillWindowRunning   = "running"
+	BackfillWindowSuccess   = "success"
+	BackfillWindowFailed    = "failed"
+	BackfillWindowCancelled = "cancelled"
+)
+
+// MaxBackfillWindows 单次补数最多的窗口数
+const MaxBackfillWindows = 1000
+
+// Backfill 补数：将时间范围按间隔切分为窗口，每个窗口执行一次任务
+type Backfill struct {
+	ID              int64            `json:"id"`
+	TaskID          int64            `json:"task_id"`
+	TaskName        string           `json:"task_name,omitempty"`
+	StartTime       time.Time        `json:"start_time"`
+	EndTime         time.Time        `json:"end_time"`
+	IntervalSeconds int              `json:"interval_seconds"`
+	Concurrency     int              `json:"concurrency"` // 同时执行的窗口数上限
+	Status          string           `json:"status"`      // running, success, failed, cancelled
+	CreatedBy       string           `json:"created_by"`
+	CancelledBy     string           `json:"cancelled_by,omitempty"`
+	CreatedAt       time.Time        `json:"created_at"`
+	FinishedAt      *time.Time       `json:"finished_at"`
+	Progress        BackfillProgress `json:"progress"`
+	Windows         []BackfillWindow `json:"windows,omitempty"`
+}
+
+// BackfillProgress 各状态的窗口数
+type BackfillProgress struct {
+	Total     int `json:"total"`
+	Pending   int `json:"pending"`
+	Running   int `json:"running"`
+	Success   int `json:"success"`
+	Failed    int `json:"failed"`
+	Cancelled int `json:"cancelled"`
+}
+
+// BackfillWindow 补数中的一个时间窗口
+type BackfillWindow struct {
+	ID               int64      `json:"id"`
+	BackfillID       int64      `json:"backfill_id"`
+	WindowStart      time.Time  `json:"window_start"`
+	WindowEnd        time.Time  `json:"window_end"`
+	Status           string     `json:"status"` // pending, running, success, failed, cancelled
+	ExecutionID      *int64     `json:"execution_id"`
+	WorkerPod        string     `json:"worker_pod,omitempty"`
+	RecordsCollected int        `json:"records_collected"`
+	Error            string     `json:"error,omitempty"`
+	StartedAt        *time.Time `json:"started_at"`
+	FinishedAt       *time.Time `json:"finished_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Calendar 工作日日历，任务引用后只在日历的工作日执行
+type Calendar struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Weekdays    []int64   `json:"weekdays"` // 每周的工作日，0 为周日，默认周一到周五
+	Holidays    []string  `json:"holidays"` // 节假日（2006-01-02），不执行
+	Workdays    []string  `json:"workdays"` // 调休的工作日（2006-01-02），优先于 weekdays 和 holidays
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
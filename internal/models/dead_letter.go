@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// 死信记录产生的阶段
+const (
+	DeadLetterStageClean     = "clean"
+	DeadLetterStageTransform = "transform"
+	DeadLetterStageValidate  = "validate"
+	DeadLetterStageScript    = "script"
+	DeadLetterStageEnrich    = "enrich"
+	DeadLetterStageStorage   = "storage"
+)
+
+// 死信记录状态
+const (
+	DeadLetterStatusPending         = "pending"          // 待处理
+	DeadLetterStatusReplayRequested = "replay_requested" // 已请求重放，等待 Worker 处理
+	DeadLetterStatusReplaying       = "replaying"        // Worker 正在重放
+	DeadLetterStatusReplayed        = "replayed"         // 重放成功
+	DeadLetterStatusDiscarded       = "discarded"        // 已丢弃
+)
+
+// DeadLetterRecord 处理或存储失败的记录
+type DeadLetterRecord struct {
+	ID           int64                  `json:"id"`
+	TaskID       int64                  `json:"task_id"`
+	ExecutionID  int64                  `json:"execution_id"`
+	Stage        string                 `json:"stage"`                // clean, transform, validate, script（或自定义阶段类型）, storage
+	StageName    string                 `json:"stage_name,omitempty"` // 拒绝记录的处理阶段名称，重放时从该阶段开始
+	StageIndex   int                    `json:"stage_index"`          // 拒绝记录的处理阶段在流水线中的下标
+	Rule         string                 `json:"rule,omitempty"`       // 失败的规则名称
+	Target       string                 `json:"target,omitempty"`     // 失败的存储目标（stage 为 storage 时）
+	Error        string                 `json:"error"`
+	Record       map[string]interface{} `json:"record"`
+	Status       string                 `json:"status"`
+	ReplayCount  int                    `json:"replay_count"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+	ReplayedAt   *time.Time             `json:"replayed_at"`
+	PIIProtected bool                   `json:"pii_protected"` // 记录是否已按任务的 PII 策略脱敏，重放时跳过 PII 阶段
+}
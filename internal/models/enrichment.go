@@ -0,0 +1,38 @@
+package models
+
+// 参考数据源类型
+const (
+	EnrichmentSourceSQL   = "sql"   // 在控制数据库或数据存储数据库上执行查询
+	EnrichmentSourceCSV   = "csv"   // Worker 参考数据目录下的 CSV 文件
+	EnrichmentSourceCache = "cache" // 缓存中的哈希，哈希字段为查找键
+)
+
+// 未匹配到参考数据时的处理方式
+const (
+	EnrichmentMissKeep    = "keep"    // 保留记录，不补充字段（默认）
+	EnrichmentMissDefault = "default" // 保留记录，写入 defaults
+	EnrichmentMissDrop    = "drop"    // 丢弃记录
+	EnrichmentMissReject  = "reject"  // 记录进入死信队列
+)
+
+// EnrichmentConfig 关联补充配置：按键将记录与参考数据关联，把参考数据的字段写入记录
+type EnrichmentConfig struct {
+	Name string `json:"name,omitempty"` // 名称，用于日志和死信记录
+
+	Source    string `json:"source"`              // sql, csv, cache
+	Database  string `json:"database,omitempty"`  // sql: data（默认，数据存储数据库），控制数据库不允许查询
+	Query     string `json:"query,omitempty"`     // sql: 只读查询，结果的列作为参考数据的字段
+	Path      string `json:"path,omitempty"`      // csv: 相对于 Worker 参考数据目录的路径，第一行为列名
+	Delimiter string `json:"delimiter,omitempty"` // csv: 分隔符，默认逗号
+	CacheKey  string `json:"cache_key,omitempty"` // cache: 哈希键，值为 JSON 对象或字符串
+
+	KeyFields    []string `json:"key_fields"`              // 记录中的关联字段，支持嵌套路径
+	LookupFields []string `json:"lookup_fields,omitempty"` // 参考数据中对应的列，为空时与 key_fields 相同；cache 数据源不使用
+	Match        string   `json:"match,omitempty"`         // exact（默认）, normalized（忽略大小写、全半角、空白和标点）
+
+	Fields map[string]string `json:"fields,omitempty"` // 写入的字段：记录中的目标字段 -> 参考数据的列
+	Target string            `json:"target,omitempty"` // 将匹配到的整行参考数据写入该字段
+
+	OnMiss   string                 `json:"on_miss,omitempty"`  // keep（默认）, default, drop, reject
+	Defaults map[string]interface{} `json:"defaults,omitempty"` // on_miss 为 default 时写入的字段
+}
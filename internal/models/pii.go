@@ -0,0 +1,41 @@
+package models
+
+// PII 类型
+const (
+	PIITypePhone    = "phone"     // 中国大陆手机号
+	PIITypeIDCard   = "id_card"   // 18 位居民身份证号（校验码校验）
+	PIITypeEmail    = "email"     // 邮箱地址
+	PIITypeBankCard = "bank_card" // 银行卡号（Luhn 校验）
+)
+
+// PII 处理方式
+const (
+	PIIActionMask     = "mask"     // 部分遮盖，如 138****5678（默认）
+	PIIActionHash     = "hash"     // 加盐 HMAC-SHA256，相同值得到相同哈希，不可还原
+	PIIActionTokenize = "tokenize" // 替换为令牌，原值加密保存在令牌库中，有权限的用户可以还原
+)
+
+// PIIConfig PII 检测与脱敏配置
+type PIIConfig struct {
+	Fields []PIIFieldPolicy `json:"fields,omitempty"` // 按字段配置的策略
+
+	// ScanAll 为 true 时扫描 fields 之外的所有字符串字段（包括嵌套字段），检测到的 PII 按 Action 处理
+	ScanAll bool   `json:"scan_all,omitempty"`
+	Action  string `json:"action,omitempty"` // scan_all 使用的处理方式，默认 mask
+}
+
+// PIIFieldPolicy 单个字段的 PII 策略
+type PIIFieldPolicy struct {
+	Field  string   `json:"field"`            // 字段路径，支持嵌套和数组通配
+	Action string   `json:"action,omitempty"` // mask（默认）, hash, tokenize
+	Type   string   `json:"type,omitempty"`   // 整个字段值按该类型处理（不做格式校验）；为空时在文本中检测
+	Types  []string `json:"types,omitempty"`  // 文本中检测的类型，为空时检测全部类型
+}
+
+// PIIResult 一次执行中某个字段的 PII 处理结果
+type PIIResult struct {
+	Field  string `json:"field"`
+	Type   string `json:"type"`
+	Action string `json:"action"`
+	Count  int    `json:"count"` // 处理的值的个数
+}
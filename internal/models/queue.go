@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// 默认队列和租户
+const (
+	DefaultQueue  = "default"
+	DefaultTenant = "default"
+)
+
+// TaskQueue 任务队列：队列优先级高的任务先领取，max_concurrency 限制队列在所有 Worker 上同时执行的任务数
+type TaskQueue struct {
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	Priority       int       `json:"priority"`        // 队列优先级，越大越先领取
+	MaxConcurrency int       `json:"max_concurrency"` // 同时执行的任务数上限，0 表示不限制
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// QueueStats 队列中等待领取的任务统计
+type QueueStats struct {
+	Queue       string  `json:"queue"`
+	Pending     int     `json:"pending"`      // 已到期、尚未被领取的任务数
+	Running     int     `json:"running"`      // 持有有效租约的任务数
+	WaitSeconds float64 `json:"wait_seconds"` // 等待最久的任务已等待的秒数
+}
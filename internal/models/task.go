@@ -17,31 +17,127 @@ type CollectionTask struct {
 	Config          *string    `json:"config"` // JSON 配置
 	CreatedAt       time.Time  `json:"created_at"`
 	UpdatedAt       time.Time  `json:"updated_at"`
+
+	Queue    string            `json:"queue"`              // 所属队列，默认 default
+	Priority int               `json:"priority"`           // 队列内的优先级，越大越先执行
+	Tenant   string            `json:"tenant"`             // 租户，同优先级的任务在租户之间公平调度
+	Selector map[string]string `json:"selector,omitempty"` // Worker 必须具有的标签，如 {"chrome": "true"}
+
+	Timezone      string `json:"timezone,omitempty"` // Cron 表达式的时区，如 Asia/Shanghai，为空时为 Worker 本地时区
+	CatchUp       string `json:"catch_up"`           // 错过执行的补执行策略：skip, once（默认）, all
+	JitterSeconds int    `json:"jitter_seconds"`     // 下次执行时间随机推迟的最大秒数
+	Calendar      string `json:"calendar,omitempty"` // 引用的日历，只在日历的工作日执行
+
+	RetryPolicy *RetryPolicy `json:"retry_policy,omitempty"` // 重试策略，为空时使用默认策略和 MaxRetries
+}
+
+// RetryPolicy 任务的重试策略，字段为 0 时使用默认值
+// 只有临时错误、限流和未分类错误会重试，认证错误和配置错误直接失败
+type RetryPolicy struct {
+	MaxAttempts         int     `json:"max_attempts,omitempty"`          // 最大尝试次数（含首次执行），1 表示不重试
+	InitialDelaySeconds int     `json:"initial_delay_seconds,omitempty"` // 首次重试前的延迟
+	MaxDelaySeconds     int     `json:"max_delay_seconds,omitempty"`     // 单次重试延迟的上限
+	BackoffFactor       float64 `json:"backoff_factor,omitempty"`        // 退避因子，每次重试延迟乘以该值
+	Jitter              float64 `json:"jitter,omitempty"`                // 随机抖动比例（0~1），延迟在 [d*(1-jitter), d] 内随机
+	MaxElapsedSeconds   int     `json:"max_elapsed_seconds,omitempty"`   // 从首次执行起的最长重试时间，超过后不再重试
+}
+
+// 执行状态
+const (
+	ExecutionStatusRunning    = "running"
+	ExecutionStatusCancelling = "cancelling" // 已请求取消，等待 Worker 停止执行
+	ExecutionStatusSuccess    = "success"
+	ExecutionStatusFailed     = "failed"
+	ExecutionStatusCancelled  = "cancelled"
+)
+
+// ExecutionCancelChannel 请求取消执行时 pg_notify 使用的频道，负载为 ExecutionCancelNotice
+const ExecutionCancelChannel = "execution_cancel"
+
+// ExecutionCancelNotice 取消执行通知
+type ExecutionCancelNotice struct {
+	ExecutionID int64  `json:"execution_id"`
+	WorkerPod   string `json:"worker_pod"`
 }
 
 // TaskExecution 任务执行记录
 type TaskExecution struct {
-	ID               int64     `json:"id"`
-	TaskID           int64     `json:"task_id"`
-	WorkerPod        string    `json:"worker_pod"`
-	Status           string    `json:"status"` // running, success, failed
-	StartTime        time.Time `json:"start_time"`
-	EndTime          *time.Time `json:"end_time"`
-	RecordsCollected int       `json:"records_collected"`
-	ErrorMessage     string    `json:"error_message"`
-	RetryCount       int       `json:"retry_count"`
+	ID               int64           `json:"id"`
+	TaskID           int64           `json:"task_id"`
+	WorkerPod        string          `json:"worker_pod"`
+	Status           string          `json:"status"` // running, cancelling, success, failed, cancelled
+	StartTime        time.Time       `json:"start_time"`
+	EndTime          *time.Time      `json:"end_time"`
+	RecordsCollected int             `json:"records_collected"`
+	ErrorMessage     string          `json:"error_message"`
+	RetryCount       int             `json:"retry_count"`
+	StorageResults   []StorageResult `json:"storage_results,omitempty"` // 各存储目标的写入结果
+	RecordsRejected  int             `json:"records_rejected"`          // 进入死信队列的记录数
+
+	ValidationResults []ValidationResult     `json:"validation_results,omitempty"` // 各校验规则的通过/失败数
+	CleaningRules     []CleaningRuleRevision `json:"cleaning_rules,omitempty"`     // 应用的已保存清洗规则版本
+	PIIResults        []PIIResult            `json:"pii_results,omitempty"`        // 各字段 PII 的处理方式和个数
+	Attempts          []ExecutionAttempt     `json:"attempts,omitempty"`           // 每次尝试的结果
+
+	Rejected []DeadLetterRecord       `json:"-"` // 本次执行被拒绝的记录，执行结束时写入死信队列
+	Output   []map[string]interface{} `json:"-"` // 工作流节点传给下游的数据（写入存储的记录）
 }
 
+// ExecutionAttempt 一次执行中单次尝试的结果
+type ExecutionAttempt struct {
+	Attempt    int       `json:"attempt"` // 从 1 开始
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	Records    int       `json:"records"`
+	Error      string    `json:"error,omitempty"`
+	ErrorClass string    `json:"error_class,omitempty"` // transient, rate_limited, auth, config, unknown
+	DelayMs    int64     `json:"delay_ms,omitempty"`    // 下一次尝试前的等待时间
+}
+
+// StorageResult 单个存储目标的写入结果
+type StorageResult struct {
+	Name       string `json:"name,omitempty"`
+	Target     string `json:"target"`
+	Table      string `json:"table,omitempty"`
+	Status     string `json:"status"` // success, failed
+	Records    int    `json:"records"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// 存储目标的写入状态
+const (
+	StorageResultSuccess = "success"
+	StorageResultFailed  = "failed"
+)
+
+// 多存储目标的失败策略
+const (
+	StoragePolicyAll      = "all"      // 任一目标失败则本次执行失败（默认）
+	StoragePolicyAny      = "any"      // 至少一个目标成功即视为成功
+	StoragePolicyRequired = "required" // 仅 required 目标失败时执行失败
+)
+
 // TaskConfig 任务配置
 type TaskConfig struct {
-	DataSource DataSourceConfig `json:"data_source"`
-	Processor  ProcessorConfig  `json:"processor"`
-	Storage    StorageConfig    `json:"storage"`
+	DataSource    DataSourceConfig `json:"data_source"`
+	Processor     ProcessorConfig  `json:"processor"`
+	Storage       StorageConfig    `json:"storage"`
+	Targets       []StorageConfig  `json:"targets,omitempty"`        // 多存储目标，非空时替代 storage
+	StoragePolicy string           `json:"storage_policy,omitempty"` // all, any, required
+}
+
+// StorageTargets 返回任务的全部存储目标，未配置 targets 时使用单个 storage
+func (c *TaskConfig) StorageTargets() []StorageConfig {
+	if len(c.Targets) > 0 {
+		return c.Targets
+	}
+	return []StorageConfig{c.Storage}
 }
 
 // DataSourceConfig 数据源配置
 type DataSourceConfig struct {
-	Type       string                 `json:"type"` // web-rpa, api, database
+	Type       string                 `json:"type"` // web-rpa, api, database, upstream（工作流上游节点输出）
 	URL        string                 `json:"url"`
 	Method     string                 `json:"method"`
 	Headers    map[string]string      `json:"headers"`
@@ -49,6 +145,7 @@ type DataSourceConfig struct {
 	RPAConfig  *RPAConfig             `json:"rpa_config,omitempty"`
 	APIConfig  *APIConfig             `json:"api_config,omitempty"`
 	DBConfig   *DBConfig              `json:"db_config,omitempty"`
+	Upstream   *UpstreamConfig        `json:"upstream,omitempty"` // 工作流中读取上游节点的输出
 }
 
 // RPALoginConfig 登录配置
@@ -113,31 +210,154 @@ type DBConfig struct {
 
 // ProcessorConfig 处理器配置
 type ProcessorConfig struct {
-	CleaningRules  []CleaningRule  `json:"cleaning_rules"`
-	TransformRules []TransformRule `json:"transform_rules"`
+	CleaningRules   []CleaningRule   `json:"cleaning_rules"`
+	TransformRules  []TransformRule  `json:"transform_rules"`
+	ValidationRules []ValidationRule `json:"validation_rules,omitempty"`
+
+	Stages        []StageConfig        `json:"stages,omitempty"`        // 处理阶段顺序，为空时依次执行 clean、transform、enrich（配置了 enrichments 时）、validate、pii（配置了 pii 时）
+	Enrichments   []EnrichmentConfig   `json:"enrichments,omitempty"`   // 关联补充配置，按顺序执行
+	PII           *PIIConfig           `json:"pii,omitempty"`           // PII 检测与脱敏配置
+	Deduplication *DeduplicationConfig `json:"deduplication,omitempty"` // 去重配置，为空时不去重
+}
+
+// PrependCleaningRules 将任务绑定的已保存清洗规则按顺序排在配置中的清洗规则之前
+func (c *ProcessorConfig) PrependCleaningRules(rules []CleaningRule) {
+	if len(rules) > 0 {
+		c.CleaningRules = append(append([]CleaningRule{}, rules...), c.CleaningRules...)
+	}
 }
 
+// AppliedCleaningRules 返回配置中来自 cleaning_rules 表的清洗规则及其版本
+func (c *ProcessorConfig) AppliedCleaningRules() []CleaningRuleRevision {
+	var revisions []CleaningRuleRevision
+	for _, rule := range c.CleaningRules {
+		if rule.RuleID == 0 {
+			continue
+		}
+		revisions = append(revisions, CleaningRuleRevision{
+			RuleID:  rule.RuleID,
+			Name:    rule.Name,
+			Version: rule.Version,
+			Field:   rule.Field,
+		})
+	}
+	return revisions
+}
+
+// StageConfig 处理阶段配置
+// clean、transform、validate、enrich 阶段未配置规则时使用 ProcessorConfig 中对应的规则
+type StageConfig struct {
+	Type string `json:"type"`           // clean, transform, enrich, validate, script, pii 或注册的自定义阶段
+	Name string `json:"name,omitempty"` // 阶段名称，用于日志和死信记录
+
+	CleaningRules   []CleaningRule   `json:"cleaning_rules,omitempty"`
+	TransformRules  []TransformRule  `json:"transform_rules,omitempty"`
+	ValidationRules []ValidationRule `json:"validation_rules,omitempty"`
+
+	Script    string `json:"script,omitempty"`     // script: Starlark 脚本，需定义 process(record) 函数
+	MaxSteps  uint64 `json:"max_steps,omitempty"`  // script: 处理单条记录最多执行的步数，默认 1000000
+	TimeoutMs int    `json:"timeout_ms,omitempty"` // script: 处理单条记录的超时（毫秒），默认 1000
+
+	PII         *PIIConfig         `json:"pii,omitempty"`         // pii: 未配置时使用 ProcessorConfig.PII
+	Enrichments []EnrichmentConfig `json:"enrichments,omitempty"` // enrich: 未配置时使用 ProcessorConfig.Enrichments
+
+	Options map[string]interface{} `json:"options,omitempty"` // 自定义阶段的参数
+}
+
+// DeduplicationConfig 去重配置，去重键持久化保存，重启后和多个 Worker 副本之间共享
+type DeduplicationConfig struct {
+	Strategy      string   `json:"strategy"`                 // content_hash, field_based, time_window, near_duplicate
+	Fields        []string `json:"fields,omitempty"`         // field_based 策略使用的字段，near_duplicate 策略的文本字段，支持嵌套路径
+	TimeWindow    string   `json:"time_window,omitempty"`    // 去重键保留时间，如 24h；time_window 策略默认 24h，其余策略为空时永久保留
+	CacheSize     int      `json:"cache_size,omitempty"`     // 兼容旧配置，持久化去重时不再使用
+	EnableLogging bool     `json:"enable_logging,omitempty"` // 是否记录去重日志
+
+	// near_duplicate 策略选项
+	Threshold     *int   `json:"threshold,omitempty"`      // 判定为近似重复的最大汉明距离（0-15），未设置时为 3，0 表示只有指纹相同才视为重复
+	Action        string `json:"action,omitempty"`         // drop（默认）, annotate（保留记录并标注近似重复的记录 ID）
+	IDField       string `json:"id_field,omitempty"`       // 记录 ID 字段，默认 id，记录没有 ID 时使用内容哈希
+	AnnotateField string `json:"annotate_field,omitempty"` // 标注写入的字段，默认 near_duplicate_of
+}
+
+// 近似重复记录的处理方式
+const (
+	NearDuplicateActionDrop     = "drop"
+	NearDuplicateActionAnnotate = "annotate"
+)
+
 // CleaningRule 清洗规则
 type CleaningRule struct {
 	Name       string `json:"name"`
 	Field      string `json:"field"`
-	Type       string `json:"type"` // regex, trim, remove_html, etc.
+	Type       string `json:"type"` // regex, trim, remove_html, date_format, number_format, currency, to_halfwidth, t2s, pinyin, segment, keywords, etc.
 	Pattern    string `json:"pattern"`
 	Replacement string `json:"replacement"`
+	TargetField string `json:"target_field,omitempty"` // 结果写入的字段，为空时写回 field
+	Locale      string `json:"locale,omitempty"`       // date_format、number_format、currency 使用的地区，如 zh-CN、en-US、de-DE
+	Timezone    string `json:"timezone,omitempty"`     // date_format 中不带时区的时间所在的时区，如 Asia/Shanghai，默认 UTC
+
+	RuleID  int64 `json:"rule_id,omitempty"` // 来自 cleaning_rules 表时的规则 ID
+	Version int   `json:"version,omitempty"` // 来自 cleaning_rules 表时的规则版本
 }
 
-// TransformRule 转换规则
+// CleaningRuleRevision 执行时应用的已保存清洗规则版本
+type CleaningRuleRevision struct {
+	RuleID  int64  `json:"rule_id"`
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+	Field   string `json:"field"`
+}
+
+// TransformRule 转换规则，按顺序应用，后面的规则可以使用前面规则产生的字段
+// 字段名支持嵌套路径，如 author.name、$.items[0].price、tags[*]
 type TransformRule struct {
 	Name       string `json:"name"`
 	SourceField string `json:"source_field"`
-	TargetField string `json:"target_field"`
-	Type       string `json:"type"` // convert, format, etc.
+	TargetField string `json:"target_field"` // 为空时写回 source_field
+	Type        string `json:"type"`         // rename（默认）, convert, template, expression, split, concat, constant, default, lookup, drop, flatten, unflatten, explode
+
+	DataType     string                 `json:"data_type,omitempty"`     // convert: int, float, string, bool, time
+	Format       string                 `json:"format,omitempty"`        // convert 为 time 时的解析格式（Go 时间格式），为空时自动识别
+	Template     string                 `json:"template,omitempty"`      // template: 如 "{title} - {author}"
+	Expression   string                 `json:"expression,omitempty"`    // expression: 表达式，可直接引用记录字段，如 price * qty、score > 60 ? "pass" : "fail"
+	SourceFields []string               `json:"source_fields,omitempty"` // concat、drop 的多个源字段
+	TargetFields []string               `json:"target_fields,omitempty"` // split 拆分后依次写入的字段，为空时写入数组
+	Separator    string                 `json:"separator,omitempty"`     // split、concat 的分隔符，flatten、unflatten 的键分隔符（默认 "."）
+	Value        interface{}            `json:"value,omitempty"`         // constant、default 的值
+	Lookup       map[string]interface{} `json:"lookup,omitempty"`        // lookup: 静态映射表
+	Default      interface{}            `json:"default,omitempty"`       // lookup 未命中时的默认值，未设置时保留原值
 }
 
 // StorageConfig 存储配置
 type StorageConfig struct {
-	Target   string            `json:"target"` // postgresql, mongodb, file
+	Name     string            `json:"name,omitempty"`     // 目标名称，用于执行记录中区分多个目标
+	Required bool              `json:"required,omitempty"` // storage_policy 为 required 时，该目标失败会使执行失败
+	Target   string            `json:"target"`             // postgresql, mongodb, file, s3, elasticsearch, webhook
 	Database string            `json:"database"`
 	Table    string            `json:"table"`
 	Mapping  map[string]string `json:"mapping"`
+	Keys     []string          `json:"keys,omitempty"` // 主键字段（源字段名），用于 upsert
+
+	// 文件类存储（file、s3）选项
+	Format            string   `json:"format,omitempty"`               // json, jsonl, csv, parquet
+	Compression       string   `json:"compression,omitempty"`          // gzip, zstd
+	PartitionBy       []string `json:"partition_by,omitempty"`         // 分区: dt, hour（按 UTC）, task 或记录字段名
+	MaxRecordsPerFile int      `json:"max_records_per_file,omitempty"` // 单文件最大记录数，超出后滚动到新文件
+
+	// 索引类存储（elasticsearch）选项，mapping 的值可写作 "目标字段:类型" 以生成索引模板
+	Rollover string `json:"rollover,omitempty"` // 索引滚动: daily（按 UTC 日期）
+
+	Webhook *WebhookConfig `json:"webhook,omitempty"` // 推送类存储（webhook）配置
+}
+
+// WebhookConfig Webhook 推送配置
+type WebhookConfig struct {
+	URL        string            `json:"url"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Format     string            `json:"format,omitempty"`      // json（默认，JSON 数组）, ndjson
+	BatchSize  int               `json:"batch_size,omitempty"`  // 每批记录数，默认 100
+	Secret     string            `json:"secret,omitempty"`      // HMAC-SHA256 签名密钥
+	SecretEnv  string            `json:"secret_env,omitempty"`  // 从环境变量读取签名密钥
+	MaxRetries int               `json:"max_retries,omitempty"` // 5xx / 429 / 网络错误时的重试次数，默认 3
+	Timeout    int               `json:"timeout,omitempty"`     // 单次请求超时（秒）
 }
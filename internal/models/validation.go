@@ -0,0 +1,46 @@
+package models
+
+// 校验规则类型
+const (
+	ValidationRequired   = "required"   // 字段必须存在且非空
+	ValidationType       = "type"       // 字段类型: string, number, integer, bool, object, array
+	ValidationRange      = "range"      // 数值范围；字符串、数组按长度
+	ValidationRegex      = "regex"      // 正则匹配
+	ValidationEnum       = "enum"       // 枚举值
+	ValidationUnique     = "unique"     // 批次内唯一（可指定多个字段组成联合键）
+	ValidationExpression = "expression" // 跨字段表达式，结果必须为 true
+)
+
+// 校验失败时的处理方式
+const (
+	ValidationActionDrop       = "drop"       // 丢弃记录
+	ValidationActionQuarantine = "quarantine" // 记录进入死信队列（默认）
+	ValidationActionFail       = "fail"       // 本次执行失败
+	ValidationActionWarn       = "warn"       // 保留记录，仅记录告警
+)
+
+// ValidationRule 数据校验规则，在清洗和转换之后对最终记录执行
+type ValidationRule struct {
+	Name       string        `json:"name"`
+	Field      string        `json:"field,omitempty"` // 字段路径，支持嵌套
+	Type       string        `json:"type"`            // required, type, range, regex, enum, unique, expression
+	DataType   string        `json:"data_type,omitempty"`
+	Min        *float64      `json:"min,omitempty"`
+	Max        *float64      `json:"max,omitempty"`
+	Pattern    string        `json:"pattern,omitempty"`
+	Values     []interface{} `json:"values,omitempty"`     // enum 允许的值
+	Fields     []string      `json:"fields,omitempty"`     // unique 联合键字段，为空时使用 field
+	Expression string        `json:"expression,omitempty"` // expression 规则，如 end_time >= start_time
+	Action     string        `json:"action,omitempty"`     // drop, quarantine（默认）, fail, warn
+	Message    string        `json:"message,omitempty"`    // 自定义错误信息
+}
+
+// ValidationResult 单条校验规则在一次执行中的结果
+type ValidationResult struct {
+	Rule       string `json:"rule"`
+	Type       string `json:"type"`
+	Action     string `json:"action"`
+	Passed     int    `json:"passed"`
+	Failed     int    `json:"failed"`
+	FirstError string `json:"first_error,omitempty"` // 第一条失败记录的错误信息
+}
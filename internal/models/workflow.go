@@ -0,0 +1,100 @@
+package models
+
+import "time"
+
+// 工作流依赖边的触发条件
+const (
+	WorkflowConditionSuccess = "success" // 上游成功时执行（默认）
+	WorkflowConditionFailure = "failure" // 上游失败时执行
+	WorkflowConditionAlways  = "always"  // 上游结束（包括被跳过）后执行
+)
+
+// 工作流节点运行状态
+const (
+	WorkflowNodePending = "pending" // 等待上游结束
+	WorkflowNodeQueued  = "queued"  // 可以执行，等待 Worker 领取
+	WorkflowNodeRunning = "running"
+	WorkflowNodeSuccess = "success"
+	WorkflowNodeFailed  = "failed"
+	WorkflowNodeSkipped = "skipped" // 触发条件不满足
+)
+
+// 工作流运行状态
+const (
+	WorkflowRunRunning = "running"
+	WorkflowRunSuccess = "success"
+	WorkflowRunFailed  = "failed"
+)
+
+// DataSourceUpstream 使用工作流上游节点输出作为采集结果的数据源类型
+const DataSourceUpstream = "upstream"
+
+// MaxWorkflowOutputRecords 单个节点传给下游的最大记录数
+const MaxWorkflowOutputRecords = 10000
+
+// Workflow 工作流：由任务节点和依赖边组成的有向无环图
+type Workflow struct {
+	ID          int64              `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Cron        *string            `json:"cron"`          // 为空时只能手动触发
+	NextRunTime *time.Time         `json:"next_run_time"` // 下次执行时间
+	Status      string             `json:"status"`        // enabled, disabled
+	Definition  WorkflowDefinition `json:"definition"`
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+}
+
+// WorkflowDefinition 工作流定义
+type WorkflowDefinition struct {
+	Nodes []WorkflowNode `json:"nodes"`
+	Edges []WorkflowEdge `json:"edges,omitempty"`
+}
+
+// WorkflowNode 工作流节点，执行一个采集任务
+type WorkflowNode struct {
+	Name   string `json:"name"` // 节点名称，工作流内唯一
+	TaskID int64  `json:"task_id"`
+}
+
+// WorkflowEdge 依赖边：From 结束且满足 Condition 后才能执行 To
+type WorkflowEdge struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Condition string `json:"condition,omitempty"` // success（默认）, failure, always
+}
+
+// WorkflowRun 工作流运行记录
+type WorkflowRun struct {
+	ID         int64              `json:"id"`
+	WorkflowID int64              `json:"workflow_id"`
+	Status     string             `json:"status"`  // running, success, failed
+	Trigger    string             `json:"trigger"` // cron, manual
+	Definition WorkflowDefinition `json:"definition"`
+	StartTime  time.Time          `json:"start_time"`
+	EndTime    *time.Time         `json:"end_time"`
+	Nodes      []WorkflowRunNode  `json:"nodes,omitempty"`
+}
+
+// WorkflowRunNode 工作流运行中单个节点的状态
+type WorkflowRunNode struct {
+	ID            int64      `json:"id"`
+	RunID         int64      `json:"run_id"`
+	Node          string     `json:"node"`
+	TaskID        int64      `json:"task_id"`
+	Status        string     `json:"status"`
+	ExecutionID   *int64     `json:"execution_id"`
+	WorkerPod     string     `json:"worker_pod,omitempty"`
+	OutputRecords int        `json:"output_records"` // 传给下游的记录数
+	Error         string     `json:"error,omitempty"`
+	StartedAt     *time.Time `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at"`
+}
+
+// UpstreamConfig 工作流中读取上游节点输出的配置
+// 数据源类型为 upstream 时直接使用上游输出作为采集结果；
+// 其他数据源配置 for_each 时对每条上游记录替换 URL 和请求头中的 {{字段}} 后分别采集
+type UpstreamConfig struct {
+	Nodes   []string `json:"nodes,omitempty"`    // 上游节点名称，为空时使用所有直接上游
+	ForEach bool     `json:"for_each,omitempty"` // 按上游记录逐条采集
+}
@@ -0,0 +1,210 @@
+package processor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/go-ego/gse"
+	"github.com/go-ego/gse/hmm/extracker"
+	"github.com/longbridgeapp/opencc"
+	"github.com/mozillazg/go-pinyin"
+)
+
+// 中文处理使用的词典随依赖一起编译进二进制，首次使用时加载
+
+// defaultKeywordCount 关键词提取默认返回的数量
+const defaultKeywordCount = 5
+
+var (
+	segmenterOnce sync.Once
+	segmenter     gse.Segmenter
+	segmenterErr  error
+
+	extractorOnce sync.Once
+	extractor     *extracker.TagExtracter
+	extractorErr  error
+
+	convertersMu sync.Mutex
+	converters   = make(map[string]*opencc.OpenCC)
+)
+
+// getSegmenter 返回加载了内置简繁体词典的分词器
+func getSegmenter() (*gse.Segmenter, error) {
+	segmenterOnce.Do(func() {
+		segmenter, segmenterErr = gse.NewEmbed("zh")
+		if segmenterErr != nil {
+			segmenterErr = fmt.Errorf("加载分词词典失败: %w", segmenterErr)
+		}
+	})
+	return &segmenter, segmenterErr
+}
+
+// getExtractor 返回使用内置 IDF 词典的关键词提取器
+func getExtractor() (*extracker.TagExtracter, error) {
+	extractorOnce.Do(func() {
+		t := &extracker.TagExtracter{}
+		if err := t.LoadIdfStr(gse.ZhIdf); err != nil {
+			extractorErr = fmt.Errorf("加载 IDF 词典失败: %w", err)
+			return
+		}
+		extractor = t
+	})
+	return extractor, extractorErr
+}
+
+// getConverter 返回简繁转换器，conversion 如 t2s、s2t、s2tw、tw2s、s2hk、hk2s
+func getConverter(conversion string) (*opencc.OpenCC, error) {
+	convertersMu.Lock()
+	defer convertersMu.Unlock()
+
+	if cc, ok := converters[conversion]; ok {
+		return cc, nil
+	}
+	cc, err := opencc.New(conversion)
+	if err != nil {
+		return nil, fmt.Errorf("不支持的简繁转换 %s: %w", conversion, err)
+	}
+	converters[conversion] = cc
+	return cc, nil
+}
+
+// toHalfWidth 全角字符转半角：全角空格转为空格，全角 ASCII 字符（！到～）转为对应的 ASCII 字符
+func toHalfWidth(value string) string {
+	var b strings.Builder
+	b.Grow(len(value))
+	for _, r := range value {
+		switch {
+		case r == '　':
+			b.WriteRune(' ')
+		case r >= '！' && r <= '～':
+			b.WriteRune(r - 0xFEE0)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// toFullWidth 半角字符转全角：空格转为全角空格，可见 ASCII 字符转为对应的全角字符
+func toFullWidth(value string) string {
+	var b strings.Builder
+	b.Grow(len(value) * 3)
+	for _, r := range value {
+		switch {
+		case r == ' ':
+			b.WriteRune('　')
+		case r >= '!' && r <= '~':
+			b.WriteRune(r + 0xFEE0)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// convertChinese 简繁转换，按词组优先匹配（如“头发”转为“頭髮”而不是“頭發”）
+func convertChinese(value, conversion string) (string, error) {
+	cc, err := getConverter(conversion)
+	if err != nil {
+		return value, err
+	}
+	converted, err := cc.Convert(value)
+	if err != nil {
+		return value, fmt.Errorf("简繁转换失败: %w", err)
+	}
+	return converted, nil
+}
+
+// toPinyin 生成拼音，汉字之间以空格分隔，非汉字部分原样保留
+// style: 为空时不带声调（zhong guo），tone 带声调（zhōng guó），tone3 数字声调（zhong1 guo2），initials 首字母（z g）
+func toPinyin(value, style string) (string, error) {
+	args := pinyin.NewArgs()
+	switch style {
+	case "", "normal":
+		args.Style = pinyin.Normal
+	case "tone":
+		args.Style = pinyin.Tone
+	case "tone3":
+		args.Style = pinyin.Tone3
+	case "initials":
+		args.Style = pinyin.FirstLetter
+	default:
+		return value, fmt.Errorf("不支持的拼音风格: %s", style)
+	}
+
+	var parts []string
+	var other strings.Builder
+	flush := func() {
+		if s := strings.TrimSpace(other.String()); s != "" {
+			parts = append(parts, s)
+		}
+		other.Reset()
+	}
+	for _, r := range value {
+		if !unicode.Is(unicode.Han, r) {
+			other.WriteRune(r)
+			continue
+		}
+		flush()
+		if py := pinyin.SinglePinyin(r, args); len(py) > 0 {
+			parts = append(parts, py[0])
+		} else {
+			parts = append(parts, string(r))
+		}
+	}
+	flush()
+	return strings.Join(parts, " "), nil
+}
+
+// segmentWords 分词，去除空白和标点；mode 为 search 时对长词再做细分，便于搜索召回
+func segmentWords(value, mode string) ([]interface{}, error) {
+	seg, err := getSegmenter()
+	if err != nil {
+		return nil, err
+	}
+
+	var words []string
+	switch mode {
+	case "":
+		words = seg.Cut(value, true)
+	case "search":
+		words = seg.CutSearch(value, true)
+	default:
+		return nil, fmt.Errorf("不支持的分词模式: %s", mode)
+	}
+
+	words = seg.TrimPunct(words)
+	result := make([]interface{}, 0, len(words))
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			result = append(result, w)
+		}
+	}
+	return result, nil
+}
+
+// extractKeywords 基于 TF-IDF 提取关键词，按权重从高到低返回，count 为空时返回 5 个
+func extractKeywords(value, count string) ([]interface{}, error) {
+	topK := defaultKeywordCount
+	if count != "" {
+		n, err := strconv.Atoi(count)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("关键词数量必须是正整数: %s", count)
+		}
+		topK = n
+	}
+
+	t, err := getExtractor()
+	if err != nil {
+		return nil, err
+	}
+	tags := t.ExtractTags(value, topK)
+	result := make([]interface{}, len(tags))
+	for i, tag := range tags {
+		result[i] = tag.Text
+	}
+	return result, nil
+}
@@ -0,0 +1,417 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/datafusion/worker/internal/cache"
+	"github.com/datafusion/worker/internal/models"
+)
+
+// defaultDedupWindow time_window 策略默认的去重时间窗口
+const defaultDedupWindow = 24 * time.Hour
+
+// Fingerprint 近似去重的文本指纹
+type Fingerprint struct {
+	Hash     uint64
+	RecordID string
+	Bands    []string // 分段索引键，见 fingerprintBands
+}
+
+// DedupStore 去重键和指纹存储，重启后保留且在多个 Worker 副本之间共享
+type DedupStore interface {
+	// Seen 返回 keys 中已记录且未过期的键
+	Seen(ctx context.Context, scope string, keys []string) (map[string]bool, error)
+	// Mark 记录去重键，ttl 为 0 时永久保留
+	Mark(ctx context.Context, scope string, keys []string, ttl time.Duration) error
+	// FindFingerprints 返回与 bands 中任一分段相同且未过期的指纹（不含 Bands）
+	FindFingerprints(ctx context.Context, scope string, bands []string) ([]Fingerprint, error)
+	// AddFingerprints 按分段记录指纹，ttl 为 0 时永久保留
+	AddFingerprints(ctx context.Context, scope string, fingerprints []Fingerprint, ttl time.Duration) error
+}
+
+// DedupResult 去重结果，数据写入成功后通过 Commit 记录其中的去重键和指纹
+type DedupResult struct {
+	Records    []map[string]interface{}
+	Duplicates int // 去除（或标注）的重复记录数
+
+	keys         []string
+	fingerprints []Fingerprint
+}
+
+// PersistentDeduplicator 基于 DedupStore 的去重器
+// 去重分两步：Deduplicate 过滤批次内和历史上已出现的记录，数据写入成功后再 Commit，
+// 这样写入失败重试时不会把本批数据误判为重复
+type PersistentDeduplicator struct {
+	config        *DeduplicatorConfig
+	store         DedupStore
+	scope         string
+	ttl           time.Duration
+	action        string
+	idField       string
+	annotateField string
+}
+
+// NewPersistentDeduplicator 创建持久化去重器，scope 区分不同任务的去重键
+func NewPersistentDeduplicator(cfg *models.DeduplicationConfig, store DedupStore, scope string) (*PersistentDeduplicator, error) {
+	config, ttl, err := parseDeduplicationConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	d := &PersistentDeduplicator{
+		config:        config,
+		store:         store,
+		scope:         scope,
+		ttl:           ttl,
+		action:        cfg.Action,
+		idField:       cfg.IDField,
+		annotateField: cfg.AnnotateField,
+	}
+	if d.action == "" {
+		d.action = models.NearDuplicateActionDrop
+	}
+	if d.idField == "" {
+		d.idField = "id"
+	}
+	if d.annotateField == "" {
+		d.annotateField = "near_duplicate_of"
+	}
+	return d, nil
+}
+
+// ValidateDeduplicationConfig 校验去重配置，用于保存任务时提前发现错误
+func ValidateDeduplicationConfig(cfg *models.DeduplicationConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	_, _, err := parseDeduplicationConfig(cfg)
+	return err
+}
+
+// parseDeduplicationConfig 将任务中的去重配置转换为去重器配置，并计算去重键的保留时间
+func parseDeduplicationConfig(cfg *models.DeduplicationConfig) (*DeduplicatorConfig, time.Duration, error) {
+	config := &DeduplicatorConfig{
+		Strategy:      DeduplicationStrategy(cfg.Strategy),
+		Fields:        cfg.Fields,
+		Threshold:     cfg.Threshold,
+		CacheSize:     cfg.CacheSize,
+		EnableLogging: cfg.EnableLogging,
+	}
+
+	switch config.Strategy {
+	case StrategyContentHash, StrategyTimeWindow:
+	case StrategyFieldBased:
+		if len(cfg.Fields) == 0 {
+			return nil, 0, fmt.Errorf("field_based 策略需要指定字段")
+		}
+	case StrategyNearDuplicate:
+		if len(cfg.Fields) == 0 {
+			return nil, 0, fmt.Errorf("near_duplicate 策略需要指定文本字段")
+		}
+		if threshold := config.nearThreshold(); threshold < 0 || threshold > maxNearThreshold {
+			return nil, 0, fmt.Errorf("汉明距离阈值应在 0-%d 之间: %d", maxNearThreshold, threshold)
+		}
+		switch cfg.Action {
+		case "", models.NearDuplicateActionDrop, models.NearDuplicateActionAnnotate:
+		default:
+			return nil, 0, fmt.Errorf("不支持的近似重复处理方式: %s", cfg.Action)
+		}
+	default:
+		return nil, 0, fmt.Errorf("未知的去重策略: %s", cfg.Strategy)
+	}
+
+	var ttl time.Duration
+	if cfg.TimeWindow != "" {
+		window, err := time.ParseDuration(cfg.TimeWindow)
+		if err != nil || window <= 0 {
+			return nil, 0, fmt.Errorf("无效的去重时间窗口: %s", cfg.TimeWindow)
+		}
+		ttl = window
+	} else if config.Strategy == StrategyTimeWindow {
+		ttl = defaultDedupWindow
+	}
+	config.TimeWindow = ttl
+
+	return config, ttl, nil
+}
+
+// Strategy 返回去重策略
+func (d *PersistentDeduplicator) Strategy() string {
+	return string(d.config.Strategy)
+}
+
+// Deduplicate 过滤重复记录
+func (d *PersistentDeduplicator) Deduplicate(ctx context.Context, data []map[string]interface{}) (*DedupResult, error) {
+	if len(data) == 0 {
+		return &DedupResult{Records: data}, nil
+	}
+
+	var result *DedupResult
+	var err error
+	if d.config.Strategy == StrategyNearDuplicate {
+		result, err = d.deduplicateNear(ctx, data)
+	} else {
+		result, err = d.deduplicateExact(ctx, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if d.config.EnableLogging {
+		log.Printf("去重完成（%s），输入 %d 条，输出 %d 条，重复 %d 条", d.config.Strategy, len(data), len(result.Records), result.Duplicates)
+	}
+	return result, nil
+}
+
+// deduplicateExact 按去重键精确去重
+func (d *PersistentDeduplicator) deduplicateExact(ctx context.Context, data []map[string]interface{}) (*DedupResult, error) {
+	// 先在批次内去重
+	keys := make([]string, 0, len(data))
+	records := make([]map[string]interface{}, 0, len(data))
+	batch := make(map[string]struct{}, len(data))
+	for _, item := range data {
+		key, err := dedupKey(d.config, item)
+		if err != nil {
+			return nil, fmt.Errorf("生成去重键失败: %w", err)
+		}
+		if _, dup := batch[key]; dup {
+			continue
+		}
+		batch[key] = struct{}{}
+		keys = append(keys, key)
+		records = append(records, item)
+	}
+
+	// 再过滤历史上已出现的记录
+	seen, err := d.store.Seen(ctx, d.scope, keys)
+	if err != nil {
+		return nil, fmt.Errorf("查询去重键失败: %w", err)
+	}
+
+	result := &DedupResult{Records: make([]map[string]interface{}, 0, len(records))}
+	for i, key := range keys {
+		if seen[key] {
+			continue
+		}
+		result.Records = append(result.Records, records[i])
+		result.keys = append(result.keys, key)
+	}
+	result.Duplicates = len(data) - len(result.Records)
+	return result, nil
+}
+
+// deduplicateNear 按文本指纹近似去重，与历史或本批次前面的记录汉明距离不超过阈值时视为重复
+func (d *PersistentDeduplicator) deduplicateNear(ctx context.Context, data []map[string]interface{}) (*DedupResult, error) {
+	prints := make([]*Fingerprint, len(data))
+	var bands []string
+	for i, item := range data {
+		text := nearText(d.config.Fields, item)
+		if text == "" {
+			continue
+		}
+		hash := simHash(text)
+		id, err := d.recordID(item)
+		if err != nil {
+			return nil, err
+		}
+		prints[i] = &Fingerprint{Hash: hash, RecordID: id, Bands: fingerprintBands(hash, d.config.nearThreshold())}
+		bands = append(bands, prints[i].Bands...)
+	}
+
+	existing, err := d.store.FindFingerprints(ctx, d.scope, bands)
+	if err != nil {
+		return nil, fmt.Errorf("查询指纹失败: %w", err)
+	}
+
+	index := make(map[string][]Fingerprint)
+	addToIndex := func(fp Fingerprint) {
+		for _, band := range fp.Bands {
+			index[band] = append(index[band], fp)
+		}
+	}
+	for _, fp := range existing {
+		fp.Bands = fingerprintBands(fp.Hash, d.config.nearThreshold())
+		addToIndex(fp)
+	}
+
+	result := &DedupResult{Records: make([]map[string]interface{}, 0, len(data))}
+	for i, item := range data {
+		fp := prints[i]
+		if fp == nil {
+			// 没有文本的记录不参与近似去重
+			result.Records = append(result.Records, item)
+			continue
+		}
+
+		if match, ok := d.nearest(index, fp); ok {
+			result.Duplicates++
+			if d.action == models.NearDuplicateActionAnnotate {
+				if err := setPath(item, d.annotateField, match.RecordID); err != nil {
+					return nil, fmt.Errorf("标注近似重复失败: %w", err)
+				}
+				result.Records = append(result.Records, item)
+			}
+			continue
+		}
+
+		addToIndex(*fp)
+		result.Records = append(result.Records, item)
+		result.fingerprints = append(result.fingerprints, *fp)
+	}
+	return result, nil
+}
+
+// nearest 返回与指纹汉明距离最小且不超过阈值的已知指纹
+func (d *PersistentDeduplicator) nearest(index map[string][]Fingerprint, fp *Fingerprint) (Fingerprint, bool) {
+	var best Fingerprint
+	bestDistance := d.config.nearThreshold() + 1
+	for _, band := range fp.Bands {
+		for _, candidate := range index[band] {
+			if distance := hammingDistance(candidate.Hash, fp.Hash); distance < bestDistance {
+				best, bestDistance = candidate, distance
+			}
+		}
+	}
+	return best, bestDistance <= d.config.nearThreshold()
+}
+
+// recordID 返回记录 ID，记录没有 ID 字段时使用内容哈希
+func (d *PersistentDeduplicator) recordID(item map[string]interface{}) (string, error) {
+	if value, ok := getPath(item, d.idField); ok && value != nil {
+		if id := stringValue(value); id != "" {
+			return id, nil
+		}
+	}
+	return generateContentHash(item)
+}
+
+// Commit 记录已写入数据的去重键和指纹
+func (d *PersistentDeduplicator) Commit(ctx context.Context, result *DedupResult) error {
+	if len(result.keys) > 0 {
+		if err := d.store.Mark(ctx, d.scope, result.keys, d.ttl); err != nil {
+			return fmt.Errorf("记录去重键失败: %w", err)
+		}
+	}
+	if len(result.fingerprints) > 0 {
+		if err := d.store.AddFingerprints(ctx, d.scope, result.fingerprints, d.ttl); err != nil {
+			return fmt.Errorf("记录指纹失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// CacheDedupStore 基于 cache.Cache（Redis）的去重键存储
+// 去重键每个单独设置过期时间；指纹按分段存放在哈希中，过期时间随值保存，读取时过滤
+type CacheDedupStore struct {
+	cache cache.Cache
+}
+
+// cachedFingerprint 缓存中保存的指纹
+type cachedFingerprint struct {
+	RecordID  string `json:"record_id"`
+	ExpiresAt int64  `json:"expires_at,omitempty"` // Unix 秒，0 表示永久保留
+}
+
+// NewCacheDedupStore 创建基于缓存的去重键存储
+func NewCacheDedupStore(c cache.Cache) *CacheDedupStore {
+	return &CacheDedupStore{cache: c}
+}
+
+// cacheKey 生成缓存键
+func (s *CacheDedupStore) cacheKey(scope, key string) string {
+	return "dedup:" + scope + ":" + key
+}
+
+// bandKey 生成指纹分段的缓存键
+func (s *CacheDedupStore) bandKey(scope, band string) string {
+	return "dedup:" + scope + ":fp:" + band
+}
+
+// Seen 返回已记录且未过期的键
+func (s *CacheDedupStore) Seen(ctx context.Context, scope string, keys []string) (map[string]bool, error) {
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		exists, err := s.cache.Exists(s.cacheKey(scope, key))
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			seen[key] = true
+		}
+	}
+	return seen, nil
+}
+
+// Mark 记录去重键
+func (s *CacheDedupStore) Mark(ctx context.Context, scope string, keys []string, ttl time.Duration) error {
+	for _, key := range keys {
+		if err := s.cache.Set(s.cacheKey(scope, key), 1, ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindFingerprints 返回与任一分段相同且未过期的指纹
+func (s *CacheDedupStore) FindFingerprints(ctx context.Context, scope string, bands []string) ([]Fingerprint, error) {
+	now := time.Now().Unix()
+	found := make(map[uint64]string)
+	for _, band := range bands {
+		entries, err := s.cache.GetAllHash(s.bandKey(scope, band))
+		if err == cache.ErrCacheNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for field, value := range entries {
+			hash, err := strconv.ParseUint(field, 16, 64)
+			if err != nil {
+				continue
+			}
+			var entry cachedFingerprint
+			if err := json.Unmarshal([]byte(value), &entry); err != nil {
+				continue
+			}
+			if entry.ExpiresAt > 0 && entry.ExpiresAt < now {
+				continue
+			}
+			found[hash] = entry.RecordID
+		}
+	}
+
+	fingerprints := make([]Fingerprint, 0, len(found))
+	for hash, id := range found {
+		fingerprints = append(fingerprints, Fingerprint{Hash: hash, RecordID: id})
+	}
+	return fingerprints, nil
+}
+
+// AddFingerprints 按分段记录指纹
+func (s *CacheDedupStore) AddFingerprints(ctx context.Context, scope string, fingerprints []Fingerprint, ttl time.Duration) error {
+	entry := cachedFingerprint{}
+	if ttl > 0 {
+		entry.ExpiresAt = time.Now().Add(ttl).Unix()
+	}
+	for _, fp := range fingerprints {
+		entry.RecordID = fp.RecordID
+		field := strconv.FormatUint(fp.Hash, 16)
+		for _, band := range fp.Bands {
+			key := s.bandKey(scope, band)
+			if err := s.cache.SetHash(key, field, entry); err != nil {
+				return err
+			}
+			// 分段键随最后写入的指纹一起过期，其中已过期的指纹在读取时跳过
+			if ttl > 0 {
+				if err := s.cache.Expire(key, ttl); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
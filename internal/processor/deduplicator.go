@@ -19,12 +19,15 @@ const (
 	StrategyFieldBased DeduplicationStrategy = "field_based"
 	// StrategyTimeWindow 基于时间窗口去重
 	StrategyTimeWindow DeduplicationStrategy = "time_window"
+	// StrategyNearDuplicate 基于 SimHash 的近似去重
+	StrategyNearDuplicate DeduplicationStrategy = "near_duplicate"
 )
 
 // DeduplicatorConfig 去重器配置
 type DeduplicatorConfig struct {
 	Strategy      DeduplicationStrategy `json:"strategy"`
-	Fields        []string              `json:"fields"`         // 用于 field_based 策略
+	Fields        []string              `json:"fields"`         // 用于 field_based 策略，near_duplicate 策略的文本字段
+	Threshold     *int                  `json:"threshold"`      // 用于 near_duplicate 策略，最大汉明距离，为空时使用默认值
 	TimeWindow    time.Duration         `json:"time_window"`    // 用于 time_window 策略
 	CacheSize     int                   `json:"cache_size"`     // 缓存大小
 	EnableLogging bool                  `json:"enable_logging"` // 是否记录去重日志
@@ -34,6 +37,7 @@ type DeduplicatorConfig struct {
 type Deduplicator struct {
 	config    *DeduplicatorConfig
 	cache     map[string]time.Time // 哈希 -> 时间戳
+	prints    []uint64             // near_duplicate 策略的指纹
 	mu        sync.RWMutex
 	stats     *DeduplicationStats
 	cleanupCh chan struct{}
@@ -55,7 +59,6 @@ func NewDeduplicator(config *DeduplicatorConfig) *Deduplicator {
 	if config.TimeWindow == 0 {
 		config.TimeWindow = 24 * time.Hour // 默认 24 小时
 	}
-
 	d := &Deduplicator{
 		config:    config,
 		cache:     make(map[string]time.Time),
@@ -109,20 +112,11 @@ func (d *Deduplicator) Deduplicate(data []map[string]interface{}) ([]map[string]
 
 // isDuplicate 检查是否重复
 func (d *Deduplicator) isDuplicate(item map[string]interface{}) (bool, error) {
-	var key string
-	var err error
-
-	switch d.config.Strategy {
-	case StrategyContentHash:
-		key, err = d.generateContentHash(item)
-	case StrategyFieldBased:
-		key, err = d.generateFieldHash(item)
-	case StrategyTimeWindow:
-		key, err = d.generateContentHash(item)
-	default:
-		return false, fmt.Errorf("未知的去重策略: %s", d.config.Strategy)
+	if d.config.Strategy == StrategyNearDuplicate {
+		return d.isNearDuplicate(item), nil
 	}
 
+	key, err := dedupKey(d.config, item)
 	if err != nil {
 		return false, err
 	}
@@ -155,8 +149,44 @@ func (d *Deduplicator) isDuplicate(item map[string]interface{}) (bool, error) {
 	return false, nil
 }
 
+// isNearDuplicate 检查是否与已处理的记录内容相近
+func (d *Deduplicator) isNearDuplicate(item map[string]interface{}) bool {
+	text := nearText(d.config.Fields, item)
+	if text == "" {
+		return false
+	}
+	fingerprint := simHash(text)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, p := range d.prints {
+		if hammingDistance(p, fingerprint) <= d.config.nearThreshold() {
+			return true
+		}
+	}
+
+	d.prints = append(d.prints, fingerprint)
+	if len(d.prints) > d.config.CacheSize {
+		d.prints = d.prints[1:]
+	}
+	return false
+}
+
+// dedupKey 按策略生成记录的去重键
+func dedupKey(config *DeduplicatorConfig, item map[string]interface{}) (string, error) {
+	switch config.Strategy {
+	case StrategyContentHash, StrategyTimeWindow:
+		return generateContentHash(item)
+	case StrategyFieldBased:
+		return generateFieldHash(config.Fields, item)
+	default:
+		return "", fmt.Errorf("未知的去重策略: %s", config.Strategy)
+	}
+}
+
 // generateContentHash 生成内容哈希
-func (d *Deduplicator) generateContentHash(item map[string]interface{}) (string, error) {
+func generateContentHash(item map[string]interface{}) (string, error) {
 	// 序列化为 JSON
 	jsonData, err := json.Marshal(item)
 	if err != nil {
@@ -168,16 +198,16 @@ func (d *Deduplicator) generateContentHash(item map[string]interface{}) (string,
 	return fmt.Sprintf("%x", hash), nil
 }
 
-// generateFieldHash 基于指定字段生成哈希
-func (d *Deduplicator) generateFieldHash(item map[string]interface{}) (string, error) {
-	if len(d.config.Fields) == 0 {
+// generateFieldHash 基于指定字段生成哈希，字段支持嵌套路径
+func generateFieldHash(fields []string, item map[string]interface{}) (string, error) {
+	if len(fields) == 0 {
 		return "", fmt.Errorf("field_based 策略需要指定字段")
 	}
 
 	// 提取指定字段
 	fieldData := make(map[string]interface{})
-	for _, field := range d.config.Fields {
-		if value, exists := item[field]; exists {
+	for _, field := range fields {
+		if value, exists := getPath(item, field); exists {
 			fieldData[field] = value
 		}
 	}
@@ -280,6 +310,7 @@ func (d *Deduplicator) ClearCache() {
 	defer d.mu.Unlock()
 
 	d.cache = make(map[string]time.Time)
+	d.prints = nil
 	if d.config.EnableLogging {
 		log.Println("已清空去重缓存")
 	}
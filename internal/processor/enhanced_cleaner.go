@@ -3,7 +3,6 @@ package processor
 import (
 	"fmt"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
 	"unicode"
@@ -13,7 +12,8 @@ import (
 
 // EnhancedCleaner 增强的数据清洗器
 type EnhancedCleaner struct {
-	rules []models.CleaningRule
+	rules       []models.CleaningRule
+	collectedAt time.Time // 相对时间（如 3小时前）的基准，为空时使用当前时间
 }
 
 // NewEnhancedCleaner 创建增强清洗器
@@ -23,17 +23,18 @@ func NewEnhancedCleaner(rules []models.CleaningRule) *EnhancedCleaner {
 	}
 }
 
+// WithCollectedAt 返回以 collectedAt 作为相对时间基准的清洗器
+func (c *EnhancedCleaner) WithCollectedAt(collectedAt time.Time) *EnhancedCleaner {
+	return &EnhancedCleaner{rules: c.rules, collectedAt: collectedAt}
+}
+
 // Clean 执行数据清洗
 func (c *EnhancedCleaner) Clean(data []map[string]interface{}) ([]map[string]interface{}, error) {
 	result := make([]map[string]interface{}, 0, len(data))
 
 	for _, item := range data {
-		cleaned := make(map[string]interface{})
-		
-		// 复制原始数据
-		for k, v := range item {
-			cleaned[k] = v
-		}
+		// 复制原始数据（深拷贝，清洗嵌套字段时不修改原始记录）
+		cleaned := deepCopyRecord(item)
 
 		// 应用清洗规则
 		for _, rule := range c.rules {
@@ -48,13 +49,64 @@ func (c *EnhancedCleaner) Clean(data []map[string]interface{}) ([]map[string]int
 	return result, nil
 }
 
-// applyRule 应用单个清洗规则
+// CleanEach 逐条清洗数据，某条记录应用规则失败时不影响其他记录，
+// 失败的记录（清洗前的原始数据）连同失败的规则一起返回
+func (c *EnhancedCleaner) CleanEach(data []map[string]interface{}) ([]map[string]interface{}, []models.DeadLetterRecord) {
+	result := make([]map[string]interface{}, 0, len(data))
+	var rejected []models.DeadLetterRecord
+
+	for _, item := range data {
+		cleaned := deepCopyRecord(item)
+
+		var failed error
+		var failedRule string
+		for _, rule := range c.rules {
+			if err := c.applyRule(cleaned, rule); err != nil {
+				failed = err
+				failedRule = rule.Name
+				if failedRule == "" {
+					failedRule = rule.Type
+				}
+				break
+			}
+		}
+
+		if failed != nil {
+			rejected = append(rejected, models.DeadLetterRecord{
+				Stage:  models.DeadLetterStageClean,
+				Rule:   failedRule,
+				Error:  failed.Error(),
+				Record: item,
+			})
+			continue
+		}
+		result = append(result, cleaned)
+	}
+
+	return result, rejected
+}
+
+// applyRule 应用单个清洗规则，字段支持嵌套路径（如 author.name、items[*].title），字段不存在时跳过
+// 配置了 target_field 时结果写入目标字段，原字段保持不变
 func (c *EnhancedCleaner) applyRule(data map[string]interface{}, rule models.CleaningRule) error {
-	value, exists := data[rule.Field]
-	if !exists {
-		return nil // 字段不存在，跳过
+	if rule.TargetField != "" && rule.TargetField != rule.Field {
+		value, ok := getPath(data, rule.Field)
+		if !ok {
+			return nil
+		}
+		cleaned, err := c.cleanValue(value, rule)
+		if err != nil {
+			return err
+		}
+		return setPath(data, rule.TargetField, cleaned)
 	}
+	return updatePath(data, rule.Field, func(value interface{}) (interface{}, error) {
+		return c.cleanValue(value, rule)
+	})
+}
 
+// cleanValue 对单个字段值应用清洗规则
+func (c *EnhancedCleaner) cleanValue(value interface{}, rule models.CleaningRule) (interface{}, error) {
 	// 转换为字符串
 	strValue := fmt.Sprintf("%v", value)
 
@@ -73,25 +125,43 @@ func (c *EnhancedCleaner) applyRule(data map[string]interface{}, rule models.Cle
 	case "remove_special_chars":
 		result = c.cleanRemoveSpecialChars(strValue)
 	case "date_format":
-		result, err = c.cleanDateFormat(strValue, rule.Pattern)
+		result, err = c.cleanDateFormat(strValue, rule)
 	case "number_format":
-		result, err = c.cleanNumberFormat(strValue)
+		result, err = parseLocalizedNumber(strValue, rule.Locale)
+	case "currency":
+		// pattern 为值中没有货币符号时使用的货币代码
+		result, err = parseCurrency(strValue, rule.Locale, rule.Pattern)
 	case "email_validate":
 		result, err = c.cleanEmailValidate(strValue)
 	case "phone_format":
 		result, err = c.cleanPhoneFormat(strValue)
 	case "url_normalize":
 		result = c.cleanURLNormalize(strValue)
+	case "to_halfwidth":
+		result = toHalfWidth(strValue)
+	case "to_fullwidth":
+		result = toFullWidth(strValue)
+	case "t2s", "s2t":
+		// pattern 可指定地区变体，如 s2tw、tw2s、s2hk
+		conversion := rule.Pattern
+		if conversion == "" {
+			conversion = rule.Type
+		}
+		result, err = convertChinese(strValue, conversion)
+	case "pinyin":
+		result, err = toPinyin(strValue, rule.Pattern)
+	case "segment":
+		result, err = segmentWords(strValue, rule.Pattern)
+	case "keywords":
+		result, err = extractKeywords(strValue, rule.Pattern)
 	default:
-		return fmt.Errorf("未知的清洗规则类型: %s", rule.Type)
+		return nil, fmt.Errorf("未知的清洗规则类型: %s", rule.Type)
 	}
 
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	data[rule.Field] = result
-	return nil
+	return result, nil
 }
 
 // cleanTrim 去除首尾空白
@@ -116,9 +186,8 @@ func (c *EnhancedCleaner) cleanRegex(value, pattern, replacement string) (string
 
 // cleanNormalizeWhitespace 规范化空白字符
 func (c *EnhancedCleaner) cleanNormalizeWhitespace(value string) string {
-	// 替换多个空白字符为单个空格
-	re := regexp.MustCompile(`\s+`)
-	return strings.TrimSpace(re.ReplaceAllString(value, " "))
+	// 替换多个空白字符（包括全角空格、不换行空格）为单个空格
+	return strings.Join(strings.Fields(value), " ")
 }
 
 // cleanRemoveSpecialChars 移除特殊字符
@@ -132,35 +201,23 @@ func (c *EnhancedCleaner) cleanRemoveSpecialChars(value string) string {
 	return result.String()
 }
 
-// cleanDateFormat 日期格式化
-func (c *EnhancedCleaner) cleanDateFormat(value, targetFormat string) (string, error) {
-	// 尝试多种常见日期格式
-	formats := []string{
-		"2006-01-02",
-		"2006/01/02",
-		"02-01-2006",
-		"02/01/2006",
-		"2006-01-02 15:04:05",
-		"2006/01/02 15:04:05",
-		time.RFC3339,
-		time.RFC1123,
-	}
-
-	var parsedTime time.Time
-	var err error
-
-	for _, format := range formats {
-		parsedTime, err = time.Parse(format, value)
-		if err == nil {
-			break
-		}
+// cleanDateFormat 日期格式化，支持中文日期、相对时间（以采集时间为基准）和时间戳
+// 带时间的值转换为 UTC 后按 pattern 输出，只有日期的值不做时区转换
+func (c *EnhancedCleaner) cleanDateFormat(value string, rule models.CleaningRule) (string, error) {
+	loc, err := loadLocation(rule.Timezone)
+	if err != nil {
+		return value, err
 	}
-
+	parsedTime, dateOnly, err := newDateParser(rule.Locale, loc, c.collectedAt).Parse(value)
 	if err != nil {
-		return value, fmt.Errorf("无法解析日期: %s", value)
+		return value, err
+	}
+	if !dateOnly {
+		parsedTime = parsedTime.UTC()
 	}
 
 	// 如果没有指定目标格式，使用 ISO 8601
+	targetFormat := rule.Pattern
 	if targetFormat == "" {
 		targetFormat = "2006-01-02"
 	}
@@ -168,22 +225,6 @@ func (c *EnhancedCleaner) cleanDateFormat(value, targetFormat string) (string, e
 	return parsedTime.Format(targetFormat), nil
 }
 
-// cleanNumberFormat 数字格式化
-func (c *EnhancedCleaner) cleanNumberFormat(value string) (float64, error) {
-	// 移除常见的数字分隔符
-	cleaned := strings.ReplaceAll(value, ",", "")
-	cleaned = strings.ReplaceAll(cleaned, " ", "")
-	cleaned = strings.TrimSpace(cleaned)
-
-	// 尝试解析为浮点数
-	num, err := strconv.ParseFloat(cleaned, 64)
-	if err != nil {
-		return 0, fmt.Errorf("无法解析数字: %s", value)
-	}
-
-	return num, nil
-}
-
 // cleanEmailValidate 邮箱验证和规范化
 func (c *EnhancedCleaner) cleanEmailValidate(value string) (string, error) {
 	// 简单的邮箱正则
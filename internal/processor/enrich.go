@@ -0,0 +1,447 @@
+package processor
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/datafusion/worker/internal/models"
+)
+
+// MaxReferenceRows 单个参考数据集最多加载的行数
+const MaxReferenceRows = 200000
+
+// ReferenceLoader 关联补充使用的参考数据加载器，由 Worker 提供数据库、文件和缓存访问
+type ReferenceLoader interface {
+	// QuerySQL 在 database（只支持 data）上执行只读查询，超过 maxRows 行时返回错误
+	QuerySQL(database, query string, maxRows int) ([]map[string]interface{}, error)
+	// OpenFile 打开参考数据目录下的文件
+	OpenFile(path string) (io.ReadCloser, error)
+	// GetAllHash 读取缓存哈希的所有字段
+	GetAllHash(key string) (map[string]string, error)
+}
+
+// referenceTable 加载的参考数据集，同一次处理中相同数据源只加载一次
+type referenceTable struct {
+	rows    []map[string]interface{}
+	columns map[string]bool
+	indexes map[string]map[string]map[string]interface{} // 按 lookup 列和匹配方式建立的索引
+}
+
+// ValidateEnrichments 校验关联补充配置
+func ValidateEnrichments(enrichments []models.EnrichmentConfig) error {
+	for i := range enrichments {
+		e := &enrichments[i]
+		name := enrichmentName(e, i)
+		if err := validateEnrichment(e); err != nil {
+			return fmt.Errorf("关联补充 %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func validateEnrichment(e *models.EnrichmentConfig) error {
+	switch e.Source {
+	case models.EnrichmentSourceSQL:
+		query := strings.ToLower(strings.TrimSpace(e.Query))
+		if !strings.HasPrefix(query, "select") && !strings.HasPrefix(query, "with") {
+			return fmt.Errorf("query 必须是 SELECT 查询")
+		}
+		// 控制数据库中有用户、API 密钥和数据源凭据，不允许任务查询
+		if e.Database != "" && e.Database != "data" {
+			return fmt.Errorf("不支持的数据库: %s，只能查询数据存储数据库（data）", e.Database)
+		}
+	case models.EnrichmentSourceCSV:
+		if e.Path == "" {
+			return fmt.Errorf("未指定 path")
+		}
+		if path.IsAbs(e.Path) || strings.HasPrefix(path.Clean(e.Path), "..") {
+			return fmt.Errorf("path 必须是参考数据目录下的相对路径")
+		}
+		if len([]rune(e.Delimiter)) > 1 {
+			return fmt.Errorf("delimiter 只能是单个字符")
+		}
+	case models.EnrichmentSourceCache:
+		if e.CacheKey == "" {
+			return fmt.Errorf("未指定 cache_key")
+		}
+	default:
+		return fmt.Errorf("不支持的数据源: %s", e.Source)
+	}
+
+	if len(e.KeyFields) == 0 {
+		return fmt.Errorf("未指定 key_fields")
+	}
+	for _, field := range e.KeyFields {
+		if _, err := parsePath(field); err != nil {
+			return fmt.Errorf("关联字段 %s: %w", field, err)
+		}
+	}
+	if e.Source != models.EnrichmentSourceCache && len(e.LookupFields) > 0 && len(e.LookupFields) != len(e.KeyFields) {
+		return fmt.Errorf("lookup_fields 与 key_fields 的数量不一致")
+	}
+	if e.Match != "" && e.Match != "exact" && e.Match != "normalized" {
+		return fmt.Errorf("不支持的匹配方式: %s", e.Match)
+	}
+
+	if len(e.Fields) == 0 && e.Target == "" {
+		return fmt.Errorf("未指定 fields 或 target")
+	}
+	for target := range e.Fields {
+		if _, err := parsePath(target); err != nil {
+			return fmt.Errorf("目标字段 %s: %w", target, err)
+		}
+	}
+	if e.Target != "" {
+		if _, err := parsePath(e.Target); err != nil {
+			return fmt.Errorf("目标字段 %s: %w", e.Target, err)
+		}
+	}
+
+	switch e.OnMiss {
+	case "", models.EnrichmentMissKeep, models.EnrichmentMissDrop, models.EnrichmentMissReject:
+	case models.EnrichmentMissDefault:
+		if len(e.Defaults) == 0 {
+			return fmt.Errorf("on_miss 为 default 时需要配置 defaults")
+		}
+	default:
+		return fmt.Errorf("不支持的 on_miss: %s", e.OnMiss)
+	}
+	return nil
+}
+
+func enrichmentName(e *models.EnrichmentConfig, index int) string {
+	if e.Name != "" {
+		return e.Name
+	}
+	return fmt.Sprintf("#%d(%s)", index+1, e.Source)
+}
+
+// enrichStage 关联补充阶段，依次执行每个关联补充
+type enrichStage struct {
+	name        string
+	enrichments []models.EnrichmentConfig
+}
+
+func newEnrichStage(config *models.StageConfig, processor *models.ProcessorConfig) (Stage, error) {
+	enrichments := config.Enrichments
+	if len(enrichments) == 0 {
+		enrichments = processor.Enrichments
+	}
+	if len(enrichments) == 0 {
+		return nil, fmt.Errorf("未配置 enrichments")
+	}
+	if err := ValidateEnrichments(enrichments); err != nil {
+		return nil, err
+	}
+	return &enrichStage{name: nameOr(config.Name, StageEnrich), enrichments: enrichments}, nil
+}
+
+func (s *enrichStage) Name() string { return s.name }
+
+func (s *enrichStage) Process(ctx *StageContext, data []map[string]interface{}) ([]map[string]interface{}, error) {
+	for i := range s.enrichments {
+		e := &s.enrichments[i]
+		name := enrichmentName(e, i)
+		table, err := ctx.referenceTable(e)
+		if err != nil {
+			return nil, fmt.Errorf("加载关联补充 %s 的参考数据失败: %w", name, err)
+		}
+		index, err := table.index(e)
+		if err != nil {
+			return nil, fmt.Errorf("关联补充 %s: %w", name, err)
+		}
+
+		result := make([]map[string]interface{}, 0, len(data))
+		matched, missed := 0, 0
+		for _, record := range data {
+			enriched := deepCopyRecord(record)
+			row, ok := index[enrichmentRecordKey(enriched, e)]
+			if !ok {
+				missed++
+				switch e.OnMiss {
+				case models.EnrichmentMissDrop:
+					continue
+				case models.EnrichmentMissReject:
+					ctx.Reject(models.DeadLetterStageEnrich, name, record, fmt.Errorf("关联补充 %s 未匹配到参考数据", name))
+					continue
+				case models.EnrichmentMissDefault:
+					for field, value := range e.Defaults {
+						if err := setPath(enriched, field, value); err != nil {
+							return nil, fmt.Errorf("写入字段 %s 失败: %w", field, err)
+						}
+					}
+				}
+				result = append(result, enriched)
+				continue
+			}
+
+			matched++
+			for target, column := range e.Fields {
+				if err := setPath(enriched, target, row[column]); err != nil {
+					return nil, fmt.Errorf("写入字段 %s 失败: %w", target, err)
+				}
+			}
+			if e.Target != "" {
+				copied := make(map[string]interface{}, len(row))
+				for k, v := range row {
+					copied[k] = v
+				}
+				if err := setPath(enriched, e.Target, copied); err != nil {
+					return nil, fmt.Errorf("写入字段 %s 失败: %w", e.Target, err)
+				}
+			}
+			result = append(result, enriched)
+		}
+
+		log.Printf("关联补充 %s: 参考数据 %d 行，匹配 %d 条，未匹配 %d 条", name, len(table.rows), matched, missed)
+		data = result
+	}
+	return data, nil
+}
+
+// referenceTable 返回关联补充的参考数据，同一次处理中相同数据源只加载一次
+func (c *StageContext) referenceTable(e *models.EnrichmentConfig) (*referenceTable, error) {
+	key := strings.Join([]string{e.Source, e.Database, e.Query, e.Path, e.Delimiter, e.CacheKey}, "\x00")
+	if table, ok := c.references[key]; ok {
+		return table, nil
+	}
+	if c.ReferenceLoader == nil {
+		return nil, fmt.Errorf("未配置参考数据加载器")
+	}
+
+	rows, err := loadReferenceRows(c.ReferenceLoader, e)
+	if err != nil {
+		return nil, err
+	}
+	table := &referenceTable{rows: rows, columns: make(map[string]bool), indexes: make(map[string]map[string]map[string]interface{})}
+	for _, row := range rows {
+		for column := range row {
+			table.columns[column] = true
+		}
+	}
+	if c.references == nil {
+		c.references = make(map[string]*referenceTable)
+	}
+	c.references[key] = table
+	return table, nil
+}
+
+// loadReferenceRows 从数据源加载参考数据
+func loadReferenceRows(loader ReferenceLoader, e *models.EnrichmentConfig) ([]map[string]interface{}, error) {
+	switch e.Source {
+	case models.EnrichmentSourceSQL:
+		if e.Database != "" && e.Database != "data" {
+			return nil, fmt.Errorf("不支持的数据库: %s", e.Database)
+		}
+		return loader.QuerySQL("data", e.Query, MaxReferenceRows)
+
+	case models.EnrichmentSourceCSV:
+		file, err := loader.OpenFile(e.Path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return readReferenceCSV(file, e.Delimiter)
+
+	default: // cache
+		hash, err := loader.GetAllHash(e.CacheKey)
+		if err != nil {
+			return nil, fmt.Errorf("读取缓存 %s 失败: %w", e.CacheKey, err)
+		}
+		if len(hash) > MaxReferenceRows {
+			return nil, fmt.Errorf("参考数据超过 %d 行", MaxReferenceRows)
+		}
+		rows := make([]map[string]interface{}, 0, len(hash))
+		for field, value := range hash {
+			row := map[string]interface{}{}
+			if err := json.Unmarshal([]byte(value), &row); err != nil || row == nil {
+				row = map[string]interface{}{"value": value}
+			}
+			row[cacheKeyColumn] = field
+			rows = append(rows, row)
+		}
+		return rows, nil
+	}
+}
+
+// cacheKeyColumn cache 数据源中保存哈希字段的列
+const cacheKeyColumn = "key"
+
+// readReferenceCSV 读取 CSV 参考数据，第一行为列名
+func readReferenceCSV(r io.Reader, delimiter string) ([]map[string]interface{}, error) {
+	reader := csv.NewReader(r)
+	if delimiter != "" {
+		reader.Comma = []rune(delimiter)[0]
+	}
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取 CSV 列名失败: %w", err)
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	var rows []map[string]interface{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取 CSV 失败: %w", err)
+		}
+		if len(rows) >= MaxReferenceRows {
+			return nil, fmt.Errorf("参考数据超过 %d 行", MaxReferenceRows)
+		}
+		row := make(map[string]interface{}, len(header))
+		for i, column := range header {
+			if i < len(record) {
+				row[column] = record[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// index 按关联补充的 lookup 列和匹配方式返回参考数据索引，键重复时保留第一行
+func (t *referenceTable) index(e *models.EnrichmentConfig) (map[string]map[string]interface{}, error) {
+	lookup := enrichmentLookupFields(e)
+	key := strings.Join(lookup, "\x00") + "\x00" + e.Match
+	if index, ok := t.indexes[key]; ok {
+		return index, nil
+	}
+
+	if len(t.rows) > 0 {
+		for _, column := range lookup {
+			if !t.columns[column] {
+				return nil, fmt.Errorf("参考数据缺少列 %s", column)
+			}
+		}
+		for target, column := range e.Fields {
+			if !t.columns[column] {
+				return nil, fmt.Errorf("参考数据缺少列 %s（写入 %s）", column, target)
+			}
+		}
+	}
+
+	index := make(map[string]map[string]interface{}, len(t.rows))
+	duplicates := 0
+	for _, row := range t.rows {
+		parts := make([]string, len(lookup))
+		complete := true
+		for i, column := range lookup {
+			value, ok := enrichmentKeyPart(row[column], e.Match)
+			if !ok {
+				complete = false
+				break
+			}
+			parts[i] = value
+		}
+		if !complete {
+			continue
+		}
+		k := strings.Join(parts, "\x1f")
+		if _, exists := index[k]; exists {
+			duplicates++
+			continue
+		}
+		index[k] = row
+	}
+	if duplicates > 0 {
+		log.Printf("警告: 参考数据中有 %d 行的关联键重复，使用第一行", duplicates)
+	}
+	t.indexes[key] = index
+	return index, nil
+}
+
+// enrichmentLookupFields 参考数据中的关联列
+func enrichmentLookupFields(e *models.EnrichmentConfig) []string {
+	if e.Source == models.EnrichmentSourceCache {
+		return []string{cacheKeyColumn}
+	}
+	if len(e.LookupFields) > 0 {
+		return e.LookupFields
+	}
+	return e.KeyFields
+}
+
+// enrichmentRecordKey 记录的关联键，缺少任一关联字段时返回空字符串（不会匹配）
+// cache 数据源的多个关联字段用 ":" 连接后作为哈希字段
+func enrichmentRecordKey(record map[string]interface{}, e *models.EnrichmentConfig) string {
+	values := make([]string, len(e.KeyFields))
+	for i, field := range e.KeyFields {
+		value, ok := getPath(record, field)
+		if !ok {
+			return "\x00"
+		}
+		text, ok := keyText(value)
+		if !ok {
+			return "\x00"
+		}
+		values[i] = text
+	}
+
+	if e.Source == models.EnrichmentSourceCache {
+		key, _ := enrichmentKeyPart(strings.Join(values, ":"), e.Match)
+		return key
+	}
+	for i := range values {
+		values[i], _ = enrichmentKeyPart(values[i], e.Match)
+	}
+	return strings.Join(values, "\x1f")
+}
+
+// enrichmentKeyPart 将关联键的一部分转换为文本，normalized 匹配时做规范化
+func enrichmentKeyPart(value interface{}, match string) (string, bool) {
+	text, ok := keyText(value)
+	if !ok {
+		return "", false
+	}
+	if match == "normalized" {
+		text = normalizeKey(text)
+	}
+	return text, true
+}
+
+// keyText 将关联键的值转换为文本，整数形式的浮点数（JSON 数字）按整数格式化
+func keyText(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case float64:
+		if v == float64(int64(v)) {
+			return strconv.FormatInt(int64(v), 10), true
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// normalizeKey 规范化关联键：全角转半角、转小写、去除空白和标点符号
+// 如 "阿里巴巴（中国）有限公司" 与 "阿里巴巴(中国) 有限公司" 规范化后相同
+func normalizeKey(value string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(toHalfWidth(value)) {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package processor
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// 转换规则和校验规则中的表达式与脚本阶段使用相同的默认限制
+// expr 不能按执行步数中断，range、map、filter 等生成的元素数受 VM 内存预算限制，上限与脚本的步数上限相同
+func init() {
+	vm.MemoryBudget = defaultScriptMaxSteps
+}
+
+// limitedProgram 限制执行时间的表达式
+type limitedProgram struct {
+	program  *vm.Program
+	timeout  time.Duration
+	timedOut int32 // 曾经超时，之后的计算直接返回错误，避免后台堆积超时的计算
+}
+
+// compileExpression 编译表达式，每条记录的计算时间上限与脚本阶段相同
+func compileExpression(expression string, options ...expr.Option) (*limitedProgram, error) {
+	program, err := expr.Compile(expression, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &limitedProgram{program: program, timeout: defaultScriptTimeoutMs * time.Millisecond}, nil
+}
+
+// run 计算表达式，超时后返回错误
+// 计算使用记录的副本：超时的计算无法中断，在后台结束后丢弃结果，不会与之后对记录的修改冲突
+func (p *limitedProgram) run(record map[string]interface{}) (interface{}, error) {
+	if atomic.LoadInt32(&p.timedOut) == 1 {
+		return nil, fmt.Errorf("执行超时（%s）", p.timeout)
+	}
+
+	type result struct {
+		value interface{}
+		err   error
+	}
+	done := make(chan result, 1)
+	env := deepCopyRecord(record)
+	go func() {
+		value, err := expr.Run(p.program, env)
+		done <- result{value, err}
+	}()
+
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-timer.C:
+		atomic.StoreInt32(&p.timedOut, 1)
+		return nil, fmt.Errorf("执行超时（%s）", p.timeout)
+	}
+}
@@ -0,0 +1,389 @@
+package processor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 字段路径语法（清洗规则的 field、转换规则的 source_field / target_field 等均支持）：
+//   - 顶层字段：title（记录中存在同名键时优先按顶层键处理，兼容键名本身含 "." 的数据）
+//   - 嵌套字段：author.name 或 JSONPath 风格 $.author.name
+//   - 数组下标：items[0].price 或 items.0.price
+//   - 数组通配：items[*].price，对数组中每个元素生效（rename、convert、lookup 的目标字段须在同一元素内，如 items[*].amount）
+//   - 特殊键名：meta['content-type']
+
+// pathSegment 字段路径中的一段
+type pathSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parsePath 解析字段路径
+func parsePath(path string) ([]pathSegment, error) {
+	path = strings.TrimSpace(path)
+	if path == "$" {
+		return nil, nil
+	}
+	path = strings.TrimPrefix(path, "$.")
+	path = strings.TrimPrefix(path, "$")
+
+	var segments []pathSegment
+	var key strings.Builder
+	flush := func() {
+		if key.Len() > 0 {
+			segments = append(segments, pathSegment{key: key.String()})
+			key.Reset()
+		}
+	}
+
+	for i := 0; i < len(path); i++ {
+		switch ch := path[i]; ch {
+		case '.':
+			flush()
+		case '[':
+			flush()
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("字段路径 %s 缺少 ]", path)
+			}
+			content := strings.TrimSpace(path[i+1 : i+end])
+			i += end
+			switch {
+			case content == "*":
+				segments = append(segments, pathSegment{wildcard: true})
+			case len(content) >= 2 && (content[0] == '\'' || content[0] == '"') && content[len(content)-1] == content[0]:
+				segments = append(segments, pathSegment{key: content[1 : len(content)-1]})
+			default:
+				index, err := strconv.Atoi(content)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("字段路径 %s 中的下标无效: %s", path, content)
+				}
+				segments = append(segments, pathSegment{index: index, isIndex: true})
+			}
+		default:
+			key.WriteByte(ch)
+		}
+	}
+	flush()
+
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("字段路径为空")
+	}
+	return segments, nil
+}
+
+// 叶子节点上的操作
+const (
+	pathKeep = iota
+	pathSet
+	pathDelete
+)
+
+// leafFunc 处理路径末端的值，返回新值和要执行的操作
+type leafFunc func(value interface{}, exists bool) (interface{}, int, error)
+
+// walkPath 沿路径访问记录，create 为 true 时自动创建缺失的中间对象
+func walkPath(record map[string]interface{}, path string, create bool, fn leafFunc) error {
+	// 顶层存在同名键时直接按顶层键处理
+	if _, ok := record[path]; ok || !isNestedPath(path) {
+		value, exists := record[path]
+		newValue, op, err := fn(value, exists)
+		if err != nil {
+			return err
+		}
+		applyLeaf(record, path, newValue, op)
+		return nil
+	}
+
+	segments, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	_, err = walkNode(record, segments, create, fn)
+	return err
+}
+
+// isNestedPath 判断字段名是否使用了路径语法
+func isNestedPath(path string) bool {
+	return strings.ContainsAny(path, ".[$")
+}
+
+// applyLeaf 在对象上执行叶子操作
+func applyLeaf(m map[string]interface{}, key string, value interface{}, op int) {
+	switch op {
+	case pathSet:
+		m[key] = value
+	case pathDelete:
+		delete(m, key)
+	}
+}
+
+// walkNode 递归访问节点，返回（可能被替换的）节点
+func walkNode(node interface{}, segments []pathSegment, create bool, fn leafFunc) (interface{}, error) {
+	seg := segments[0]
+	last := len(segments) == 1
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if seg.isIndex || seg.wildcard {
+			return node, nil
+		}
+		child, exists := n[seg.key]
+		if last {
+			newValue, op, err := fn(child, exists)
+			if err != nil {
+				return node, err
+			}
+			applyLeaf(n, seg.key, newValue, op)
+			return n, nil
+		}
+		if !exists || child == nil {
+			if !create {
+				return node, nil
+			}
+			child = map[string]interface{}{}
+		}
+		newChild, err := walkNode(child, segments[1:], create, fn)
+		if err != nil {
+			return node, err
+		}
+		n[seg.key] = newChild
+		return n, nil
+
+	case []interface{}:
+		if seg.wildcard {
+			result := n[:0:0]
+			for _, item := range n {
+				if last {
+					newValue, op, err := fn(item, true)
+					if err != nil {
+						return node, err
+					}
+					switch op {
+					case pathSet:
+						item = newValue
+					case pathDelete:
+						continue
+					}
+				} else {
+					newItem, err := walkNode(item, segments[1:], create, fn)
+					if err != nil {
+						return node, err
+					}
+					item = newItem
+				}
+				result = append(result, item)
+			}
+			return result, nil
+		}
+
+		index := seg.index
+		if !seg.isIndex {
+			i, err := strconv.Atoi(seg.key)
+			if err != nil {
+				return node, nil
+			}
+			index = i
+		}
+		if index >= len(n) {
+			if last {
+				_, _, err := fn(nil, false)
+				return node, err
+			}
+			return node, nil
+		}
+		if last {
+			newValue, op, err := fn(n[index], true)
+			if err != nil {
+				return node, err
+			}
+			switch op {
+			case pathSet:
+				n[index] = newValue
+			case pathDelete:
+				return append(n[:index:index], n[index+1:]...), nil
+			}
+			return n, nil
+		}
+		newItem, err := walkNode(n[index], segments[1:], create, fn)
+		if err != nil {
+			return node, err
+		}
+		n[index] = newItem
+		return n, nil
+
+	default:
+		if create && node != nil {
+			return node, fmt.Errorf("字段 %s 不是对象，无法写入子字段", seg.key)
+		}
+		if last {
+			_, _, err := fn(nil, false)
+			return node, err
+		}
+		return node, nil
+	}
+}
+
+// getPath 读取字段值，路径包含通配符时返回所有匹配值组成的数组
+func getPath(record map[string]interface{}, path string) (interface{}, bool) {
+	var values []interface{}
+	found := false
+	err := walkPath(record, path, false, func(value interface{}, exists bool) (interface{}, int, error) {
+		if exists {
+			values = append(values, value)
+			found = true
+		}
+		return nil, pathKeep, nil
+	})
+	if err != nil || !found {
+		return nil, false
+	}
+	if strings.Contains(path, "*") {
+		return values, true
+	}
+	return values[0], true
+}
+
+// setPath 写入字段值，缺失的中间对象会自动创建
+func setPath(record map[string]interface{}, path string, value interface{}) error {
+	return walkPath(record, path, true, func(interface{}, bool) (interface{}, int, error) {
+		return value, pathSet, nil
+	})
+}
+
+// deletePath 删除字段
+func deletePath(record map[string]interface{}, path string) {
+	walkPath(record, path, false, func(interface{}, bool) (interface{}, int, error) {
+		return nil, pathDelete, nil
+	})
+}
+
+// updatePath 对字段（通配时为每个匹配值）应用 fn，字段不存在时跳过
+func updatePath(record map[string]interface{}, path string, fn func(value interface{}) (interface{}, error)) error {
+	return walkPath(record, path, false, func(value interface{}, exists bool) (interface{}, int, error) {
+		if !exists {
+			return nil, pathKeep, nil
+		}
+		newValue, err := fn(value)
+		if err != nil {
+			return nil, pathKeep, err
+		}
+		return newValue, pathSet, nil
+	})
+}
+
+// flattenValue 将嵌套对象和数组展开为 prefix+sep+key 形式的顶层字段
+func flattenValue(prefix string, value interface{}, sep string, out map[string]interface{}) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + sep + key
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 && prefix != "" {
+			out[prefix] = v
+			return
+		}
+		for key, child := range v {
+			flattenValue(join(key), child, sep, out)
+		}
+	case []interface{}:
+		if len(v) == 0 && prefix != "" {
+			out[prefix] = v
+			return
+		}
+		for i, child := range v {
+			flattenValue(join(strconv.Itoa(i)), child, sep, out)
+		}
+	default:
+		out[prefix] = v
+	}
+}
+
+// unflattenRecord 将含分隔符的键还原为嵌套对象，纯数字的子键还原为数组
+func unflattenRecord(record map[string]interface{}, sep string) map[string]interface{} {
+	keys := make([]string, 0, len(record))
+	for key := range record {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make(map[string]interface{}, len(record))
+	for _, key := range keys {
+		parts := strings.Split(key, sep)
+		node := result
+		for i, part := range parts {
+			if i == len(parts)-1 {
+				node[part] = record[key]
+				break
+			}
+			child, ok := node[part].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				node[part] = child
+			}
+			node = child
+		}
+	}
+
+	for key, value := range result {
+		result[key] = mapsToArrays(value)
+	}
+	return result
+}
+
+// mapsToArrays 将键全部为连续下标（0..n-1）的对象转换为数组
+func mapsToArrays(value interface{}) interface{} {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	for key, child := range m {
+		m[key] = mapsToArrays(child)
+	}
+
+	items := make([]interface{}, len(m))
+	for key, child := range m {
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || index >= len(m) || strconv.Itoa(index) != key {
+			return m
+		}
+		items[index] = child
+	}
+	if len(items) == 0 {
+		return m
+	}
+	return items
+}
+
+// deepCopyValue 深拷贝对象和数组，避免修改嵌套字段时影响原始记录
+func deepCopyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return deepCopyRecord(v)
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = deepCopyValue(item)
+		}
+		return items
+	default:
+		return v
+	}
+}
+
+// deepCopyRecord 深拷贝记录
+func deepCopyRecord(record map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(record))
+	for k, v := range record {
+		result[k] = deepCopyValue(v)
+	}
+	return result
+}
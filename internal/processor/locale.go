@@ -0,0 +1,544 @@
+package processor
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 本地化的日期、数字和货币解析，用于 date_format、number_format 和 currency 清洗规则
+// 采集的页面中常见 "3小时前"、"昨天 14:20"、"2026年10月18日"、"1.2万"、"¥3,499.00" 等写法
+
+// monthFirstLocales 数字日期按 月/日/年 解析的地区，其他地区按 日/月/年 解析
+var monthFirstLocales = map[string]bool{"en-us": true, "en-ph": true}
+
+// monthFirstShortLanguages 省略年份的 月/日 短日期按月在前解析的语言，中日韩页面上的 "10/18 14:20" 均为月在前
+var monthFirstShortLanguages = map[string]bool{"zh": true, "ja": true, "ko": true}
+
+// decimalCommaLanguages 以逗号作为小数点、以点或空格作为千位分隔符的语言
+var decimalCommaLanguages = map[string]bool{
+	"de": true, "fr": true, "es": true, "it": true, "pt": true, "ru": true, "nl": true,
+	"pl": true, "tr": true, "id": true, "vi": true, "sv": true, "da": true, "nb": true, "fi": true,
+}
+
+// localeLanguage 返回地区的语言部分，如 de-DE 返回 de
+func localeLanguage(locale string) string {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	if i := strings.Index(locale, "-"); i >= 0 {
+		return locale[:i]
+	}
+	return locale
+}
+
+// loadLocation 加载时区，为空时使用 UTC
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("无效的时区 %s: %w", name, err)
+	}
+	return loc, nil
+}
+
+// dateParser 本地化日期解析
+// 没有时区信息的时间按 loc 解析，相对时间（如 3小时前、昨天）以 ref（采集时间）为基准
+type dateParser struct {
+	loc        *time.Location
+	ref        time.Time
+	monthFirst bool
+	// shortMonthFirst 省略年份的 月/日 短日期按月在前解析，未指定 locale 时同样按月在前
+	shortMonthFirst bool
+}
+
+func newDateParser(locale string, loc *time.Location, ref time.Time) *dateParser {
+	if ref.IsZero() {
+		ref = time.Now()
+	}
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	language, _, _ := strings.Cut(locale, "-")
+	monthFirst := monthFirstLocales[locale]
+	return &dateParser{
+		loc:             loc,
+		ref:             ref.In(loc),
+		monthFirst:      monthFirst,
+		shortMonthFirst: monthFirst || locale == "" || monthFirstShortLanguages[language],
+	}
+}
+
+var (
+	weekdayPattern     = regexp.MustCompile(`(?i)[(（]?(星期|礼拜|周)[一二三四五六日天][)）]?|^(mon|tue|wed|thu|fri|sat|sun)[a-z]*\.?,?\s+`)
+	relativeZhPattern  = regexp.MustCompile(`^(\d+(?:\.\d+)?|[半一二两三四五六七八九十]+)\s*(秒钟?|分钟?|个?小时|个?钟头|天|日|周|星期|个?礼拜|个月|月|年)\s*(前|以前|之前|后|以后|之后)$`)
+	relativeEnPattern  = regexp.MustCompile(`(?i)^(\d+|an?|one)\s+(second|sec|minute|min|hour|hr|day|week|month|year)s?\s+ago$`)
+	dayWordPattern     = regexp.MustCompile(`(?i)^(今天|今日|昨天|昨日|前天|明天|后天|today|yesterday|tomorrow)\s*(.*)$`)
+	clockPattern       = regexp.MustCompile(`^(上午|早上|凌晨|中午|下午|晚上)?\s*(\d{1,2})\s*[:：时点]\s*(\d{1,2})?\s*分?(?:\s*[:：]?\s*(\d{1,2})\s*秒?)?$`)
+	chineseDatePattern = regexp.MustCompile(`^(?:(\d{2}|\d{4})\s*年\s*)?(\d{1,2})\s*月\s*(\d{1,2})\s*[日号]?\s*(.*)$`)
+	shortDatePattern   = regexp.MustCompile(`^(\d{1,2})[-/](\d{1,2})(?:\s+(.+))?$`)
+	timestampPattern   = regexp.MustCompile(`^\d{10}(\d{3})?$`)
+)
+
+// 带时区信息的格式
+var zonedLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 -0700 MST",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC822Z,
+	time.RFC822,
+	time.RFC850,
+	time.UnixDate,
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+}
+
+// 不带时区、带时间的格式
+var dateTimeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"2006.01.02 15:04:05",
+	"2006.01.02 15:04",
+	"Jan 2, 2006 15:04:05",
+	"Jan 2, 2006 15:04",
+	"Jan 2, 2006 3:04 PM",
+	"January 2, 2006 15:04",
+	"January 2, 2006 3:04 PM",
+	"2 Jan 2006 15:04:05",
+	"2 Jan 2006 15:04",
+	"Jan _2 15:04:05 2006",
+}
+
+// 只有日期的格式
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006/01/02",
+	"2006.01.02",
+	"20060102",
+	"Jan 2, 2006",
+	"Jan 2 2006",
+	"January 2, 2006",
+	"January 2 2006",
+	"2 Jan 2006",
+	"2 January 2006",
+}
+
+// 日在前和月在前的数字日期格式
+var (
+	dayFirstDateLayouts       = []string{"02-01-2006", "02/01/2006", "02.01.2006"}
+	dayFirstDateTimeLayouts   = []string{"02-01-2006 15:04:05", "02/01/2006 15:04:05", "02/01/2006 15:04"}
+	monthFirstDateLayouts     = []string{"01-02-2006", "01/02/2006", "01.02.2006"}
+	monthFirstDateTimeLayouts = []string{"01-02-2006 15:04:05", "01/02/2006 15:04:05", "01/02/2006 15:04"}
+)
+
+// Parse 解析日期，dateOnly 表示输入只有日期没有时间，此时不做时区转换
+func (p *dateParser) Parse(value string) (t time.Time, dateOnly bool, err error) {
+	s := strings.Join(strings.Fields(toHalfWidth(value)), " ")
+	if s == "" {
+		return time.Time{}, false, fmt.Errorf("无法解析日期: %s", value)
+	}
+
+	if timestampPattern.MatchString(s) {
+		n, _ := strconv.ParseInt(s, 10, 64)
+		if len(s) == 13 {
+			return time.UnixMilli(n), false, nil
+		}
+		return time.Unix(n, 0), false, nil
+	}
+	for _, layout := range zonedLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, false, nil
+		}
+	}
+
+	// 以下格式忽略星期，如 2026年10月18日 星期日、Sunday, October 18, 2026
+	s = strings.Join(strings.Fields(weekdayPattern.ReplaceAllString(s, " ")), " ")
+	if t, dateOnly, ok := p.parseRelative(s); ok {
+		return t, dateOnly, nil
+	}
+	if t, dateOnly, ok := p.parseChinese(s); ok {
+		return t, dateOnly, nil
+	}
+
+	numericDates, numericDateTimes := dayFirstDateLayouts, dayFirstDateTimeLayouts
+	if p.monthFirst {
+		numericDates, numericDateTimes = monthFirstDateLayouts, monthFirstDateTimeLayouts
+	}
+	for _, layouts := range [][]string{dateTimeLayouts, numericDateTimes} {
+		for _, layout := range layouts {
+			if t, err := time.ParseInLocation(layout, s, p.loc); err == nil {
+				return t, false, nil
+			}
+		}
+	}
+	for _, layouts := range [][]string{dateLayouts, numericDates} {
+		for _, layout := range layouts {
+			if t, err := time.ParseInLocation(layout, s, p.loc); err == nil {
+				return t, true, nil
+			}
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("无法解析日期: %s", value)
+}
+
+// parseRelative 解析相对时间：刚刚、3小时前、2 days ago、昨天 14:20、14:20（今天）
+func (p *dateParser) parseRelative(s string) (time.Time, bool, bool) {
+	switch strings.ToLower(s) {
+	case "刚刚", "刚才", "just now", "now":
+		return p.ref, false, true
+	}
+
+	if m := relativeZhPattern.FindStringSubmatch(s); m != nil {
+		n, ok := parseSmallNumber(m[1])
+		if !ok {
+			return time.Time{}, false, false
+		}
+		if strings.Contains(m[3], "后") {
+			n = -n
+		}
+		return p.before(n, m[2]), false, true
+	}
+	if m := relativeEnPattern.FindStringSubmatch(s); m != nil {
+		n, ok := parseSmallNumber(strings.ToLower(m[1]))
+		if !ok {
+			return time.Time{}, false, false
+		}
+		return p.before(n, strings.ToLower(m[2])), false, true
+	}
+
+	if m := dayWordPattern.FindStringSubmatch(s); m != nil {
+		days := map[string]int{
+			"今天": 0, "今日": 0, "today": 0,
+			"昨天": -1, "昨日": -1, "yesterday": -1,
+			"前天": -2,
+			"明天": 1, "tomorrow": 1,
+			"后天": 2,
+		}[strings.ToLower(m[1])]
+		day := p.ref.AddDate(0, 0, days)
+		return p.atClock(day, strings.TrimSpace(m[2]))
+	}
+
+	// 只有时间时为采集当天
+	if clockPattern.MatchString(s) {
+		return p.atClock(p.ref, s)
+	}
+	return time.Time{}, false, false
+}
+
+// before 返回采集时间之前 n 个单位的时间，n 为负数时为之后
+func (p *dateParser) before(n float64, unit string) time.Time {
+	unit = strings.TrimPrefix(unit, "个")
+	switch unit {
+	case "秒", "秒钟", "second", "sec":
+		return p.ref.Add(-time.Duration(n * float64(time.Second)))
+	case "分", "分钟", "minute", "min":
+		return p.ref.Add(-time.Duration(n * float64(time.Minute)))
+	case "小时", "钟头", "hour", "hr":
+		return p.ref.Add(-time.Duration(n * float64(time.Hour)))
+	case "天", "日", "day":
+		return p.ref.Add(-time.Duration(n * 24 * float64(time.Hour)))
+	case "周", "星期", "礼拜", "week":
+		return p.ref.Add(-time.Duration(n * 7 * 24 * float64(time.Hour)))
+	case "月", "month":
+		return p.ref.AddDate(0, -int(math.Round(n)), 0)
+	default: // 年
+		return p.ref.AddDate(-int(math.Round(n)), 0, 0)
+	}
+}
+
+// atClock 返回 day 当天 clock 指定的时间，clock 为空时只有日期
+func (p *dateParser) atClock(day time.Time, clock string) (time.Time, bool, bool) {
+	if clock == "" {
+		return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, p.loc), true, true
+	}
+	m := clockPattern.FindStringSubmatch(clock)
+	if m == nil {
+		return time.Time{}, false, false
+	}
+	hour, _ := strconv.Atoi(m[2])
+	minute, _ := strconv.Atoi(m[3])
+	second, _ := strconv.Atoi(m[4])
+	switch m[1] {
+	case "下午", "晚上":
+		if hour < 12 {
+			hour += 12
+		}
+	case "中午":
+		if hour < 11 {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 || second > 59 {
+		return time.Time{}, false, false
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, second, 0, p.loc), false, true
+}
+
+// parseChinese 解析中文日期（2026年10月18日、10月18日 14:20）和省略年份的日期（10-18 14:20）
+// 省略年份时使用采集时间的年份，得到的日期晚于采集时间一天以上时取上一年
+func (p *dateParser) parseChinese(s string) (time.Time, bool, bool) {
+	var year, month, day int
+	var rest string
+	if m := chineseDatePattern.FindStringSubmatch(s); m != nil {
+		year, _ = strconv.Atoi(m[1])
+		month, _ = strconv.Atoi(m[2])
+		day, _ = strconv.Atoi(m[3])
+		rest = strings.TrimSpace(m[4])
+	} else if m := shortDatePattern.FindStringSubmatch(s); m != nil {
+		month, _ = strconv.Atoi(m[1])
+		day, _ = strconv.Atoi(m[2])
+		if !p.shortMonthFirst && strings.Contains(s, "/") {
+			month, day = day, month
+		}
+		rest = strings.TrimSpace(m[3])
+	} else {
+		return time.Time{}, false, false
+	}
+
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		return time.Time{}, false, false
+	}
+	inferYear := year == 0
+	if inferYear {
+		year = p.ref.Year()
+	} else if year < 100 {
+		year += 2000
+	}
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, p.loc)
+	if date.Day() != day {
+		return time.Time{}, false, false // 如 2月30日
+	}
+	if inferYear && date.After(p.ref.AddDate(0, 0, 1)) {
+		date = date.AddDate(-1, 0, 0)
+	}
+	return p.atClock(date, rest)
+}
+
+// parseSmallNumber 解析相对时间中的数量：阿拉伯数字、半、一到九十九的中文数字、a/an/one
+func parseSmallNumber(s string) (float64, bool) {
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return n, true
+	}
+	switch s {
+	case "半":
+		return 0.5, true
+	case "a", "an", "one":
+		return 1, true
+	}
+
+	digits := map[rune]int{'一': 1, '二': 2, '两': 2, '三': 3, '四': 4, '五': 5, '六': 6, '七': 7, '八': 8, '九': 9}
+	runes := []rune(s)
+	switch {
+	case len(runes) == 1 && runes[0] == '十':
+		return 10, true
+	case len(runes) == 1:
+		n, ok := digits[runes[0]]
+		return float64(n), ok
+	case len(runes) == 2 && runes[0] == '十':
+		n, ok := digits[runes[1]]
+		return float64(10 + n), ok
+	case len(runes) == 2 && runes[1] == '十':
+		n, ok := digits[runes[0]]
+		return float64(n * 10), ok
+	case len(runes) == 3 && runes[1] == '十':
+		tens, ok1 := digits[runes[0]]
+		ones, ok2 := digits[runes[2]]
+		return float64(tens*10 + ones), ok1 && ok2
+	}
+	return 0, false
+}
+
+// numberUnits 数字后缀单位，按长度优先匹配
+var numberUnits = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"万亿", 1e12},
+	{"千万", 1e7},
+	{"百万", 1e6},
+	{"亿", 1e8},
+	{"万", 1e4},
+	{"千", 1e3},
+	{"百", 1e2},
+	{"w", 1e4},
+	{"W", 1e4},
+	{"k", 1e3},
+	{"K", 1e3},
+	{"M", 1e6},
+	{"B", 1e9},
+}
+
+// parseLocalizedNumber 解析本地化数字：千位分隔符、中文单位（万、亿）、k/M/B、百分号和千分号、
+// 会计格式的负数 (1,234)，以及货币符号，locale 决定小数点是点还是逗号
+func parseLocalizedNumber(value, locale string) (float64, error) {
+	_, rest := extractCurrency(value, locale)
+	n, err := parseAmount(rest, locale)
+	if err != nil {
+		return 0, fmt.Errorf("无法解析数字: %s", value)
+	}
+	return n, nil
+}
+
+// parseAmount 解析去除货币后的数字
+func parseAmount(value, locale string) (float64, error) {
+	s := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', ' ', ' ', ' ', '\t':
+			return -1
+		case '−':
+			return '-'
+		}
+		return r
+	}, toHalfWidth(value))
+	s = strings.TrimSuffix(s, "+")
+
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = s[1 : len(s)-1]
+	}
+	if strings.HasPrefix(s, "-") {
+		negative = !negative
+		s = s[1:]
+	} else {
+		s = strings.TrimPrefix(s, "+")
+	}
+
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(s, "%"):
+		multiplier, s = 0.01, strings.TrimSuffix(s, "%")
+	case strings.HasSuffix(s, "‰"):
+		multiplier, s = 0.001, strings.TrimSuffix(s, "‰")
+	default:
+		for _, unit := range numberUnits {
+			if strings.HasSuffix(s, unit.suffix) {
+				multiplier, s = unit.multiplier, strings.TrimSuffix(s, unit.suffix)
+				break
+			}
+		}
+	}
+
+	if decimalCommaLanguages[localeLanguage(locale)] {
+		s = strings.ReplaceAll(s, ".", "")
+		s = strings.ReplaceAll(s, "'", "")
+		s = strings.ReplaceAll(s, ",", ".")
+	} else {
+		s = strings.ReplaceAll(s, ",", "")
+		s = strings.ReplaceAll(s, "'", "")
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+		return 0, fmt.Errorf("无法解析数字: %s", value)
+	}
+	// 乘以单位后保留 15 位有效数字，避免 1.2万 得到 11999.999999999998
+	if multiplier != 1 {
+		n = roundSignificant(n * multiplier)
+	}
+	if negative {
+		n = -n
+	}
+	return n, nil
+}
+
+// roundSignificant 保留 15 位有效数字，消除浮点乘法误差
+func roundSignificant(n float64) float64 {
+	rounded, err := strconv.ParseFloat(strconv.FormatFloat(n, 'g', 15, 64), 64)
+	if err != nil {
+		return n
+	}
+	return rounded
+}
+
+// currencySymbols 货币符号和名称，按长度优先匹配
+var currencySymbols = []struct {
+	symbol string
+	code   string
+}{
+	{"人民币", "CNY"}, {"新台币", "TWD"}, {"美元", "USD"}, {"美金", "USD"}, {"港币", "HKD"}, {"港元", "HKD"},
+	{"欧元", "EUR"}, {"英镑", "GBP"}, {"日元", "JPY"}, {"韩元", "KRW"},
+	{"US$", "USD"}, {"HK$", "HKD"}, {"NT$", "TWD"}, {"C$", "CAD"}, {"A$", "AUD"}, {"S$", "SGD"},
+	{"CN¥", "CNY"}, {"JP¥", "JPY"}, {"RMB", "CNY"},
+	{"CNY", "CNY"}, {"USD", "USD"}, {"HKD", "HKD"}, {"TWD", "TWD"}, {"EUR", "EUR"}, {"GBP", "GBP"},
+	{"JPY", "JPY"}, {"KRW", "KRW"}, {"CAD", "CAD"}, {"AUD", "AUD"}, {"SGD", "SGD"},
+	{"元", "CNY"}, {"块", "CNY"}, {"円", "JPY"}, {"€", "EUR"}, {"£", "GBP"}, {"₩", "KRW"},
+	{"¥", ""}, {"￥", ""}, {"$", ""}, // 含义随地区变化，见 localCurrency
+}
+
+// localCurrency 返回 ¥、$ 在地区下对应的货币
+func localCurrency(symbol, locale string) string {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	if symbol == "$" {
+		switch locale {
+		case "zh-hk", "en-hk":
+			return "HKD"
+		case "zh-tw":
+			return "TWD"
+		case "en-ca", "fr-ca":
+			return "CAD"
+		case "en-au":
+			return "AUD"
+		case "en-sg", "zh-sg":
+			return "SGD"
+		}
+		return "USD"
+	}
+	if localeLanguage(locale) == "ja" {
+		return "JPY"
+	}
+	return "CNY"
+}
+
+// extractCurrency 识别并去除值首尾的货币符号或名称，返回 ISO 4217 货币代码（未识别时为空）和剩余部分
+func extractCurrency(value, locale string) (code, rest string) {
+	rest = strings.TrimSpace(value)
+	for _, c := range currencySymbols {
+		var found bool
+		if strings.HasPrefix(rest, c.symbol) {
+			rest, found = strings.TrimSpace(strings.TrimPrefix(rest, c.symbol)), true
+		} else if strings.HasSuffix(rest, c.symbol) {
+			rest, found = strings.TrimSpace(strings.TrimSuffix(rest, c.symbol)), true
+		} else if strings.HasPrefix(rest, "-"+c.symbol) {
+			// -¥12.50
+			rest, found = "-"+strings.TrimSpace(strings.TrimPrefix(rest, "-"+c.symbol)), true
+		}
+		if found {
+			code = c.code
+			if code == "" {
+				code = localCurrency(c.symbol, locale)
+			}
+			return code, rest
+		}
+	}
+	return "", rest
+}
+
+// parseCurrency 解析金额和货币，如 "¥3,499.00" 返回 {"amount": 3499, "currency": "CNY"}
+// 值中没有货币符号时使用 defaultCode，仍无法确定货币时返回错误
+func parseCurrency(value, locale, defaultCode string) (map[string]interface{}, error) {
+	code, rest := extractCurrency(value, locale)
+	if code == "" {
+		code = strings.ToUpper(defaultCode)
+	}
+	if code == "" {
+		return nil, fmt.Errorf("无法识别货币: %s", value)
+	}
+	amount, err := parseAmount(rest, locale)
+	if err != nil {
+		return nil, fmt.Errorf("无法解析金额: %s", value)
+	}
+	return map[string]interface{}{"amount": amount, "currency": code}, nil
+}
@@ -0,0 +1,533 @@
+package processor
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/datafusion/worker/internal/models"
+)
+
+// TokenVault 令牌库，为 PII 原值分配令牌并加密保存原值
+type TokenVault interface {
+	// Tokenize 返回 values 中每个值对应的令牌，相同类型的相同值总是得到相同的令牌
+	Tokenize(piiType string, values []string) (map[string]string, error)
+}
+
+// PIIOptions PII 阶段运行时使用的密钥，来自 Worker 配置而不是任务配置
+type PIIOptions struct {
+	HashSalt []byte     // hash 使用的盐
+	Vault    TokenVault // tokenize 使用的令牌库
+}
+
+// piiTypes 检测顺序，同一位置被多个类型匹配时取靠前的类型
+var piiTypes = []string{models.PIITypeIDCard, models.PIITypeBankCard, models.PIITypeEmail, models.PIITypePhone}
+
+var piiPatterns = map[string]*regexp.Regexp{
+	models.PIITypeIDCard:   regexp.MustCompile(`\d{17}[\dXx]`),
+	models.PIITypeBankCard: regexp.MustCompile(`\d{4}(?:[ -]\d{4}){2,3}(?:[ -]\d{1,3})?|\d{13,19}`),
+	models.PIITypeEmail:    regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	models.PIITypePhone:    regexp.MustCompile(`(?:\+?86[ -]?)?1[3-9]\d(?:[ -]?\d{4}){2}`),
+}
+
+// piiMatch 文本中检测到的 PII
+type piiMatch struct {
+	Type       string
+	Start, End int
+}
+
+// detectPII 检测文本中的 PII，types 为空时检测全部类型
+// 身份证号校验出生日期和校验码，银行卡号做 Luhn 校验，数字前后不能紧跟其他数字
+func detectPII(text string, types []string) []piiMatch {
+	var matches []piiMatch
+	for _, piiType := range piiTypes {
+		if len(types) > 0 && !containsString(types, piiType) {
+			continue
+		}
+		for _, loc := range piiPatterns[piiType].FindAllStringIndex(text, -1) {
+			m := piiMatch{Type: piiType, Start: loc[0], End: loc[1]}
+			if piiType != models.PIITypeEmail && !digitBoundary(text, m.Start, m.End) {
+				continue
+			}
+			if !validPII(piiType, text[m.Start:m.End]) || overlaps(matches, m) {
+				continue
+			}
+			matches = append(matches, m)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Start < matches[j].Start })
+	return matches
+}
+
+// digitBoundary 匹配前后不是数字
+func digitBoundary(text string, start, end int) bool {
+	if start > 0 && isDigit(text[start-1]) {
+		return false
+	}
+	if end < len(text) && isDigit(text[end]) {
+		return false
+	}
+	return true
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func overlaps(matches []piiMatch, m piiMatch) bool {
+	for _, existing := range matches {
+		if m.Start < existing.End && existing.Start < m.End {
+			return true
+		}
+	}
+	return false
+}
+
+// validPII 校验候选值
+func validPII(piiType, value string) bool {
+	switch piiType {
+	case models.PIITypeIDCard:
+		return validIDCard(value)
+	case models.PIITypeBankCard:
+		digits := normalizePII(piiType, value)
+		return len(digits) >= 13 && len(digits) <= 19 && luhnValid(digits)
+	default:
+		return true
+	}
+}
+
+// validIDCard 校验 18 位身份证号的出生日期和 GB 11643 校验码
+func validIDCard(id string) bool {
+	if len(id) != 18 {
+		return false
+	}
+	birth, err := time.Parse("20060102", id[6:14])
+	if err != nil || birth.Year() < 1900 || birth.After(time.Now()) {
+		return false
+	}
+
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	sum := 0
+	for i, w := range weights {
+		sum += int(id[i]-'0') * w
+	}
+	return "10X98765432"[sum%11] == strings.ToUpper(id[17:])[0]
+}
+
+// luhnValid Luhn 校验
+func luhnValid(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// normalizePII 规范化 PII 值，用于哈希和令牌：号码只保留数字（身份证末位 X 大写），邮箱转为小写
+func normalizePII(piiType, value string) string {
+	if piiType == models.PIITypeEmail {
+		return strings.ToLower(strings.TrimSpace(value))
+	}
+	var b strings.Builder
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		} else if r == 'x' || r == 'X' {
+			b.WriteRune('X')
+		}
+	}
+	digits := b.String()
+	if piiType == models.PIITypePhone && len(digits) == 13 && strings.HasPrefix(digits, "86") {
+		digits = digits[2:]
+	}
+	return digits
+}
+
+// maskPII 部分遮盖：手机号保留前 3 位和后 4 位，身份证号和银行卡号保留前 6 位和后 4 位，邮箱保留用户名首字符和域名
+func maskPII(piiType, value string) string {
+	switch piiType {
+	case models.PIITypePhone:
+		keepFirst := 3
+		if strings.Count(maskDigits(value, 0, 0), "*") == 13 {
+			keepFirst = 5 // +86 前缀
+		}
+		return maskDigits(value, keepFirst, 4)
+	case models.PIITypeIDCard, models.PIITypeBankCard:
+		return maskDigits(value, 6, 4)
+	case models.PIITypeEmail:
+		at := strings.LastIndex(value, "@")
+		if at <= 0 {
+			return strings.Repeat("*", len(value))
+		}
+		return value[:1] + "***" + value[at:]
+	default:
+		return strings.Repeat("*", len([]rune(value)))
+	}
+}
+
+// maskDigits 遮盖除前 keepFirst 位和后 keepLast 位以外的数字，分隔符保持不变
+func maskDigits(value string, keepFirst, keepLast int) string {
+	total := 0
+	for _, r := range value {
+		if isDigitOrX(r) {
+			total++
+		}
+	}
+
+	var b strings.Builder
+	index := 0
+	for _, r := range value {
+		if !isDigitOrX(r) {
+			b.WriteRune(r)
+			continue
+		}
+		if index < keepFirst || index >= total-keepLast {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('*')
+		}
+		index++
+	}
+	return b.String()
+}
+
+func isDigitOrX(r rune) bool {
+	return (r >= '0' && r <= '9') || r == 'x' || r == 'X'
+}
+
+// hashPII 加盐 HMAC-SHA256，返回十六进制字符串
+func hashPII(salt []byte, piiType, value string) string {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(piiType + ":" + normalizePII(piiType, value)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidatePIIConfig 校验 PII 配置
+func ValidatePIIConfig(config *models.PIIConfig) error {
+	if config == nil {
+		return nil
+	}
+	if len(config.Fields) == 0 && !config.ScanAll {
+		return fmt.Errorf("未配置需要处理的字段，请配置 fields 或 scan_all")
+	}
+	if err := validatePIIAction(config.Action); err != nil {
+		return err
+	}
+	for i, policy := range config.Fields {
+		if policy.Field == "" {
+			return fmt.Errorf("第 %d 个字段策略未指定 field", i+1)
+		}
+		if _, err := parsePath(policy.Field); err != nil {
+			return fmt.Errorf("字段 %s: %w", policy.Field, err)
+		}
+		if err := validatePIIAction(policy.Action); err != nil {
+			return fmt.Errorf("字段 %s: %w", policy.Field, err)
+		}
+		types := policy.Types
+		if policy.Type != "" {
+			types = append([]string{policy.Type}, types...)
+		}
+		for _, piiType := range types {
+			if _, ok := piiPatterns[piiType]; !ok {
+				return fmt.Errorf("字段 %s: 不支持的 PII 类型 %s", policy.Field, piiType)
+			}
+		}
+	}
+	return nil
+}
+
+func validatePIIAction(action string) error {
+	switch action {
+	case "", models.PIIActionMask, models.PIIActionHash, models.PIIActionTokenize:
+		return nil
+	default:
+		return fmt.Errorf("不支持的 PII 处理方式: %s", action)
+	}
+}
+
+// piiStage PII 检测与脱敏阶段
+type piiStage struct {
+	name   string
+	config *models.PIIConfig
+}
+
+func newPIIStage(config *models.StageConfig, processor *models.ProcessorConfig) (Stage, error) {
+	pii := config.PII
+	if pii == nil {
+		pii = processor.PII
+	}
+	if pii == nil {
+		return nil, fmt.Errorf("未配置 pii")
+	}
+	if err := ValidatePIIConfig(pii); err != nil {
+		return nil, err
+	}
+	return &piiStage{name: nameOr(config.Name, StagePII), config: pii}, nil
+}
+
+func (s *piiStage) Name() string { return s.name }
+
+// piiReplacer 返回 PII 值的替换值
+type piiReplacer func(piiType, value string) string
+
+func (s *piiStage) Process(ctx *StageContext, data []map[string]interface{}) ([]map[string]interface{}, error) {
+	var salt []byte
+	var vault TokenVault
+	if ctx.PII != nil {
+		salt, vault = ctx.PII.HashSalt, ctx.PII.Vault
+	}
+
+	// 需要令牌化时先收集所有值，一次性向令牌库申请令牌
+	var tokens map[string]map[string]string
+	if s.uses(models.PIIActionTokenize) {
+		if vault == nil {
+			return nil, fmt.Errorf("未配置 PII 令牌库，无法执行 tokenize")
+		}
+		values := make(map[string]map[string]bool)
+		collect := func(action string) piiReplacer {
+			return func(piiType, value string) string {
+				if action == models.PIIActionTokenize {
+					if values[piiType] == nil {
+						values[piiType] = make(map[string]bool)
+					}
+					values[piiType][normalizePII(piiType, value)] = true
+				}
+				return value
+			}
+		}
+		for _, record := range data {
+			s.protect(deepCopyRecord(record), collect, nil)
+		}
+
+		tokens = make(map[string]map[string]string)
+		for piiType, set := range values {
+			list := make([]string, 0, len(set))
+			for v := range set {
+				list = append(list, v)
+			}
+			sort.Strings(list)
+			result, err := vault.Tokenize(piiType, list)
+			if err != nil {
+				return nil, fmt.Errorf("PII 令牌化失败: %w", err)
+			}
+			tokens[piiType] = result
+		}
+	}
+	if s.uses(models.PIIActionHash) && len(salt) == 0 {
+		return nil, fmt.Errorf("未配置 PII 哈希盐，无法执行 hash")
+	}
+
+	replacers := func(action string) piiReplacer {
+		switch action {
+		case models.PIIActionHash:
+			return func(piiType, value string) string { return hashPII(salt, piiType, value) }
+		case models.PIIActionTokenize:
+			return func(piiType, value string) string { return tokens[piiType][normalizePII(piiType, value)] }
+		default:
+			return maskPII
+		}
+	}
+
+	counts := make(map[models.PIIResult]int)
+	result := make([]map[string]interface{}, 0, len(data))
+	for _, record := range data {
+		protected := deepCopyRecord(record)
+		s.protect(protected, replacers, counts)
+		result = append(result, protected)
+	}
+
+	keys := make([]models.PIIResult, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Field != keys[j].Field {
+			return keys[i].Field < keys[j].Field
+		}
+		return keys[i].Type < keys[j].Type
+	})
+	for _, key := range keys {
+		key.Count = counts[key]
+		ctx.PIIResults = append(ctx.PIIResults, key)
+	}
+	return result, nil
+}
+
+// protectRejected 对 rejected 中下标为 indexes 的记录应用本阶段的策略，
+// 哈希盐或令牌库不可用时退化为遮盖，保证写入死信队列的记录不含明文 PII
+func (s *piiStage) protectRejected(options *PIIOptions, rejected []models.DeadLetterRecord, indexes []int) {
+	if len(indexes) == 0 {
+		return
+	}
+	records := make([]map[string]interface{}, len(indexes))
+	for i, index := range indexes {
+		records[i] = rejected[index].Record
+	}
+	protected, err := s.Process(&StageContext{PII: options}, records)
+	for i, index := range indexes {
+		if err == nil {
+			rejected[index].Record = protected[i]
+			continue
+		}
+		record := deepCopyRecord(rejected[index].Record)
+		s.protect(record, func(string) piiReplacer { return maskPII }, nil)
+		rejected[index].Record = record
+	}
+}
+
+// uses 是否有策略使用了 action
+func (s *piiStage) uses(action string) bool {
+	if s.config.ScanAll && piiAction(s.config.Action) == action {
+		return true
+	}
+	for _, policy := range s.config.Fields {
+		if piiAction(policy.Action) == action {
+			return true
+		}
+	}
+	return false
+}
+
+func piiAction(action string) string {
+	if action == "" {
+		return models.PIIActionMask
+	}
+	return action
+}
+
+// protect 对记录应用所有策略，counts 不为空时统计各字段处理的值的个数
+func (s *piiStage) protect(record map[string]interface{}, replacers func(action string) piiReplacer, counts map[models.PIIResult]int) {
+	covered := make(map[string]bool)
+	for _, policy := range s.config.Fields {
+		action := piiAction(policy.Action)
+		replace := replacers(action)
+		field := strings.TrimPrefix(policy.Field, "$.")
+		covered[field] = true
+
+		updatePath(record, policy.Field, func(value interface{}) (interface{}, error) {
+			text, ok := piiText(value)
+			if !ok {
+				return value, nil
+			}
+			if policy.Type != "" {
+				if strings.TrimSpace(text) == "" {
+					return value, nil
+				}
+				count(counts, field, policy.Type, action, 1)
+				return replace(policy.Type, strings.TrimSpace(text)), nil
+			}
+			return replaceDetected(text, policy.Types, replace, func(piiType string) {
+				count(counts, field, piiType, action, 1)
+			}), nil
+		})
+	}
+
+	if s.config.ScanAll {
+		action := piiAction(s.config.Action)
+		scanPII(record, "", covered, replacers(action), func(field, piiType string) {
+			count(counts, field, piiType, action, 1)
+		})
+	}
+}
+
+func count(counts map[models.PIIResult]int, field, piiType, action string, n int) {
+	if counts != nil {
+		counts[models.PIIResult{Field: field, Type: piiType, Action: action}] += n
+	}
+}
+
+// replaceDetected 替换文本中检测到的 PII
+func replaceDetected(text string, types []string, replace piiReplacer, found func(piiType string)) string {
+	matches := detectPII(text, types)
+	if len(matches) == 0 {
+		return text
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(text[last:m.Start])
+		b.WriteString(replace(m.Type, text[m.Start:m.End]))
+		found(m.Type)
+		last = m.End
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// scanPII 扫描 covered 之外的所有字符串字段，数组元素的路径记为 field[*]
+func scanPII(node map[string]interface{}, prefix string, covered map[string]bool, replace piiReplacer, found func(field, piiType string)) {
+	for key, value := range node {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if covered[path] {
+			continue
+		}
+		node[key] = scanValue(value, path, covered, replace, found)
+	}
+}
+
+func scanValue(value interface{}, path string, covered map[string]bool, replace piiReplacer, found func(field, piiType string)) interface{} {
+	switch v := value.(type) {
+	case string:
+		return replaceDetected(v, nil, replace, func(piiType string) { found(path, piiType) })
+	case map[string]interface{}:
+		scanPII(v, path, covered, replace, found)
+		return v
+	case []interface{}:
+		itemPath := path + "[*]"
+		if covered[itemPath] {
+			return v
+		}
+		for i, item := range v {
+			v[i] = scanValue(item, itemPath, covered, replace, found)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+// piiText 将字段值转换为文本，数字形式的号码（如 13812345678）按整数格式化
+func piiText(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		if v == float64(int64(v)) {
+			return strconv.FormatInt(int64(v), 10), true
+		}
+		return "", false
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	default:
+		return "", false
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package processor
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// VaultCipher 令牌库加密：原值使用 AES-256-GCM 加密保存，查找令牌使用 HMAC-SHA256，两者的密钥都由主密钥派生
+type VaultCipher struct {
+	aead   cipher.AEAD
+	macKey []byte
+}
+
+// ParseVaultKey 解析令牌库主密钥，支持 32 字节的 base64 或十六进制编码
+func ParseVaultKey(encoded string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	if key, err := base64.StdEncoding.DecodeString(encoded); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := hex.DecodeString(encoded); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, fmt.Errorf("令牌库密钥必须是 32 字节的 base64 或十六进制编码")
+}
+
+// NewVaultCipher 使用主密钥创建令牌库加密器
+func NewVaultCipher(key []byte) (*VaultCipher, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("令牌库密钥长度必须为 32 字节")
+	}
+	block, err := aes.NewCipher(deriveKey(key, "datafusion-pii-vault-encrypt"))
+	if err != nil {
+		return nil, fmt.Errorf("创建令牌库加密器失败: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("创建令牌库加密器失败: %w", err)
+	}
+	return &VaultCipher{aead: aead, macKey: deriveKey(key, "datafusion-pii-vault-lookup")}, nil
+}
+
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// LookupHash 返回用于查找令牌的值哈希，value 应已规范化
+func (c *VaultCipher) LookupHash(piiType, value string) string {
+	mac := hmac.New(sha256.New, c.macKey)
+	mac.Write([]byte(piiType + ":" + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Seal 加密原值，返回 base64(nonce || 密文)
+func (c *VaultCipher) Seal(value string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("生成随机数失败: %w", err)
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(value), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open 解密 Seal 的结果
+func (c *VaultCipher) Open(sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < c.aead.NonceSize() {
+		return "", fmt.Errorf("密文格式错误")
+	}
+	nonceSize := c.aead.NonceSize()
+	plain, err := c.aead.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+	if err != nil {
+		return "", fmt.Errorf("解密失败（密钥不匹配或数据被篡改）: %w", err)
+	}
+	return string(plain), nil
+}
+
+// NewPIIToken 生成随机令牌，如 tok_phone_3f9c2a7e5b1d4c08a6e2f71b
+func NewPIIToken(piiType string) (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成令牌失败: %w", err)
+	}
+	return "tok_" + piiType + "_" + hex.EncodeToString(buf), nil
+}
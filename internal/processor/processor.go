@@ -5,13 +5,21 @@ import (
 	"log"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/datafusion/worker/internal/models"
 )
 
 // Processor 数据处理器
 type Processor struct {
-	config *models.ProcessorConfig
+	config      *models.ProcessorConfig
+	pii         *PIIOptions
+	collectedAt time.Time
+	references  ReferenceLoader
+	piiApplied  bool
+	rejected    []models.DeadLetterRecord
+	validation  []models.ValidationResult
+	piiResults  []models.PIIResult
 }
 
 // NewProcessor 创建数据处理器
@@ -19,6 +27,26 @@ func NewProcessor(config *models.ProcessorConfig) *Processor {
 	return &Processor{config: config}
 }
 
+// SetPIIOptions 设置 PII 阶段使用的哈希盐和令牌库
+func (p *Processor) SetPIIOptions(options *PIIOptions) {
+	p.pii = options
+}
+
+// SetCollectedAt 设置数据的采集时间，清洗相对时间时作为基准，未设置时使用处理时的当前时间
+func (p *Processor) SetCollectedAt(collectedAt time.Time) {
+	p.collectedAt = collectedAt
+}
+
+// SetPIIApplied 标记输入数据已经过 PII 处理（如重放死信队列中已脱敏的记录），处理时跳过 PII 阶段
+func (p *Processor) SetPIIApplied(applied bool) {
+	p.piiApplied = applied
+}
+
+// SetReferenceLoader 设置关联补充阶段使用的参考数据加载器
+func (p *Processor) SetReferenceLoader(loader ReferenceLoader) {
+	p.references = loader
+}
+
 // Process 处理数据
 func (p *Processor) Process(data []map[string]interface{}) ([]map[string]interface{}, error) {
 	if p.config == nil {
@@ -27,29 +55,186 @@ func (p *Processor) Process(data []map[string]interface{}) ([]map[string]interfa
 
 	log.Printf("开始数据处理，共 %d 条数据", len(data))
 
-	// 使用增强清洗器
-	if len(p.config.CleaningRules) > 0 {
-		enhancedCleaner := NewEnhancedCleaner(p.config.CleaningRules)
-		cleaned, err := enhancedCleaner.Clean(data)
-		if err != nil {
-			return nil, fmt.Errorf("增强清洗失败: %w", err)
+	// 按配置顺序执行处理阶段，未配置时依次为清洗、转换、校验
+	stages, err := defaultStageFactory.Build(p.config)
+	if err != nil {
+		p.reset()
+		return nil, err
+	}
+	processed, err := p.run(stages, 0, data)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("数据处理完成，有效数据 %d 条，拒绝 %d 条", len(processed), len(p.rejected))
+	return processed, nil
+}
+
+// Validate 从第一个校验阶段开始执行后续阶段（默认只有校验和 PII 阶段），用于重放校验阶段进入死信队列的记录
+func (p *Processor) Validate(data []map[string]interface{}) ([]map[string]interface{}, error) {
+	p.reset()
+	if p.config == nil {
+		return data, nil
+	}
+
+	stages, err := defaultStageFactory.Build(p.config)
+	if err != nil {
+		return nil, err
+	}
+	for i, stage := range stages {
+		if _, ok := stage.(*validateStage); ok {
+			return p.run(stages, i, data)
+		}
+	}
+	return data, nil
+}
+
+// Resume 从拒绝记录的阶段开始执行该阶段及之后的阶段，用于重放死信记录：
+// 优先使用 stageIndex 处名称一致的阶段，阶段顺序调整过时使用第一个同名阶段，找不到时返回错误
+func (p *Processor) Resume(data []map[string]interface{}, stageName string, stageIndex int) ([]map[string]interface{}, error) {
+	p.reset()
+	if p.config == nil {
+		return data, nil
+	}
+
+	stages, err := defaultStageFactory.Build(p.config)
+	if err != nil {
+		return nil, err
+	}
+	if stageIndex >= 0 && stageIndex < len(stages) && stages[stageIndex].Name() == stageName {
+		return p.run(stages, stageIndex, data)
+	}
+	for i, stage := range stages {
+		if stage.Name() == stageName {
+			return p.run(stages, i, data)
+		}
+	}
+	return nil, fmt.Errorf("处理阶段 %s 已不存在", stageName)
+}
+
+// Replay 重放死信记录，以记录进入死信队列的时间（即原采集时间）作为相对时间的基准：
+// 处理阶段拒绝的记录从拒绝它的阶段开始重新处理，之前的阶段不会重复执行，已脱敏的记录不再经过 PII 阶段；
+// 存储阶段的记录已处理完毕，只在未脱敏（如通过 API 修改过内容）时执行 PII 阶段，避免明文 PII 写入存储目标
+func (p *Processor) Replay(record *models.DeadLetterRecord) ([]map[string]interface{}, error) {
+	p.collectedAt = record.CreatedAt
+	p.piiApplied = record.PIIProtected
+	data := []map[string]interface{}{record.Record}
+
+	switch {
+	case record.Stage == models.DeadLetterStageStorage:
+		return p.protectStored(data)
+	case record.StageName != "":
+		return p.Resume(data, record.StageName, record.StageIndex)
+	case record.Stage == models.DeadLetterStageValidate:
+		// 没有记录阶段名称的旧记录：校验阶段的记录已经过清洗和转换，只需重新校验
+		return p.Validate(data)
+	default:
+		return p.Process(data)
+	}
+}
+
+// protectStored 只执行流水线中的 PII 阶段，用于重放存储阶段进入死信队列的记录
+func (p *Processor) protectStored(data []map[string]interface{}) ([]map[string]interface{}, error) {
+	p.reset()
+	if p.config == nil || p.piiApplied {
+		return data, nil
+	}
+
+	stages, err := defaultStageFactory.Build(p.config)
+	if err != nil {
+		return nil, err
+	}
+	var piiStages []Stage
+	for _, stage := range stages {
+		if _, ok := stage.(*piiStage); ok {
+			piiStages = append(piiStages, stage)
 		}
-		data = cleaned
 	}
+	if len(piiStages) == 0 {
+		return data, nil
+	}
+	return p.run(piiStages, 0, data)
+}
+
+// run 从下标 from 开始依次执行处理阶段，被拒绝的记录记录所在阶段的名称和下标
+func (p *Processor) run(stages []Stage, from int, data []map[string]interface{}) ([]map[string]interface{}, error) {
+	p.reset()
+	ctx := &StageContext{PII: p.pii, CollectedAt: p.collectedAt, ReferenceLoader: p.references}
+	defer func() {
+		p.rejected = ctx.Rejected
+		p.validation = ctx.Validation
+		p.piiResults = ctx.PIIResults
+	}()
+
+	// 结束时对被拒绝的记录补做所在阶段之后的 PII 阶段
+	defer func() { p.protectRejected(stages, ctx.Rejected) }()
 
-	// 应用转换规则
-	var processed []map[string]interface{}
-	for _, record := range data {
-		transformed, err := p.applyTransformRules(record)
+	processed := data
+	var err error
+	for i := from; i < len(stages); i++ {
+		stage := stages[i]
+		if _, ok := stage.(*piiStage); ok && p.piiApplied {
+			continue
+		}
+		rejected := len(ctx.Rejected)
+		processed, err = stage.Process(ctx, processed)
+		for j := rejected; j < len(ctx.Rejected); j++ {
+			ctx.Rejected[j].StageName = stage.Name()
+			ctx.Rejected[j].StageIndex = i
+		}
 		if err != nil {
-			log.Printf("转换数据失败: %v", err)
+			return nil, err
+		}
+	}
+	return processed, nil
+}
+
+// protectRejected 对在 PII 阶段之前被拒绝（或因处理失败没有经过 PII 阶段）的记录补做 PII 处理，
+// 避免死信队列保存明文 PII；流水线中有 PII 阶段或输入数据已经过 PII 处理时将记录标记为已脱敏
+func (p *Processor) protectRejected(stages []Stage, rejected []models.DeadLetterRecord) {
+	if p.piiApplied {
+		for i := range rejected {
+			rejected[i].PIIProtected = true
+		}
+		return
+	}
+	for k, stage := range stages {
+		pii, ok := stage.(*piiStage)
+		if !ok {
 			continue
 		}
-		processed = append(processed, transformed)
+		var pending []int
+		for i := range rejected {
+			if rejected[i].StageIndex < k {
+				pending = append(pending, i)
+			}
+		}
+		pii.protectRejected(p.pii, rejected, pending)
+		for i := range rejected {
+			rejected[i].PIIProtected = true
+		}
 	}
+}
 
-	log.Printf("数据处理完成，有效数据 %d 条", len(processed))
-	return processed, nil
+func (p *Processor) reset() {
+	p.rejected = nil
+	p.validation = nil
+	p.piiResults = nil
+}
+
+// ValidationResults 返回最近一次处理中各校验规则的结果
+func (p *Processor) ValidationResults() []models.ValidationResult {
+	return p.validation
+}
+
+// PIIResults 返回最近一次处理中各字段的 PII 处理结果
+func (p *Processor) PIIResults() []models.PIIResult {
+	return p.piiResults
+}
+
+// Rejected 返回最近一次 Process 中被拒绝的记录
+func (p *Processor) Rejected() []models.DeadLetterRecord {
+	return p.rejected
 }
 
 // applyCleaningRules 应用清洗规则
@@ -112,26 +297,3 @@ func (p *Processor) applyCleaningRule(value string, rule *models.CleaningRule) (
 		return value, nil
 	}
 }
-
-// applyTransformRules 应用转换规则
-func (p *Processor) applyTransformRules(record map[string]interface{}) (map[string]interface{}, error) {
-	result := make(map[string]interface{})
-	for k, v := range record {
-		result[k] = v
-	}
-
-	for _, rule := range p.config.TransformRules {
-		value, ok := result[rule.SourceField]
-		if !ok {
-			continue
-		}
-
-		// 简单的字段映射
-		if rule.TargetField != "" && rule.TargetField != rule.SourceField {
-			result[rule.TargetField] = value
-			delete(result, rule.SourceField)
-		}
-	}
-
-	return result, nil
-}
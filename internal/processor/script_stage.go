@@ -0,0 +1,275 @@
+package processor
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	starjson "go.starlark.net/lib/json"
+	starmath "go.starlark.net/lib/math"
+	"go.starlark.net/starlark"
+
+	"github.com/datafusion/worker/internal/models"
+)
+
+// 脚本阶段默认限制
+const (
+	defaultScriptMaxSteps  = 1000000
+	defaultScriptTimeoutMs = 1000
+)
+
+// scriptStage 用户自定义 Starlark 脚本阶段
+// 脚本需定义 process(record) 函数，返回 dict 表示一条记录，返回 list 表示多条记录，返回 None 表示丢弃
+// 脚本运行在沙箱中：不支持 load，没有文件和网络访问，每条记录限制执行步数和时间
+type scriptStage struct {
+	name     string
+	process  starlark.Value
+	maxSteps uint64
+	timeout  time.Duration
+}
+
+func newScriptStage(config *models.StageConfig, _ *models.ProcessorConfig) (Stage, error) {
+	if config.Script == "" {
+		return nil, fmt.Errorf("脚本不能为空")
+	}
+	if config.TimeoutMs < 0 {
+		return nil, fmt.Errorf("timeout_ms 不能为负数")
+	}
+
+	s := &scriptStage{
+		name:     nameOr(config.Name, StageScript),
+		maxSteps: config.MaxSteps,
+		timeout:  time.Duration(config.TimeoutMs) * time.Millisecond,
+	}
+	if s.maxSteps == 0 {
+		s.maxSteps = defaultScriptMaxSteps
+	}
+	if s.timeout == 0 {
+		s.timeout = defaultScriptTimeoutMs * time.Millisecond
+	}
+
+	// 顶层代码同样受步数和时间限制，执行完成后全局变量被冻结，可在多个线程中共享
+	thread := s.newThread()
+	timer := time.AfterFunc(s.timeout, func() { thread.Cancel("执行超时") })
+	globals, err := starlark.ExecFile(thread, s.name+".star", config.Script, starlark.StringDict{
+		"json": starjson.Module,
+		"math": starmath.Module,
+	})
+	timer.Stop()
+	if err != nil {
+		return nil, fmt.Errorf("编译脚本失败: %w", err)
+	}
+
+	process, ok := globals["process"]
+	if !ok {
+		return nil, fmt.Errorf("脚本未定义 process(record) 函数")
+	}
+	if _, ok := process.(starlark.Callable); !ok {
+		return nil, fmt.Errorf("脚本中的 process 不是函数")
+	}
+	s.process = process
+	return s, nil
+}
+
+func (s *scriptStage) Name() string { return s.name }
+
+// newThread 创建受步数限制的执行线程，print 输出到日志
+func (s *scriptStage) newThread() *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: s.name,
+		Print: func(_ *starlark.Thread, msg string) {
+			log.Printf("脚本阶段 %s: %s", s.name, msg)
+		},
+	}
+	thread.SetMaxExecutionSteps(s.maxSteps)
+	return thread
+}
+
+func (s *scriptStage) Process(ctx *StageContext, data []map[string]interface{}) ([]map[string]interface{}, error) {
+	var processed []map[string]interface{}
+	for _, record := range data {
+		records, err := s.run(record)
+		if err != nil {
+			log.Printf("脚本阶段 %s 处理数据失败: %v", s.name, err)
+			ctx.Reject(models.DeadLetterStageScript, s.name, record, err)
+			continue
+		}
+		processed = append(processed, records...)
+	}
+	return processed, nil
+}
+
+// run 对单条记录执行 process 函数
+func (s *scriptStage) run(record map[string]interface{}) ([]map[string]interface{}, error) {
+	arg, err := toStarlark(record)
+	if err != nil {
+		return nil, err
+	}
+
+	thread := s.newThread()
+	timer := time.AfterFunc(s.timeout, func() { thread.Cancel("执行超时") })
+	result, err := starlark.Call(thread, s.process, starlark.Tuple{arg}, nil)
+	timer.Stop()
+	if err != nil {
+		return nil, fmt.Errorf("执行脚本失败: %w", err)
+	}
+
+	switch v := result.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case *starlark.Dict:
+		out, err := fromStarlarkRecord(v)
+		if err != nil {
+			return nil, err
+		}
+		return []map[string]interface{}{out}, nil
+	case *starlark.List:
+		records := make([]map[string]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			dict, ok := v.Index(i).(*starlark.Dict)
+			if !ok {
+				return nil, fmt.Errorf("process 返回的列表中第 %d 项不是 dict: %s", i, v.Index(i).Type())
+			}
+			out, err := fromStarlarkRecord(dict)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, out)
+		}
+		return records, nil
+	default:
+		return nil, fmt.Errorf("process 只能返回 dict、list 或 None，实际为 %s", result.Type())
+	}
+}
+
+// toStarlark 将记录中的值转换为 Starlark 值
+func toStarlark(value interface{}) (starlark.Value, error) {
+	switch v := value.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case string:
+		return starlark.String(v), nil
+	case int:
+		return starlark.MakeInt(v), nil
+	case int32:
+		return starlark.MakeInt64(int64(v)), nil
+	case int64:
+		return starlark.MakeInt64(v), nil
+	case uint64:
+		return starlark.MakeUint64(v), nil
+	case float32:
+		return starlark.Float(v), nil
+	case float64:
+		return starlark.Float(v), nil
+	case time.Time:
+		return starlark.String(v.Format(time.RFC3339)), nil
+	case []string:
+		items := make([]starlark.Value, len(v))
+		for i, item := range v {
+			items[i] = starlark.String(item)
+		}
+		return starlark.NewList(items), nil
+	case []interface{}:
+		items := make([]starlark.Value, len(v))
+		for i, item := range v {
+			sv, err := toStarlark(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = sv
+		}
+		return starlark.NewList(items), nil
+	case map[string]interface{}:
+		// 按键排序，保证脚本中遍历顺序稳定
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		dict := starlark.NewDict(len(v))
+		for _, k := range keys {
+			sv, err := toStarlark(v[k])
+			if err != nil {
+				return nil, err
+			}
+			if err := dict.SetKey(starlark.String(k), sv); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	default:
+		return starlark.String(fmt.Sprintf("%v", v)), nil
+	}
+}
+
+// fromStarlarkRecord 将脚本返回的 dict 转换为记录
+func fromStarlarkRecord(dict *starlark.Dict) (map[string]interface{}, error) {
+	value, err := fromStarlark(dict)
+	if err != nil {
+		return nil, err
+	}
+	return value.(map[string]interface{}), nil
+}
+
+// fromStarlark 将 Starlark 值转换为记录中的值
+func fromStarlark(value starlark.Value) (interface{}, error) {
+	switch v := value.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Int:
+		if i, ok := v.Int64(); ok {
+			return i, nil
+		}
+		f := v.Float()
+		if math.IsInf(float64(f), 0) {
+			return nil, fmt.Errorf("整数超出范围: %s", v)
+		}
+		return float64(f), nil
+	case starlark.Float:
+		return float64(v), nil
+	case *starlark.List:
+		items := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			item, err := fromStarlark(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	case starlark.Tuple:
+		items := make([]interface{}, len(v))
+		for i, elem := range v {
+			item, err := fromStarlark(elem)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	case *starlark.Dict:
+		out := make(map[string]interface{}, v.Len())
+		for _, kv := range v.Items() {
+			key, ok := kv[0].(starlark.String)
+			if !ok {
+				return nil, fmt.Errorf("dict 的键必须是字符串，实际为 %s", kv[0].Type())
+			}
+			item, err := fromStarlark(kv[1])
+			if err != nil {
+				return nil, err
+			}
+			out[string(key)] = item
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("不支持的返回值类型: %s", value.Type())
+	}
+}
@@ -0,0 +1,126 @@
+package processor
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+)
+
+// defaultNearThreshold 近似去重默认的最大汉明距离
+const defaultNearThreshold = 3
+
+// maxNearThreshold 近似去重允许的最大汉明距离，超过后分段过短，候选指纹过多
+const maxNearThreshold = 15
+
+// nearThreshold 返回近似去重的最大汉明距离，未配置时使用默认值，配置为 0 时只有指纹相同才视为重复
+func (c *DeduplicatorConfig) nearThreshold() int {
+	if c.Threshold == nil {
+		return defaultNearThreshold
+	}
+	return *c.Threshold
+}
+
+// simHash 计算文本的 64 位 SimHash 指纹，内容相近的文本指纹的汉明距离较小
+func simHash(text string) uint64 {
+	var weights [64]int
+	for feature, count := range textFeatures(text) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		for i := 0; i < 64; i++ {
+			if sum&(1<<uint(i)) != 0 {
+				weights[i] += count
+			} else {
+				weights[i] -= count
+			}
+		}
+	}
+
+	var fingerprint uint64
+	for i := 0; i < 64; i++ {
+		if weights[i] > 0 {
+			fingerprint |= 1 << uint(i)
+		}
+	}
+	return fingerprint
+}
+
+// textFeatures 提取文本特征及出现次数：字母数字按单词（忽略大小写），汉字等无空格分词的文字按相邻两字
+func textFeatures(text string) map[string]int {
+	features := make(map[string]int)
+	var word []rune
+	var han []rune
+
+	flushWord := func() {
+		if len(word) > 0 {
+			features[strings.ToLower(string(word))]++
+			word = word[:0]
+		}
+	}
+	flushHan := func() {
+		switch len(han) {
+		case 0:
+		case 1:
+			features[string(han)]++
+		default:
+			for i := 0; i+1 < len(han); i++ {
+				features[string(han[i:i+2])]++
+			}
+		}
+		han = han[:0]
+	}
+
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+			flushWord()
+			han = append(han, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushHan()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushHan()
+		}
+	}
+	flushWord()
+	flushHan()
+	return features
+}
+
+// hammingDistance 计算两个指纹的汉明距离
+func hammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// fingerprintBands 将指纹分成 threshold+1 段并生成各段的索引键
+// 汉明距离不超过 threshold 的两个指纹至少有一段完全相同，只需比较有相同分段的候选指纹
+func fingerprintBands(fingerprint uint64, threshold int) []string {
+	n := threshold + 1
+	width := 64 / n
+	bands := make([]string, n)
+	start := 0
+	for i := 0; i < n; i++ {
+		size := width
+		if i == n-1 {
+			size = 64 - start
+		}
+		value := (fingerprint >> uint(start)) & (1<<uint(size) - 1)
+		bands[i] = fmt.Sprintf("%d/%d:%x", i, n, value)
+		start += size
+	}
+	return bands
+}
+
+// nearText 拼接用于近似去重的文本字段
+func nearText(fields []string, item map[string]interface{}) string {
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if value, ok := getPath(item, field); ok && value != nil {
+			parts = append(parts, stringValue(value))
+		}
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n"))
+}
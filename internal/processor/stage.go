@@ -0,0 +1,269 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/datafusion/worker/internal/models"
+)
+
+// 内置处理阶段类型
+const (
+	StageClean     = "clean"
+	StageTransform = "transform"
+	StageValidate  = "validate"
+	StageScript    = "script"
+	StagePII       = "pii"
+	StageEnrich    = "enrich"
+)
+
+// Stage 处理阶段接口
+type Stage interface {
+	// Process 处理一批记录，返回保留的记录
+	// 单条记录失败时通过 ctx.Reject 放入死信队列，返回错误时本次处理整体失败
+	Process(ctx *StageContext, data []map[string]interface{}) ([]map[string]interface{}, error)
+
+	// Name 返回阶段名称
+	Name() string
+}
+
+// StageContext 阶段执行上下文，收集被拒绝的记录、校验结果和 PII 处理结果
+type StageContext struct {
+	Rejected   []models.DeadLetterRecord
+	Validation []models.ValidationResult
+	PIIResults []models.PIIResult
+
+	PII             *PIIOptions     // PII 阶段使用的哈希盐和令牌库
+	CollectedAt     time.Time       // 数据的采集时间，清洗相对时间（如 3小时前）时作为基准
+	ReferenceLoader ReferenceLoader // 关联补充阶段使用的参考数据加载器
+
+	references map[string]*referenceTable // 本次处理中已加载的参考数据
+}
+
+// Reject 记录被拒绝的数据
+func (c *StageContext) Reject(stage, rule string, record map[string]interface{}, err error) {
+	c.Rejected = append(c.Rejected, models.DeadLetterRecord{
+		Stage:  stage,
+		Rule:   rule,
+		Error:  err.Error(),
+		Record: record,
+	})
+}
+
+// StageBuilder 根据阶段配置创建处理阶段，processor 为任务的处理器配置
+type StageBuilder func(config *models.StageConfig, processor *models.ProcessorConfig) (Stage, error)
+
+// StageFactory 处理阶段工厂
+type StageFactory struct {
+	mu       sync.RWMutex
+	builders map[string]StageBuilder
+}
+
+// NewStageFactory 创建处理阶段工厂，已注册内置阶段
+func NewStageFactory() *StageFactory {
+	f := &StageFactory{builders: make(map[string]StageBuilder)}
+	f.Register(StageClean, newCleanStage)
+	f.Register(StageTransform, newTransformStage)
+	f.Register(StageValidate, newValidateStage)
+	f.Register(StageScript, newScriptStage)
+	f.Register(StagePII, newPIIStage)
+	f.Register(StageEnrich, newEnrichStage)
+	return f
+}
+
+// Register 注册处理阶段，同名类型会覆盖已有注册
+func (f *StageFactory) Register(stageType string, builder StageBuilder) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.builders[stageType] = builder
+}
+
+// Get 获取处理阶段的构造函数
+func (f *StageFactory) Get(stageType string) (StageBuilder, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	builder, ok := f.builders[stageType]
+	return builder, ok
+}
+
+// Build 按处理器配置创建有序的阶段列表
+// 未配置 stages 时依次为 clean、transform、validate，配置了 enrichments 时在 validate 之前执行 enrich，
+// 配置了 pii 时最后执行 pii
+func (f *StageFactory) Build(processor *models.ProcessorConfig) ([]Stage, error) {
+	configs := processor.Stages
+	if len(configs) == 0 {
+		configs = []models.StageConfig{{Type: StageClean}, {Type: StageTransform}}
+		if len(processor.Enrichments) > 0 {
+			configs = append(configs, models.StageConfig{Type: StageEnrich})
+		}
+		configs = append(configs, models.StageConfig{Type: StageValidate})
+		if processor.PII != nil {
+			configs = append(configs, models.StageConfig{Type: StagePII})
+		}
+	}
+
+	stages := make([]Stage, 0, len(configs))
+	for i := range configs {
+		config := &configs[i]
+		builder, ok := f.Get(config.Type)
+		if !ok {
+			return nil, fmt.Errorf("不支持的处理阶段: %s", config.Type)
+		}
+		stage, err := builder(config, processor)
+		if err != nil {
+			return nil, fmt.Errorf("处理阶段 %s 配置错误: %w", stageName(config, i), err)
+		}
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
+
+// UsesPII 判断处理器配置的流水线中是否包含 PII 阶段，包含时流水线输出的数据已经脱敏
+func UsesPII(processor *models.ProcessorConfig) bool {
+	if len(processor.Stages) == 0 {
+		return processor.PII != nil
+	}
+	for _, stage := range processor.Stages {
+		if stage.Type == StagePII {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultStageFactory 处理器使用的默认阶段工厂
+var defaultStageFactory = NewStageFactory()
+
+// RegisterStage 在默认工厂中注册自定义处理阶段
+func RegisterStage(stageType string, builder StageBuilder) {
+	defaultStageFactory.Register(stageType, builder)
+}
+
+// ValidateStages 校验处理阶段配置（包括脚本编译），用于保存任务时提前发现错误
+func ValidateStages(processor *models.ProcessorConfig) error {
+	if len(processor.Stages) == 0 {
+		return nil
+	}
+	_, err := defaultStageFactory.Build(processor)
+	return err
+}
+
+// stageName 返回阶段名称，未配置时使用类型
+func stageName(config *models.StageConfig, index int) string {
+	if config.Name != "" {
+		return config.Name
+	}
+	return fmt.Sprintf("#%d(%s)", index+1, config.Type)
+}
+
+// cleanStage 清洗阶段，清洗失败的记录进入死信队列
+type cleanStage struct {
+	name    string
+	cleaner *EnhancedCleaner
+	empty   bool
+}
+
+func newCleanStage(config *models.StageConfig, processor *models.ProcessorConfig) (Stage, error) {
+	rules := config.CleaningRules
+	if len(rules) == 0 {
+		rules = processor.CleaningRules
+	}
+	return &cleanStage{name: config.Name, cleaner: NewEnhancedCleaner(rules), empty: len(rules) == 0}, nil
+}
+
+func (s *cleanStage) Name() string { return nameOr(s.name, StageClean) }
+
+func (s *cleanStage) Process(ctx *StageContext, data []map[string]interface{}) ([]map[string]interface{}, error) {
+	if s.empty {
+		return data, nil
+	}
+	cleaned, rejected := s.cleaner.WithCollectedAt(ctx.CollectedAt).CleanEach(data)
+	ctx.Rejected = append(ctx.Rejected, rejected...)
+	return cleaned, nil
+}
+
+// transformStage 转换阶段，转换失败的记录进入死信队列
+type transformStage struct {
+	name        string
+	transformer *Transformer
+}
+
+func newTransformStage(config *models.StageConfig, processor *models.ProcessorConfig) (Stage, error) {
+	rules := config.TransformRules
+	if len(rules) == 0 {
+		rules = processor.TransformRules
+	}
+	transformer, err := NewTransformer(rules)
+	if err != nil {
+		return nil, fmt.Errorf("转换规则配置错误: %w", err)
+	}
+	return &transformStage{name: config.Name, transformer: transformer}, nil
+}
+
+func (s *transformStage) Name() string { return nameOr(s.name, StageTransform) }
+
+func (s *transformStage) Process(ctx *StageContext, data []map[string]interface{}) ([]map[string]interface{}, error) {
+	var processed []map[string]interface{}
+	for _, record := range data {
+		transformed, err := s.transformer.Transform(record)
+		if err != nil {
+			log.Printf("转换数据失败: %v", err)
+			rule := ""
+			var ruleErr *RuleError
+			if errors.As(err, &ruleErr) {
+				rule = ruleErr.Rule
+			}
+			ctx.Reject(models.DeadLetterStageTransform, rule, record, err)
+			continue
+		}
+		processed = append(processed, transformed...)
+	}
+	return processed, nil
+}
+
+// validateStage 校验阶段，违反 quarantine 规则的记录进入死信队列
+type validateStage struct {
+	name      string
+	validator *Validator
+}
+
+func newValidateStage(config *models.StageConfig, processor *models.ProcessorConfig) (Stage, error) {
+	rules := config.ValidationRules
+	if len(rules) == 0 {
+		rules = processor.ValidationRules
+	}
+	if len(rules) == 0 {
+		return &validateStage{name: config.Name}, nil
+	}
+	validator, err := NewValidator(rules)
+	if err != nil {
+		return nil, fmt.Errorf("校验规则配置错误: %w", err)
+	}
+	return &validateStage{name: config.Name, validator: validator}, nil
+}
+
+func (s *validateStage) Name() string { return nameOr(s.name, StageValidate) }
+
+func (s *validateStage) Process(ctx *StageContext, data []map[string]interface{}) ([]map[string]interface{}, error) {
+	if s.validator == nil {
+		return data, nil
+	}
+	passed, quarantined, results, err := s.validator.Validate(data)
+	ctx.Validation = append(ctx.Validation, results...)
+	if err != nil {
+		return nil, fmt.Errorf("数据校验失败: %w", err)
+	}
+	ctx.Rejected = append(ctx.Rejected, quarantined...)
+	return passed, nil
+}
+
+// nameOr 返回 name，为空时返回 fallback
+func nameOr(name, fallback string) string {
+	if name != "" {
+		return name
+	}
+	return fallback
+}
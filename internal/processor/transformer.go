@@ -0,0 +1,557 @@
+package processor
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/expr-lang/expr"
+)
+
+// 转换规则类型
+const (
+	TransformRename     = "rename"
+	TransformConvert    = "convert"
+	TransformTemplate   = "template"
+	TransformExpression = "expression"
+	TransformSplit      = "split"
+	TransformConcat     = "concat"
+	TransformConstant   = "constant"
+	TransformDefault    = "default"
+	TransformLookup     = "lookup"
+	TransformDrop       = "drop"
+	TransformFlatten    = "flatten"
+	TransformUnflatten  = "unflatten"
+	TransformExplode    = "explode"
+)
+
+// defaultFlattenSeparator flatten / unflatten 默认的键分隔符
+const defaultFlattenSeparator = "."
+
+// templatePlaceholder 模板占位符，如 {title}
+var templatePlaceholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// RuleError 某条规则应用失败
+type RuleError struct {
+	Rule string
+	Err  error
+}
+
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("规则 %s: %v", e.Rule, e.Err)
+}
+
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
+
+// compiledTransform 预编译的转换规则
+type compiledTransform struct {
+	rule    models.TransformRule
+	name    string
+	program *limitedProgram
+}
+
+// Transformer 转换引擎，创建时校验并预编译所有规则
+type Transformer struct {
+	rules []compiledTransform
+}
+
+// NewTransformer 创建转换引擎，规则配置错误（包括表达式语法错误）时返回错误
+func NewTransformer(rules []models.TransformRule) (*Transformer, error) {
+	t := &Transformer{rules: make([]compiledTransform, 0, len(rules))}
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d(%s)", i+1, ruleType(rule))
+		}
+
+		compiled := compiledTransform{rule: rule, name: name}
+		if err := validateTransformRule(&compiled); err != nil {
+			return nil, &RuleError{Rule: name, Err: err}
+		}
+		t.rules = append(t.rules, compiled)
+	}
+	return t, nil
+}
+
+// ValidateTransformRules 校验转换规则，用于保存任务时提前发现错误
+func ValidateTransformRules(rules []models.TransformRule) error {
+	_, err := NewTransformer(rules)
+	return err
+}
+
+// ruleType 返回规则类型，未指定时为 rename
+// 未指定 data_type 的 convert 规则与旧版本一致，按字段映射处理
+func ruleType(rule models.TransformRule) string {
+	t := strings.ToLower(rule.Type)
+	if t == "" || (t == TransformConvert && rule.DataType == "") {
+		return TransformRename
+	}
+	return t
+}
+
+// validateTransformRule 校验单条规则并编译表达式
+func validateTransformRule(c *compiledTransform) error {
+	rule := c.rule
+	if err := validateWildcardRule(rule); err != nil {
+		return err
+	}
+	switch ruleType(rule) {
+	case TransformRename, "map", "format":
+		// format 为旧版本遗留的类型名，按字段映射处理
+		if rule.SourceField == "" {
+			return fmt.Errorf("缺少 source_field")
+		}
+	case TransformConvert:
+		if rule.SourceField == "" {
+			return fmt.Errorf("缺少 source_field")
+		}
+		switch strings.ToLower(rule.DataType) {
+		case "int", "integer", "float", "number", "string", "bool", "boolean", "time", "datetime":
+		default:
+			return fmt.Errorf("不支持的数据类型: %s", rule.DataType)
+		}
+	case TransformTemplate:
+		if rule.Template == "" {
+			return fmt.Errorf("缺少 template")
+		}
+		if rule.TargetField == "" {
+			return fmt.Errorf("缺少 target_field")
+		}
+	case TransformExpression:
+		if rule.Expression == "" {
+			return fmt.Errorf("缺少 expression")
+		}
+		if targetField(rule) == "" {
+			return fmt.Errorf("缺少 target_field")
+		}
+		program, err := compileExpression(rule.Expression,
+			expr.Env(map[string]interface{}{}),
+			expr.AllowUndefinedVariables())
+		if err != nil {
+			return fmt.Errorf("表达式错误: %w", err)
+		}
+		c.program = program
+	case TransformSplit:
+		if rule.SourceField == "" {
+			return fmt.Errorf("缺少 source_field")
+		}
+		if rule.Separator == "" {
+			return fmt.Errorf("缺少 separator")
+		}
+	case TransformConcat:
+		if len(rule.SourceFields) == 0 {
+			return fmt.Errorf("缺少 source_fields")
+		}
+		if rule.TargetField == "" {
+			return fmt.Errorf("缺少 target_field")
+		}
+	case TransformConstant, TransformDefault:
+		if targetField(rule) == "" {
+			return fmt.Errorf("缺少 target_field")
+		}
+	case TransformLookup:
+		if rule.SourceField == "" {
+			return fmt.Errorf("缺少 source_field")
+		}
+		if len(rule.Lookup) == 0 {
+			return fmt.Errorf("缺少 lookup")
+		}
+	case TransformDrop:
+		if rule.SourceField == "" && len(rule.SourceFields) == 0 {
+			return fmt.Errorf("缺少 source_field 或 source_fields")
+		}
+	case TransformFlatten, TransformUnflatten:
+	case TransformExplode:
+		if rule.SourceField == "" {
+			return fmt.Errorf("缺少 source_field")
+		}
+	default:
+		return fmt.Errorf("不支持的转换类型: %s", rule.Type)
+	}
+	return nil
+}
+
+// splitWildcard 在最后一个 [*] 处拆分路径，返回数组路径（含 [*]）和元素内的相对路径，不含通配时 ok 为 false
+func splitWildcard(path string) (array, rest string, ok bool) {
+	i := strings.LastIndex(path, "[*]")
+	if i < 0 {
+		return "", "", false
+	}
+	return path[:i+3], strings.TrimPrefix(path[i+3:], "."), true
+}
+
+// elementwise 判断规则是否按数组元素逐个应用（rename、convert、lookup 的 source_field 含 [*]）
+func elementwise(rule models.TransformRule) bool {
+	switch ruleType(rule) {
+	case TransformRename, "map", "format", TransformConvert, TransformLookup:
+		return strings.Contains(rule.SourceField, "[*]")
+	}
+	return false
+}
+
+// validateWildcardRule 校验通配路径：逐元素应用的规则，target_field 必须位于同一数组元素内，
+// 如 items[*].price -> items[*].amount；rename 不能重命名数组元素本身
+func validateWildcardRule(rule models.TransformRule) error {
+	if !elementwise(rule) {
+		return nil
+	}
+	array, rest, _ := splitWildcard(rule.SourceField)
+	target := targetField(rule)
+	if target == rule.SourceField {
+		return nil
+	}
+	targetArray, targetRest, ok := splitWildcard(target)
+	if !ok || targetArray != array || targetRest == "" || rest == "" {
+		return fmt.Errorf("通配路径 %s 的 target_field 必须位于同一数组元素内，如 %s.字段", rule.SourceField, array)
+	}
+	return nil
+}
+
+// applyEach 对通配路径匹配的每个数组元素分别应用规则，字段路径改为元素内的相对路径
+func (c *compiledTransform) applyEach(record map[string]interface{}) error {
+	array, rest, _ := splitWildcard(c.rule.SourceField)
+	_, targetRest, _ := splitWildcard(targetField(c.rule))
+
+	elemRule := c.rule
+	elemRule.SourceField = rest
+	elemRule.TargetField = targetRest
+	elem := &compiledTransform{rule: elemRule, name: c.name}
+
+	return updatePath(record, array, func(item interface{}) (interface{}, error) {
+		if rest == "" {
+			// 数组元素本身（如 tags[*]），包装为临时对象后按顶层字段处理
+			wrapper := map[string]interface{}{"value": item}
+			elem.rule.SourceField, elem.rule.TargetField = "value", "value"
+			if err := elem.apply(wrapper); err != nil {
+				return item, err
+			}
+			return wrapper["value"], nil
+		}
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return item, nil
+		}
+		if err := elem.apply(obj); err != nil {
+			return item, err
+		}
+		return obj, nil
+	})
+}
+
+// targetField 返回写入的字段，未指定 target_field 时写回 source_field
+func targetField(rule models.TransformRule) string {
+	if rule.TargetField != "" {
+		return rule.TargetField
+	}
+	return rule.SourceField
+}
+
+// Transform 对单条记录依次应用所有规则，失败时返回 *RuleError
+// 通常返回一行，explode 规则会将一条记录展开为多行
+func (t *Transformer) Transform(record map[string]interface{}) ([]map[string]interface{}, error) {
+	rows := []map[string]interface{}{deepCopyRecord(record)}
+
+	for i := range t.rules {
+		c := &t.rules[i]
+		if ruleType(c.rule) == TransformExplode {
+			exploded, err := explodeRows(rows, c.rule)
+			if err != nil {
+				return nil, &RuleError{Rule: c.name, Err: err}
+			}
+			rows = exploded
+			continue
+		}
+		for _, row := range rows {
+			if err := c.apply(row); err != nil {
+				return nil, &RuleError{Rule: c.name, Err: err}
+			}
+		}
+	}
+	return rows, nil
+}
+
+// apply 应用单条规则，字段均支持嵌套路径
+func (c *compiledTransform) apply(record map[string]interface{}) error {
+	rule := c.rule
+	if elementwise(rule) {
+		return c.applyEach(record)
+	}
+	switch ruleType(rule) {
+	case TransformRename, "map", "format":
+		value, ok := getPath(record, rule.SourceField)
+		if !ok {
+			return nil
+		}
+		if rule.TargetField != "" && rule.TargetField != rule.SourceField {
+			deletePath(record, rule.SourceField)
+			return setPath(record, rule.TargetField, value)
+		}
+
+	case TransformConvert:
+		value, ok := getPath(record, rule.SourceField)
+		if !ok {
+			return nil
+		}
+		converted, err := convertValue(value, strings.ToLower(rule.DataType), rule.Format)
+		if err != nil {
+			return fmt.Errorf("字段 %s 类型转换失败: %w", rule.SourceField, err)
+		}
+		return setPath(record, targetField(rule), converted)
+
+	case TransformTemplate:
+		return setPath(record, rule.TargetField, templatePlaceholder.ReplaceAllStringFunc(rule.Template, func(m string) string {
+			value, _ := getPath(record, strings.TrimSpace(m[1:len(m)-1]))
+			return stringValue(value)
+		}))
+
+	case TransformExpression:
+		value, err := c.program.run(record)
+		if err != nil {
+			return fmt.Errorf("表达式计算失败: %w", err)
+		}
+		return setPath(record, targetField(rule), value)
+
+	case TransformSplit:
+		value, ok := getPath(record, rule.SourceField)
+		if !ok || value == nil {
+			return nil
+		}
+		parts := strings.Split(stringValue(value), rule.Separator)
+		if len(rule.TargetFields) == 0 {
+			items := make([]interface{}, len(parts))
+			for i, part := range parts {
+				items[i] = strings.TrimSpace(part)
+			}
+			return setPath(record, targetField(rule), items)
+		}
+		for i, field := range rule.TargetFields {
+			var part interface{}
+			if i < len(parts) {
+				part = strings.TrimSpace(parts[i])
+			}
+			if err := setPath(record, field, part); err != nil {
+				return err
+			}
+		}
+
+	case TransformConcat:
+		parts := make([]string, 0, len(rule.SourceFields))
+		for _, field := range rule.SourceFields {
+			if value, ok := getPath(record, field); ok && value != nil {
+				parts = append(parts, stringValue(value))
+			}
+		}
+		return setPath(record, rule.TargetField, strings.Join(parts, rule.Separator))
+
+	case TransformConstant:
+		return setPath(record, targetField(rule), rule.Value)
+
+	case TransformDefault:
+		field := targetField(rule)
+		if value, ok := getPath(record, field); !ok || value == nil || value == "" {
+			return setPath(record, field, rule.Value)
+		}
+
+	case TransformLookup:
+		value, ok := getPath(record, rule.SourceField)
+		if !ok {
+			return nil
+		}
+		if mapped, ok := rule.Lookup[stringValue(value)]; ok {
+			value = mapped
+		} else if rule.Default != nil {
+			value = rule.Default
+		}
+		return setPath(record, targetField(rule), value)
+
+	case TransformDrop:
+		if rule.SourceField != "" {
+			deletePath(record, rule.SourceField)
+		}
+		for _, field := range rule.SourceFields {
+			deletePath(record, field)
+		}
+
+	case TransformFlatten:
+		sep := flattenSeparator(rule)
+		flattened := make(map[string]interface{})
+		if rule.SourceField == "" {
+			// 展开整条记录
+			flattenValue("", record, sep, flattened)
+			for k := range record {
+				delete(record, k)
+			}
+		} else {
+			value, ok := getPath(record, rule.SourceField)
+			if !ok {
+				return nil
+			}
+			deletePath(record, rule.SourceField)
+			flattenValue(targetField(rule), value, sep, flattened)
+		}
+		for k, v := range flattened {
+			record[k] = v
+		}
+
+	case TransformUnflatten:
+		unflattened := unflattenRecord(record, flattenSeparator(rule))
+		for k := range record {
+			delete(record, k)
+		}
+		for k, v := range unflattened {
+			record[k] = v
+		}
+	}
+	return nil
+}
+
+// flattenSeparator 返回 flatten / unflatten 使用的分隔符
+func flattenSeparator(rule models.TransformRule) string {
+	if rule.Separator != "" {
+		return rule.Separator
+	}
+	return defaultFlattenSeparator
+}
+
+// explodeRows 将数组字段展开为多行，每个元素写入 target_field（默认写回原字段）
+// 字段不存在或不是数组时保留原行，空数组保留一行且字段为 null，避免记录丢失
+func explodeRows(rows []map[string]interface{}, rule models.TransformRule) ([]map[string]interface{}, error) {
+	result := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		value, ok := getPath(row, rule.SourceField)
+		items, isArray := value.([]interface{})
+		if !ok || !isArray {
+			result = append(result, row)
+			continue
+		}
+		if len(items) == 0 {
+			items = []interface{}{nil}
+		}
+
+		for _, item := range items {
+			exploded := deepCopyRecord(row)
+			if rule.TargetField != "" && rule.TargetField != rule.SourceField {
+				deletePath(exploded, rule.SourceField)
+			}
+			if err := setPath(exploded, targetField(rule), deepCopyValue(item)); err != nil {
+				return nil, err
+			}
+			result = append(result, exploded)
+		}
+	}
+	return result, nil
+}
+
+// convertValue 将值转换为指定类型，nil 保持为 nil
+func convertValue(value interface{}, dataType, format string) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	switch dataType {
+	case "int", "integer":
+		switch v := value.(type) {
+		case int:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		case float64:
+			return int64(v), nil
+		case bool:
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+		s := strings.ReplaceAll(strings.TrimSpace(stringValue(value)), ",", "")
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n, nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("无法转换为整数: %v", value)
+		}
+		return int64(f), nil
+
+	case "float", "number":
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		}
+		s := strings.ReplaceAll(strings.TrimSpace(stringValue(value)), ",", "")
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("无法转换为浮点数: %v", value)
+		}
+		return f, nil
+
+	case "bool", "boolean":
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		switch strings.ToLower(strings.TrimSpace(stringValue(value))) {
+		case "true", "1", "yes", "y", "on", "是":
+			return true, nil
+		case "false", "0", "no", "n", "off", "否", "":
+			return false, nil
+		}
+		return nil, fmt.Errorf("无法转换为布尔值: %v", value)
+
+	case "time", "datetime":
+		if t, ok := value.(time.Time); ok {
+			return t, nil
+		}
+		s := strings.TrimSpace(stringValue(value))
+		if format != "" {
+			t, err := time.Parse(format, s)
+			if err != nil {
+				return nil, fmt.Errorf("无法按格式 %s 解析时间: %s", format, s)
+			}
+			return t, nil
+		}
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("无法解析时间: %s", s)
+
+	default:
+		return stringValue(value), nil
+	}
+}
+
+// timeLayouts 未指定格式时依次尝试的时间格式
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02",
+	"2006年01月02日",
+}
+
+// stringValue 将值转换为字符串
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
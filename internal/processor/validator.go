@@ -0,0 +1,358 @@
+package processor
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/expr-lang/expr"
+)
+
+// actionSeverity 同一记录违反多条规则时按最严重的处理方式处理
+var actionSeverity = map[string]int{
+	models.ValidationActionWarn:       0,
+	models.ValidationActionDrop:       1,
+	models.ValidationActionQuarantine: 2,
+	models.ValidationActionFail:       3,
+}
+
+// compiledValidation 预编译的校验规则
+type compiledValidation struct {
+	rule    models.ValidationRule
+	name    string
+	action  string
+	pattern *regexp.Regexp
+	program *limitedProgram
+	enum    map[string]struct{}
+	seen    map[string]struct{} // unique 规则在本批次中已出现的键
+}
+
+// Validator 数据校验器
+type Validator struct {
+	rules []*compiledValidation
+}
+
+// NewValidator 创建校验器，规则配置错误（包括正则、表达式错误）时返回错误
+func NewValidator(rules []models.ValidationRule) (*Validator, error) {
+	v := &Validator{rules: make([]*compiledValidation, 0, len(rules))}
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d(%s)", i+1, rule.Type)
+		}
+		compiled, err := compileValidation(rule, name)
+		if err != nil {
+			return nil, &RuleError{Rule: name, Err: err}
+		}
+		v.rules = append(v.rules, compiled)
+	}
+	return v, nil
+}
+
+// ValidateValidationRules 校验规则配置，用于保存任务时提前发现错误
+func ValidateValidationRules(rules []models.ValidationRule) error {
+	_, err := NewValidator(rules)
+	return err
+}
+
+// compileValidation 校验规则配置并预编译
+func compileValidation(rule models.ValidationRule, name string) (*compiledValidation, error) {
+	c := &compiledValidation{rule: rule, name: name, action: strings.ToLower(rule.Action)}
+	if c.action == "" {
+		c.action = models.ValidationActionQuarantine
+	}
+	if _, ok := actionSeverity[c.action]; !ok {
+		return nil, fmt.Errorf("不支持的处理方式: %s", rule.Action)
+	}
+
+	needField := func() error {
+		if rule.Field == "" {
+			return fmt.Errorf("缺少 field")
+		}
+		return nil
+	}
+
+	switch rule.Type {
+	case models.ValidationRequired:
+		return c, needField()
+	case models.ValidationType:
+		switch rule.DataType {
+		case "string", "number", "integer", "bool", "object", "array":
+		default:
+			return nil, fmt.Errorf("不支持的数据类型: %s", rule.DataType)
+		}
+		return c, needField()
+	case models.ValidationRange:
+		if rule.Min == nil && rule.Max == nil {
+			return nil, fmt.Errorf("缺少 min 或 max")
+		}
+		return c, needField()
+	case models.ValidationRegex:
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("缺少 pattern")
+		}
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("正则表达式错误: %w", err)
+		}
+		c.pattern = pattern
+		return c, needField()
+	case models.ValidationEnum:
+		if len(rule.Values) == 0 {
+			return nil, fmt.Errorf("缺少 values")
+		}
+		c.enum = make(map[string]struct{}, len(rule.Values))
+		for _, value := range rule.Values {
+			c.enum[stringValue(value)] = struct{}{}
+		}
+		return c, needField()
+	case models.ValidationUnique:
+		if rule.Field == "" && len(rule.Fields) == 0 {
+			return nil, fmt.Errorf("缺少 field 或 fields")
+		}
+		return c, nil
+	case models.ValidationExpression:
+		if rule.Expression == "" {
+			return nil, fmt.Errorf("缺少 expression")
+		}
+		program, err := compileExpression(rule.Expression,
+			expr.Env(map[string]interface{}{}),
+			expr.AllowUndefinedVariables(),
+			expr.AsBool())
+		if err != nil {
+			return nil, fmt.Errorf("表达式错误: %w", err)
+		}
+		c.program = program
+		return c, nil
+	default:
+		return nil, fmt.Errorf("不支持的校验类型: %s", rule.Type)
+	}
+}
+
+// Validate 校验一批记录
+// 返回通过（含仅告警）的记录、需要进入死信队列的记录和各规则结果；
+// 任一记录违反 fail 规则时返回错误，此时结果中包含已校验部分的统计
+func (v *Validator) Validate(data []map[string]interface{}) ([]map[string]interface{}, []models.DeadLetterRecord, []models.ValidationResult, error) {
+	results := make([]models.ValidationResult, len(v.rules))
+	for i, c := range v.rules {
+		c.seen = make(map[string]struct{})
+		results[i] = models.ValidationResult{Rule: c.name, Type: c.rule.Type, Action: c.action}
+	}
+
+	passed := make([]map[string]interface{}, 0, len(data))
+	var quarantined []models.DeadLetterRecord
+	dropped := 0
+
+	for _, record := range data {
+		worst := -1
+		var worstRule *compiledValidation
+		var worstErr error
+
+		for i, c := range v.rules {
+			err := c.check(record)
+			if err == nil {
+				results[i].Passed++
+				continue
+			}
+			if c.rule.Message != "" {
+				err = fmt.Errorf("%s", c.rule.Message)
+			}
+			results[i].Failed++
+			if results[i].FirstError == "" {
+				results[i].FirstError = err.Error()
+			}
+			if severity := actionSeverity[c.action]; severity > worst {
+				worst, worstRule, worstErr = severity, c, err
+			}
+		}
+
+		if worstRule == nil {
+			passed = append(passed, record)
+			continue
+		}
+
+		switch worstRule.action {
+		case models.ValidationActionFail:
+			return nil, nil, results, &RuleError{Rule: worstRule.name, Err: worstErr}
+		case models.ValidationActionQuarantine:
+			quarantined = append(quarantined, models.DeadLetterRecord{
+				Stage:  models.DeadLetterStageValidate,
+				Rule:   worstRule.name,
+				Error:  worstErr.Error(),
+				Record: record,
+			})
+		case models.ValidationActionDrop:
+			dropped++
+		default:
+			passed = append(passed, record)
+		}
+	}
+
+	for _, result := range results {
+		if result.Failed > 0 {
+			log.Printf("校验规则 %s 失败 %d 条（%s），首个错误: %s", result.Rule, result.Failed, result.Action, result.FirstError)
+		}
+	}
+	if dropped > 0 {
+		log.Printf("校验丢弃 %d 条记录", dropped)
+	}
+	return passed, quarantined, results, nil
+}
+
+// check 对单条记录执行规则
+func (c *compiledValidation) check(record map[string]interface{}) error {
+	rule := c.rule
+
+	switch rule.Type {
+	case models.ValidationRequired:
+		value, ok := getPath(record, rule.Field)
+		if !ok || isEmptyValue(value) {
+			return fmt.Errorf("字段 %s 不能为空", rule.Field)
+		}
+		return nil
+
+	case models.ValidationUnique:
+		fields := rule.Fields
+		if len(fields) == 0 {
+			fields = []string{rule.Field}
+		}
+		// 缺少任一字段的记录不参与唯一性校验，否则缺失值之间会被判为重复
+		parts := make([]string, len(fields))
+		for i, field := range fields {
+			value, ok := getPath(record, field)
+			if !ok || value == nil {
+				return nil
+			}
+			parts[i] = stringValue(value)
+		}
+		key := strings.Join(parts, "\x00")
+		if _, dup := c.seen[key]; dup {
+			return fmt.Errorf("字段 %s 的值 %s 在本批次中重复", strings.Join(fields, ","), strings.Join(parts, ","))
+		}
+		c.seen[key] = struct{}{}
+		return nil
+
+	case models.ValidationExpression:
+		result, err := c.program.run(record)
+		if err != nil {
+			return fmt.Errorf("表达式计算失败: %w", err)
+		}
+		if ok, _ := result.(bool); !ok {
+			return fmt.Errorf("不满足条件: %s", rule.Expression)
+		}
+		return nil
+	}
+
+	// 其余规则只校验存在且非空的字段，是否必填由 required 规则决定
+	value, ok := getPath(record, rule.Field)
+	if !ok || value == nil {
+		return nil
+	}
+
+	switch rule.Type {
+	case models.ValidationType:
+		if !matchesType(value, rule.DataType) {
+			return fmt.Errorf("字段 %s 类型应为 %s，实际为 %T", rule.Field, rule.DataType, value)
+		}
+
+	case models.ValidationRange:
+		n, unit, ok := measure(value)
+		if !ok {
+			return fmt.Errorf("字段 %s 的值 %v 不是数值", rule.Field, value)
+		}
+		if rule.Min != nil && n < *rule.Min {
+			return fmt.Errorf("字段 %s 的%s %v 小于 %v", rule.Field, unit, n, *rule.Min)
+		}
+		if rule.Max != nil && n > *rule.Max {
+			return fmt.Errorf("字段 %s 的%s %v 大于 %v", rule.Field, unit, n, *rule.Max)
+		}
+
+	case models.ValidationRegex:
+		if !c.pattern.MatchString(stringValue(value)) {
+			return fmt.Errorf("字段 %s 的值 %v 不匹配 %s", rule.Field, value, rule.Pattern)
+		}
+
+	case models.ValidationEnum:
+		if _, ok := c.enum[stringValue(value)]; !ok {
+			return fmt.Errorf("字段 %s 的值 %v 不在允许范围内", rule.Field, value)
+		}
+	}
+	return nil
+}
+
+// isEmptyValue 判断值是否为空（nil、空字符串、空数组、空对象）
+func isEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(v) == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// matchesType 判断值是否为指定类型
+func matchesType(value interface{}, dataType string) bool {
+	switch dataType {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "bool":
+		_, ok := value.(bool)
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "number", "integer":
+		kind := reflect.TypeOf(value).Kind()
+		switch {
+		case kind >= reflect.Int && kind <= reflect.Uint64:
+			return true
+		case kind == reflect.Float32 || kind == reflect.Float64:
+			if dataType == "number" {
+				return true
+			}
+			f := reflect.ValueOf(value).Float()
+			return f == float64(int64(f))
+		}
+	}
+	return false
+}
+
+// measure 返回用于范围比较的数值：数字取值本身，数值字符串解析后比较，其余字符串和数组比较长度
+func measure(value interface{}) (float64, string, bool) {
+	switch v := value.(type) {
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return f, "值", true
+		}
+		return float64(utf8.RuneCountInString(v)), "长度", true
+	case []interface{}:
+		return float64(len(v)), "长度", true
+	case bool, map[string]interface{}:
+		return 0, "", false
+	}
+
+	rv := reflect.ValueOf(value)
+	switch {
+	case rv.Kind() >= reflect.Int && rv.Kind() <= reflect.Int64:
+		return float64(rv.Int()), "值", true
+	case rv.Kind() >= reflect.Uint && rv.Kind() <= reflect.Uint64:
+		return float64(rv.Uint()), "值", true
+	case rv.Kind() == reflect.Float32 || rv.Kind() == reflect.Float64:
+		return rv.Float(), "值", true
+	}
+	return 0, "", false
+}
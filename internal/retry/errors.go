@@ -0,0 +1,226 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// Class 错误分类，决定任务执行失败后是否重试
+type Class string
+
+const (
+	ClassTransient   Class = "transient"    // 网络错误、超时、5xx 等临时错误，可重试
+	ClassRateLimited Class = "rate_limited" // 被限流（429），等待 Retry-After 后重试
+	ClassAuth        Class = "auth"         // 认证或权限错误（401、403），重试无效
+	ClassConfig      Class = "config"       // 配置错误（4xx、SQL 语法错误等），重试无效
+	ClassUnknown     Class = "unknown"      // 未分类的错误，与之前的行为一致按可重试处理
+)
+
+// Error 带分类的错误，采集器和存储返回的错误用它标记是否可重试
+type Error struct {
+	Class      Class
+	RetryAfter time.Duration // 限流时服务端要求的等待时间，未指定时为 0
+	Err        error
+}
+
+// Error 返回原始错误信息
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap 返回原始错误
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap 为错误标记分类，err 为 nil 时返回 nil
+func Wrap(class Class, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Class: class, Err: err}
+}
+
+// Transient 标记为临时错误
+func Transient(err error) error {
+	return Wrap(ClassTransient, err)
+}
+
+// Auth 标记为认证错误
+func Auth(err error) error {
+	return Wrap(ClassAuth, err)
+}
+
+// Config 标记为配置错误
+func Config(err error) error {
+	return Wrap(ClassConfig, err)
+}
+
+// RateLimited 标记为限流错误，after 为服务端要求的等待时间
+func RateLimited(err error, after time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Class: ClassRateLimited, RetryAfter: after, Err: err}
+}
+
+// ClassOf 返回错误的分类：优先使用错误链中最外层的 *Error，
+// 其次将超时和网络错误视为临时错误，其余为 ClassUnknown
+func ClassOf(err error) Class {
+	if err == nil {
+		return ""
+	}
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified.Class
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ClassTransient
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ClassTransient
+	}
+	return ClassUnknown
+}
+
+// RetryAfterOf 返回限流错误要求的等待时间，没有时为 0
+func RetryAfterOf(err error) time.Duration {
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified.RetryAfter
+	}
+	return 0
+}
+
+// Retryable 判断该分类的错误是否值得重试
+func Retryable(class Class) bool {
+	switch class {
+	case ClassAuth, ClassConfig:
+		return false
+	default:
+		return true
+	}
+}
+
+// Combine 按多个原因为合并后的错误 err 分类：任一原因可重试时取第一个可重试原因的分类，
+// 全部不可重试时取第一个原因的分类；限流等待时间取各原因中最长的
+func Combine(err error, causes []error) error {
+	if err == nil || len(causes) == 0 {
+		return err
+	}
+	combined := &Error{Class: ClassOf(causes[0]), Err: err}
+	found := Retryable(combined.Class)
+	for _, cause := range causes {
+		class := ClassOf(cause)
+		if !found && Retryable(class) {
+			combined.Class = class
+			found = true
+		}
+		if after := RetryAfterOf(cause); after > combined.RetryAfter {
+			combined.RetryAfter = after
+		}
+	}
+	return combined
+}
+
+// HTTPStatus 按 HTTP 状态码为错误分类：401/403 为认证错误，429 为限流（解析 Retry-After），
+// 408 和 5xx 为临时错误，其余 4xx 为配置错误
+func HTTPStatus(code int, retryAfter string, err error) error {
+	switch {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return Auth(err)
+	case code == http.StatusTooManyRequests:
+		return RateLimited(err, ParseRetryAfter(retryAfter, time.Now()))
+	case code == http.StatusRequestTimeout || code >= 500:
+		return Transient(err)
+	case code >= 400:
+		return Config(err)
+	default:
+		return Wrap(ClassUnknown, err)
+	}
+}
+
+// ParseRetryAfter 解析 Retry-After 响应头，支持秒数和 HTTP 日期两种格式，无效或已过期时返回 0
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// SQL 按数据库驱动的错误码为错误分类：
+// PostgreSQL 28xxx、42501 和 MySQL 1044/1045/1142 为认证错误，PostgreSQL 42xxx、22xxx 和 MySQL 1054/1064/1146 为配置错误，
+// 连接异常、资源不足、死锁和序列化失败为临时错误，驱动以外的连接错误按网络错误处理
+func SQL(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		code := string(pqErr.Code)
+		switch {
+		case code == "42501" || strings.HasPrefix(code, "28"):
+			return Auth(err)
+		case strings.HasPrefix(code, "42") || strings.HasPrefix(code, "22"):
+			return Config(err)
+		case strings.HasPrefix(code, "08") || strings.HasPrefix(code, "40") ||
+			strings.HasPrefix(code, "53") || strings.HasPrefix(code, "57P"):
+			return Transient(err)
+		}
+		return Wrap(ClassUnknown, err)
+	}
+
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		switch myErr.Number {
+		case 1044, 1045, 1142:
+			return Auth(err)
+		case 1049, 1054, 1064, 1146:
+			return Config(err)
+		case 1040, 1205, 1213:
+			return Transient(err)
+		}
+		return Wrap(ClassUnknown, err)
+	}
+
+	if ClassOf(err) == ClassTransient {
+		return Transient(err)
+	}
+	return err
+}
+
+// Describe 返回错误分类的说明，用于日志和执行记录
+func Describe(class Class) string {
+	switch class {
+	case ClassTransient:
+		return "临时错误"
+	case ClassRateLimited:
+		return "限流"
+	case ClassAuth:
+		return "认证错误"
+	case ClassConfig:
+		return "配置错误"
+	default:
+		return "未分类错误"
+	}
+}
@@ -0,0 +1,145 @@
+package retry
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/datafusion/worker/internal/models"
+)
+
+// DefaultMaxRetryAfter 服务端要求的 Retry-After 的默认上限，超过时不再重试，
+// 避免任务占用执行槽位和租约等待过长时间
+const DefaultMaxRetryAfter = 10 * time.Minute
+
+// Policy 重试策略
+type Policy struct {
+	MaxRetries    int           // 最大重试次数
+	InitialDelay  time.Duration // 初始延迟
+	MaxDelay      time.Duration // 最大延迟
+	BackoffFactor float64       // 退避因子
+	Jitter        float64       // 随机抖动比例（0~1），避免多个任务同时重试
+	MaxElapsed    time.Duration // 从首次执行起的最长重试时间，0 表示不限制
+}
+
+// DefaultPolicy 默认重试策略
+func DefaultPolicy() *Policy {
+	return &Policy{
+		MaxRetries:    3,
+		InitialDelay:  5 * time.Second,
+		MaxDelay:      60 * time.Second,
+		BackoffFactor: 2.0,
+	}
+}
+
+// NewPolicy 构建任务的重试策略：任务的 retry_policy 优先，其次为 max_retries，未配置的字段使用默认值
+func NewPolicy(maxRetries int, config *models.RetryPolicy) *Policy {
+	policy := DefaultPolicy()
+
+	// 如果任务配置了最大重试次数，使用任务配置
+	if maxRetries > 0 {
+		policy.MaxRetries = maxRetries
+	}
+
+	if config == nil {
+		return policy
+	}
+	if config.MaxAttempts > 0 {
+		policy.MaxRetries = config.MaxAttempts - 1
+	}
+	if config.InitialDelaySeconds > 0 {
+		policy.InitialDelay = time.Duration(config.InitialDelaySeconds) * time.Second
+	}
+	if config.MaxDelaySeconds > 0 {
+		policy.MaxDelay = time.Duration(config.MaxDelaySeconds) * time.Second
+	}
+	if policy.MaxDelay < policy.InitialDelay {
+		policy.MaxDelay = policy.InitialDelay
+	}
+	if config.BackoffFactor >= 1 {
+		policy.BackoffFactor = config.BackoffFactor
+	}
+	if config.Jitter > 0 && config.Jitter <= 1 {
+		policy.Jitter = config.Jitter
+	}
+	if config.MaxElapsedSeconds > 0 {
+		policy.MaxElapsed = time.Duration(config.MaxElapsedSeconds) * time.Second
+	}
+	return policy
+}
+
+// Delay 计算第 attempt 次尝试失败后的退避延迟（指数退避），配置了抖动时在 [delay*(1-jitter), delay] 内随机
+func (p *Policy) Delay(attempt int) time.Duration {
+	delay := float64(p.InitialDelay)
+	if attempt > 0 {
+		// 指数退避: delay = initialDelay * (backoffFactor ^ attempt)
+		delay *= pow(p.BackoffFactor, float64(attempt))
+	}
+
+	// 限制最大延迟
+	if delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+
+	if p.Jitter > 0 {
+		delay -= delay * p.Jitter * rand.Float64()
+	}
+
+	return time.Duration(delay)
+}
+
+// pow 计算幂次方
+func pow(base, exp float64) float64 {
+	result := 1.0
+	for i := 0; i < int(exp); i++ {
+		result *= base
+	}
+	return result
+}
+
+// ShouldRetry 判断是否应该重试：认证错误和配置错误不重试，其余错误在重试次数内重试
+func (p *Policy) ShouldRetry(attempt int, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if !Retryable(ClassOf(err)) {
+		return false
+	}
+
+	if attempt >= p.MaxRetries {
+		return false
+	}
+
+	return true
+}
+
+// MaxRetryAfter 返回允许等待的 Retry-After 上限：不小于最大延迟，且不超过最长重试时间
+func (p *Policy) MaxRetryAfter() time.Duration {
+	limit := DefaultMaxRetryAfter
+	if p.MaxDelay > limit {
+		limit = p.MaxDelay
+	}
+	if p.MaxElapsed > 0 && p.MaxElapsed < limit {
+		limit = p.MaxElapsed
+	}
+	return limit
+}
+
+// RetryDelay 计算第 attempt 次尝试失败后的等待时间，限流错误至少等待服务端要求的 Retry-After；
+// Retry-After 超过 MaxRetryAfter 时提前重试只会再次被限流，返回 false 表示不再重试
+func (p *Policy) RetryDelay(attempt int, err error) (time.Duration, bool) {
+	delay := p.Delay(attempt)
+	after := RetryAfterOf(err)
+	if after > p.MaxRetryAfter() {
+		return 0, false
+	}
+	if after > delay {
+		delay = after
+	}
+	return delay, true
+}
+
+// ExceedsElapsed 判断等待 delay 后再次执行是否会超过最长重试时间
+func (p *Policy) ExceedsElapsed(start time.Time, delay time.Duration) bool {
+	return p.MaxElapsed > 0 && time.Since(start)+delay > p.MaxElapsed
+}
@@ -0,0 +1,60 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+)
+
+// dateLayout 日历中日期的格式
+const dateLayout = "2006-01-02"
+
+// Calendar 工作日日历：按每周的工作日判断，节假日不执行，调休的工作日优先执行
+type Calendar struct {
+	weekdays map[time.Weekday]bool
+	holidays map[string]bool
+	workdays map[string]bool
+}
+
+// NewCalendar 创建日历，weekdays 为 0（周日）到 6（周六），为空时为周一到周五；
+// holidays、workdays 为 2006-01-02 格式的日期，同一天同时出现时以 workdays 为准
+func NewCalendar(weekdays []int64, holidays, workdays []string) (*Calendar, error) {
+	c := &Calendar{
+		weekdays: make(map[time.Weekday]bool),
+		holidays: make(map[string]bool, len(holidays)),
+		workdays: make(map[string]bool, len(workdays)),
+	}
+	if len(weekdays) == 0 {
+		weekdays = []int64{1, 2, 3, 4, 5}
+	}
+	for _, d := range weekdays {
+		if d < 0 || d > 6 {
+			return nil, fmt.Errorf("无效的星期 %d，应为 0（周日）到 6（周六）", d)
+		}
+		c.weekdays[time.Weekday(d)] = true
+	}
+	for _, d := range holidays {
+		if _, err := time.Parse(dateLayout, d); err != nil {
+			return nil, fmt.Errorf("无效的节假日日期 %s: %w", d, err)
+		}
+		c.holidays[d] = true
+	}
+	for _, d := range workdays {
+		if _, err := time.Parse(dateLayout, d); err != nil {
+			return nil, fmt.Errorf("无效的调休日期 %s: %w", d, err)
+		}
+		c.workdays[d] = true
+	}
+	return c, nil
+}
+
+// IsBusinessDay 判断 t 所在时区的日期是否为工作日
+func (c *Calendar) IsBusinessDay(t time.Time) bool {
+	date := t.Format(dateLayout)
+	if c.workdays[date] {
+		return true
+	}
+	if c.holidays[date] {
+		return false
+	}
+	return c.weekdays[t.Weekday()]
+}
@@ -0,0 +1,61 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	// parser6 含秒的 6 字段表达式
+	parser6 = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+	// parser5 标准 5 字段表达式
+	parser5 = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+)
+
+// ParseCron 解析 Cron 表达式，支持 6 字段（含秒）和 5 字段，Quartz 风格的 '?' 视为 '*'
+func ParseCron(expr string) (cron.Schedule, error) {
+	expr = strings.ReplaceAll(strings.TrimSpace(expr), "?", "*")
+
+	schedule, err := parser6.Parse(expr)
+	if err != nil {
+		schedule, err = parser5.Parse(expr)
+		if err != nil {
+			return nil, fmt.Errorf("解析 Cron 表达式失败: %w", err)
+		}
+	}
+	return schedule, nil
+}
+
+// NextRun 返回 Cron 表达式在 from 之后的下次执行时间
+func NextRun(expr string, from time.Time) (time.Time, error) {
+	schedule, err := ParseCron(expr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return schedule.Next(from), nil
+}
+
+// maxPrevLookback PrevRun 向前查找的最长时间
+const maxPrevLookback = 5 * 366 * 24 * time.Hour
+
+// PrevRun 返回 Cron 表达式在 before 之前（不含 before）的上一次执行时间
+// Cron 没有反向计算，从 before 往前逐步扩大查找范围，在范围内顺序取下次执行时间
+func PrevRun(expr string, before time.Time) (time.Time, error) {
+	schedule, err := ParseCron(expr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for lookback := time.Minute; lookback <= maxPrevLookback; lookback *= 2 {
+		var prev time.Time
+		for t := schedule.Next(before.Add(-lookback)); !t.IsZero() && t.Before(before); t = schedule.Next(t) {
+			prev = t
+		}
+		if !prev.IsZero() {
+			return prev, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Cron 表达式 %s 在 %s 之前没有执行时间", expr, before.Format(time.RFC3339))
+}
@@ -0,0 +1,203 @@
+package schedule
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Executor 并发执行器的槽位和租约状态：登记正在执行的任务，每个任务在独立的 goroutine 中执行，
+// 执行期间由调用方定期续期租约。执行器记录每个任务租约的到期时间，续期失败（如数据库不可用）
+// 直到租约过期时由 ExpireLeases 在本地取消任务，避免租约被其他 Worker 回收后同一任务重复执行
+type Executor[K comparable] struct {
+	slots int
+
+	mu       sync.Mutex
+	running  map[K]*runningTask
+	draining bool
+	wg       sync.WaitGroup
+	wake     chan struct{} // 任务完成后唤醒主循环领取新任务
+}
+
+// runningTask 正在执行的任务
+type runningTask struct {
+	cancel      context.CancelFunc
+	executionID int64
+	leaseUntil  time.Time // 租约到期时间（本地时钟，不晚于数据库中的到期时间）
+	lost        bool      // 租约已丢失（过期被回收或被其他 Worker 领取）
+	cancelled   bool      // 已通过 API 请求取消
+}
+
+// NewExecutor 创建有 slots 个执行槽位的执行器
+func NewExecutor[K comparable](slots int) *Executor[K] {
+	return &Executor[K]{
+		slots:   slots,
+		running: make(map[K]*runningTask),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Slots 返回执行槽位数
+func (e *Executor[K]) Slots() int {
+	return e.slots
+}
+
+// Free 返回空闲槽位数，停止领取后始终为 0
+func (e *Executor[K]) Free() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.draining {
+		return 0
+	}
+	return e.slots - len(e.running)
+}
+
+// Add 登记开始执行的任务，leaseUntil 为领取时写入的租约的到期时间，返回当前运行的任务数
+func (e *Executor[K]) Add(key K, cancel context.CancelFunc, leaseUntil time.Time) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.running[key] = &runningTask{cancel: cancel, leaseUntil: leaseUntil}
+	e.wg.Add(1)
+	return len(e.running)
+}
+
+// Remove 移除执行结束的任务，返回租约是否已丢失和剩余运行的任务数
+func (e *Executor[K]) Remove(key K) (lost bool, count int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if task, ok := e.running[key]; ok {
+		lost = task.lost
+		delete(e.running, key)
+	}
+	return lost, len(e.running)
+}
+
+// Done 任务收尾完成，唤醒主循环领取新任务
+func (e *Executor[K]) Done() {
+	e.wg.Done()
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Wake 返回任务完成时收到通知的 channel
+func (e *Executor[K]) Wake() <-chan struct{} {
+	return e.wake
+}
+
+// Keys 返回正在执行的任务
+func (e *Executor[K]) Keys() []K {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	keys := make([]K, 0, len(e.running))
+	for key := range e.running {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// SetExecution 记录任务当前的执行 ID
+func (e *Executor[K]) SetExecution(key K, executionID int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if task, ok := e.running[key]; ok {
+		task.executionID = executionID
+	}
+}
+
+// CancelExecution 取消指定执行所属的任务，执行不在本执行器上时返回 false
+func (e *Executor[K]) CancelExecution(executionID int64) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, task := range e.running {
+		if task.executionID == executionID {
+			if !task.cancelled {
+				task.cancelled = true
+				task.cancel()
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// CancelRequested 任务是否已通过 API 请求取消
+func (e *Executor[K]) CancelRequested(key K) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	task, ok := e.running[key]
+	return ok && task.cancelled
+}
+
+// MarkLost 标记租约丢失并取消任务
+func (e *Executor[K]) MarkLost(key K) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if task, ok := e.running[key]; ok && !task.lost {
+		task.lost = true
+		task.cancel()
+	}
+}
+
+// Renew 记录续期成功后租约新的到期时间，until 应按发出续期请求前的时间计算
+func (e *Executor[K]) Renew(key K, until time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if task, ok := e.running[key]; ok && until.After(task.leaseUntil) {
+		task.leaseUntil = until
+	}
+}
+
+// ExpireLeases 将租约在 now 之前到期的任务标记为租约丢失并取消，返回这些任务
+func (e *Executor[K]) ExpireLeases(now time.Time) []K {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var expired []K
+	for key, task := range e.running {
+		if !task.lost && !task.leaseUntil.After(now) {
+			task.lost = true
+			task.cancel()
+			expired = append(expired, key)
+		}
+	}
+	return expired
+}
+
+// Drain 停止领取新任务
+func (e *Executor[K]) Drain() {
+	e.mu.Lock()
+	e.draining = true
+	e.mu.Unlock()
+}
+
+// Stopped 是否已停止领取新任务
+func (e *Executor[K]) Stopped() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.draining
+}
+
+// CancelAll 取消所有正在执行的任务
+func (e *Executor[K]) CancelAll() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, task := range e.running {
+		task.cancel()
+	}
+}
+
+// Wait 等待所有任务执行结束，ctx 结束时返回 false
+func (e *Executor[K]) Wait(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
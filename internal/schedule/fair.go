@@ -0,0 +1,74 @@
+package schedule
+
+import "time"
+
+// Candidate 等待领取的任务
+type Candidate struct {
+	ID            int64
+	Queue         string
+	Tenant        string
+	QueuePriority int       // 队列优先级
+	Priority      int       // 队列内的任务优先级
+	Due           time.Time // 到期时间，零值视为最早
+}
+
+// Pick 从候选任务中选出最多 limit 个，按以下顺序比较：
+// 队列优先级、任务优先级从高到低；同优先级时先选正在执行（含本轮已选出）任务最少的租户；
+// 最后按到期时间、ID 先后。queueFree 中的队列最多再选出对应数量，不在其中的队列不限制；
+// tenantRunning 为各租户正在执行的任务数。两个 map 都不会被修改
+func Pick(candidates []Candidate, limit int, queueFree map[string]int, tenantRunning map[string]int) []Candidate {
+	free := make(map[string]int, len(queueFree))
+	for queue, n := range queueFree {
+		free[queue] = n
+	}
+	load := make(map[string]int, len(tenantRunning))
+	for tenant, n := range tenantRunning {
+		load[tenant] = n
+	}
+
+	picked := make([]Candidate, 0, limit)
+	used := make([]bool, len(candidates))
+	for len(picked) < limit {
+		best := -1
+		for i, c := range candidates {
+			if used[i] {
+				continue
+			}
+			if n, capped := free[c.Queue]; capped && n <= 0 {
+				continue
+			}
+			if best < 0 || before(c, candidates[best], load) {
+				best = i
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		c := candidates[best]
+		used[best] = true
+		picked = append(picked, c)
+		load[c.Tenant]++
+		if _, capped := free[c.Queue]; capped {
+			free[c.Queue]--
+		}
+	}
+	return picked
+}
+
+// before 判断 a 是否应该先于 b 领取
+func before(a, b Candidate, load map[string]int) bool {
+	if a.QueuePriority != b.QueuePriority {
+		return a.QueuePriority > b.QueuePriority
+	}
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if la, lb := load[a.Tenant], load[b.Tenant]; la != lb {
+		return la < lb
+	}
+	if !a.Due.Equal(b.Due) {
+		return a.Due.Before(b.Due)
+	}
+	return a.ID < b.ID
+}
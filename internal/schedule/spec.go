@@ -0,0 +1,89 @@
+package schedule
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// 错过执行的补执行策略
+const (
+	CatchUpSkip = "skip" // 错过的执行全部跳过，等下一次计划时间
+	CatchUpOnce = "once" // 错过多次时只补执行一次
+	CatchUpAll  = "all"  // 按计划时间逐个补执行错过的执行
+)
+
+// maxCalendarDays 按日历查找下次执行时间时最多向后查找的天数
+const maxCalendarDays = 366
+
+// Spec 任务的调度配置
+type Spec struct {
+	Cron     string
+	Location *time.Location // Cron 表达式的时区，nil 时为本地时区
+	Calendar *Calendar      // 不为 nil 时只在日历的工作日执行
+	CatchUp  string         // 为空时为 CatchUpOnce
+	Jitter   time.Duration  // 下次执行时间随机推迟的上限
+}
+
+// ValidCatchUp 判断补执行策略是否有效，空值视为默认策略
+func ValidCatchUp(catchUp string) bool {
+	switch catchUp {
+	case "", CatchUpSkip, CatchUpOnce, CatchUpAll:
+		return true
+	}
+	return false
+}
+
+// Next 返回 from 之后的下次计划执行时间（不含抖动），跳过日历中的非工作日
+func (s Spec) Next(from time.Time) (time.Time, error) {
+	sched, err := ParseCron(s.Cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc := s.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	t := from.In(loc)
+	for day := 0; day <= maxCalendarDays; {
+		next := sched.Next(t)
+		if next.IsZero() {
+			return time.Time{}, fmt.Errorf("Cron 表达式 %s 没有下次执行时间", s.Cron)
+		}
+		if s.Calendar == nil || s.Calendar.IsBusinessDay(next) {
+			return next, nil
+		}
+		// 非工作日从次日零点继续查找
+		y, m, d := next.Date()
+		t = time.Date(y, m, d+1, 0, 0, 0, 0, next.Location()).Add(-time.Nanosecond)
+		day++
+	}
+	return time.Time{}, fmt.Errorf("日历中 %d 天内没有可执行的工作日", maxCalendarDays)
+}
+
+// Missed 判断计划在 scheduled 的执行是否已错过：scheduled 之后的下一次计划时间也已到期
+func (s Spec) Missed(scheduled, now time.Time) (bool, error) {
+	next, err := s.Next(scheduled)
+	if err != nil {
+		return false, err
+	}
+	return !next.After(now), nil
+}
+
+// After 返回一次执行结束后的下次执行时间：CatchUpAll 从本次计划时间起算，逐个补执行错过的计划时间，
+// 其他策略从 now 起算；下次执行时间在 now 之后时加上 [0, Jitter) 的随机抖动
+func (s Spec) After(scheduled *time.Time, now time.Time) (time.Time, error) {
+	from := now
+	if s.CatchUp == CatchUpAll && scheduled != nil && scheduled.Before(now) {
+		from = *scheduled
+	}
+	next, err := s.Next(from)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if s.Jitter > 0 && next.After(now) {
+		next = next.Add(time.Duration(rand.Int63n(int64(s.Jitter))))
+	}
+	return next, nil
+}
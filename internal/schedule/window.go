@@ -0,0 +1,108 @@
+package schedule
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"text/template"
+	"time"
+)
+
+// DefaultWindow 没有 Cron 表达式的任务执行时的时间窗口长度
+const DefaultWindow = 24 * time.Hour
+
+// windowPattern 时间窗口参数，如 {{.WindowStart}}、{{ .WindowEnd.Format "2006-01-02" }}
+// 只处理以 . 开头的模板动作，工作流上游字段占位符 {{id}} 保持不变
+var windowPattern = regexp.MustCompile(`\{\{-?\s*\.[^{}]*\}\}`)
+
+// Window 一次执行采集的时间范围 [Start, End)
+type Window struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Timestamp 模板中的时间参数，直接输出时为 RFC3339 格式，也可以调用 .Format、.Unix 等 time.Time 的方法
+type Timestamp struct {
+	time.Time
+}
+
+// String 返回 RFC3339 格式
+func (t Timestamp) String() string {
+	return t.Format(time.RFC3339)
+}
+
+// windowParams 模板可用的参数
+type windowParams struct {
+	WindowStart Timestamp
+	WindowEnd   Timestamp
+}
+
+// CountWindows 返回 SplitWindows 切分出的窗口数 ceil((end-start)/interval)，不生成窗口
+func CountWindows(start, end time.Time, interval time.Duration) int64 {
+	if interval <= 0 || !start.Before(end) {
+		return 0
+	}
+	span := end.Sub(start)
+	n := int64(span / interval)
+	if span%interval != 0 {
+		n++
+	}
+	return n
+}
+
+// SplitWindows 将 [start, end) 按 interval 切分为连续的窗口，最后一个窗口截止到 end
+func SplitWindows(start, end time.Time, interval time.Duration) []Window {
+	if interval <= 0 || !start.Before(end) {
+		return nil
+	}
+	var windows []Window
+	for s := start; s.Before(end); s = s.Add(interval) {
+		e := s.Add(interval)
+		if e.After(end) {
+			e = end
+		}
+		windows = append(windows, Window{Start: s, End: e})
+	}
+	return windows
+}
+
+// CronWindow 返回按 Cron 调度的一次执行对应的时间窗口：截止到 end，从 end 之前的上一次计划执行时间开始，
+// 如工作日 9 点执行的任务周一的窗口从上周五 9 点开始；表达式为空时长度为 DefaultWindow
+func CronWindow(expr string, end time.Time) (Window, error) {
+	if expr == "" {
+		return Window{Start: end.Add(-DefaultWindow), End: end}, nil
+	}
+	prev, err := PrevRun(expr, end)
+	if err != nil {
+		return Window{}, err
+	}
+	return Window{Start: prev, End: end}, nil
+}
+
+// RenderWindow 用时间窗口替换字符串中的 {{.WindowStart}}、{{.WindowEnd}} 等模板动作
+func RenderWindow(s string, w Window) (string, error) {
+	var renderErr error
+	params := windowParams{WindowStart: Timestamp{w.Start}, WindowEnd: Timestamp{w.End}}
+	rendered := windowPattern.ReplaceAllStringFunc(s, func(action string) string {
+		if renderErr != nil {
+			return action
+		}
+		tmpl, err := template.New("window").Option("missingkey=error").Parse(action)
+		if err != nil {
+			renderErr = fmt.Errorf("解析时间窗口参数 %s 失败: %w", action, err)
+			return action
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, params); err != nil {
+			renderErr = fmt.Errorf("渲染时间窗口参数 %s 失败: %w", action, err)
+			return action
+		}
+		return buf.String()
+	})
+	return rendered, renderErr
+}
+
+// HasWindowParams 判断字符串中是否包含时间窗口参数
+func HasWindowParams(s string) bool {
+	return windowPattern.MatchString(s)
+}
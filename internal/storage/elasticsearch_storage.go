@@ -0,0 +1,326 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/retry"
+)
+
+// ElasticsearchConfig Elasticsearch / OpenSearch 存储配置
+type ElasticsearchConfig struct {
+	Address  string // 例如 http://elasticsearch:9200
+	Username string
+	Password string
+	APIKey   string // 设置后使用 ApiKey 认证，优先于用户名密码
+	BulkSize int    // 每次 bulk 请求的文档数
+	Timeout  time.Duration
+}
+
+// BulkItemError bulk 请求中单条文档的失败信息
+type BulkItemError struct {
+	Position int    `json:"position"` // 在本次存储数据中的下标
+	Index    string `json:"index"`
+	ID       string `json:"id,omitempty"`
+	Status   int    `json:"status"`
+	Type     string `json:"type"`
+	Reason   string `json:"reason"`
+}
+
+// BulkError bulk 写入全部失败
+type BulkError struct {
+	Total  int
+	Failed []BulkItemError
+}
+
+func (e *BulkError) Error() string {
+	if len(e.Failed) == 0 {
+		return "bulk 写入失败"
+	}
+	first := e.Failed[0]
+	return fmt.Sprintf("bulk 写入 %d/%d 条失败，首个错误: [%d] %s: %s",
+		len(e.Failed), e.Total, first.Status, first.Type, first.Reason)
+}
+
+// ElasticsearchStorage Elasticsearch / OpenSearch 存储，使用 bulk API 写入
+type ElasticsearchStorage struct {
+	client    *http.Client
+	config    *ElasticsearchConfig
+	templates sync.Map // 已创建索引模板的表
+}
+
+// NewElasticsearchStorage 创建 Elasticsearch 存储
+func NewElasticsearchStorage(config *ElasticsearchConfig) (*ElasticsearchStorage, error) {
+	if config.Address == "" {
+		return nil, fmt.Errorf("Elasticsearch 地址不能为空")
+	}
+	config.Address = strings.TrimRight(config.Address, "/")
+	if config.BulkSize <= 0 {
+		config.BulkSize = 500
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	return &ElasticsearchStorage{
+		client: &http.Client{Timeout: config.Timeout},
+		config: config,
+	}, nil
+}
+
+// Type 返回存储类型
+func (e *ElasticsearchStorage) Type() string {
+	return "elasticsearch"
+}
+
+// Store 存储数据
+// 索引名取自 config.Table（开启 daily 滚动时追加日期后缀），声明了 config.Keys 时以主键值作为文档 ID，
+// 重复采集会覆盖同一文档。
+// 写入失败的单条文档交给拒绝记录收集器（写入死信队列），其余文档写入成功即视为成功，
+// 避免整批重试时重复写入已成功的文档（未声明主键时会生成新的文档 ID）；只有全部失败才返回错误
+func (e *ElasticsearchStorage) Store(ctx context.Context, config *models.StorageConfig, data []map[string]interface{}) error {
+	if len(data) == 0 {
+		log.Println("没有数据需要存储")
+		return nil
+	}
+	if config.Table == "" {
+		return fmt.Errorf("未指定索引名")
+	}
+
+	fields, types := parseFieldMapping(config.Mapping)
+	if err := e.ensureTemplate(ctx, config, types); err != nil {
+		return err
+	}
+
+	index := e.indexName(config, ExecutionInfoFromContext(ctx).StartTime)
+	log.Printf("开始存储数据到 Elasticsearch，索引: %s，数据量: %d", index, len(data))
+
+	bulkErr := &BulkError{Total: len(data)}
+	for start := 0; start < len(data); start += e.config.BulkSize {
+		end := start + e.config.BulkSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		failed, err := e.bulk(ctx, index, config.Keys, fields, data[start:end], start)
+		if err != nil {
+			return err
+		}
+		bulkErr.Failed = append(bulkErr.Failed, failed...)
+	}
+
+	for _, item := range bulkErr.Failed {
+		log.Printf("文档写入失败: 下标=%d, ID=%s, 状态=%d, %s: %s", item.Position, item.ID, item.Status, item.Type, item.Reason)
+		RejectRecord(ctx, data[item.Position], fmt.Errorf("[%d] %s: %s", item.Status, item.Type, item.Reason))
+	}
+	log.Printf("数据存储完成，成功: %d 条，失败: %d 条", len(data)-len(bulkErr.Failed), len(bulkErr.Failed))
+
+	if len(bulkErr.Failed) == len(data) {
+		return bulkErr
+	}
+	return nil
+}
+
+// indexName 计算写入的索引名，按天滚动的日期按 UTC 计算，与文件存储的 dt 分区一致
+func (e *ElasticsearchStorage) indexName(config *models.StorageConfig, at time.Time) string {
+	if strings.EqualFold(config.Rollover, "daily") {
+		return fmt.Sprintf("%s-%s", config.Table, at.UTC().Format("2006.01.02"))
+	}
+	return config.Table
+}
+
+// bulk 发送一批文档，返回失败的文档
+func (e *ElasticsearchStorage) bulk(ctx context.Context, index string, keys []string, fields map[string]string, batch []map[string]interface{}, offset int) ([]BulkItemError, error) {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	ids := make([]string, len(batch))
+	for i, record := range batch {
+		action := map[string]interface{}{"_index": index}
+		if len(keys) > 0 {
+			id, err := documentID(keys, record)
+			if err != nil {
+				return nil, err
+			}
+			ids[i] = id
+			action["_id"] = id
+		}
+
+		doc := make(map[string]interface{}, len(record))
+		for k, v := range record {
+			if mapped, ok := fields[k]; ok {
+				k = mapped
+			}
+			doc[k] = v
+		}
+
+		if err := encoder.Encode(map[string]interface{}{"index": action}); err != nil {
+			return nil, fmt.Errorf("序列化 bulk 请求失败: %w", err)
+		}
+		if err := encoder.Encode(doc); err != nil {
+			return nil, fmt.Errorf("序列化文档失败: %w", err)
+		}
+	}
+
+	respBody, err := e.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", &body)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Index  string `json:"_index"`
+			ID     string `json:"_id"`
+			Status int    `json:"status"`
+			Error  *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("解析 bulk 响应失败: %w", err)
+	}
+	if !resp.Errors {
+		return nil, nil
+	}
+
+	var failed []BulkItemError
+	for i, item := range resp.Items {
+		for _, result := range item {
+			if result.Error == nil {
+				continue
+			}
+			id := result.ID
+			if id == "" && i < len(ids) {
+				id = ids[i]
+			}
+			failed = append(failed, BulkItemError{
+				Position: offset + i,
+				Index:    result.Index,
+				ID:       id,
+				Status:   result.Status,
+				Type:     result.Error.Type,
+				Reason:   result.Error.Reason,
+			})
+		}
+	}
+	return failed, nil
+}
+
+// ensureTemplate 确保索引模板存在，映射由 config.Mapping 中声明的字段类型生成（每张表只创建一次）
+func (e *ElasticsearchStorage) ensureTemplate(ctx context.Context, config *models.StorageConfig, types map[string]string) error {
+	if len(types) == 0 && len(config.Keys) == 0 {
+		return nil
+	}
+	if _, done := e.templates.Load(config.Table); done {
+		return nil
+	}
+
+	properties := make(map[string]interface{}, len(types))
+	for field, fieldType := range types {
+		properties[field] = map[string]interface{}{"type": fieldType}
+	}
+	// 主键字段默认使用 keyword，便于精确查询
+	fields, _ := parseFieldMapping(config.Mapping)
+	for _, key := range config.Keys {
+		if mapped, ok := fields[key]; ok {
+			key = mapped
+		}
+		if _, ok := properties[key]; !ok {
+			properties[key] = map[string]interface{}{"type": "keyword"}
+		}
+	}
+
+	template := map[string]interface{}{
+		"index_patterns": []string{config.Table, config.Table + "-*"},
+		"template": map[string]interface{}{
+			"mappings": map[string]interface{}{"properties": properties},
+		},
+	}
+	body, err := json.Marshal(template)
+	if err != nil {
+		return fmt.Errorf("序列化索引模板失败: %w", err)
+	}
+
+	if _, err := e.do(ctx, http.MethodPut, "/_index_template/"+config.Table, "application/json", bytes.NewReader(body)); err != nil {
+		return fmt.Errorf("创建索引模板失败: %w", err)
+	}
+
+	e.templates.Store(config.Table, struct{}{})
+	log.Printf("成功创建索引模板: %s", config.Table)
+	return nil
+}
+
+// do 发送请求，非 2xx 响应返回错误
+func (e *ElasticsearchStorage) do(ctx context.Context, method, path, contentType string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, e.config.Address+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if e.config.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+e.config.APIKey)
+	} else if e.config.Username != "" {
+		req.SetBasicAuth(e.config.Username, e.config.Password)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, retry.Transient(fmt.Errorf("请求 Elasticsearch 失败: %w", err))
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, retry.HTTPStatus(resp.StatusCode, resp.Header.Get("Retry-After"),
+			fmt.Errorf("Elasticsearch 返回错误 (HTTP %d): %s", resp.StatusCode, string(respBody)))
+	}
+	return respBody, nil
+}
+
+// parseFieldMapping 解析字段映射，值的格式为 "目标字段" 或 "目标字段:类型"（如 "content:text"）
+// 返回 源字段->目标字段 以及 目标字段->类型
+func parseFieldMapping(mapping map[string]string) (map[string]string, map[string]string) {
+	fields := make(map[string]string, len(mapping))
+	types := make(map[string]string)
+	for source, target := range mapping {
+		name, fieldType := target, ""
+		if idx := strings.LastIndex(target, ":"); idx >= 0 {
+			name, fieldType = target[:idx], target[idx+1:]
+		}
+		if name == "" {
+			name = source
+		}
+		fields[source] = name
+		if fieldType != "" {
+			types[name] = fieldType
+		}
+	}
+	return fields, types
+}
+
+// documentID 由主键字段值生成文档 ID，多个主键用 "|" 连接
+func documentID(keys []string, record map[string]interface{}) (string, error) {
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value, ok := record[key]
+		if !ok || value == nil {
+			return "", fmt.Errorf("数据缺少主键字段: %s", key)
+		}
+		parts = append(parts, stringifyValue(value))
+	}
+	return strings.Join(parts, "|"), nil
+}
@@ -4,14 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
-	"time"
 
 	"github.com/datafusion/worker/internal/models"
 )
 
+// manifestDir 清单文件所在的子目录
+const manifestDir = "_manifests"
+
 // FileStorage 文件存储
 type FileStorage struct {
 	basePath string
@@ -28,37 +31,120 @@ func (f *FileStorage) Type() string {
 }
 
 // Store 存储数据到文件
+// 支持 json / jsonl / csv / parquet 格式、gzip / zstd 压缩以及 Hive 风格分区目录，
+// 文件先写入临时文件再重命名，保证读取方不会看到写了一半的文件
 func (f *FileStorage) Store(ctx context.Context, config *models.StorageConfig, data []map[string]interface{}) error {
 	if len(data) == 0 {
 		log.Println("没有数据需要存储")
 		return nil
 	}
 
-	log.Printf("开始存储数据到文件，数据量: %d", len(data))
+	format, err := normalizeFormat(config.Format)
+	if err != nil {
+		return err
+	}
+	compression, err := normalizeCompression(config.Compression)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("开始存储数据到文件，数据量: %d，格式: %s", len(data), format)
+
+	info := ExecutionInfoFromContext(ctx)
+	plans, err := planFiles(config, info, format, compression, data)
+	if err != nil {
+		return err
+	}
+
+	// 未分区时保持旧版目录结构 basePath/database，分区时按表名再分一级目录
+	rootDir := filepath.Join(f.basePath, config.Database)
+	if len(config.PartitionBy) > 0 {
+		rootDir = filepath.Join(rootDir, config.Table)
+	}
+
+	// 写入失败时删除本次已写入的文件：它们不在任何清单中，重试会重新写入全部数据
+	var written []string
+	fail := func(err error) error {
+		removeFiles(written)
+		return err
+	}
+
+	manifest := newManifest(info, config.Table, format, compression)
+	for _, plan := range plans {
+		if err := ctx.Err(); err != nil {
+			return fail(err)
+		}
+
+		dirPath := filepath.Join(rootDir, filepath.FromSlash(plan.Dir))
+		filePath := filepath.Join(dirPath, plan.Name)
+		size, err := writeFileAtomic(filePath, func(w io.Writer) error {
+			return encodeRecords(w, format, compression, plan.Records)
+		})
+		if err != nil {
+			return fail(err)
+		}
+		written = append(written, filePath)
+
+		relPath, _ := filepath.Rel(f.basePath, filePath)
+		manifest.add(filepath.ToSlash(relPath), plan.Partition, len(plan.Records), size)
+		log.Printf("写入文件: %s，数据量: %d", filePath, len(plan.Records))
+	}
+
+	manifestPath := filepath.Join(f.basePath, config.Database, manifestDir, manifestName(info, config.Table))
+	if _, err := writeFileAtomic(manifestPath, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(manifest)
+	}); err != nil {
+		return fail(fmt.Errorf("写入清单失败: %w", err))
+	}
+
+	log.Printf("数据存储完成，共 %d 个文件，清单: %s", len(manifest.Files), manifestPath)
+	return nil
+}
 
-	// 创建目录
-	dirPath := filepath.Join(f.basePath, config.Database)
+// writeFileAtomic 先写入同目录下的临时文件，成功后重命名为目标文件，返回文件大小
+func writeFileAtomic(filePath string, write func(w io.Writer) error) (int64, error) {
+	dirPath := filepath.Dir(filePath)
 	if err := os.MkdirAll(dirPath, 0755); err != nil {
-		return fmt.Errorf("创建目录失败: %w", err)
+		return 0, fmt.Errorf("创建目录失败: %w", err)
 	}
 
-	// 生成文件名（使用时间戳）
-	filename := fmt.Sprintf("%s_%s.json", config.Table, time.Now().Format("20060102_150405"))
-	filePath := filepath.Join(dirPath, filename)
+	tmp, err := os.CreateTemp(dirPath, "."+filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // 重命名成功后为空操作
 
-	// 写入文件
-	file, err := os.Create(filePath)
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("写入文件失败: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("同步文件失败: %w", err)
+	}
+	stat, err := tmp.Stat()
 	if err != nil {
-		return fmt.Errorf("创建文件失败: %w", err)
+		tmp.Close()
+		return 0, fmt.Errorf("读取文件信息失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("关闭文件失败: %w", err)
 	}
-	defer file.Close()
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(data); err != nil {
-		return fmt.Errorf("写入文件失败: %w", err)
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return 0, fmt.Errorf("重命名文件失败: %w", err)
 	}
+	return stat.Size(), nil
+}
 
-	log.Printf("数据存储完成，文件: %s", filePath)
-	return nil
+// removeFiles 删除已写入的文件，删除失败只记录日志
+func removeFiles(paths []string) {
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			log.Printf("删除文件 %s 失败: %v", p, err)
+		}
+	}
 }
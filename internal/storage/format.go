@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/xitongsys/parquet-go-source/writerfile"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// 支持的文件格式
+const (
+	FormatJSON    = "json"
+	FormatJSONL   = "jsonl"
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+)
+
+// 支持的压缩方式
+const (
+	CompressionNone = ""
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// normalizeFormat 规范化格式名称，未指定时默认 json（保持与旧版本一致）
+func normalizeFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "", FormatJSON:
+		return FormatJSON, nil
+	case FormatJSONL, "ndjson":
+		return FormatJSONL, nil
+	case FormatCSV:
+		return FormatCSV, nil
+	case FormatParquet:
+		return FormatParquet, nil
+	default:
+		return "", fmt.Errorf("不支持的文件格式: %s", format)
+	}
+}
+
+// normalizeCompression 规范化压缩方式名称
+func normalizeCompression(compression string) (string, error) {
+	switch strings.ToLower(compression) {
+	case "", "none":
+		return CompressionNone, nil
+	case CompressionGzip, "gz":
+		return CompressionGzip, nil
+	case CompressionZstd, "zst":
+		return CompressionZstd, nil
+	default:
+		return "", fmt.Errorf("不支持的压缩方式: %s", compression)
+	}
+}
+
+// fileExtension 返回格式与压缩方式对应的文件扩展名
+// parquet 在文件内部按列压缩，不追加外层压缩扩展名
+func fileExtension(format, compression string) string {
+	ext := "." + format
+	if format == FormatParquet {
+		return ext
+	}
+	switch compression {
+	case CompressionGzip:
+		ext += ".gz"
+	case CompressionZstd:
+		ext += ".zst"
+	}
+	return ext
+}
+
+// encodeRecords 按指定格式和压缩方式将数据写入 w
+func encodeRecords(w io.Writer, format, compression string, data []map[string]interface{}) error {
+	if format == FormatParquet {
+		return encodeParquet(w, compression, data)
+	}
+
+	switch compression {
+	case CompressionGzip:
+		gz := gzip.NewWriter(w)
+		if err := encodeText(gz, format, data); err != nil {
+			gz.Close()
+			return err
+		}
+		return gz.Close()
+	case CompressionZstd:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return fmt.Errorf("创建 zstd 压缩器失败: %w", err)
+		}
+		if err := encodeText(zw, format, data); err != nil {
+			zw.Close()
+			return err
+		}
+		return zw.Close()
+	default:
+		return encodeText(w, format, data)
+	}
+}
+
+// encodeText 写入文本格式（json / jsonl / csv）
+func encodeText(w io.Writer, format string, data []map[string]interface{}) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(data); err != nil {
+			return fmt.Errorf("写入 JSON 失败: %w", err)
+		}
+		return nil
+
+	case FormatJSONL:
+		encoder := json.NewEncoder(w)
+		for _, record := range data {
+			if err := encoder.Encode(record); err != nil {
+				return fmt.Errorf("写入 JSON Lines 失败: %w", err)
+			}
+		}
+		return nil
+
+	case FormatCSV:
+		columns := collectColumns(data)
+		cw := csv.NewWriter(w)
+		if err := cw.Write(columns); err != nil {
+			return fmt.Errorf("写入 CSV 表头失败: %w", err)
+		}
+		row := make([]string, len(columns))
+		for _, record := range data {
+			for i, col := range columns {
+				row[i] = stringifyValue(record[col])
+			}
+			if err := cw.Write(row); err != nil {
+				return fmt.Errorf("写入 CSV 数据失败: %w", err)
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+
+	default:
+		return fmt.Errorf("不支持的文件格式: %s", format)
+	}
+}
+
+// encodeParquet 写入 Parquet 文件，所有列按可空 UTF8 字符串存储
+// 字段名来自采集的数据，不能拼接到 parquet-go 的 "name=..., type=..." 标签中（含逗号或等号的字段名会改写列定义），
+// 标签中只使用按序号生成的列名，写入前再把文件中的列名替换为原始字段名
+func encodeParquet(w io.Writer, compression string, data []map[string]interface{}) error {
+	columns := collectColumns(data)
+	schema := make([]string, len(columns))
+	for i, col := range columns {
+		if strings.Contains(col, common.PAR_GO_PATH_DELIMITER) {
+			return fmt.Errorf("字段名 %q 包含控制字符，不能写入 Parquet", col)
+		}
+		schema[i] = fmt.Sprintf("name=c%d, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL", i)
+	}
+
+	pw, err := writer.NewCSVWriter(schema, writerfile.NewWriterFile(w), 1)
+	if err != nil {
+		return fmt.Errorf("创建 Parquet 写入器失败: %w", err)
+	}
+	// WriteStop 按 ExName 重命名文件中的列和列块路径
+	for i, col := range columns {
+		pw.SchemaHandler.Infos[i+1].ExName = col
+	}
+	pw.SchemaHandler.CreateInExMap()
+
+	switch compression {
+	case CompressionGzip:
+		pw.CompressionType = parquet.CompressionCodec_GZIP
+	case CompressionZstd:
+		pw.CompressionType = parquet.CompressionCodec_ZSTD
+	default:
+		pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	}
+
+	for _, record := range data {
+		row := make([]*string, len(columns))
+		for i, col := range columns {
+			value, ok := record[col]
+			if !ok || value == nil {
+				continue
+			}
+			str := stringifyValue(value)
+			row[i] = &str
+		}
+		if err := pw.WriteString(row); err != nil {
+			return fmt.Errorf("写入 Parquet 数据失败: %w", err)
+		}
+	}
+
+	if err := pw.WriteStop(); err != nil {
+		return fmt.Errorf("写入 Parquet 文件尾失败: %w", err)
+	}
+	return nil
+}
+
+// collectColumns 收集所有记录中出现过的字段，按字母序返回
+func collectColumns(data []map[string]interface{}) []string {
+	seen := make(map[string]struct{})
+	for _, record := range data {
+		for k := range record {
+			seen[k] = struct{}{}
+		}
+	}
+
+	columns := make([]string, 0, len(seen))
+	for k := range seen {
+		columns = append(columns, k)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// stringifyValue 将字段值转换为字符串，嵌套对象和数组序列化为 JSON
+func stringifyValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(b)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
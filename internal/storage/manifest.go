@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// Manifest 一次执行写入的文件清单
+type Manifest struct {
+	TaskID      int64          `json:"task_id"`
+	ExecutionID int64          `json:"execution_id"`
+	ReplayID    int64          `json:"replay_id,omitempty"`
+	Table       string         `json:"table"`
+	Format      string         `json:"format"`
+	Compression string         `json:"compression,omitempty"`
+	Records     int            `json:"records"`
+	CreatedAt   time.Time      `json:"created_at"`
+	Files       []ManifestFile `json:"files"`
+}
+
+// ManifestFile 清单中的单个文件
+type ManifestFile struct {
+	Path      string            `json:"path"`
+	Partition map[string]string `json:"partition,omitempty"`
+	Records   int               `json:"records"`
+	Bytes     int64             `json:"bytes"`
+}
+
+// newManifest 创建执行清单
+func newManifest(info ExecutionInfo, table, format, compression string) *Manifest {
+	return &Manifest{
+		TaskID:      info.TaskID,
+		ExecutionID: info.ExecutionID,
+		ReplayID:    info.ReplayID,
+		Table:       table,
+		Format:      format,
+		Compression: compression,
+		CreatedAt:   time.Now(),
+		Files:       []ManifestFile{},
+	}
+}
+
+// add 记录一个已写入的文件
+func (m *Manifest) add(path string, partition map[string]string, records int, bytes int64) {
+	m.Files = append(m.Files, ManifestFile{
+		Path:      path,
+		Partition: partition,
+		Records:   records,
+		Bytes:     bytes,
+	})
+	m.Records += records
+}
+
+// manifestName 清单文件名，同一执行的多次写入（如重试）会覆盖同一清单，
+// 死信重放使用单独的清单，不覆盖原执行的清单
+func manifestName(info ExecutionInfo, table string) string {
+	if info.ReplayID > 0 {
+		return fmt.Sprintf("%s_execution_%d_replay_%d.json", table, info.ExecutionID, info.ReplayID)
+	}
+	if info.ExecutionID > 0 {
+		return fmt.Sprintf("%s_execution_%d.json", table, info.ExecutionID)
+	}
+	return fmt.Sprintf("%s_%s.json", table, info.StartTime.UTC().Format("20060102_150405.000000000"))
+}
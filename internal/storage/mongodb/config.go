@@ -3,6 +3,8 @@ package mongodb
 import (
 	"fmt"
 	"time"
+
+	"github.com/datafusion/worker/internal/config"
 )
 
 // Config MongoDB 配置
@@ -29,6 +31,30 @@ func DefaultConfig() *Config {
 	}
 }
 
+// NewConfig 将 Worker 配置转换为 MongoDB 存储配置，未设置的项使用默认值
+func NewConfig(cfg config.MongoDBConfig) *Config {
+	mongoConfig := DefaultConfig()
+	if cfg.URI != "" {
+		mongoConfig.URI = cfg.URI
+	}
+	if cfg.Database != "" {
+		mongoConfig.Database = cfg.Database
+	}
+	if cfg.Collection != "" {
+		mongoConfig.Collection = cfg.Collection
+	}
+	if cfg.Timeout > 0 {
+		mongoConfig.Timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+	if cfg.MaxPoolSize > 0 {
+		mongoConfig.MaxPoolSize = cfg.MaxPoolSize
+	}
+	if cfg.MinPoolSize > 0 {
+		mongoConfig.MinPoolSize = cfg.MinPoolSize
+	}
+	return mongoConfig
+}
+
 // Validate 验证配置
 func (c *Config) Validate() error {
 	if c.URI == "" {
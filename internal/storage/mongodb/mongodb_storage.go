@@ -4,8 +4,11 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/datafusion/worker/internal/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -16,6 +19,7 @@ type MongoDBStorage struct {
 	pool       *Pool
 	config     *Config
 	collection string
+	indexed    sync.Map // 已创建主键索引的集合
 }
 
 // NewMongoDBStorage 创建 MongoDB 存储
@@ -25,11 +29,25 @@ func NewMongoDBStorage(config *Config) (*MongoDBStorage, error) {
 		return nil, fmt.Errorf("创建连接池失败: %w", err)
 	}
 
+	return newMongoDBStorage(pool, config), nil
+}
+
+// NewMongoDBStorageWithClient 使用已创建的客户端创建 MongoDB 存储
+func NewMongoDBStorageWithClient(client *mongo.Client, config *Config) (*MongoDBStorage, error) {
+	pool, err := NewPoolWithClient(client, config)
+	if err != nil {
+		return nil, fmt.Errorf("创建连接池失败: %w", err)
+	}
+
+	return newMongoDBStorage(pool, config), nil
+}
+
+func newMongoDBStorage(pool *Pool, config *Config) *MongoDBStorage {
 	return &MongoDBStorage{
 		pool:       pool,
 		config:     config,
 		collection: config.Collection,
-	}, nil
+	}
 }
 
 // Type 返回存储类型
@@ -38,37 +56,66 @@ func (m *MongoDBStorage) Type() string {
 }
 
 // Store 存储数据
-func (m *MongoDBStorage) Store(ctx context.Context, data []map[string]interface{}) error {
+// 集合名取自 config.Table（为空时使用默认集合），字段按 config.Mapping 重命名；
+// 声明了 config.Keys 时按主键 upsert，否则直接批量插入
+func (m *MongoDBStorage) Store(ctx context.Context, config *models.StorageConfig, data []map[string]interface{}) error {
 	if len(data) == 0 {
 		return nil
 	}
 
-	log.Printf("开始存储数据到 MongoDB，共 %d 条", len(data))
+	collName := config.Table
+	if collName == "" {
+		collName = m.collection
+	}
+
+	log.Printf("开始存储数据到 MongoDB，集合: %s，共 %d 条", collName, len(data))
 
-	coll, err := m.pool.GetCollection()
+	coll, err := m.pool.GetCollectionByName(config.Database, collName)
 	if err != nil {
 		return fmt.Errorf("获取集合失败: %w", err)
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, m.config.Timeout)
+	defer cancel()
+
+	keys := applyMapping(config.Keys, config.Mapping)
+	if len(keys) > 0 {
+		if err := m.ensureKeyIndex(ctx, config.Database, collName, keys); err != nil {
+			return err
+		}
+	}
+
 	// 添加时间戳
 	now := time.Now()
-	documents := make([]interface{}, 0, len(data))
+	documents := make([]bson.M, 0, len(data))
 	for _, item := range data {
-		doc := make(map[string]interface{})
+		doc := bson.M{}
 		for k, v := range item {
+			if mapped, ok := config.Mapping[k]; ok && mapped != "" {
+				k = mapped
+			}
 			doc[k] = v
 		}
-		doc["_created_at"] = now
 		doc["_updated_at"] = now
 		documents = append(documents, doc)
 	}
 
-	// 批量插入
-	ctx, cancel := context.WithTimeout(ctx, m.config.Timeout)
-	defer cancel()
+	if len(keys) == 0 {
+		return m.insertMany(ctx, coll, documents, now)
+	}
+	return m.upsertMany(ctx, coll, documents, keys, now)
+}
+
+// insertMany 批量插入（未声明主键时使用）
+func (m *MongoDBStorage) insertMany(ctx context.Context, coll *mongo.Collection, documents []bson.M, now time.Time) error {
+	docs := make([]interface{}, 0, len(documents))
+	for _, doc := range documents {
+		doc["_created_at"] = now
+		docs = append(docs, doc)
+	}
 
 	opts := options.InsertMany().SetOrdered(false) // 允许部分失败
-	result, err := coll.InsertMany(ctx, documents, opts)
+	result, err := coll.InsertMany(ctx, docs, opts)
 	if err != nil {
 		// 检查是否是部分成功
 		if mongo.IsDuplicateKeyError(err) {
@@ -82,6 +129,64 @@ func (m *MongoDBStorage) Store(ctx context.Context, data []map[string]interface{
 	return nil
 }
 
+// upsertMany 按主键批量 upsert，_created_at 只在首次插入时写入
+func (m *MongoDBStorage) upsertMany(ctx context.Context, coll *mongo.Collection, documents []bson.M, keys []string, now time.Time) error {
+	writes := make([]mongo.WriteModel, 0, len(documents))
+	for _, doc := range documents {
+		filter := bson.M{}
+		for _, key := range keys {
+			value, ok := doc[key]
+			if !ok {
+				return fmt.Errorf("数据缺少主键字段: %s", key)
+			}
+			filter[key] = value
+		}
+
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(filter).
+			SetUpdate(bson.M{
+				"$set":         doc,
+				"$setOnInsert": bson.M{"_created_at": now},
+			}).
+			SetUpsert(true))
+	}
+
+	result, err := coll.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return fmt.Errorf("upsert 数据失败: %w", err)
+	}
+
+	log.Printf("MongoDB upsert 完成，新增: %d 条，更新: %d 条", result.UpsertedCount, result.ModifiedCount)
+	return nil
+}
+
+// ensureKeyIndex 确保主键字段上存在唯一索引（每个集合只创建一次）
+func (m *MongoDBStorage) ensureKeyIndex(ctx context.Context, database, collName string, keys []string) error {
+	cacheKey := database + "." + collName + ":" + strings.Join(keys, ",")
+	if _, done := m.indexed.Load(cacheKey); done {
+		return nil
+	}
+
+	if err := m.CreateIndex(ctx, database, collName, keys, true); err != nil {
+		return err
+	}
+
+	m.indexed.Store(cacheKey, struct{}{})
+	return nil
+}
+
+// applyMapping 将字段名按映射转换为存储字段名
+func applyMapping(fields []string, mapping map[string]string) []string {
+	result := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if mapped, ok := mapping[field]; ok && mapped != "" {
+			field = mapped
+		}
+		result = append(result, field)
+	}
+	return result
+}
+
 // Query 查询数据
 func (m *MongoDBStorage) Query(ctx context.Context, filter map[string]interface{}, limit int) ([]map[string]interface{}, error) {
 	coll, err := m.pool.GetCollection()
@@ -178,17 +283,17 @@ func (m *MongoDBStorage) Count(ctx context.Context, filter map[string]interface{
 	return count, nil
 }
 
-// CreateIndex 创建索引
-func (m *MongoDBStorage) CreateIndex(ctx context.Context, keys map[string]int, unique bool) error {
-	coll, err := m.pool.GetCollection()
+// CreateIndex 在指定集合上创建索引，keys 按顺序组成复合索引（升序）
+func (m *MongoDBStorage) CreateIndex(ctx context.Context, database, collName string, keys []string, unique bool) error {
+	coll, err := m.pool.GetCollectionByName(database, collName)
 	if err != nil {
 		return fmt.Errorf("获取集合失败: %w", err)
 	}
 
 	// 构建索引模型
 	indexKeys := bson.D{}
-	for key, order := range keys {
-		indexKeys = append(indexKeys, bson.E{Key: key, Value: order})
+	for _, key := range keys {
+		indexKeys = append(indexKeys, bson.E{Key: key, Value: 1})
 	}
 
 	indexModel := mongo.IndexModel{
@@ -205,7 +310,7 @@ func (m *MongoDBStorage) CreateIndex(ctx context.Context, keys map[string]int, u
 		return fmt.Errorf("创建索引失败: %w", err)
 	}
 
-	log.Printf("成功创建索引: %s", indexName)
+	log.Printf("成功创建索引: %s.%s", collName, indexName)
 	return nil
 }
 
@@ -53,6 +53,18 @@ func NewPool(config *Config) (*Pool, error) {
 	}, nil
 }
 
+// NewPoolWithClient 使用已创建的客户端创建连接池，不检查连接
+func NewPoolWithClient(client *mongo.Client, config *Config) (*Pool, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("配置验证失败: %w", err)
+	}
+
+	return &Pool{
+		client: client,
+		config: config,
+	}, nil
+}
+
 // GetClient 获取客户端
 func (p *Pool) GetClient() (*mongo.Client, error) {
 	p.mu.RLock()
@@ -85,6 +97,23 @@ func (p *Pool) GetCollection() (*mongo.Collection, error) {
 	return db.Collection(p.config.Collection), nil
 }
 
+// GetCollectionByName 获取指定数据库下的集合，database 为空时使用默认数据库
+func (p *Pool) GetCollectionByName(database, collection string) (*mongo.Collection, error) {
+	client, err := p.GetClient()
+	if err != nil {
+		return nil, err
+	}
+
+	if database == "" {
+		database = p.config.Database
+	}
+	if collection == "" {
+		collection = p.config.Collection
+	}
+
+	return client.Database(database).Collection(collection), nil
+}
+
 // Close 关闭连接池
 func (p *Pool) Close() error {
 	p.mu.Lock()
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/datafusion/worker/internal/models"
+)
+
+// defaultPartitionValue 记录缺少分区字段时使用的分区值（与 Hive 保持一致）
+const defaultPartitionValue = "__HIVE_DEFAULT_PARTITION__"
+
+// ExecutionInfo 当前存储操作所属的任务执行信息，由 Worker 通过 context 传入
+type ExecutionInfo struct {
+	TaskID      int64
+	ExecutionID int64
+	StartTime   time.Time
+	ReplayID    int64 // 重放的死信记录 ID，重放时清单和推送标识不能与原执行相同
+}
+
+type executionInfoKey struct{}
+
+// WithExecutionInfo 将执行信息写入 context
+func WithExecutionInfo(ctx context.Context, info ExecutionInfo) context.Context {
+	return context.WithValue(ctx, executionInfoKey{}, info)
+}
+
+// ExecutionInfoFromContext 从 context 读取执行信息，不存在时以当前时间作为开始时间
+func ExecutionInfoFromContext(ctx context.Context) ExecutionInfo {
+	if info, ok := ctx.Value(executionInfoKey{}).(ExecutionInfo); ok {
+		if info.StartTime.IsZero() {
+			info.StartTime = time.Now()
+		}
+		return info
+	}
+	return ExecutionInfo{StartTime: time.Now()}
+}
+
+// filePlan 一个待写入的文件：相对目录、文件名及其数据
+type filePlan struct {
+	Dir       string
+	Name      string
+	Partition map[string]string
+	Records   []map[string]interface{}
+}
+
+// partitionValueSanitizer 分区值中不允许出现路径分隔符等特殊字符
+var partitionValueSanitizer = regexp.MustCompile(`[/\\:*?"<>|=\s]+`)
+
+// planFiles 按分区和单文件记录数上限将数据拆分为多个文件
+// 返回的 Dir 使用 "/" 分隔，可直接作为对象存储的 key 前缀
+func planFiles(config *models.StorageConfig, info ExecutionInfo, format, compression string, data []map[string]interface{}) ([]filePlan, error) {
+	type group struct {
+		dir       string
+		partition map[string]string
+		records   []map[string]interface{}
+	}
+
+	groups := make(map[string]*group)
+	order := make([]string, 0)
+	for _, record := range data {
+		dir := ""
+		partition := make(map[string]string, len(config.PartitionBy))
+		for _, key := range config.PartitionBy {
+			value := partitionValue(key, info, record)
+			partition[key] = value
+			dir = path.Join(dir, key+"="+value)
+		}
+
+		g, ok := groups[dir]
+		if !ok {
+			g = &group{dir: dir, partition: partition}
+			groups[dir] = g
+			order = append(order, dir)
+		}
+		g.records = append(g.records, record)
+	}
+
+	suffix, err := uniqueSuffix(info)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := fileExtension(format, compression)
+	stamp := info.StartTime.UTC().Format("20060102_150405")
+	plans := make([]filePlan, 0, len(order))
+	for _, dir := range order {
+		g := groups[dir]
+		chunks := splitRecords(g.records, config.MaxRecordsPerFile)
+		for i, chunk := range chunks {
+			name := fmt.Sprintf("%s_%s_%s%s", config.Table, stamp, suffix, ext)
+			if len(chunks) > 1 {
+				name = fmt.Sprintf("%s_%s_%s_part%04d%s", config.Table, stamp, suffix, i+1, ext)
+			}
+			plans = append(plans, filePlan{
+				Dir:       g.dir,
+				Name:      name,
+				Partition: g.partition,
+				Records:   chunk,
+			})
+		}
+	}
+
+	return plans, nil
+}
+
+// partitionValue 计算分区值：dt / hour / task 为内置分区，其余取记录字段
+// dt / hour 按 UTC 计算，不同时区的 Worker 写入同一时刻的数据时落在同一分区
+func partitionValue(key string, info ExecutionInfo, record map[string]interface{}) string {
+	switch key {
+	case "dt":
+		return info.StartTime.UTC().Format("2006-01-02")
+	case "hour":
+		return info.StartTime.UTC().Format("15")
+	case "task":
+		return strconv.FormatInt(info.TaskID, 10)
+	}
+
+	value, ok := record[key]
+	if !ok || value == nil {
+		return defaultPartitionValue
+	}
+	str := partitionValueSanitizer.ReplaceAllString(stringifyValue(value), "_")
+	if str == "" {
+		return defaultPartitionValue
+	}
+	return str
+}
+
+// splitRecords 按单文件记录数上限切分数据，maxPerFile <= 0 表示不切分
+func splitRecords(data []map[string]interface{}, maxPerFile int) [][]map[string]interface{} {
+	if maxPerFile <= 0 || len(data) <= maxPerFile {
+		return [][]map[string]interface{}{data}
+	}
+
+	chunks := make([][]map[string]interface{}, 0, (len(data)+maxPerFile-1)/maxPerFile)
+	for start := 0; start < len(data); start += maxPerFile {
+		end := start + maxPerFile
+		if end > len(data) {
+			end = len(data)
+		}
+		chunks = append(chunks, data[start:end])
+	}
+	return chunks
+}
+
+// uniqueSuffix 生成文件名后缀，包含执行 ID 和随机串，避免同一秒内的多次写入互相覆盖
+func uniqueSuffix(info ExecutionInfo) (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成文件名失败: %w", err)
+	}
+	return fmt.Sprintf("e%d_%s", info.ExecutionID, hex.EncodeToString(b)), nil
+}
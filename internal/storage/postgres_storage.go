@@ -9,6 +9,7 @@ import (
 
 	_ "github.com/lib/pq"
 	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/retry"
 )
 
 // PostgresStorage PostgreSQL 存储
@@ -49,7 +50,7 @@ func (p *PostgresStorage) Store(ctx context.Context, config *models.StorageConfi
 
 	// 自动创建表（如果不存在）
 	if err := p.ensureTable(ctx, config.Table, data[0]); err != nil {
-		return fmt.Errorf("自动创建表失败: %w", err)
+		return fmt.Errorf("自动创建表失败: %w", retry.SQL(err))
 	}
 
 	// 构建插入语句
@@ -79,7 +80,7 @@ func (p *PostgresStorage) Store(ctx context.Context, config *models.StorageConfi
 	// 批量插入
 	tx, err := p.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("开始事务失败: %w", err)
+		return fmt.Errorf("开始事务失败: %w", retry.SQL(err))
 	}
 	defer func() {
 		if err != nil {
@@ -89,7 +90,7 @@ func (p *PostgresStorage) Store(ctx context.Context, config *models.StorageConfi
 
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
-		return fmt.Errorf("准备语句失败: %w", err)
+		return fmt.Errorf("准备语句失败: %w", retry.SQL(err))
 	}
 	defer stmt.Close()
 
@@ -111,12 +112,23 @@ func (p *PostgresStorage) Store(ctx context.Context, config *models.StorageConfi
 			values[i] = record[originalField]
 		}
 
+		// 每条记录使用保存点，单条失败不会使整个事务进入中止状态
+		if _, err = tx.ExecContext(ctx, "SAVEPOINT store_record"); err != nil {
+			return fmt.Errorf("创建保存点失败: %w", err)
+		}
 		result, execErr := stmt.ExecContext(ctx, values...)
 		if execErr != nil {
 			log.Printf("插入数据失败: %v, 数据: %v", execErr, record)
+			if _, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT store_record"); err != nil {
+				return fmt.Errorf("回滚保存点失败: %w", err)
+			}
+			RejectRecord(ctx, record, execErr)
 			errorCount++
 			continue
 		}
+		if _, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT store_record"); err != nil {
+			return fmt.Errorf("释放保存点失败: %w", err)
+		}
 		
 		// 检查是否实际插入了数据
 		rowsAffected, _ := result.RowsAffected()
@@ -129,7 +141,7 @@ func (p *PostgresStorage) Store(ctx context.Context, config *models.StorageConfi
 	}
 
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("提交事务失败: %w", err)
+		return fmt.Errorf("提交事务失败: %w", retry.SQL(err))
 	}
 
 	log.Printf("数据存储完成，成功: %d 条，重复: %d 条，失败: %d 条", successCount, duplicateCount, errorCount)
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"sync"
+
+	"github.com/datafusion/worker/internal/models"
+)
+
+// RejectCollector 收集存储阶段被拒绝的单条记录，由 Worker 通过 context 传入
+type RejectCollector struct {
+	mu      sync.Mutex
+	records []models.DeadLetterRecord
+}
+
+// NewRejectCollector 创建拒绝记录收集器
+func NewRejectCollector() *RejectCollector {
+	return &RejectCollector{}
+}
+
+// Add 添加一条被拒绝的记录
+func (c *RejectCollector) Add(record map[string]interface{}, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.records = append(c.records, models.DeadLetterRecord{
+		Stage:  models.DeadLetterStageStorage,
+		Error:  err.Error(),
+		Record: record,
+	})
+}
+
+// Records 返回已收集的记录
+func (c *RejectCollector) Records() []models.DeadLetterRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]models.DeadLetterRecord(nil), c.records...)
+}
+
+type rejectCollectorKey struct{}
+
+// WithRejectCollector 将拒绝记录收集器写入 context
+func WithRejectCollector(ctx context.Context, c *RejectCollector) context.Context {
+	return context.WithValue(ctx, rejectCollectorKey{}, c)
+}
+
+// RejectRecord 将存储失败的单条记录交给 context 中的收集器，未设置收集器时忽略，
+// 存储实现用它跳过无法写入的记录而不使整批失败
+func RejectRecord(ctx context.Context, record map[string]interface{}, err error) {
+	if c, ok := ctx.Value(rejectCollectorKey{}).(*RejectCollector); ok {
+		c.Add(record, err)
+	}
+}
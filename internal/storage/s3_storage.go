@@ -0,0 +1,239 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+// 服务端加密方式
+const (
+	SSENone = ""
+	SSES3   = "sse-s3"
+	SSEKMS  = "sse-kms"
+)
+
+// minPartSize S3 要求分片（最后一片除外）不小于 5MiB
+const minPartSize = 5 * 1024 * 1024
+
+// S3Config S3 兼容对象存储配置
+type S3Config struct {
+	Endpoint     string // 例如 s3.amazonaws.com、minio:9000 或 http://127.0.0.1:9000
+	Region       string
+	Bucket       string // 默认桶，任务 StorageConfig.Database 非空时覆盖
+	Prefix       string // 所有对象 key 的公共前缀
+	UseSSL       bool
+	PathStyle    bool // MinIO 等自建服务通常需要路径风格访问
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	SSE          string // sse-s3, sse-kms
+	SSEKMSKeyID  string
+	PartSize     uint64 // 分片大小（字节），超过该大小的文件使用分片上传
+}
+
+// S3Storage S3 兼容对象存储
+type S3Storage struct {
+	client *minio.Client
+	config *S3Config
+	sse    encrypt.ServerSide
+}
+
+// NewS3Storage 创建 S3 存储
+func NewS3Storage(config *S3Config) (*S3Storage, error) {
+	if config.Endpoint == "" {
+		return nil, fmt.Errorf("S3 endpoint 不能为空")
+	}
+
+	// 兼容带协议的 endpoint
+	endpoint := config.Endpoint
+	secure := config.UseSSL
+	if strings.Contains(endpoint, "://") {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("解析 S3 endpoint 失败: %w", err)
+		}
+		endpoint = u.Host
+		secure = u.Scheme == "https"
+	}
+
+	if config.PartSize == 0 {
+		config.PartSize = 64 * 1024 * 1024
+	}
+	if config.PartSize < minPartSize {
+		config.PartSize = minPartSize
+	}
+
+	lookup := minio.BucketLookupAuto
+	if config.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(config.AccessKey, config.SecretKey, config.SessionToken),
+		Secure:       secure,
+		Region:       config.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建 S3 客户端失败: %w", err)
+	}
+
+	sse, err := newServerSideEncryption(config.SSE, config.SSEKMSKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Storage{client: client, config: config, sse: sse}, nil
+}
+
+// newServerSideEncryption 根据配置创建服务端加密选项
+func newServerSideEncryption(mode, kmsKeyID string) (encrypt.ServerSide, error) {
+	switch strings.ToLower(mode) {
+	case SSENone, "none":
+		return nil, nil
+	case SSES3, "aes256":
+		return encrypt.NewSSE(), nil
+	case SSEKMS, "aws:kms":
+		sse, err := encrypt.NewSSEKMS(kmsKeyID, nil)
+		if err != nil {
+			return nil, fmt.Errorf("创建 SSE-KMS 配置失败: %w", err)
+		}
+		return sse, nil
+	default:
+		return nil, fmt.Errorf("不支持的服务端加密方式: %s", mode)
+	}
+}
+
+// Type 返回存储类型
+func (s *S3Storage) Type() string {
+	return "s3"
+}
+
+// Store 存储数据到对象存储
+// 格式、压缩、分区和滚动规则与文件存储一致，对象 key 为 prefix/table/分区目录/文件名
+func (s *S3Storage) Store(ctx context.Context, config *models.StorageConfig, data []map[string]interface{}) error {
+	if len(data) == 0 {
+		log.Println("没有数据需要存储")
+		return nil
+	}
+
+	format, err := normalizeFormat(config.Format)
+	if err != nil {
+		return err
+	}
+	compression, err := normalizeCompression(config.Compression)
+	if err != nil {
+		return err
+	}
+
+	bucket := config.Database
+	if bucket == "" {
+		bucket = s.config.Bucket
+	}
+	if bucket == "" {
+		return fmt.Errorf("未指定 S3 桶")
+	}
+
+	log.Printf("开始存储数据到 S3，桶: %s，表: %s，数据量: %d，格式: %s", bucket, config.Table, len(data), format)
+
+	info := ExecutionInfoFromContext(ctx)
+	plans, err := planFiles(config, info, format, compression, data)
+	if err != nil {
+		return err
+	}
+
+	// 上传失败时删除本次已上传的对象：它们不在任何清单中，重试会重新写入全部数据
+	var written []string
+	fail := func(err error) error {
+		s.removeObjects(bucket, written)
+		return err
+	}
+
+	manifest := newManifest(info, config.Table, format, compression)
+	for _, plan := range plans {
+		var buf bytes.Buffer
+		if err := encodeRecords(&buf, format, compression, plan.Records); err != nil {
+			return fail(err)
+		}
+
+		key := path.Join(s.config.Prefix, config.Table, plan.Dir, plan.Name)
+		size := int64(buf.Len())
+		if err := s.putObject(ctx, bucket, key, &buf, size, contentType(format, compression)); err != nil {
+			return fail(err)
+		}
+		written = append(written, key)
+
+		manifest.add(key, plan.Partition, len(plan.Records), size)
+		log.Printf("写入对象: s3://%s/%s，数据量: %d", bucket, key, len(plan.Records))
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fail(fmt.Errorf("序列化清单失败: %w", err))
+	}
+	manifestKey := path.Join(s.config.Prefix, manifestDir, manifestName(info, config.Table))
+	if err := s.putObject(ctx, bucket, manifestKey, bytes.NewReader(manifestBytes), int64(len(manifestBytes)), "application/json"); err != nil {
+		return fail(fmt.Errorf("写入清单失败: %w", err))
+	}
+
+	log.Printf("数据存储完成，共 %d 个对象，清单: s3://%s/%s", len(manifest.Files), bucket, manifestKey)
+	return nil
+}
+
+// putObject 上传对象，超过分片大小时 minio 客户端自动使用分片上传，失败时会中止未完成的分片
+func (s *S3Storage) putObject(ctx context.Context, bucket, key string, reader io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(ctx, bucket, key, reader, size, minio.PutObjectOptions{
+		ContentType:          contentType,
+		PartSize:             s.config.PartSize,
+		ServerSideEncryption: s.sse,
+	})
+	if err != nil {
+		return fmt.Errorf("上传对象 %s 失败: %w", key, err)
+	}
+	return nil
+}
+
+// removeObjects 删除已上传的对象，删除失败只记录日志
+// 上传失败可能是因为任务被取消，删除不使用任务的 context
+func (s *S3Storage) removeObjects(bucket string, keys []string) {
+	for _, key := range keys {
+		if err := s.client.RemoveObject(context.Background(), bucket, key, minio.RemoveObjectOptions{}); err != nil {
+			log.Printf("删除对象 s3://%s/%s 失败: %v", bucket, key, err)
+		}
+	}
+}
+
+// contentType 返回对象的 Content-Type
+func contentType(format, compression string) string {
+	if format != FormatParquet {
+		switch compression {
+		case CompressionGzip:
+			return "application/gzip"
+		case CompressionZstd:
+			return "application/zstd"
+		}
+	}
+
+	switch format {
+	case FormatJSON:
+		return "application/json"
+	case FormatJSONL:
+		return "application/x-ndjson"
+	case FormatCSV:
+		return "text/csv"
+	default:
+		return "application/octet-stream"
+	}
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/retry"
+)
+
+// ValidateStoragePolicy 校验任务的多存储目标失败策略
+func ValidateStoragePolicy(config *models.TaskConfig) error {
+	switch config.StoragePolicy {
+	case "", models.StoragePolicyAll, models.StoragePolicyAny, models.StoragePolicyRequired:
+		return nil
+	default:
+		return fmt.Errorf("不支持的 storage_policy: %s（可选 all、any、required）", config.StoragePolicy)
+	}
+}
+
+// TargetLabel 返回存储目标在日志、错误信息和死信记录中的名称
+func TargetLabel(target *models.StorageConfig) string {
+	if target.Name != "" {
+		return target.Name
+	}
+	if target.Table != "" {
+		return target.Target + ":" + target.Table
+	}
+	return target.Target
+}
+
+// resultLabel 返回写入结果对应的存储目标名称
+func resultLabel(result *models.StorageResult) string {
+	return TargetLabel(&models.StorageConfig{Name: result.Name, Target: result.Target, Table: result.Table})
+}
+
+// Store 使用 config.Target 对应的存储写入数据
+func (f *StorageFactory) Store(ctx context.Context, config *models.StorageConfig, data []map[string]interface{}) error {
+	stor, ok := f.Get(config.Target)
+	if !ok {
+		return retry.Config(fmt.Errorf("不支持的存储类型: %s", config.Target))
+	}
+	return stor.Store(ctx, config, data)
+}
+
+// StoreTargets 将数据分别写入任务的每个存储目标，单个目标失败不影响其他目标，
+// 返回每个目标的写入结果和目标拒绝的单条记录，是否整体失败由 storage_policy 决定，
+// 整体失败时任一失败目标的错误可重试则可以重试。
+// previous 为同一执行上一次尝试的结果，其中已写入成功的目标沿用原结果、不再写入，避免重试时重复写入
+func (f *StorageFactory) StoreTargets(ctx context.Context, config *models.TaskConfig, data []map[string]interface{}, previous []models.StorageResult) ([]models.StorageResult, []models.DeadLetterRecord, error) {
+	targets := config.StorageTargets()
+	results := make([]models.StorageResult, 0, len(targets))
+	var rejected []models.DeadLetterRecord
+
+	var failed []string
+	var requiredFailed []string
+	var errs, requiredErrs []error
+	for i := range targets {
+		target := &targets[i]
+		label := TargetLabel(target)
+		if i < len(previous) && previous[i].Status == models.StorageResultSuccess && resultLabel(&previous[i]) == label {
+			log.Printf("存储目标 %s 已在之前的尝试中写入成功，跳过", label)
+			results = append(results, previous[i])
+			continue
+		}
+
+		start := time.Now()
+		rejects := NewRejectCollector()
+		err := f.Store(WithRejectCollector(ctx, rejects), target, data)
+
+		targetRejected := rejects.Records()
+		for j := range targetRejected {
+			targetRejected[j].Target = label
+		}
+		rejected = append(rejected, targetRejected...)
+
+		result := models.StorageResult{
+			Name:       target.Name,
+			Target:     target.Target,
+			Table:      target.Table,
+			Status:     models.StorageResultSuccess,
+			Records:    len(data) - len(targetRejected),
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			result.Status = models.StorageResultFailed
+			result.Records = 0
+			result.Error = err.Error()
+
+			log.Printf("存储目标 %s 写入失败: %v", label, err)
+			failed = append(failed, fmt.Sprintf("%s: %v", label, err))
+			errs = append(errs, err)
+			if target.Required {
+				requiredFailed = append(requiredFailed, failed[len(failed)-1])
+				requiredErrs = append(requiredErrs, err)
+			}
+		}
+		results = append(results, result)
+	}
+
+	if len(failed) == 0 {
+		return results, rejected, nil
+	}
+
+	switch config.StoragePolicy {
+	case models.StoragePolicyAny:
+		if len(failed) < len(targets) {
+			log.Printf("%d/%d 个存储目标失败，按 any 策略视为成功", len(failed), len(targets))
+			return results, rejected, nil
+		}
+	case models.StoragePolicyRequired:
+		if len(requiredFailed) == 0 {
+			log.Printf("%d/%d 个非必需存储目标失败，按 required 策略视为成功", len(failed), len(targets))
+			return results, rejected, nil
+		}
+		failed = requiredFailed
+		errs = requiredErrs
+	}
+
+	return results, rejected, retry.Combine(fmt.Errorf("%s", strings.Join(failed, "; ")), errs)
+}
+
+// StoredRejects 返回已写入成功的存储目标拒绝的记录，重试时这些目标不再写入，它们的拒绝记录需要保留
+func StoredRejects(rejected []models.DeadLetterRecord, results []models.StorageResult) []models.DeadLetterRecord {
+	stored := make(map[string]bool)
+	for i := range results {
+		if results[i].Status == models.StorageResultSuccess {
+			stored[resultLabel(&results[i])] = true
+		}
+	}
+
+	var kept []models.DeadLetterRecord
+	for _, record := range rejected {
+		if record.Stage == models.DeadLetterStageStorage && stored[record.Target] {
+			kept = append(kept, record)
+		}
+	}
+	return kept
+}
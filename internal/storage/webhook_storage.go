@@ -0,0 +1,372 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/retry"
+)
+
+// Webhook 请求头
+const (
+	WebhookHeaderTimestamp = "X-DataFusion-Timestamp"
+	WebhookHeaderSignature = "X-DataFusion-Signature"
+	WebhookHeaderDelivery  = "X-DataFusion-Delivery"
+)
+
+// webhookDeliveredTTL 已送达批次的记录保留时间，覆盖同一执行的整体重试
+const webhookDeliveredTTL = 6 * time.Hour
+
+// WebhookStorage Webhook 推送存储，按批次将数据 POST 到接收方
+type WebhookStorage struct {
+	client        *http.Client
+	deadLetterDir string
+	initialDelay  time.Duration
+	maxDelay      time.Duration
+
+	mu        sync.Mutex
+	delivered map[int64]*deliveredBatches // 按执行 ID 记录已送达和已写入死信目录的批次
+}
+
+// deliveredBatches 一次执行已送达和已写入死信目录的批次，键为投递 ID + 请求体摘要
+type deliveredBatches struct {
+	touched      time.Time
+	keys         map[string]bool
+	deadLettered map[string]bool
+}
+
+// NewWebhookStorage 创建 Webhook 存储，重试耗尽的批次写入 deadLetterDir
+func NewWebhookStorage(deadLetterDir string) *WebhookStorage {
+	return &WebhookStorage{
+		client:        &http.Client{},
+		deadLetterDir: deadLetterDir,
+		initialDelay:  time.Second,
+		maxDelay:      30 * time.Second,
+		delivered:     make(map[int64]*deliveredBatches),
+	}
+}
+
+// SetRetryDelay 设置重试的初始延迟和最大延迟（指数退避）
+func (s *WebhookStorage) SetRetryDelay(initial, max time.Duration) {
+	s.initialDelay = initial
+	s.maxDelay = max
+}
+
+// Type 返回存储类型
+func (s *WebhookStorage) Type() string {
+	return "webhook"
+}
+
+// webhookDeadLetter 重试耗尽的批次
+type webhookDeadLetter struct {
+	URL         string                   `json:"url"`
+	TaskID      int64                    `json:"task_id"`
+	ExecutionID int64                    `json:"execution_id"`
+	Batch       int                      `json:"batch"`
+	Attempts    int                      `json:"attempts"`
+	Error       string                   `json:"error"`
+	FailedAt    time.Time                `json:"failed_at"`
+	Records     []map[string]interface{} `json:"records"`
+}
+
+// Store 按批次推送数据
+// 5xx、429 和网络错误按指数退避重试，重试耗尽的批次写入死信目录，其余批次继续推送。
+// 同一执行整体重试时，内容相同且已送达或已写入死信目录的批次不再推送，死信目录中的批次需要人工处理；X-DataFusion-Delivery 在重试中保持不变，
+// 接收方仍应按它去重（如 Worker 重启后重新执行）
+func (s *WebhookStorage) Store(ctx context.Context, config *models.StorageConfig, data []map[string]interface{}) error {
+	if len(data) == 0 {
+		log.Println("没有数据需要存储")
+		return nil
+	}
+
+	hook := config.Webhook
+	if hook == nil || hook.URL == "" {
+		return retry.Config(fmt.Errorf("未配置 webhook url"))
+	}
+
+	batchSize := hook.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	maxRetries := hook.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = 3
+	}
+	secret := hook.Secret
+	if hook.SecretEnv != "" {
+		secret = os.Getenv(hook.SecretEnv)
+	}
+
+	info := ExecutionInfoFromContext(ctx)
+	log.Printf("开始推送数据到 Webhook: %s，数据量: %d，批大小: %d", hook.URL, len(data), batchSize)
+
+	deadLetters := 0
+	var lastErr error
+	for batch, start := 0, 0; start < len(data); batch, start = batch+1, start+batchSize {
+		end := start + batchSize
+		if end > len(data) {
+			end = len(data)
+		}
+		records := data[start:end]
+
+		body, contentType, err := encodeWebhookBody(hook.Format, records)
+		if err != nil {
+			return retry.Config(err)
+		}
+
+		delivery := deliveryID(info, batch)
+		key := deliveredKey(delivery, body)
+		if s.isDelivered(info.ExecutionID, key) {
+			log.Printf("Webhook 批次 %d 已在之前的尝试中送达，跳过", batch)
+			continue
+		}
+		if s.isDeadLettered(info.ExecutionID, key) {
+			log.Printf("Webhook 批次 %d 已在之前的尝试中写入死信目录，跳过", batch)
+			continue
+		}
+		attempts, err := s.deliver(ctx, hook, secret, delivery, body, contentType, maxRetries)
+		if err == nil {
+			s.markDelivered(info.ExecutionID, key)
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		log.Printf("Webhook 批次 %d 推送失败（已尝试 %d 次）: %v", batch, attempts, err)
+		lastErr = err
+		if dlErr := s.writeDeadLetter(config, webhookDeadLetter{
+			URL:         hook.URL,
+			TaskID:      info.TaskID,
+			ExecutionID: info.ExecutionID,
+			Batch:       batch,
+			Attempts:    attempts,
+			Error:       err.Error(),
+			FailedAt:    time.Now(),
+			Records:     records,
+		}); dlErr != nil {
+			return fmt.Errorf("批次 %d 推送失败且写入死信失败: %v: %w", batch, err, dlErr)
+		}
+		s.markDeadLettered(info.ExecutionID, key)
+		deadLetters++
+	}
+
+	// 错误分类与最后一个失败批次一致，接收方认证或配置错误时任务不再重试
+	if deadLetters > 0 {
+		return retry.Wrap(retry.ClassOf(lastErr),
+			fmt.Errorf("%d 个批次推送失败，已写入死信目录 %s", deadLetters, s.deadLetterDir))
+	}
+
+	log.Printf("Webhook 推送完成: %s，共 %d 条", hook.URL, len(data))
+	return nil
+}
+
+// deliver 推送单个批次，返回尝试次数
+func (s *WebhookStorage) deliver(ctx context.Context, hook *models.WebhookConfig, secret, delivery string, body []byte, contentType string, maxRetries int) (int, error) {
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			delay := s.initialDelay << uint(attempt-1)
+			if delay > s.maxDelay || delay <= 0 {
+				delay = s.maxDelay
+			}
+			select {
+			case <-ctx.Done():
+				return attempt, ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		retryable, err := s.post(ctx, hook, secret, delivery, body, contentType)
+		if err == nil {
+			return attempt + 1, nil
+		}
+		lastErr = err
+		if !retryable {
+			return attempt + 1, err
+		}
+	}
+	return maxRetries + 1, lastErr
+}
+
+// post 发送一次请求，返回错误是否可重试
+func (s *WebhookStorage) post(ctx context.Context, hook *models.WebhookConfig, secret, delivery string, body []byte, contentType string) (bool, error) {
+	if hook.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(hook.Timeout)*time.Second)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("创建请求失败: %w", err)
+	}
+	for k, v := range hook.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(WebhookHeaderDelivery, delivery)
+	if secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(WebhookHeaderTimestamp, timestamp)
+		req.Header.Set(WebhookHeaderSignature, "sha256="+SignWebhook(secret, timestamp, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, retry.Transient(fmt.Errorf("请求失败: %w", err))
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = retry.HTTPStatus(resp.StatusCode, resp.Header.Get("Retry-After"),
+		fmt.Errorf("接收方返回 HTTP %d: %s", resp.StatusCode, string(respBody)))
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+// deliveryID 批次的推送标识 <任务>-<执行>-<批次>，死信重放为 <任务>-<执行>-r<死信记录>-<批次>，
+// 不会与原执行的批次相同而被接收方去重
+func deliveryID(info ExecutionInfo, batch int) string {
+	if info.ReplayID > 0 {
+		return fmt.Sprintf("%d-%d-r%d-%d", info.TaskID, info.ExecutionID, info.ReplayID, batch)
+	}
+	return fmt.Sprintf("%d-%d-%d", info.TaskID, info.ExecutionID, batch)
+}
+
+// deliveredKey 已送达批次的标识，重试时重新采集的数据内容不同则重新推送
+func deliveredKey(delivery string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return delivery + ":" + hex.EncodeToString(sum[:])
+}
+
+// isDelivered 批次是否已在同一执行之前的尝试中送达，没有执行 ID 时不跳过
+func (s *WebhookStorage) isDelivered(executionID int64, key string) bool {
+	if executionID == 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batches, ok := s.delivered[executionID]
+	return ok && batches.keys[key]
+}
+
+// isDeadLettered 批次是否已在同一执行之前的尝试中写入死信目录，没有执行 ID 时不跳过
+func (s *WebhookStorage) isDeadLettered(executionID int64, key string) bool {
+	if executionID == 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batches, ok := s.delivered[executionID]
+	return ok && batches.deadLettered[key]
+}
+
+// markDelivered 记录已送达的批次
+func (s *WebhookStorage) markDelivered(executionID int64, key string) {
+	s.mark(executionID, key, false)
+}
+
+// markDeadLettered 记录已写入死信目录的批次，同一执行重试时不再推送，也不再重复写入死信文件
+func (s *WebhookStorage) markDeadLettered(executionID int64, key string) {
+	s.mark(executionID, key, true)
+}
+
+// mark 记录批次的处理结果，并清理过期的执行
+func (s *WebhookStorage) mark(executionID int64, key string, deadLettered bool) {
+	if executionID == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, batches := range s.delivered {
+		if now.Sub(batches.touched) > webhookDeliveredTTL {
+			delete(s.delivered, id)
+		}
+	}
+	batches, ok := s.delivered[executionID]
+	if !ok {
+		batches = &deliveredBatches{keys: make(map[string]bool), deadLettered: make(map[string]bool)}
+		s.delivered[executionID] = batches
+	}
+	batches.touched = now
+	if deadLettered {
+		batches.deadLettered[key] = true
+	} else {
+		batches.keys[key] = true
+	}
+}
+
+// writeDeadLetter 将失败批次写入死信目录，子目录名只取目标名称的最后一级，不能指向死信目录之外
+func (s *WebhookStorage) writeDeadLetter(config *models.StorageConfig, letter webhookDeadLetter) error {
+	name := config.Name
+	if name == "" {
+		name = config.Table
+	}
+	name = filepath.Base(filepath.Clean("/" + name))
+	if name == string(filepath.Separator) {
+		name = "webhook"
+	}
+
+	filePath := filepath.Join(s.deadLetterDir, name,
+		fmt.Sprintf("%s_e%d_batch%d.json", letter.FailedAt.Format("20060102_150405"), letter.ExecutionID, letter.Batch))
+	_, err := writeFileAtomic(filePath, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(letter)
+	})
+	if err == nil {
+		log.Printf("已写入死信文件: %s", filePath)
+	}
+	return err
+}
+
+// encodeWebhookBody 编码请求体：json 为 JSON 数组，ndjson 为每行一条记录
+func encodeWebhookBody(format string, records []map[string]interface{}) ([]byte, string, error) {
+	var buf bytes.Buffer
+	switch format {
+	case "", "json":
+		if err := json.NewEncoder(&buf).Encode(records); err != nil {
+			return nil, "", fmt.Errorf("序列化数据失败: %w", err)
+		}
+		return buf.Bytes(), "application/json", nil
+	case "ndjson", "jsonl":
+		encoder := json.NewEncoder(&buf)
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return nil, "", fmt.Errorf("序列化数据失败: %w", err)
+			}
+		}
+		return buf.Bytes(), "application/x-ndjson", nil
+	default:
+		return nil, "", fmt.Errorf("不支持的 webhook 格式: %s", format)
+	}
+}
+
+// SignWebhook 计算签名：hex(HMAC-SHA256(secret, timestamp + "." + body))
+// 接收方应使用相同算法校验 X-DataFusion-Signature，并拒绝时间戳过旧的请求
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
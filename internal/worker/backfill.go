@@ -0,0 +1,148 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/datafusion/worker/internal/database"
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/schedule"
+)
+
+// backfillWindowKey context 中补数窗口的键
+type backfillWindowKey struct{}
+
+// withBackfillWindow 将补数窗口附加到 context
+func withBackfillWindow(ctx context.Context, window models.BackfillWindow) context.Context {
+	return context.WithValue(ctx, backfillWindowKey{}, window)
+}
+
+// backfillWindowFrom 读取 context 中的补数窗口，不是补数时返回 false
+func backfillWindowFrom(ctx context.Context) (models.BackfillWindow, bool) {
+	window, ok := ctx.Value(backfillWindowKey{}).(models.BackfillWindow)
+	return window, ok
+}
+
+// recoverBackfills 回收 Worker 中断的补数窗口
+func (w *Worker) recoverBackfills(ctx context.Context) {
+	recovered, err := w.db.RecoverBackfillWindows(ctx)
+	if err != nil {
+		log.Printf("回收中断的补数窗口失败: %v", err)
+	} else if recovered > 0 {
+		log.Printf("%d 个补数的窗口因 Worker 租约过期标记为失败", recovered)
+	}
+}
+
+// claimBackfillWindows 领取最多 limit 个补数窗口并发执行，返回领取的窗口数
+func (w *Worker) claimBackfillWindows(ctx context.Context, limit int) int {
+	leaseUntil := time.Now().Add(w.sched.lease)
+	claimed, err := w.db.ClaimBackfillWindows(ctx, w.claimFilter(), limit, w.sched.lease)
+	if err != nil {
+		log.Printf("领取补数窗口失败: %v", err)
+		return 0
+	}
+	if len(claimed) == 0 {
+		return 0
+	}
+
+	log.Printf("领取 %d 个补数窗口", len(claimed))
+	for i := range claimed {
+		c := claimed[i]
+		key := runKey{taskID: c.Task.ID, windowID: c.Window.ID}
+		w.runTask(withBackfillWindow(ctx, c.Window), key, leaseUntil, c.Task, func(execution *models.TaskExecution, err error) {
+			w.finishBackfillWindow(c, execution, err)
+		})
+	}
+	return len(claimed)
+}
+
+// finishBackfillWindow 记录补数窗口的执行结果
+func (w *Worker) finishBackfillWindow(c database.ClaimedBackfillWindow, execution *models.TaskExecution, execErr error) {
+	status := models.BackfillWindowSuccess
+	errMsg := ""
+	var executionID int64
+	records := 0
+	if execution != nil {
+		executionID = execution.ID
+		records = execution.RecordsCollected
+	}
+	if execErr != nil {
+		status = models.BackfillWindowFailed
+		if execution != nil && execution.Status == models.ExecutionStatusCancelled {
+			status = models.BackfillWindowCancelled
+		}
+		errMsg = execErr.Error()
+	}
+
+	finishCtx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	ok, err := w.db.FinishBackfillWindow(finishCtx, c.Window.ID, w.podName, status, executionID, records, errMsg)
+	if err != nil {
+		log.Printf("更新补数窗口 %d (补数 %d) 失败: %v", c.Window.ID, c.Window.BackfillID, err)
+		return
+	}
+	if !ok {
+		log.Printf("补数窗口 %d (补数 %d) 已被回收，忽略执行结果", c.Window.ID, c.Window.BackfillID)
+		return
+	}
+	log.Printf("补数窗口 %s ~ %s (补数 %d) 执行结束: %s", c.Window.WindowStart.Format(time.RFC3339),
+		c.Window.WindowEnd.Format(time.RFC3339), c.Window.BackfillID, status)
+}
+
+// executionWindow 返回本次执行采集的时间窗口：补数时为补数窗口；
+// 否则为截止到计划执行时间（工作流节点为当前时间）的一个调度周期，没有 Cron 或 Cron 无效时为 schedule.DefaultWindow
+func executionWindow(ctx context.Context, task *models.CollectionTask) schedule.Window {
+	if window, ok := backfillWindowFrom(ctx); ok {
+		return schedule.Window{Start: window.WindowStart, End: window.WindowEnd}
+	}
+	end := time.Now()
+	if workflowNodeFrom(ctx) == nil && task.NextRunTime != nil && task.NextRunTime.Before(end) {
+		end = *task.NextRunTime
+	}
+	expr := ""
+	if task.Cron != nil {
+		expr = *task.Cron
+	}
+	// Cron 表达式按任务的时区计算上一次计划时间
+	if task.Timezone != "" {
+		if loc, err := time.LoadLocation(task.Timezone); err == nil {
+			end = end.In(loc)
+		}
+	}
+	window, err := schedule.CronWindow(expr, end)
+	if err != nil {
+		log.Printf("任务 %s (ID: %d) 的 Cron 表达式无效，时间窗口使用默认长度: %v", task.Name, task.ID, err)
+		window, _ = schedule.CronWindow("", end)
+	}
+	return window
+}
+
+// applyWindow 替换数据源 URL、请求头和查询语句中的 {{.WindowStart}}、{{.WindowEnd}} 时间窗口参数
+func applyWindow(config *models.DataSourceConfig, window schedule.Window) error {
+	url, err := schedule.RenderWindow(config.URL, window)
+	if err != nil {
+		return fmt.Errorf("URL: %w", err)
+	}
+	config.URL = url
+
+	if len(config.Headers) > 0 {
+		headers := make(map[string]string, len(config.Headers))
+		for k, v := range config.Headers {
+			if headers[k], err = schedule.RenderWindow(v, window); err != nil {
+				return fmt.Errorf("请求头 %s: %w", k, err)
+			}
+		}
+		config.Headers = headers
+	}
+
+	if config.DBConfig != nil {
+		dbConfig := *config.DBConfig
+		if dbConfig.Query, err = schedule.RenderWindow(dbConfig.Query, window); err != nil {
+			return fmt.Errorf("查询语句: %w", err)
+		}
+		config.DBConfig = &dbConfig
+	}
+	return nil
+}
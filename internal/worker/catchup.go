@@ -0,0 +1,67 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/schedule"
+)
+
+// taskSpec 返回任务的调度配置，引用了日历时从控制库读取
+func (w *Worker) taskSpec(ctx context.Context, task *models.CollectionTask) (schedule.Spec, error) {
+	spec := schedule.Spec{
+		CatchUp: task.CatchUp,
+		Jitter:  time.Duration(task.JitterSeconds) * time.Second,
+	}
+	if task.Cron != nil {
+		spec.Cron = *task.Cron
+	}
+	if task.Timezone != "" {
+		loc, err := time.LoadLocation(task.Timezone)
+		if err != nil {
+			return spec, fmt.Errorf("加载时区 %s 失败: %w", task.Timezone, err)
+		}
+		spec.Location = loc
+	}
+	if task.Calendar != "" {
+		cal, err := w.db.GetCalendar(ctx, task.Calendar)
+		if err != nil {
+			return spec, err
+		}
+		if spec.Calendar, err = schedule.NewCalendar(cal.Weekdays, cal.Holidays, cal.Workdays); err != nil {
+			return spec, fmt.Errorf("日历 %s 无效: %w", task.Calendar, err)
+		}
+	}
+	return spec, nil
+}
+
+// skipMissedRun 补执行策略为 skip 且本次计划执行已错过时，不执行任务，更新下次执行时间并释放租约
+func (w *Worker) skipMissedRun(ctx context.Context, task *models.CollectionTask) bool {
+	if task.CatchUp != schedule.CatchUpSkip || task.Cron == nil || *task.Cron == "" || task.NextRunTime == nil {
+		return false
+	}
+	spec, err := w.taskSpec(ctx, task)
+	if err != nil {
+		log.Printf("读取任务 %s (ID: %d) 的调度配置失败: %v", task.Name, task.ID, err)
+		return false
+	}
+	missed, err := spec.Missed(*task.NextRunTime, time.Now())
+	if err != nil || !missed {
+		return false
+	}
+
+	log.Printf("任务 %s (ID: %d) 错过了计划在 %s 的执行，按 skip 策略跳过",
+		task.Name, task.ID, task.NextRunTime.Format(time.RFC3339))
+	if err := w.updateNextRunTime(ctx, task); err != nil {
+		log.Printf("更新下次执行时间失败: %v", err)
+	}
+	releaseCtx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	if err := w.db.ReleaseTaskLease(releaseCtx, task.ID, w.podName); err != nil {
+		log.Printf("释放任务 %s (ID: %d) 的租约失败: %v", task.Name, task.ID, err)
+	}
+	return true
+}
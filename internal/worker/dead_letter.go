@@ -0,0 +1,138 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/processor"
+	"github.com/datafusion/worker/internal/storage"
+)
+
+// replayBatchSize 每次轮询最多重放的死信记录数
+const replayBatchSize = 100
+
+// replayDeadLetters 回收中断的重放，并重放通过 API 请求重放的死信记录
+// 领取的记录持有租约，重放过程中按心跳间隔续期，租约丢失的记录不再重放
+func (w *Worker) replayDeadLetters(ctx context.Context) {
+	recovered, err := w.db.RecoverDeadLetterReplays(ctx)
+	if err != nil {
+		log.Printf("回收中断的死信重放失败: %v", err)
+	} else if recovered > 0 {
+		log.Printf("%d 条死信记录因 Worker 租约过期退回待处理", recovered)
+	}
+
+	records, err := w.db.ClaimReplayDeadLetters(ctx, w.podName, replayBatchSize, w.sched.lease)
+	if err != nil {
+		log.Printf("领取死信重放记录失败: %v", err)
+		return
+	}
+	if len(records) == 0 {
+		return
+	}
+
+	log.Printf("开始重放 %d 条死信记录", len(records))
+	replayed, failed := 0, 0
+	lost := make(map[int64]bool)
+	renewedAt := time.Now()
+	for i := range records {
+		record := &records[i]
+		if time.Since(renewedAt) >= w.sched.heartbeat {
+			ids := make([]int64, 0, len(records)-i)
+			for _, r := range records[i:] {
+				ids = append(ids, r.ID)
+			}
+			renewed, err := w.db.RenewDeadLetterLeases(ctx, w.podName, ids, w.sched.lease)
+			if err != nil {
+				// 剩余记录在租约过期后回收
+				log.Printf("续期死信重放租约失败，停止本轮重放: %v", err)
+				break
+			}
+			for _, id := range ids {
+				lost[id] = !renewed[id]
+			}
+			renewedAt = time.Now()
+		}
+		if lost[record.ID] {
+			log.Printf("死信记录 %d 的重放租约已丢失，跳过", record.ID)
+			continue
+		}
+
+		replayErr := w.replayDeadLetter(ctx, record)
+		owned, err := w.db.FinishDeadLetterReplay(ctx, record.ID, w.podName, replayErr)
+		if err != nil {
+			log.Printf("更新死信记录 %d 失败: %v", record.ID, err)
+		} else if !owned {
+			log.Printf("死信记录 %d 的重放租约已丢失，不更新重放结果", record.ID)
+			continue
+		}
+		if replayErr != nil {
+			log.Printf("死信记录 %d 重放失败: %v", record.ID, replayErr)
+			failed++
+		} else {
+			replayed++
+		}
+	}
+	log.Printf("死信重放完成，成功: %d 条，失败: %d 条", replayed, failed)
+}
+
+// replayDeadLetter 按任务当前配置重放单条死信记录
+// 处理阶段拒绝的记录从拒绝它的阶段开始重新处理后写入所有存储目标，之前的阶段不会重复执行；
+// 存储阶段失败的记录只写入原先失败的目标，未脱敏时先经过 PII 阶段
+func (w *Worker) replayDeadLetter(ctx context.Context, record *models.DeadLetterRecord) error {
+	task, err := w.db.GetTask(ctx, record.TaskID)
+	if err != nil {
+		return err
+	}
+	taskConfig, err := w.resolveTaskConfig(ctx, task)
+	if err != nil {
+		return fmt.Errorf("解析任务配置失败: %w", err)
+	}
+
+	proc := processor.NewProcessor(&taskConfig.Processor)
+	proc.SetPIIOptions(w.pii)
+	proc.SetReferenceLoader(w.references)
+	data, err := proc.Replay(record)
+	if err != nil {
+		return fmt.Errorf("数据处理失败: %w", err)
+	}
+	if rejected := proc.Rejected(); len(rejected) > 0 {
+		return fmt.Errorf("%s", rejected[0].Error)
+	}
+	if len(data) == 0 && record.Stage == models.DeadLetterStageValidate {
+		return fmt.Errorf("记录未通过校验，已丢弃")
+	}
+
+	targets := taskConfig.StorageTargets()
+	if record.Stage == models.DeadLetterStageStorage {
+		var matched []models.StorageConfig
+		for _, target := range targets {
+			if storage.TargetLabel(&target) == record.Target {
+				matched = append(matched, target)
+			}
+		}
+		if len(matched) == 0 {
+			return fmt.Errorf("存储目标 %s 已不存在", record.Target)
+		}
+		targets = matched
+	}
+
+	storeCtx := storage.WithExecutionInfo(ctx, storage.ExecutionInfo{
+		TaskID:      record.TaskID,
+		ExecutionID: record.ExecutionID,
+		StartTime:   time.Now(),
+		ReplayID:    record.ID,
+	})
+	for i := range targets {
+		rejects := storage.NewRejectCollector()
+		if err := w.storageFactory.Store(storage.WithRejectCollector(storeCtx, rejects), &targets[i], data); err != nil {
+			return fmt.Errorf("%s: %w", storage.TargetLabel(&targets[i]), err)
+		}
+		if rejected := rejects.Records(); len(rejected) > 0 {
+			return fmt.Errorf("%s: %s", storage.TargetLabel(&targets[i]), rejected[0].Error)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/datafusion/worker/internal/cache"
+	"github.com/datafusion/worker/internal/config"
+	"github.com/datafusion/worker/internal/database"
+	"github.com/datafusion/worker/internal/logger"
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/processor"
+)
+
+// dbDedupStore 基于控制数据库 dedup_keys 表的去重键存储
+type dbDedupStore struct {
+	db *database.PostgresDB
+}
+
+// Seen 返回已记录且未过期的键
+func (s *dbDedupStore) Seen(ctx context.Context, scope string, keys []string) (map[string]bool, error) {
+	return s.db.SeenDedupKeys(ctx, scope, keys)
+}
+
+// Mark 记录去重键
+func (s *dbDedupStore) Mark(ctx context.Context, scope string, keys []string, ttl time.Duration) error {
+	return s.db.MarkDedupKeys(ctx, scope, keys, ttl)
+}
+
+// FindFingerprints 返回与任一分段相同且未过期的指纹
+func (s *dbDedupStore) FindFingerprints(ctx context.Context, scope string, bands []string) ([]processor.Fingerprint, error) {
+	rows, err := s.db.FindDedupFingerprints(ctx, scope, bands)
+	if err != nil {
+		return nil, err
+	}
+	fingerprints := make([]processor.Fingerprint, len(rows))
+	for i, row := range rows {
+		fingerprints[i] = processor.Fingerprint{Hash: row.Hash, RecordID: row.RecordID}
+	}
+	return fingerprints, nil
+}
+
+// AddFingerprints 按分段记录指纹
+func (s *dbDedupStore) AddFingerprints(ctx context.Context, scope string, fingerprints []processor.Fingerprint, ttl time.Duration) error {
+	rows := make([]database.DedupFingerprint, len(fingerprints))
+	for i, fp := range fingerprints {
+		rows[i] = database.DedupFingerprint{Hash: fp.Hash, RecordID: fp.RecordID, Bands: fp.Bands}
+	}
+	return s.db.AddDedupFingerprints(ctx, scope, rows, ttl)
+}
+
+// newDedupStore 根据配置创建去重键存储，Redis 不可用时降级为控制数据库
+func newDedupStore(cfg config.DedupConfig, db *database.PostgresDB) processor.DedupStore {
+	if cfg.Store != "redis" {
+		return &dbDedupStore{db: db}
+	}
+
+	redisCache := cache.NewRedisCache(&cache.RedisConfig{
+		Host:     cfg.Redis.Host,
+		Port:     cfg.Redis.Port,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+		PoolSize: cfg.Redis.PoolSize,
+	}, logger.GetLogger())
+	if err := redisCache.Ping(); err != nil {
+		log.Printf("警告: 连接去重 Redis 失败，使用控制数据库保存去重键: %v", err)
+		return &dbDedupStore{db: db}
+	}
+	return processor.NewCacheDedupStore(redisCache)
+}
+
+// dedupScope 任务的去重范围
+func dedupScope(task *models.CollectionTask) string {
+	return fmt.Sprintf("task:%d", task.ID)
+}
+
+// deduplicate 按任务配置去重，返回保留的记录和写入成功后需要提交的去重器
+// 任务未配置去重时原样返回
+func (w *Worker) deduplicate(ctx context.Context, task *models.CollectionTask, cfg *models.DeduplicationConfig, data []map[string]interface{}) ([]map[string]interface{}, *dedupCommit, error) {
+	if cfg == nil {
+		return data, nil, nil
+	}
+
+	dedup, err := processor.NewPersistentDeduplicator(cfg, w.dedupStore, dedupScope(task))
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := dedup.Deduplicate(ctx, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w.metrics.RecordDeduplication(task.Name, dedup.Strategy(), w.podName, len(data), result.Duplicates)
+	if result.Duplicates > 0 {
+		log.Printf("任务 %s 发现重复记录 %d 条（%s）", task.Name, result.Duplicates, dedup.Strategy())
+	}
+	return result.Records, &dedupCommit{dedup: dedup, result: result}, nil
+}
+
+// dedupCommit 等待数据写入成功后提交的去重键
+type dedupCommit struct {
+	dedup  *processor.PersistentDeduplicator
+	result *processor.DedupResult
+}
+
+// commit 记录去重键和指纹，失败只记录日志，最坏情况下下次执行会重复写入这批数据
+func (c *dedupCommit) commit(ctx context.Context) {
+	if c == nil {
+		return
+	}
+	if err := c.dedup.Commit(ctx, c.result); err != nil {
+		log.Printf("警告: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/datafusion/worker/internal/cache"
+	"github.com/datafusion/worker/internal/config"
+	"github.com/datafusion/worker/internal/database"
+	"github.com/datafusion/worker/internal/logger"
+)
+
+// referenceLoader 关联补充的参考数据加载器
+// 参考数据库和 Redis 在第一次使用时连接，连接失败时下次使用再重试
+type referenceLoader struct {
+	cfg     config.EnrichmentConfig
+	storage config.DatabaseConfig
+
+	mu     sync.Mutex
+	dataDB *database.PostgresDB
+	cache  cache.Cache
+}
+
+func newReferenceLoader(cfg *config.Config) *referenceLoader {
+	storage := cfg.Storage.Database
+	if cfg.Enrichment.Database.Host != "" {
+		storage = cfg.Enrichment.Database
+	}
+	return &referenceLoader{cfg: cfg.Enrichment, storage: storage}
+}
+
+// QuerySQL 在数据存储数据库（data）上执行只读查询，控制数据库不对任务开放
+func (l *referenceLoader) QuerySQL(name, query string, maxRows int) ([]map[string]interface{}, error) {
+	if name != "data" {
+		return nil, fmt.Errorf("不支持的数据库: %s", name)
+	}
+	db, err := l.getDataDB()
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := time.Duration(l.cfg.QueryTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return db.QueryReference(ctx, query, maxRows)
+}
+
+func (l *referenceLoader) getDataDB() (*database.PostgresDB, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.dataDB != nil {
+		return l.dataDB, nil
+	}
+	if l.storage.Host == "" {
+		return nil, fmt.Errorf("未配置参考数据库（enrichment.database 或 storage.database）")
+	}
+	db, err := database.NewPostgresDBFromConfig(l.storage)
+	if err != nil {
+		return nil, fmt.Errorf("连接数据存储数据库失败: %w", err)
+	}
+	l.dataDB = db
+	return db, nil
+}
+
+// OpenFile 打开参考数据目录下的文件，路径不能超出该目录
+func (l *referenceLoader) OpenFile(path string) (io.ReadCloser, error) {
+	dir := l.cfg.ReferenceDir
+	if dir == "" {
+		dir = "./data/reference"
+	}
+	file, err := os.Open(filepath.Join(dir, filepath.Clean(string(filepath.Separator)+path)))
+	if err != nil {
+		return nil, fmt.Errorf("打开参考数据文件失败: %w", err)
+	}
+	return file, nil
+}
+
+// GetAllHash 读取 Redis 哈希
+func (l *referenceLoader) GetAllHash(key string) (map[string]string, error) {
+	c, err := l.getCache()
+	if err != nil {
+		return nil, err
+	}
+	return c.GetAllHash(key)
+}
+
+func (l *referenceLoader) getCache() (cache.Cache, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cache != nil {
+		return l.cache, nil
+	}
+	if l.cfg.Redis.Host == "" {
+		return nil, fmt.Errorf("未配置参考数据 Redis（enrichment.redis）")
+	}
+	redisCache := cache.NewRedisCache(&cache.RedisConfig{
+		Host:     l.cfg.Redis.Host,
+		Port:     l.cfg.Redis.Port,
+		Password: l.cfg.Redis.Password,
+		DB:       l.cfg.Redis.DB,
+		PoolSize: l.cfg.Redis.PoolSize,
+	}, logger.GetLogger())
+	if err := redisCache.Ping(); err != nil {
+		redisCache.Close()
+		return nil, fmt.Errorf("连接参考数据 Redis 失败: %w", err)
+	}
+	l.cache = redisCache
+	return redisCache, nil
+}
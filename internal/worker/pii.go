@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/datafusion/worker/internal/config"
+	"github.com/datafusion/worker/internal/database"
+	"github.com/datafusion/worker/internal/processor"
+)
+
+// piiVaultTimeout 单次写入令牌库的超时时间
+const piiVaultTimeout = 30 * time.Second
+
+// dbTokenVault 基于控制数据库 pii_vault 表的令牌库
+type dbTokenVault struct {
+	db     *database.PostgresDB
+	cipher *processor.VaultCipher
+}
+
+// Tokenize 为每个值分配令牌，已存在的值复用原有令牌
+func (v *dbTokenVault) Tokenize(piiType string, values []string) (map[string]string, error) {
+	entries := make([]database.PIIVaultEntry, 0, len(values))
+	hashes := make(map[string]string, len(values))
+	for _, value := range values {
+		token, err := processor.NewPIIToken(piiType)
+		if err != nil {
+			return nil, err
+		}
+		sealed, err := v.cipher.Seal(value)
+		if err != nil {
+			return nil, err
+		}
+		hash := v.cipher.LookupHash(piiType, value)
+		hashes[value] = hash
+		entries = append(entries, database.PIIVaultEntry{Token: token, Type: piiType, ValueHash: hash, Ciphertext: sealed})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), piiVaultTimeout)
+	defer cancel()
+	byHash, err := v.db.TokenizePII(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make(map[string]string, len(values))
+	for value, hash := range hashes {
+		token, ok := byHash[hash]
+		if !ok {
+			return nil, fmt.Errorf("令牌库缺少 %s 类型值的令牌", piiType)
+		}
+		tokens[value] = token
+	}
+	return tokens, nil
+}
+
+// newPIIOptions 根据配置创建 PII 阶段使用的哈希盐和令牌库
+// 未配置的项为空，任务使用 hash 或 tokenize 时处理失败
+func newPIIOptions(cfg config.PIIConfig, db *database.PostgresDB) *processor.PIIOptions {
+	options := &processor.PIIOptions{}
+	salt, vaultKey, err := cfg.Secrets()
+	if err != nil {
+		log.Printf("警告: 读取 PII 密钥失败: %v", err)
+		return options
+	}
+	if salt != "" {
+		options.HashSalt = []byte(salt)
+	}
+	if vaultKey == "" {
+		return options
+	}
+
+	key, err := processor.ParseVaultKey(vaultKey)
+	if err != nil {
+		log.Printf("警告: PII 令牌库密钥无效: %v", err)
+		return options
+	}
+	cipher, err := processor.NewVaultCipher(key)
+	if err != nil {
+		log.Printf("警告: 创建 PII 令牌库失败: %v", err)
+		return options
+	}
+	options.Vault = &dbTokenVault{db: db, cipher: cipher}
+	return options
+}
@@ -7,104 +7,61 @@ import (
 	"time"
 
 	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/retry"
+	"github.com/datafusion/worker/internal/storage"
 )
 
-// RetryPolicy 重试策略
-type RetryPolicy struct {
-	MaxRetries    int           // 最大重试次数
-	InitialDelay  time.Duration // 初始延迟
-	MaxDelay      time.Duration // 最大延迟
-	BackoffFactor float64       // 退避因子
-}
-
-// DefaultRetryPolicy 默认重试策略
-func DefaultRetryPolicy() *RetryPolicy {
-	return &RetryPolicy{
-		MaxRetries:    3,
-		InitialDelay:  5 * time.Second,
-		MaxDelay:      60 * time.Second,
-		BackoffFactor: 2.0,
-	}
-}
-
-// calculateDelay 计算重试延迟（指数退避）
-func (p *RetryPolicy) calculateDelay(attempt int) time.Duration {
-	if attempt <= 0 {
-		return p.InitialDelay
-	}
-
-	// 指数退避: delay = initialDelay * (backoffFactor ^ attempt)
-	delay := float64(p.InitialDelay) * pow(p.BackoffFactor, float64(attempt))
-
-	// 限制最大延迟
-	if delay > float64(p.MaxDelay) {
-		return p.MaxDelay
-	}
-
-	return time.Duration(delay)
-}
-
-// pow 计算幂次方
-func pow(base, exp float64) float64 {
-	result := 1.0
-	for i := 0; i < int(exp); i++ {
-		result *= base
-	}
-	return result
-}
-
-// shouldRetry 判断是否应该重试
-func (p *RetryPolicy) shouldRetry(attempt int, err error) bool {
-	if err == nil {
-		return false
-	}
-
-	if attempt >= p.MaxRetries {
-		return false
-	}
-
-	return true
-}
-
-// executeWithRetry 带重试的任务执行（只创建一条执行记录）
-func (w *Worker) executeWithRetry(ctx context.Context, task *models.CollectionTask) error {
-	policy := DefaultRetryPolicy()
-
-	// 如果任务配置了最大重试次数，使用任务配置
-	if task.MaxRetries > 0 {
-		policy.MaxRetries = task.MaxRetries
-	}
+// executeWithRetry 带重试的任务执行（只创建一条执行记录），返回执行记录，创建执行记录失败时为 nil
+// 每次尝试的起止时间、错误及错误分类记录到 execution.Attempts
+func (w *Worker) executeWithRetry(ctx context.Context, task *models.CollectionTask) (*models.TaskExecution, error) {
+	policy := retry.NewPolicy(task.MaxRetries, task.RetryPolicy)
 
 	// 创建唯一的执行记录
 	startTime := time.Now()
 	execID, err := w.db.CreateExecution(task.ID, w.podName)
 	if err != nil {
-		return fmt.Errorf("创建执行记录失败: %w", err)
+		return nil, fmt.Errorf("创建执行记录失败: %w", err)
 	}
 
 	execution := &models.TaskExecution{
 		ID:        execID,
 		TaskID:    task.ID,
 		WorkerPod: w.podName,
-		Status:    "running",
+		Status:    models.ExecutionStatusRunning,
 		StartTime: startTime,
 	}
 
 	log.Printf("创建执行记录: 任务=%s, 执行ID=%d", task.Name, execID)
+	key := runKeyFrom(ctx, task.ID)
+	w.sched.SetExecution(key, execID)
+	if key.windowID != 0 {
+		cancelled, err := w.db.SetBackfillWindowExecution(ctx, key.windowID, execID)
+		if err != nil {
+			log.Printf("记录%s的执行ID失败: %v", key, err)
+		} else if cancelled {
+			// 领取窗口后、记录执行 ID 前补数已被取消，取消请求无法找到本次执行
+			log.Printf("%s所属的补数已取消，不再执行", key)
+			return execution, w.finishCancelled(ctx, task, execution, 0)
+		}
+	}
 
 	var lastErr error
+	lastCount := 0
+	var delay time.Duration
 
 	for attempt := 0; attempt <= policy.MaxRetries; attempt++ {
-		// 第一次尝试不延迟，后续尝试需要延迟
+		// 第一次尝试不延迟，后续尝试等待上次失败时计算的延迟
 		if attempt > 0 {
-			delay := policy.calculateDelay(attempt - 1)
 			log.Printf("任务 %s (ID: %d) 第 %d 次重试，延迟 %v",
 				task.Name, task.ID, attempt, delay)
 
 			select {
 			case <-ctx.Done():
-				w.finishExecution(ctx, execution, "failed", 0, "任务被取消")
-				return fmt.Errorf("任务被取消: %w", ctx.Err())
+				if w.sched.CancelRequested(key) {
+					return execution, w.finishCancelled(ctx, task, execution, lastCount)
+				}
+				w.finishExecution(ctx, execution, models.ExecutionStatusFailed, 0, "任务被取消")
+				return execution, fmt.Errorf("任务被取消: %w", ctx.Err())
 			case <-time.After(delay):
 				// 延迟结束，继续执行
 			}
@@ -114,29 +71,72 @@ func (w *Worker) executeWithRetry(ctx context.Context, task *models.CollectionTa
 		log.Printf("任务 %s (ID: %d) 开始执行 (尝试 %d/%d, 执行ID: %d)",
 			task.Name, task.ID, attempt+1, policy.MaxRetries+1, execID)
 
+		attemptStart := time.Now()
 		recordCount, err := w.executeTaskOnce(ctx, task, execution, attempt)
+		record := models.ExecutionAttempt{
+			Attempt:   attempt + 1,
+			StartTime: attemptStart,
+			EndTime:   time.Now(),
+			Records:   recordCount,
+		}
 
 		if err == nil {
 			// 执行成功
-			w.finishExecution(ctx, execution, "success", recordCount, "")
+			execution.Attempts = append(execution.Attempts, record)
+			w.finishExecution(ctx, execution, models.ExecutionStatusSuccess, recordCount, "")
 			log.Printf("任务执行完成: %s, 耗时: %v, 数据量: %d", task.Name, time.Since(startTime), recordCount)
-			return nil
+			return execution, nil
 		}
 
+		class := retry.ClassOf(err)
+		record.Error = err.Error()
+		record.ErrorClass = string(class)
 		lastErr = err
+		lastCount = recordCount
+
+		// 通过 API 取消的执行不再重试，记录已处理的数据量
+		if w.sched.CancelRequested(key) {
+			execution.Attempts = append(execution.Attempts, record)
+			return execution, w.finishCancelled(ctx, task, execution, recordCount)
+		}
 
 		// 判断是否应该重试
-		if !policy.shouldRetry(attempt, err) {
-			log.Printf("任务 %s (ID: %d) 不应该重试: %v", task.Name, task.ID, err)
+		if !policy.ShouldRetry(attempt, err) {
+			execution.Attempts = append(execution.Attempts, record)
+			log.Printf("任务 %s (ID: %d) 不应该重试（%s）: %v", task.Name, task.ID, retry.Describe(class), err)
 			break
 		}
 
-		log.Printf("任务 %s (ID: %d) 执行失败: %v", task.Name, task.ID, err)
+		var ok bool
+		delay, ok = policy.RetryDelay(attempt, err)
+		if !ok {
+			execution.Attempts = append(execution.Attempts, record)
+			log.Printf("任务 %s (ID: %d) 服务端要求等待 %v，超过最长等待时间 %v，不再重试: %v",
+				task.Name, task.ID, retry.RetryAfterOf(err), policy.MaxRetryAfter(), err)
+			break
+		}
+		if policy.ExceedsElapsed(startTime, delay) {
+			execution.Attempts = append(execution.Attempts, record)
+			log.Printf("任务 %s (ID: %d) 超过最长重试时间 %v，不再重试: %v", task.Name, task.ID, policy.MaxElapsed, err)
+			break
+		}
+		record.DelayMs = delay.Milliseconds()
+		execution.Attempts = append(execution.Attempts, record)
+
+		log.Printf("任务 %s (ID: %d) 执行失败（%s）: %v", task.Name, task.ID, retry.Describe(class), err)
 	}
 
-	// 所有重试都失败，标记执行记录为失败
-	w.finishExecution(ctx, execution, "failed", 0, fmt.Sprintf("重试 %d 次后失败: %v", policy.MaxRetries, lastErr))
-	return fmt.Errorf("任务执行失败，已重试 %d 次: %w", policy.MaxRetries, lastErr)
+	// 所有重试都失败或错误不可重试，标记执行记录为失败
+	retries := len(execution.Attempts) - 1
+	w.finishExecution(ctx, execution, models.ExecutionStatusFailed, 0, fmt.Sprintf("重试 %d 次后失败: %v", retries, lastErr))
+	return execution, fmt.Errorf("任务执行失败，已重试 %d 次: %w", retries, lastErr)
+}
+
+// finishCancelled 将通过 API 取消的执行记录为 cancelled，recordCount 为取消前已处理的数据量
+func (w *Worker) finishCancelled(ctx context.Context, task *models.CollectionTask, execution *models.TaskExecution, recordCount int) error {
+	w.finishExecution(ctx, execution, models.ExecutionStatusCancelled, recordCount, "执行已取消")
+	log.Printf("任务 %s (ID: %d) 执行已取消，执行ID: %d，已处理数据量: %d", task.Name, task.ID, execution.ID, recordCount)
+	return fmt.Errorf("任务执行已取消: %w", context.Canceled)
 }
 
 // executeTaskOnce 执行一次任务（不创建执行记录，不管理执行状态）
@@ -151,31 +151,61 @@ func (w *Worker) executeTaskOnce(ctx context.Context, task *models.CollectionTas
 	taskCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	// 更新执行记录的重试次数
+	// 更新执行记录的重试次数，拒绝记录、校验结果和 PII 处理结果只保留最后一次尝试的结果，
+	// 之前的尝试中已写入成功的存储目标不再写入，保留它们拒绝的记录
 	execution.RetryCount = retryCount
+	execution.Rejected = storage.StoredRejects(execution.Rejected, execution.StorageResults)
+	execution.ValidationResults = nil
+	execution.PIIResults = nil
+	execution.Output = nil
 
 	// 解析任务配置：优先使用 task.Config，为空时从数据源自动构建
-	taskConfig, err := w.resolveTaskConfig(task)
+	taskConfig, err := w.resolveTaskConfig(taskCtx, task)
 	if err != nil {
 		return 0, fmt.Errorf("解析任务配置失败: %w", err)
 	}
+	execution.CleaningRules = taskConfig.Processor.AppliedCleaningRules()
+
+	// 替换时间窗口参数（补数窗口或本次调度周期）
+	if err := applyWindow(&taskConfig.DataSource, executionWindow(ctx, task)); err != nil {
+		return 0, retry.Config(fmt.Errorf("替换时间窗口参数失败: %w", err))
+	}
 
 	// 1. 数据采集
 	collectedData, err := w.collectData(taskCtx, &taskConfig.DataSource)
 	if err != nil {
 		return 0, fmt.Errorf("数据采集失败: %w", err)
 	}
+	collectedAt := time.Now()
 
 	// 2. 数据处理
-	processedData, err := w.processData(collectedData, &taskConfig.Processor)
+	processedData, err := w.processData(collectedData, &taskConfig.Processor, execution, collectedAt)
+	w.recordValidationMetrics(task, execution.ValidationResults)
 	if err != nil {
 		return len(collectedData), fmt.Errorf("数据处理失败: %w", err)
 	}
 
-	// 3. 数据存储
-	if err := w.storeData(taskCtx, &taskConfig.Storage, processedData); err != nil {
+	// 3. 数据去重（去重键在写入成功后提交）
+	processedData, dedup, err := w.deduplicate(taskCtx, task, taskConfig.Processor.Deduplication, processedData)
+	if err != nil {
+		return len(collectedData), fmt.Errorf("数据去重失败: %w", err)
+	}
+
+	// 4. 数据存储
+	storeCtx := storage.WithExecutionInfo(taskCtx, storage.ExecutionInfo{
+		TaskID:      task.ID,
+		ExecutionID: execution.ID,
+		StartTime:   execution.StartTime,
+	})
+	if err := w.storeToTargets(storeCtx, taskConfig, execution, processedData); err != nil {
 		return len(processedData), fmt.Errorf("数据存储失败: %w", err)
 	}
+	dedup.commit(taskCtx)
+
+	// 工作流节点有下游时保存写入的数据，执行结束后传给下游
+	if info := workflowNodeFrom(ctx); info != nil && info.captureOutput {
+		execution.Output = processedData
+	}
 
 	return len(processedData), nil
 }
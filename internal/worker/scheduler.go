@@ -0,0 +1,295 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/datafusion/worker/internal/database"
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/schedule"
+)
+
+// releaseTimeout 释放租约、更新下次执行时间等收尾操作的超时
+const releaseTimeout = 10 * time.Second
+
+// scheduleErrorDelay 任务的调度配置无法读取时推迟执行的时间
+const scheduleErrorDelay = 10 * time.Minute
+
+// runKey 正在执行的任务的标识：普通任务和工作流节点按任务 ID 区分（任务租约保证同一任务只执行一个），
+// 补数窗口同一任务可以同时执行多个，按窗口 ID 区分
+type runKey struct {
+	taskID   int64
+	windowID int64 // 补数窗口 ID，不是补数时为 0
+}
+
+// String 返回日志中使用的描述
+func (k runKey) String() string {
+	if k.windowID != 0 {
+		return fmt.Sprintf("任务 %d 的补数窗口 %d", k.taskID, k.windowID)
+	}
+	return fmt.Sprintf("任务 %d", k.taskID)
+}
+
+// runKeyCtxKey context 中执行标识的键
+type runKeyCtxKey struct{}
+
+// withRunKey 将执行标识附加到 context
+func withRunKey(ctx context.Context, key runKey) context.Context {
+	return context.WithValue(ctx, runKeyCtxKey{}, key)
+}
+
+// runKeyFrom 读取 context 中的执行标识，没有时为普通任务 taskID
+func runKeyFrom(ctx context.Context, taskID int64) runKey {
+	if key, ok := ctx.Value(runKeyCtxKey{}).(runKey); ok {
+		return key
+	}
+	return runKey{taskID: taskID}
+}
+
+// scheduler 并发执行器：按空闲槽位领取任务，每个任务在独立的 goroutine 中执行，
+// 执行期间由心跳定期续期租约，续期失败直到租约过期的任务在本地取消
+type scheduler struct {
+	*schedule.Executor[runKey]
+	lease     time.Duration
+	heartbeat time.Duration
+}
+
+// newScheduler 创建并发执行器
+func newScheduler(slots int, lease, heartbeat time.Duration) *scheduler {
+	return &scheduler{
+		Executor:  schedule.NewExecutor[runKey](slots),
+		lease:     lease,
+		heartbeat: heartbeat,
+	}
+}
+
+// claimTasks 回收过期租约，按空闲槽位领取工作流节点、到期任务和补数窗口并发执行
+func (w *Worker) claimTasks(ctx context.Context) {
+	leases, interrupted, err := w.db.RecoverExpiredLeases(ctx)
+	if err != nil {
+		log.Printf("回收过期租约失败: %v", err)
+	} else if leases > 0 {
+		log.Printf("回收 %d 个过期租约，%d 条执行记录标记为中断", leases, interrupted)
+	}
+
+	// 触发到期的定时工作流，回收中断的工作流节点和补数窗口
+	w.scheduleWorkflows(ctx)
+	w.recoverBackfills(ctx)
+
+	free := w.sched.Free()
+	if free <= 0 {
+		log.Printf("执行槽位已满 (%d)，本轮不领取任务", w.sched.Slots())
+		return
+	}
+
+	// 工作流节点优先领取
+	free -= w.claimWorkflowNodes(ctx, free)
+	if free <= 0 {
+		return
+	}
+
+	free -= w.claimDueTasks(ctx, free)
+	if free <= 0 {
+		return
+	}
+
+	// 补数窗口使用剩余的槽位，不影响定时任务
+	w.claimBackfillWindows(ctx, free)
+}
+
+// claimDueTasks 领取最多 limit 个到期任务并发执行，返回领取的任务数
+func (w *Worker) claimDueTasks(ctx context.Context, limit int) int {
+	// 租约到期时间按领取前的时间计算，不会晚于数据库中的到期时间
+	leaseUntil := time.Now().Add(w.sched.lease)
+	tasks, err := w.db.ClaimTasks(ctx, w.claimFilter(), limit, w.sched.lease)
+	if err != nil {
+		log.Printf("领取待执行任务失败: %v", err)
+		return 0
+	}
+	if len(tasks) == 0 {
+		log.Printf("没有待执行任务")
+		return 0
+	}
+
+	log.Printf("领取 %d 个待执行任务 (空闲槽位 %d/%d)", len(tasks), limit, w.sched.Slots())
+	for i := range tasks {
+		task := tasks[i]
+		if w.skipMissedRun(ctx, &task) {
+			continue
+		}
+		if task.NextRunTime != nil {
+			w.metrics.RecordTaskWait(task.Queue, w.podName, time.Since(*task.NextRunTime))
+		}
+		w.runTask(ctx, runKey{taskID: task.ID}, leaseUntil, task, func(execution *models.TaskExecution, err error) {
+			// 先更新下次执行时间再释放租约，避免释放后被立即重新领取
+			// 注意：不要将 next_run_time 设为 NOW()，否则会被立即重新领取
+			if err := w.updateNextRunTime(ctx, &task); err != nil {
+				log.Printf("更新下次执行时间失败: %v", err)
+			}
+		})
+	}
+	return len(tasks)
+}
+
+// claimFilter 返回本 Worker 领取任务的路由条件
+func (w *Worker) claimFilter() database.ClaimFilter {
+	return database.ClaimFilter{
+		WorkerType: w.config.WorkerType,
+		WorkerPod:  w.podName,
+		Queues:     w.config.Scheduler.Queues,
+		Labels:     w.config.Scheduler.Labels,
+	}
+}
+
+// updateQueueMetrics 更新各队列等待领取的任务数和等待时长
+func (w *Worker) updateQueueMetrics(ctx context.Context) {
+	stats, err := w.db.QueueStats(ctx)
+	if err != nil {
+		log.Printf("统计任务队列失败: %v", err)
+		return
+	}
+	// 重置后再设置，已删除的队列不再保留旧值
+	w.metrics.TaskQueueLength.Reset()
+	w.metrics.TaskQueueWait.Reset()
+	for _, s := range stats {
+		w.metrics.SetQueueLength(s.Queue, s.Pending, s.WaitSeconds)
+	}
+}
+
+// runTask 在独立的 goroutine 中执行已领取的任务，ctx 可以携带工作流节点或补数窗口信息，
+// leaseUntil 为领取时租约的到期时间；执行结束且租约仍然有效时调用 finish，
+// 然后释放任务租约（补数窗口的租约由 finish 结束）
+func (w *Worker) runTask(ctx context.Context, key runKey, leaseUntil time.Time, task models.CollectionTask, finish func(execution *models.TaskExecution, err error)) {
+	taskCtx, cancel := context.WithCancel(withRunKey(ctx, key))
+	w.metrics.SetRunningTasks(w.sched.Add(key, cancel, leaseUntil))
+
+	go func() {
+		defer w.sched.Done()
+		defer cancel()
+		log.Printf("成功领取任务 %s (ID: %d)，开始执行", task.Name, task.ID)
+
+		execution, err := w.executeWithRetry(taskCtx, &task)
+		if err != nil {
+			log.Printf("任务执行最终失败: %v", err)
+		}
+
+		lost, count := w.sched.Remove(key)
+		w.metrics.SetRunningTasks(count)
+		if lost {
+			// 租约已被回收，任务可能已由其他 Worker 领取，不再更新执行时间
+			log.Printf("%s (%s) 的租约已丢失，跳过收尾", key, task.Name)
+			return
+		}
+
+		finish(execution, err)
+		if key.windowID != 0 {
+			return
+		}
+
+		releaseCtx, releaseCancel := context.WithTimeout(context.Background(), releaseTimeout)
+		defer releaseCancel()
+		if err := w.db.ReleaseTaskLease(releaseCtx, task.ID, w.podName); err != nil {
+			log.Printf("释放任务 %s (ID: %d) 的租约失败: %v", task.Name, task.ID, err)
+		}
+	}()
+}
+
+// heartbeatLoop 定期续期正在执行任务的租约，续期失败的任务视为租约丢失并取消执行
+func (w *Worker) heartbeatLoop(ctx context.Context) {
+	ticker := time.NewTicker(w.sched.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.renewLeases(ctx)
+		}
+	}
+}
+
+// renewLeases 续期一次租约，续期失败时任务继续执行到租约过期，过期后在本地取消，
+// 避免租约被其他 Worker 回收后同一任务重复执行
+func (w *Worker) renewLeases(ctx context.Context) {
+	defer w.expireLeases()
+
+	keys := w.sched.Keys()
+	if len(keys) == 0 {
+		return
+	}
+	var taskIDs, windowIDs []int64
+	for _, key := range keys {
+		if key.windowID != 0 {
+			windowIDs = append(windowIDs, key.windowID)
+		} else {
+			taskIDs = append(taskIDs, key.taskID)
+		}
+	}
+
+	renewCtx, cancel := context.WithTimeout(ctx, w.sched.heartbeat)
+	defer cancel()
+	leaseUntil := time.Now().Add(w.sched.lease)
+	renewed, err := w.db.RenewTaskLeases(renewCtx, w.podName, taskIDs, w.sched.lease)
+	if err != nil {
+		// 数据库暂时不可用时保留任务，租约在过期前还有机会续期
+		log.Printf("续期任务租约失败: %v", err)
+		return
+	}
+	renewedWindows, err := w.db.RenewBackfillLeases(renewCtx, w.podName, windowIDs, w.sched.lease)
+	if err != nil {
+		log.Printf("续期补数窗口租约失败: %v", err)
+		return
+	}
+
+	for _, key := range keys {
+		ok := renewed[key.taskID]
+		if key.windowID != 0 {
+			ok = renewedWindows[key.windowID]
+		}
+		if !ok {
+			log.Printf("%s 的租约已丢失，停止执行", key)
+			w.sched.MarkLost(key)
+			continue
+		}
+		w.sched.Renew(key, leaseUntil)
+	}
+
+	// 取消通知可能在监听连接重连期间丢失，随心跳检查一次
+	cancelling, err := w.db.CancellingExecutions(renewCtx, w.podName)
+	if err != nil {
+		log.Printf("查询待取消的执行记录失败: %v", err)
+		return
+	}
+	for _, id := range cancelling {
+		w.cancelExecution(id)
+	}
+}
+
+// expireLeases 取消租约已过期且未能续期的任务
+func (w *Worker) expireLeases() {
+	for _, key := range w.sched.ExpireLeases(time.Now()) {
+		log.Printf("%s 的租约已过期且未能续期，停止执行", key)
+	}
+}
+
+// listenCancels 监听 API 发出的取消执行通知，监听失败时只依赖心跳检查
+func (w *Worker) listenCancels(ctx context.Context) {
+	err := database.ListenExecutionCancels(ctx, w.config.Database, func(notice models.ExecutionCancelNotice) {
+		if notice.WorkerPod == w.podName {
+			w.cancelExecution(notice.ExecutionID)
+		}
+	})
+	if err != nil {
+		log.Printf("%v，取消请求将在租约续期时检查", err)
+	}
+}
+
+// cancelExecution 取消本 Worker 上正在进行的执行
+func (w *Worker) cancelExecution(executionID int64) {
+	if w.sched.CancelExecution(executionID) {
+		log.Printf("收到取消请求，停止执行 %d", executionID)
+	}
+}
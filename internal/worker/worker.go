@@ -9,13 +9,15 @@ import (
 	"strings"
 	"time"
 
-	"github.com/robfig/cron/v3"
 	"github.com/datafusion/worker/internal/collector"
 	"github.com/datafusion/worker/internal/config"
 	"github.com/datafusion/worker/internal/database"
+	"github.com/datafusion/worker/internal/metrics"
 	"github.com/datafusion/worker/internal/models"
 	"github.com/datafusion/worker/internal/processor"
+	"github.com/datafusion/worker/internal/retry"
 	"github.com/datafusion/worker/internal/storage"
+	"github.com/datafusion/worker/internal/storage/mongodb"
 )
 
 // Worker 工作节点
@@ -24,6 +26,11 @@ type Worker struct {
 	db                *database.PostgresDB
 	collectorFactory  *collector.CollectorFactory
 	storageFactory    *storage.StorageFactory
+	metrics           *metrics.Metrics
+	dedupStore        processor.DedupStore
+	pii               *processor.PIIOptions
+	references        *referenceLoader
+	sched             *scheduler
 	podName           string
 }
 
@@ -51,12 +58,41 @@ func NewWorker(cfg *config.Config) (*Worker, error) {
 	collectorFactory.Register(dbCollector)
 
 	// 创建存储工厂
+	storageFactory := NewStorageFactory(cfg)
+
+	// 获取 Pod 名称
+	podName := os.Getenv("POD_NAME")
+	if podName == "" {
+		podName = fmt.Sprintf("worker-%d", time.Now().Unix())
+	}
+
+	return &Worker{
+		config:           cfg,
+		db:               db,
+		collectorFactory: collectorFactory,
+		storageFactory:   storageFactory,
+		metrics:          metrics.Default(),
+		dedupStore:       newDedupStore(cfg.Dedup, db),
+		pii:              newPIIOptions(cfg.PII, db),
+		references:       newReferenceLoader(cfg),
+		sched:            newScheduler(cfg.Scheduler.Slots, cfg.Scheduler.LeaseDuration, cfg.Scheduler.HeartbeatInterval),
+		podName:          podName,
+	}, nil
+}
+
+// NewStorageFactory 创建存储工厂，注册文件、Webhook 存储和配置中启用的存储
+// 创建失败的存储只记录警告，不影响其他存储
+func NewStorageFactory(cfg *config.Config) *storage.StorageFactory {
 	storageFactory := storage.NewStorageFactory()
-	
+
 	// 注册文件存储
 	fileStorage := storage.NewFileStorage("./data")
 	storageFactory.Register(fileStorage)
-	
+
+	// 注册 Webhook 推送存储（重试耗尽的批次写入死信目录）
+	webhookStorage := storage.NewWebhookStorage("./data/dead_letter/webhook")
+	storageFactory.Register(webhookStorage)
+
 	// 注册 PostgreSQL 存储（如果配置了）
 	if cfg.Storage.Type == "postgresql" {
 		pgStorage, err := storage.NewPostgresStorage(
@@ -74,28 +110,96 @@ func NewWorker(cfg *config.Config) (*Worker, error) {
 		}
 	}
 
-	// 获取 Pod 名称
-	podName := os.Getenv("POD_NAME")
-	if podName == "" {
-		podName = fmt.Sprintf("worker-%d", time.Now().Unix())
+	// 注册 MongoDB 存储（如果配置了）
+	if cfg.Storage.Type == "mongodb" || cfg.Storage.MongoDB.URI != "" {
+		mongoStorage, err := mongodb.NewMongoDBStorage(mongodb.NewConfig(cfg.Storage.MongoDB))
+		if err != nil {
+			log.Printf("警告: 创建 MongoDB 存储失败: %v", err)
+		} else {
+			storageFactory.Register(mongoStorage)
+		}
 	}
 
-	return &Worker{
-		config:           cfg,
-		db:               db,
-		collectorFactory: collectorFactory,
-		storageFactory:   storageFactory,
-		podName:          podName,
+	// 注册 S3 对象存储（如果配置了）
+	if cfg.Storage.S3.Endpoint != "" {
+		s3Config, err := newS3Config(cfg.Storage.S3)
+		if err != nil {
+			log.Printf("警告: 读取 S3 配置失败: %v", err)
+		} else if s3Storage, err := storage.NewS3Storage(s3Config); err != nil {
+			log.Printf("警告: 创建 S3 存储失败: %v", err)
+		} else {
+			storageFactory.Register(s3Storage)
+		}
+	}
+
+	// 注册 Elasticsearch 存储（如果配置了）
+	if cfg.Storage.Elasticsearch.Address != "" {
+		esConfig, err := newElasticsearchConfig(cfg.Storage.Elasticsearch)
+		if err != nil {
+			log.Printf("警告: 读取 Elasticsearch 配置失败: %v", err)
+		} else if esStorage, err := storage.NewElasticsearchStorage(esConfig); err != nil {
+			log.Printf("警告: 创建 Elasticsearch 存储失败: %v", err)
+		} else {
+			storageFactory.Register(esStorage)
+		}
+	}
+
+	return storageFactory
+}
+
+// newS3Config 将 Worker 配置转换为 S3 存储配置
+func newS3Config(cfg config.S3Config) (*storage.S3Config, error) {
+	accessKey, secretKey, err := cfg.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	return &storage.S3Config{
+		Endpoint:    cfg.Endpoint,
+		Region:      cfg.Region,
+		Bucket:      cfg.Bucket,
+		Prefix:      cfg.Prefix,
+		UseSSL:      cfg.UseSSL,
+		PathStyle:   cfg.PathStyle,
+		AccessKey:   accessKey,
+		SecretKey:   secretKey,
+		SSE:         cfg.SSE,
+		SSEKMSKeyID: cfg.SSEKMSKeyID,
+		PartSize:    uint64(cfg.PartSizeMB) * 1024 * 1024,
+	}, nil
+}
+
+// newElasticsearchConfig 将 Worker 配置转换为 Elasticsearch 存储配置
+func newElasticsearchConfig(cfg config.ElasticsearchConfig) (*storage.ElasticsearchConfig, error) {
+	password, err := config.ResolveSecret(cfg.Password, cfg.PasswordFile, "ELASTICSEARCH_PASSWORD")
+	if err != nil {
+		return nil, err
+	}
+	apiKey, err := config.ResolveSecret(cfg.APIKey, cfg.APIKeyFile, "ELASTICSEARCH_API_KEY")
+	if err != nil {
+		return nil, err
+	}
+	return &storage.ElasticsearchConfig{
+		Address:  cfg.Address,
+		Username: cfg.Username,
+		Password: password,
+		APIKey:   apiKey,
+		BulkSize: cfg.BulkSize,
+		Timeout:  time.Duration(cfg.Timeout) * time.Second,
 	}, nil
 }
 
 // Start 启动 Worker
 func (w *Worker) Start(ctx context.Context) error {
-	log.Printf("Worker 启动: %s, 类型: %s", w.podName, w.config.WorkerType)
+	log.Printf("Worker 启动: %s, 类型: %s, 执行槽位: %d, 租约时长: %v, 队列: %v, 标签: %v",
+		w.podName, w.config.WorkerType, w.sched.Slots(), w.sched.lease,
+		w.config.Scheduler.Queues, w.config.Scheduler.Labels)
 
 	ticker := time.NewTicker(w.config.PollInterval)
 	defer ticker.Stop()
 
+	go w.heartbeatLoop(ctx)
+	go w.listenCancels(ctx)
+
 	// 立即执行一次
 	w.poll(ctx)
 
@@ -106,62 +210,53 @@ func (w *Worker) Start(ctx context.Context) error {
 			return nil
 		case <-ticker.C:
 			w.poll(ctx)
+		case <-w.sched.Wake():
+			// 有任务执行完成，立即领取新任务填补空闲槽位
+			w.poll(ctx)
 		}
 	}
 }
 
-// poll 轮询待执行任务
+// poll 处理死信重放并领取待执行任务
 func (w *Worker) poll(ctx context.Context) {
-	// 查询待执行任务
-	tasks, err := w.db.GetPendingTasks(w.config.WorkerType)
-	if err != nil {
-		log.Printf("查询待执行任务失败: %v", err)
+	// 正在关闭时不再领取死信重放和新任务
+	if w.sched.Stopped() {
 		return
 	}
 
-	if len(tasks) == 0 {
-		log.Printf("没有待执行任务")
-		return
-	}
-
-	log.Printf("发现 %d 个待执行任务", len(tasks))
-
-	// 处理每个任务
-	for _, task := range tasks {
-		// 尝试获取任务锁
-		locked, err := w.db.TryLockTask(task.ID, w.podName)
-		if err != nil {
-			log.Printf("获取任务锁失败: %v", err)
-			continue
-		}
-
-		if !locked {
-			log.Printf("任务 %s (ID: %d) 已被其他 Worker 锁定", task.Name, task.ID)
-			continue
-		}
-
-		log.Printf("成功锁定任务 %s (ID: %d)，开始执行", task.Name, task.ID)
+	// 处理已请求重放的死信记录
+	w.replayDeadLetters(ctx)
 
-		// 执行任务（带重试）
-		if err := w.executeWithRetry(ctx, &task); err != nil {
-			log.Printf("任务执行最终失败: %v", err)
-		}
+	w.claimTasks(ctx)
+	w.updateQueueMetrics(ctx)
+}
 
-		// 无论成功或失败，都更新下次执行时间，避免重复轮询
-		// 注意：不调用 UnlockTask（它会将 next_run_time 设为 NOW()，导致立即重新拾取）
-		if err := w.updateNextRunTime(ctx, &task); err != nil {
-			log.Printf("更新下次执行时间失败: %v", err)
-		}
+// parseTaskConfig 解析任务配置，配置无效时返回配置错误
+func (w *Worker) parseTaskConfig(configJSON string) (*models.TaskConfig, error) {
+	taskConfig, err := database.ParseTaskConfig(configJSON)
+	if err != nil {
+		return nil, retry.Config(err)
 	}
+	return taskConfig, nil
 }
 
-// parseTaskConfig 解析任务配置
-func (w *Worker) parseTaskConfig(configJSON string) (*models.TaskConfig, error) {
-	return database.ParseTaskConfig(configJSON)
+// resolveTaskConfig 解析任务配置，任务绑定的已保存清洗规则按顺序排在配置中的清洗规则之前
+func (w *Worker) resolveTaskConfig(ctx context.Context, task *models.CollectionTask) (*models.TaskConfig, error) {
+	taskConfig, err := w.buildTaskConfig(task)
+	if err != nil {
+		return nil, err
+	}
+
+	bound, err := w.db.GetTaskCleaningRules(ctx, task.ID)
+	if err != nil {
+		return nil, err
+	}
+	taskConfig.Processor.PrependCleaningRules(bound)
+	return taskConfig, nil
 }
 
-// resolveTaskConfig 解析任务配置：优先使用 task.Config，为空时从数据源自动构建
-func (w *Worker) resolveTaskConfig(task *models.CollectionTask) (*models.TaskConfig, error) {
+// buildTaskConfig 构建任务配置：优先使用 task.Config，为空时从数据源自动构建
+func (w *Worker) buildTaskConfig(task *models.CollectionTask) (*models.TaskConfig, error) {
 	// 如果任务有完整配置，直接使用
 	if task.Config != nil && *task.Config != "" {
 		return w.parseTaskConfig(*task.Config)
@@ -169,7 +264,7 @@ func (w *Worker) resolveTaskConfig(task *models.CollectionTask) (*models.TaskCon
 
 	// 从关联的数据源自动构建配置
 	if task.DataSourceID == 0 {
-		return nil, fmt.Errorf("任务没有配置且未关联数据源")
+		return nil, retry.Config(fmt.Errorf("任务没有配置且未关联数据源"))
 	}
 
 	dsType, dsConfigJSON, err := w.db.GetDataSourceConfig(task.DataSourceID)
@@ -180,7 +275,7 @@ func (w *Worker) resolveTaskConfig(task *models.CollectionTask) (*models.TaskCon
 	// 解析数据源配置JSON
 	var dsConfig map[string]interface{}
 	if err := json.Unmarshal([]byte(dsConfigJSON), &dsConfig); err != nil {
-		return nil, fmt.Errorf("解析数据源配置JSON失败: %w", err)
+		return nil, retry.Config(fmt.Errorf("解析数据源配置JSON失败: %w", err))
 	}
 
 	// 构建 DataSourceConfig
@@ -258,63 +353,112 @@ func (w *Worker) resolveTaskConfig(task *models.CollectionTask) (*models.TaskCon
 
 // collectData 采集数据
 func (w *Worker) collectData(ctx context.Context, config *models.DataSourceConfig) ([]map[string]interface{}, error) {
+	// 工作流节点读取上游输出
+	if info := workflowNodeFrom(ctx); info != nil &&
+		(config.Type == models.DataSourceUpstream || (config.Upstream != nil && config.Upstream.ForEach)) {
+		return w.collectWorkflowData(ctx, info, config)
+	}
+	if config.Type == models.DataSourceUpstream {
+		return nil, retry.Config(fmt.Errorf("upstream 数据源只能在工作流中使用"))
+	}
+
 	col, ok := w.collectorFactory.Get(config.Type)
 	if !ok {
-		return nil, fmt.Errorf("不支持的采集器类型: %s", config.Type)
+		return nil, retry.Config(fmt.Errorf("不支持的采集器类型: %s", config.Type))
 	}
 
 	return col.Collect(ctx, config)
 }
 
-// processData 处理数据
-func (w *Worker) processData(data []map[string]interface{}, config *models.ProcessorConfig) ([]map[string]interface{}, error) {
+// processData 处理数据，被拒绝的记录、校验结果和 PII 处理结果记录到 execution
+// collectedAt 为数据的采集时间，清洗相对时间（如 3小时前）时作为基准
+func (w *Worker) processData(data []map[string]interface{}, config *models.ProcessorConfig, execution *models.TaskExecution, collectedAt time.Time) ([]map[string]interface{}, error) {
 	proc := processor.NewProcessor(config)
-	return proc.Process(data)
+	proc.SetPIIOptions(w.pii)
+	proc.SetCollectedAt(collectedAt)
+	proc.SetReferenceLoader(w.references)
+	processed, err := proc.Process(data)
+	execution.Rejected = append(execution.Rejected, proc.Rejected()...)
+	execution.ValidationResults = proc.ValidationResults()
+	execution.PIIResults = proc.PIIResults()
+	return processed, err
 }
 
-// storeData 存储数据
-func (w *Worker) storeData(ctx context.Context, config *models.StorageConfig, data []map[string]interface{}) error {
-	stor, ok := w.storageFactory.Get(config.Target)
-	if !ok {
-		return fmt.Errorf("不支持的存储类型: %s", config.Target)
+// recordValidationMetrics 导出校验规则的通过/失败数
+func (w *Worker) recordValidationMetrics(task *models.CollectionTask, results []models.ValidationResult) {
+	for _, result := range results {
+		w.metrics.RecordValidation(task.Name, result.Rule, result.Action, w.podName, result.Passed, result.Failed)
 	}
+}
 
-	return stor.Store(ctx, config, data)
+// storeToTargets 将数据分别写入每个存储目标，每个目标的结果记录到 execution.StorageResults，
+// 目标拒绝的单条记录追加到 execution.Rejected；重试时跳过之前的尝试中已写入成功的目标
+func (w *Worker) storeToTargets(ctx context.Context, taskConfig *models.TaskConfig, execution *models.TaskExecution, data []map[string]interface{}) error {
+	results, rejected, err := w.storageFactory.StoreTargets(ctx, taskConfig, data, execution.StorageResults)
+	for i := range rejected {
+		rejected[i].PIIProtected = processor.UsesPII(&taskConfig.Processor)
+	}
+	execution.Rejected = append(execution.Rejected, rejected...)
+	execution.StorageResults = results
+	return err
 }
 
-// updateNextRunTime 更新下次执行时间
+// updateNextRunTime 按任务的时区、日历、补执行策略和抖动更新下次执行时间
 func (w *Worker) updateNextRunTime(ctx context.Context, task *models.CollectionTask) error {
 	if task.Cron == nil || *task.Cron == "" {
 		// 没有cron表达式的一次性任务，清空next_run_time防止重复执行
 		return w.db.ClearTaskNextRunTime(task.ID)
 	}
 
-	cronExpr := strings.TrimSpace(*task.Cron)
-	// 移除 Quartz 风格的 '?' 字符（替换为 '*'）
-	cronExpr = strings.ReplaceAll(cronExpr, "?", "*")
-
-	// 尝试6字段（含秒）解析，失败则回退到5字段
-	parser6 := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	schedule, err := parser6.Parse(cronExpr)
+	spec, err := w.taskSpec(ctx, task)
 	if err != nil {
-		parser5 := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-		schedule, err = parser5.Parse(cronExpr)
-		if err != nil {
-			return fmt.Errorf("解析 Cron 表达式失败: %w", err)
-		}
+		return w.postponeNextRunTime(task, err)
 	}
+	nextRunTime, err := spec.After(task.NextRunTime, time.Now())
+	if err != nil {
+		return w.postponeNextRunTime(task, err)
+	}
+	return w.db.UpdateTaskNextRunTime(task.ID, nextRunTime)
+}
 
-	nextRunTime := schedule.Next(time.Now())
-	return w.db.UpdateTaskNextRunTime(task.ID, nextRunTime.Format("2006-01-02 15:04:05"))
+// postponeNextRunTime 无法计算下次执行时间（如日历无法读取）时推迟 scheduleErrorDelay 再试，
+// 避免 next_run_time 停留在过去，任务每轮都被重新领取
+func (w *Worker) postponeNextRunTime(task *models.CollectionTask, cause error) error {
+	retryAt := time.Now().Add(scheduleErrorDelay)
+	if err := w.db.UpdateTaskNextRunTime(task.ID, retryAt); err != nil {
+		return fmt.Errorf("计算下次执行时间失败: %v，推迟执行也失败: %w", cause, err)
+	}
+	return fmt.Errorf("计算下次执行时间失败，推迟到 %s 再试: %w", retryAt.Format(time.RFC3339), cause)
 }
 
 // finishExecution 完成执行
 func (w *Worker) finishExecution(ctx context.Context, execution *models.TaskExecution, status string, recordsCollected int, errorMsg string) {
+	// 任务被取消时 ctx 已结束，执行结果仍需写入
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), releaseTimeout)
+		defer cancel()
+	}
+
 	endTime := time.Now()
 	execution.Status = status
 	execution.EndTime = &endTime
 	execution.RecordsCollected = recordsCollected
 	execution.ErrorMessage = errorMsg
+	execution.RecordsRejected = len(execution.Rejected)
+
+	// 被拒绝的记录写入死信表
+	if len(execution.Rejected) > 0 {
+		for i := range execution.Rejected {
+			execution.Rejected[i].TaskID = execution.TaskID
+			execution.Rejected[i].ExecutionID = execution.ID
+		}
+		if err := w.db.SaveDeadLetters(ctx, execution.Rejected); err != nil {
+			log.Printf("写入死信记录失败: %v", err)
+		} else {
+			log.Printf("执行 %d 共 %d 条记录进入死信队列", execution.ID, len(execution.Rejected))
+		}
+	}
 
 	if err := w.db.UpdateExecution(ctx, execution); err != nil {
 		log.Printf("更新执行记录失败: %v", err)
@@ -326,13 +470,19 @@ func (w *Worker) GetDB() *database.PostgresDB {
 	return w.db
 }
 
-// Shutdown 优雅关闭 Worker
+// Shutdown 优雅关闭 Worker：停止领取新任务并等待正在执行的任务结束，
+// ctx 超时后取消剩余任务，未释放的租约过期后由其他 Worker 回收
 func (w *Worker) Shutdown(ctx context.Context) error {
 	log.Println("开始优雅关闭 Worker...")
-	
-	// 这里可以添加等待正在运行的任务完成的逻辑
-	// 目前简单实现，直接返回
-	
+
+	w.sched.Drain()
+	if !w.sched.Wait(ctx) {
+		keys := w.sched.Keys()
+		log.Printf("等待任务结束超时，取消 %d 个正在执行的任务", len(keys))
+		w.sched.CancelAll()
+		return fmt.Errorf("等待任务结束超时: %w", ctx.Err())
+	}
+
 	log.Println("Worker 优雅关闭完成")
 	return nil
 }
@@ -0,0 +1,178 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/datafusion/worker/internal/database"
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/workflow"
+)
+
+// workflowScheduleBatch 每轮最多触发的定时工作流数
+const workflowScheduleBatch = 10
+
+// workflowNodeKey context 中工作流节点信息的键
+type workflowNodeKey struct{}
+
+// workflowNodeInfo 正在执行的工作流节点
+type workflowNodeInfo struct {
+	runID         int64
+	node          string
+	upstream      []string // 直接上游节点
+	captureOutput bool     // 有下游节点，需要保存输出
+}
+
+// withWorkflowNode 将工作流节点信息附加到 context
+func withWorkflowNode(ctx context.Context, info *workflowNodeInfo) context.Context {
+	return context.WithValue(ctx, workflowNodeKey{}, info)
+}
+
+// workflowNodeFrom 读取 context 中的工作流节点信息，不是工作流节点时返回 nil
+func workflowNodeFrom(ctx context.Context) *workflowNodeInfo {
+	info, _ := ctx.Value(workflowNodeKey{}).(*workflowNodeInfo)
+	return info
+}
+
+// scheduleWorkflows 触发到期的定时工作流，并回收 Worker 中断的工作流节点
+func (w *Worker) scheduleWorkflows(ctx context.Context) {
+	runIDs, err := w.db.ScheduleDueWorkflows(ctx, workflowScheduleBatch)
+	if err != nil {
+		log.Printf("触发定时工作流失败: %v", err)
+	} else if len(runIDs) > 0 {
+		log.Printf("触发 %d 个定时工作流运行: %v", len(runIDs), runIDs)
+	}
+
+	recovered, err := w.db.RecoverWorkflowNodes(ctx)
+	if err != nil {
+		log.Printf("回收中断的工作流节点失败: %v", err)
+	} else if recovered > 0 {
+		log.Printf("%d 个工作流节点因 Worker 租约过期标记为失败", recovered)
+	}
+}
+
+// claimWorkflowNodes 领取最多 limit 个可执行的工作流节点并发执行，返回领取的节点数
+func (w *Worker) claimWorkflowNodes(ctx context.Context, limit int) int {
+	leaseUntil := time.Now().Add(w.sched.lease)
+	claimed, err := w.db.ClaimWorkflowNodes(ctx, w.claimFilter(), limit, w.sched.lease)
+	if err != nil {
+		log.Printf("领取工作流节点失败: %v", err)
+		return 0
+	}
+	if len(claimed) == 0 {
+		return 0
+	}
+
+	log.Printf("领取 %d 个工作流节点", len(claimed))
+	for i := range claimed {
+		c := claimed[i]
+		info := &workflowNodeInfo{
+			runID:         c.Node.RunID,
+			node:          c.Node.Node,
+			captureOutput: workflow.HasDownstream(c.Definition, c.Node.Node),
+		}
+		for _, edge := range workflow.Upstream(c.Definition, c.Node.Node) {
+			info.upstream = append(info.upstream, edge.From)
+		}
+
+		w.runTask(withWorkflowNode(ctx, info), runKey{taskID: c.Task.ID}, leaseUntil, c.Task, func(execution *models.TaskExecution, err error) {
+			w.finishWorkflowNode(c, info, execution, err)
+		})
+	}
+	return len(claimed)
+}
+
+// finishWorkflowNode 记录节点结果（有下游时保存输出）并推进工作流
+func (w *Worker) finishWorkflowNode(c database.ClaimedWorkflowNode, info *workflowNodeInfo, execution *models.TaskExecution, execErr error) {
+	status := models.WorkflowNodeSuccess
+	errMsg := ""
+	var executionID int64
+	var output []map[string]interface{}
+	if execution != nil {
+		executionID = execution.ID
+	}
+	if execErr != nil {
+		status = models.WorkflowNodeFailed
+		errMsg = execErr.Error()
+	} else if info.captureOutput {
+		output = execution.Output
+		if output == nil {
+			output = []map[string]interface{}{}
+		}
+		if len(output) > models.MaxWorkflowOutputRecords {
+			errMsg = fmt.Sprintf("输出 %d 条记录，只传递前 %d 条", len(output), models.MaxWorkflowOutputRecords)
+			log.Printf("工作流节点 %s: %s", c.Node.Node, errMsg)
+			output = output[:models.MaxWorkflowOutputRecords]
+		}
+	}
+
+	finishCtx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	ok, err := w.db.FinishWorkflowNode(finishCtx, c.Node.ID, w.podName, status, executionID, errMsg, output)
+	if err != nil {
+		log.Printf("更新工作流节点 %s (运行 %d) 失败: %v", c.Node.Node, c.Node.RunID, err)
+		return
+	}
+	if !ok {
+		log.Printf("工作流节点 %s (运行 %d) 已被回收，忽略执行结果", c.Node.Node, c.Node.RunID)
+		return
+	}
+	log.Printf("工作流节点 %s (运行 %d) 执行结束: %s", c.Node.Node, c.Node.RunID, status)
+}
+
+// collectWorkflowData 在工作流节点中读取上游输出：upstream 数据源直接返回上游记录，
+// 配置 for_each 的数据源对每条上游记录替换 URL 和请求头中的 {{字段}} 后分别采集
+func (w *Worker) collectWorkflowData(ctx context.Context, info *workflowNodeInfo, config *models.DataSourceConfig) ([]map[string]interface{}, error) {
+	nodes := info.upstream
+	if config.Upstream != nil && len(config.Upstream.Nodes) > 0 {
+		direct := make(map[string]bool, len(info.upstream))
+		for _, name := range info.upstream {
+			direct[name] = true
+		}
+		for _, name := range config.Upstream.Nodes {
+			if !direct[name] {
+				return nil, fmt.Errorf("节点 %s 不是 %s 的直接上游", name, info.node)
+			}
+		}
+		nodes = config.Upstream.Nodes
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("节点 %s 没有上游节点", info.node)
+	}
+
+	records, err := w.db.WorkflowNodeOutputs(ctx, info.runID, nodes)
+	if err != nil {
+		return nil, err
+	}
+	if config.Type == models.DataSourceUpstream {
+		return records, nil
+	}
+
+	col, ok := w.collectorFactory.Get(config.Type)
+	if !ok {
+		return nil, fmt.Errorf("不支持的采集器类型: %s", config.Type)
+	}
+
+	var collected []map[string]interface{}
+	for i, record := range records {
+		itemConfig := *config
+		itemConfig.Upstream = nil
+		itemConfig.URL = workflow.Render(config.URL, record)
+		if len(config.Headers) > 0 {
+			itemConfig.Headers = make(map[string]string, len(config.Headers))
+			for k, v := range config.Headers {
+				itemConfig.Headers[k] = workflow.Render(v, record)
+			}
+		}
+
+		data, err := col.Collect(ctx, &itemConfig)
+		if err != nil {
+			return nil, fmt.Errorf("采集第 %d 条上游记录 (%s) 失败: %w", i+1, itemConfig.URL, err)
+		}
+		collected = append(collected, data...)
+	}
+	log.Printf("工作流节点 %s: 按 %d 条上游记录采集 %d 条数据", info.node, len(records), len(collected))
+	return collected, nil
+}
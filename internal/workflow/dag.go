@@ -0,0 +1,242 @@
+package workflow
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/datafusion/worker/internal/models"
+)
+
+// placeholderPattern 上游字段占位符，如 {{id}}、{{item.url}}
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([\w.]+)\s*\}\}`)
+
+// Validate 校验工作流定义：节点名称唯一且引用了任务，依赖边引用已有节点、条件有效，且图中没有环
+func Validate(def models.WorkflowDefinition) error {
+	if len(def.Nodes) == 0 {
+		return fmt.Errorf("工作流至少需要一个节点")
+	}
+
+	nodes := make(map[string]bool, len(def.Nodes))
+	for i, node := range def.Nodes {
+		if strings.TrimSpace(node.Name) == "" {
+			return fmt.Errorf("第 %d 个节点缺少名称", i+1)
+		}
+		if nodes[node.Name] {
+			return fmt.Errorf("节点名称 %s 重复", node.Name)
+		}
+		if node.TaskID <= 0 {
+			return fmt.Errorf("节点 %s 缺少 task_id", node.Name)
+		}
+		nodes[node.Name] = true
+	}
+
+	edges := make(map[string]bool, len(def.Edges))
+	for _, edge := range def.Edges {
+		if !nodes[edge.From] {
+			return fmt.Errorf("依赖边引用了不存在的节点 %s", edge.From)
+		}
+		if !nodes[edge.To] {
+			return fmt.Errorf("依赖边引用了不存在的节点 %s", edge.To)
+		}
+		if edge.From == edge.To {
+			return fmt.Errorf("节点 %s 不能依赖自身", edge.From)
+		}
+		switch edge.Condition {
+		case "", models.WorkflowConditionSuccess, models.WorkflowConditionFailure, models.WorkflowConditionAlways:
+		default:
+			return fmt.Errorf("依赖边 %s -> %s 的条件 %s 无效（可选 success, failure, always）", edge.From, edge.To, edge.Condition)
+		}
+		key := edge.From + "\x00" + edge.To
+		if edges[key] {
+			return fmt.Errorf("依赖边 %s -> %s 重复", edge.From, edge.To)
+		}
+		edges[key] = true
+	}
+
+	if cycle := findCycle(def); cycle != "" {
+		return fmt.Errorf("工作流存在循环依赖: %s", cycle)
+	}
+	return nil
+}
+
+// findCycle 按拓扑排序检查环，返回环上的一个节点名称
+func findCycle(def models.WorkflowDefinition) string {
+	indegree := make(map[string]int, len(def.Nodes))
+	next := make(map[string][]string)
+	for _, edge := range def.Edges {
+		indegree[edge.To]++
+		next[edge.From] = append(next[edge.From], edge.To)
+	}
+
+	var queue []string
+	for _, node := range def.Nodes {
+		if indegree[node.Name] == 0 {
+			queue = append(queue, node.Name)
+		}
+	}
+	visited := 0
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		visited++
+		for _, to := range next[name] {
+			indegree[to]--
+			if indegree[to] == 0 {
+				queue = append(queue, to)
+			}
+		}
+	}
+	if visited == len(def.Nodes) {
+		return ""
+	}
+	for _, node := range def.Nodes {
+		if indegree[node.Name] > 0 {
+			return node.Name
+		}
+	}
+	return ""
+}
+
+// Upstream 返回指向 node 的依赖边
+func Upstream(def models.WorkflowDefinition, node string) []models.WorkflowEdge {
+	var edges []models.WorkflowEdge
+	for _, edge := range def.Edges {
+		if edge.To == node {
+			edges = append(edges, edge)
+		}
+	}
+	return edges
+}
+
+// HasDownstream 判断 node 是否有下游节点（有下游时需要保存输出）
+func HasDownstream(def models.WorkflowDefinition, node string) bool {
+	for _, edge := range def.Edges {
+		if edge.From == node {
+			return true
+		}
+	}
+	return false
+}
+
+// Advance 根据当前节点状态计算可以执行和需要跳过的 pending 节点
+// 节点的所有上游都结束后：每条依赖边的条件都满足时进入 queued，否则跳过；
+// 跳过的节点也视为结束，继续推进它的下游
+func Advance(def models.WorkflowDefinition, statuses map[string]string) (queue []string, skip []string) {
+	current := make(map[string]string, len(statuses))
+	for name, status := range statuses {
+		current[name] = status
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, node := range def.Nodes {
+			if status, ok := current[node.Name]; ok && status != models.WorkflowNodePending {
+				continue
+			}
+
+			ready, satisfied := true, true
+			for _, edge := range Upstream(def, node.Name) {
+				upstream := current[edge.From]
+				if !finished(upstream) {
+					ready = false
+					break
+				}
+				if !conditionMet(edge.Condition, upstream) {
+					satisfied = false
+				}
+			}
+			if !ready {
+				continue
+			}
+
+			if satisfied {
+				current[node.Name] = models.WorkflowNodeQueued
+				queue = append(queue, node.Name)
+			} else {
+				current[node.Name] = models.WorkflowNodeSkipped
+				skip = append(skip, node.Name)
+			}
+			changed = true
+		}
+	}
+	return queue, skip
+}
+
+// RunStatus 返回工作流运行的状态：所有节点结束后，有节点失败为 failed，否则为 success
+func RunStatus(def models.WorkflowDefinition, statuses map[string]string) string {
+	failed := false
+	for _, node := range def.Nodes {
+		status := statuses[node.Name]
+		if !finished(status) {
+			return models.WorkflowRunRunning
+		}
+		if status == models.WorkflowNodeFailed {
+			failed = true
+		}
+	}
+	if failed {
+		return models.WorkflowRunFailed
+	}
+	return models.WorkflowRunSuccess
+}
+
+// finished 节点是否已结束
+func finished(status string) bool {
+	switch status {
+	case models.WorkflowNodeSuccess, models.WorkflowNodeFailed, models.WorkflowNodeSkipped:
+		return true
+	}
+	return false
+}
+
+// conditionMet 上游状态是否满足依赖边的条件
+func conditionMet(condition, upstream string) bool {
+	switch condition {
+	case models.WorkflowConditionFailure:
+		return upstream == models.WorkflowNodeFailed
+	case models.WorkflowConditionAlways:
+		return true
+	default:
+		return upstream == models.WorkflowNodeSuccess
+	}
+}
+
+// HasPlaceholder 判断字符串中是否包含 {{字段}} 占位符
+func HasPlaceholder(s string) bool {
+	return placeholderPattern.MatchString(s)
+}
+
+// Render 用上游记录的字段替换 {{字段}} 占位符（支持嵌套路径），字段不存在时替换为空字符串
+func Render(template string, record map[string]interface{}) string {
+	return placeholderPattern.ReplaceAllStringFunc(template, func(match string) string {
+		path := placeholderPattern.FindStringSubmatch(match)[1]
+		value, ok := lookup(record, path)
+		if !ok || value == nil {
+			return ""
+		}
+		// 上游输出经 JSON 保存后数字为 float64，整数按整数格式输出
+		if f, ok := value.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1e15 {
+			return strconv.FormatInt(int64(f), 10)
+		}
+		return fmt.Sprint(value)
+	})
+}
+
+// lookup 按点分路径读取嵌套字段
+func lookup(record map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = record
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
@@ -29,12 +29,26 @@ CREATE TABLE IF NOT EXISTS cleaning_rules (
     description TEXT,
     rule_type VARCHAR(50) NOT NULL,  -- trim, remove_html, regex, etc.
     config JSONB NOT NULL,            -- 规则配置（JSON格式）
+    version INT DEFAULT 1,            -- 规则版本，每次修改递增
     created_at TIMESTAMP DEFAULT NOW(),
     updated_at TIMESTAMP DEFAULT NOW()
 );
 
 CREATE INDEX idx_cleaning_rules_type ON cleaning_rules(rule_type);
 
+-- 2.1 清洗规则版本表（每次创建或修改保存一份）
+CREATE TABLE IF NOT EXISTS cleaning_rule_versions (
+    id BIGSERIAL PRIMARY KEY,
+    rule_id BIGINT REFERENCES cleaning_rules(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    rule_type VARCHAR(50) NOT NULL,
+    config JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE(rule_id, version)
+);
+
 -- 3. 采集任务表
 CREATE TABLE IF NOT EXISTS collection_tasks (
     id BIGSERIAL PRIMARY KEY,
@@ -43,12 +57,21 @@ CREATE TABLE IF NOT EXISTS collection_tasks (
     type VARCHAR(50) NOT NULL,        -- web-rpa, api, database
     data_source_id BIGINT REFERENCES data_sources(id) ON DELETE CASCADE,
     cron VARCHAR(100),                -- Cron表达式
-    next_run_time TIMESTAMP,          -- 下次执行时间
+    next_run_time TIMESTAMPTZ,        -- 下次执行时间（带时区，与 NOW() 比较不受 Worker 时区影响）
     status VARCHAR(50) DEFAULT 'enabled',  -- enabled, disabled
     replicas INT DEFAULT 1,           -- 并发执行数
     execution_timeout INT DEFAULT 3600,  -- 执行超时（秒）
     max_retries INT DEFAULT 3,        -- 最大重试次数
     config JSONB,                     -- 任务配置（JSON格式）
+    queue VARCHAR(100) DEFAULT 'default',   -- 所属队列
+    priority INT DEFAULT 0,           -- 队列内的优先级，越大越先执行
+    tenant VARCHAR(100) DEFAULT 'default',  -- 租户，同优先级的任务在租户之间公平调度
+    selector JSONB,                   -- Worker 必须具有的标签，如 {"chrome": "true"}
+    timezone VARCHAR(64),             -- Cron 表达式的时区（IANA 名称，如 Asia/Shanghai），为空时为 Worker 本地时区
+    catch_up VARCHAR(20) DEFAULT 'once',  -- 错过执行的补执行策略：skip, once, all
+    jitter_seconds INT DEFAULT 0,     -- 下次执行时间随机推迟的最大秒数
+    calendar VARCHAR(100),            -- 引用的日历，只在日历的工作日执行
+    retry_policy JSONB,               -- 重试策略：最大尝试次数、退避、抖动、最长重试时间
     created_at TIMESTAMP DEFAULT NOW(),
     updated_at TIMESTAMP DEFAULT NOW()
 );
@@ -56,18 +79,50 @@ CREATE TABLE IF NOT EXISTS collection_tasks (
 CREATE INDEX idx_collection_tasks_status ON collection_tasks(status);
 CREATE INDEX idx_collection_tasks_next_run_time ON collection_tasks(next_run_time);
 CREATE INDEX idx_collection_tasks_data_source ON collection_tasks(data_source_id);
+CREATE INDEX idx_collection_tasks_queue ON collection_tasks(queue, priority DESC);
+
+-- 3.1 任务队列表
+CREATE TABLE IF NOT EXISTS task_queues (
+    name VARCHAR(100) PRIMARY KEY,
+    description TEXT,
+    priority INT DEFAULT 0,           -- 队列优先级，越大越先领取
+    max_concurrency INT DEFAULT 0,    -- 所有 Worker 上同时执行的任务数上限，0 表示不限制
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+INSERT INTO task_queues (name, description) VALUES ('default', '默认队列') ON CONFLICT (name) DO NOTHING;
+
+-- 3.2 日历表（工作日和节假日，任务引用后只在工作日执行）
+CREATE TABLE IF NOT EXISTS calendars (
+    name VARCHAR(100) PRIMARY KEY,
+    description TEXT,
+    weekdays INT[] DEFAULT '{1,2,3,4,5}',  -- 每周的工作日，0 为周日
+    holidays DATE[] DEFAULT '{}',     -- 节假日，不执行
+    workdays DATE[] DEFAULT '{}',     -- 调休的工作日，优先于 weekdays
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
 
 -- 4. 任务执行记录表
 CREATE TABLE IF NOT EXISTS task_executions (
     id BIGSERIAL PRIMARY KEY,
     task_id BIGINT REFERENCES collection_tasks(id) ON DELETE CASCADE,
     worker_pod VARCHAR(255),          -- 执行的Worker Pod名称
-    status VARCHAR(50) NOT NULL,      -- running, success, failed
+    status VARCHAR(50) NOT NULL,      -- running, cancelling, success, failed, cancelled
     start_time TIMESTAMP DEFAULT NOW(),
     end_time TIMESTAMP,
     records_collected INT DEFAULT 0,  -- 采集的记录数
     error_message TEXT,               -- 错误信息
     retry_count INT DEFAULT 0,        -- 重试次数
+    storage_results JSONB,            -- 各存储目标的写入结果
+    records_rejected INT DEFAULT 0,   -- 进入死信队列的记录数
+    validation_results JSONB,         -- 各校验规则的通过/失败数
+    pii_results JSONB,                -- 各字段 PII 的处理方式和个数
+    cleaning_rule_versions JSONB,     -- 应用的已保存清洗规则版本
+    cancel_requested_at TIMESTAMP,    -- 请求取消的时间
+    cancel_requested_by VARCHAR(255), -- 请求取消的用户
+    attempts JSONB,                   -- 每次尝试的起止时间、错误及错误分类
     created_at TIMESTAMP DEFAULT NOW()
 );
 
@@ -75,6 +130,109 @@ CREATE INDEX idx_task_executions_task_id ON task_executions(task_id);
 CREATE INDEX idx_task_executions_status ON task_executions(status);
 CREATE INDEX idx_task_executions_start_time ON task_executions(start_time DESC);
 
+-- 4.1 任务租约表（Worker 领取任务后持有租约并定期续期，过期后任务可被其他 Worker 重新领取）
+CREATE TABLE IF NOT EXISTS task_leases (
+    task_id BIGINT PRIMARY KEY REFERENCES collection_tasks(id) ON DELETE CASCADE,
+    worker_pod VARCHAR(255) NOT NULL, -- 持有租约的Worker Pod名称
+    acquired_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    heartbeat_at TIMESTAMP NOT NULL DEFAULT NOW(),  -- 最近一次续期时间
+    expires_at TIMESTAMP NOT NULL     -- 租约过期时间
+);
+
+CREATE INDEX idx_task_leases_expires ON task_leases(expires_at);
+CREATE INDEX idx_task_leases_worker ON task_leases(worker_pod);
+
+-- 4.2 工作流表（由任务节点和依赖边组成的有向无环图）
+CREATE TABLE IF NOT EXISTS workflows (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT,
+    cron VARCHAR(100),                -- Cron表达式，为空时只能手动触发
+    next_run_time TIMESTAMP,          -- 下次执行时间
+    status VARCHAR(50) DEFAULT 'enabled',  -- enabled, disabled
+    definition JSONB NOT NULL,        -- 节点和依赖边
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_workflows_next_run_time ON workflows(next_run_time);
+
+-- 4.3 工作流运行记录表
+CREATE TABLE IF NOT EXISTS workflow_runs (
+    id BIGSERIAL PRIMARY KEY,
+    workflow_id BIGINT REFERENCES workflows(id) ON DELETE CASCADE,
+    status VARCHAR(50) NOT NULL,      -- running, success, failed
+    trigger VARCHAR(50) NOT NULL,     -- cron, manual
+    definition JSONB NOT NULL,        -- 运行开始时的工作流定义
+    start_time TIMESTAMP DEFAULT NOW(),
+    end_time TIMESTAMP
+);
+
+CREATE INDEX idx_workflow_runs_workflow ON workflow_runs(workflow_id, start_time DESC);
+
+-- 4.4 工作流节点运行状态表
+CREATE TABLE IF NOT EXISTS workflow_run_nodes (
+    id BIGSERIAL PRIMARY KEY,
+    run_id BIGINT REFERENCES workflow_runs(id) ON DELETE CASCADE,
+    node VARCHAR(255) NOT NULL,       -- 节点名称
+    task_id BIGINT REFERENCES collection_tasks(id) ON DELETE CASCADE,
+    status VARCHAR(50) NOT NULL,      -- pending, queued, running, success, failed, skipped
+    execution_id BIGINT REFERENCES task_executions(id) ON DELETE SET NULL,
+    worker_pod VARCHAR(255),          -- 执行的Worker Pod名称
+    output_records INT DEFAULT 0,     -- 传给下游的记录数
+    error TEXT,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    UNIQUE(run_id, node)
+);
+
+CREATE INDEX idx_workflow_run_nodes_status ON workflow_run_nodes(status);
+
+-- 4.5 工作流节点输出表（传给下游节点的数据）
+CREATE TABLE IF NOT EXISTS workflow_node_outputs (
+    run_node_id BIGINT PRIMARY KEY REFERENCES workflow_run_nodes(id) ON DELETE CASCADE,
+    records JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+-- 4.6 补数表（按时间窗口重新采集一段时间范围的数据）
+CREATE TABLE IF NOT EXISTS backfills (
+    id BIGSERIAL PRIMARY KEY,
+    task_id BIGINT REFERENCES collection_tasks(id) ON DELETE CASCADE,
+    start_time TIMESTAMP NOT NULL,    -- 时间范围（UTC）
+    end_time TIMESTAMP NOT NULL,
+    interval_seconds INT NOT NULL,    -- 窗口长度
+    concurrency INT NOT NULL DEFAULT 1,  -- 同时执行的窗口数上限
+    status VARCHAR(50) NOT NULL,      -- running, success, failed, cancelled
+    created_by VARCHAR(255),
+    cancelled_by VARCHAR(255),
+    created_at TIMESTAMP DEFAULT NOW(),
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX idx_backfills_task ON backfills(task_id, created_at DESC);
+CREATE INDEX idx_backfills_status ON backfills(status);
+
+-- 4.7 补数窗口表（每个窗口执行一次任务，执行期间持有窗口租约）
+CREATE TABLE IF NOT EXISTS backfill_windows (
+    id BIGSERIAL PRIMARY KEY,
+    backfill_id BIGINT REFERENCES backfills(id) ON DELETE CASCADE,
+    window_start TIMESTAMP NOT NULL,
+    window_end TIMESTAMP NOT NULL,
+    status VARCHAR(50) NOT NULL,      -- pending, running, success, failed, cancelled
+    execution_id BIGINT REFERENCES task_executions(id) ON DELETE SET NULL,
+    worker_pod VARCHAR(255),          -- 执行的Worker Pod名称
+    lease_expires_at TIMESTAMP,       -- 窗口租约过期时间
+    records_collected INT DEFAULT 0,
+    error TEXT,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    UNIQUE(backfill_id, window_start)
+);
+
+CREATE INDEX idx_backfill_windows_status ON backfill_windows(status);
+CREATE INDEX idx_backfill_windows_execution ON backfill_windows(execution_id);
+
 -- 5. 任务-清洗规则关联表
 CREATE TABLE IF NOT EXISTS task_cleaning_rules (
     id BIGSERIAL PRIMARY KEY,
@@ -89,6 +247,77 @@ CREATE TABLE IF NOT EXISTS task_cleaning_rules (
 CREATE INDEX idx_task_cleaning_rules_task ON task_cleaning_rules(task_id);
 CREATE INDEX idx_task_cleaning_rules_rule ON task_cleaning_rules(cleaning_rule_id);
 
+-- 5.1 死信记录表（处理或存储失败的单条记录）
+CREATE TABLE IF NOT EXISTS dead_letter_records (
+    id BIGSERIAL PRIMARY KEY,
+    task_id BIGINT REFERENCES collection_tasks(id) ON DELETE CASCADE,
+    execution_id BIGINT REFERENCES task_executions(id) ON DELETE SET NULL,
+    stage VARCHAR(50) NOT NULL,       -- clean, transform, validate, script, enrich, storage
+    stage_name VARCHAR(255),          -- 拒绝记录的处理阶段名称，重放时从该阶段开始
+    stage_index INT,                  -- 拒绝记录的处理阶段在流水线中的下标
+    rule VARCHAR(255),                -- 失败的清洗规则
+    target VARCHAR(255),              -- 失败的存储目标
+    error TEXT,                       -- 错误信息
+    record JSONB NOT NULL,            -- 原始记录（任务配置了 PII 处理时为脱敏后的记录）
+    status VARCHAR(50) DEFAULT 'pending',  -- pending, replay_requested, replaying, replayed, discarded
+    replay_count INT DEFAULT 0,       -- 重放次数
+    pii_protected BOOLEAN DEFAULT FALSE,  -- 记录是否已按 PII 策略脱敏，重放时跳过 PII 阶段
+    worker_pod VARCHAR(255),          -- 正在重放的 Worker（status 为 replaying 时）
+    lease_expires_at TIMESTAMP,       -- 重放租约过期时间，过期后由其他 Worker 回收
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    replayed_at TIMESTAMP
+);
+
+CREATE INDEX idx_dead_letter_records_task ON dead_letter_records(task_id);
+CREATE INDEX idx_dead_letter_records_execution ON dead_letter_records(execution_id);
+CREATE INDEX idx_dead_letter_records_status ON dead_letter_records(status);
+
+-- 5.2 去重键表（持久化去重状态，多个 Worker 共享）
+CREATE TABLE IF NOT EXISTS dedup_keys (
+    scope VARCHAR(255) NOT NULL,      -- 去重范围，如 task:1
+    key VARCHAR(64) NOT NULL,         -- 记录的去重键（哈希）
+    expires_at TIMESTAMP,             -- 过期时间，NULL 表示永久保留
+    created_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX idx_dedup_keys_expires ON dedup_keys(expires_at) WHERE expires_at IS NOT NULL;
+
+-- 5.3 近似去重指纹表（SimHash 指纹按分段索引，每个分段一行）
+CREATE TABLE IF NOT EXISTS dedup_fingerprints (
+    scope VARCHAR(255) NOT NULL,      -- 去重范围，如 task:1
+    band VARCHAR(64) NOT NULL,        -- 指纹分段，汉明距离不超过阈值的指纹至少有一段相同
+    fingerprint BIGINT NOT NULL,      -- 64 位 SimHash 指纹
+    record_id TEXT,                   -- 指纹对应的记录 ID
+    expires_at TIMESTAMP,             -- 过期时间，NULL 表示永久保留
+    created_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (scope, band, fingerprint)
+);
+
+CREATE INDEX idx_dedup_fingerprints_expires ON dedup_fingerprints(expires_at) WHERE expires_at IS NOT NULL;
+
+-- 5.4 PII 令牌库（原值加密保存，有 pii:detokenize 权限的用户可以通过 API 还原）
+CREATE TABLE IF NOT EXISTS pii_vault (
+    token VARCHAR(64) PRIMARY KEY,
+    pii_type VARCHAR(20) NOT NULL,        -- phone, id_card, email, bank_card
+    value_hash VARCHAR(64) NOT NULL UNIQUE, -- HMAC(类型:原值)，相同的值复用同一个令牌
+    ciphertext TEXT NOT NULL,             -- AES-256-GCM 加密的原值
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+-- 5.5 令牌还原审计记录
+CREATE TABLE IF NOT EXISTS pii_vault_access (
+    id SERIAL PRIMARY KEY,
+    user_id BIGINT,
+    username VARCHAR(100),
+    tokens TEXT[] NOT NULL,
+    reason TEXT,                          -- 还原原因
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_pii_vault_access_created ON pii_vault_access(created_at);
+
 -- 6. 用户表
 CREATE TABLE IF NOT EXISTS users (
     id BIGSERIAL PRIMARY KEY,
@@ -182,5 +411,50 @@ CREATE TRIGGER update_users_updated_at BEFORE UPDATE ON users
 CREATE TRIGGER update_system_configs_updated_at BEFORE UPDATE ON system_configs
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
+CREATE TRIGGER update_dead_letter_records_updated_at BEFORE UPDATE ON dead_letter_records
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER update_workflows_updated_at BEFORE UPDATE ON workflows
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER update_task_queues_updated_at BEFORE UPDATE ON task_queues
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER update_calendars_updated_at BEFORE UPDATE ON calendars
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- 升级已有数据库（新增字段）
+ALTER TABLE task_executions ADD COLUMN IF NOT EXISTS storage_results JSONB;
+ALTER TABLE task_executions ADD COLUMN IF NOT EXISTS records_rejected INT DEFAULT 0;
+ALTER TABLE task_executions ADD COLUMN IF NOT EXISTS validation_results JSONB;
+ALTER TABLE task_executions ADD COLUMN IF NOT EXISTS cleaning_rule_versions JSONB;
+ALTER TABLE task_executions ADD COLUMN IF NOT EXISTS pii_results JSONB;
+ALTER TABLE task_executions ADD COLUMN IF NOT EXISTS cancel_requested_at TIMESTAMP;
+ALTER TABLE task_executions ADD COLUMN IF NOT EXISTS cancel_requested_by VARCHAR(255);
+ALTER TABLE cleaning_rules ADD COLUMN IF NOT EXISTS version INT DEFAULT 1;
+ALTER TABLE collection_tasks ADD COLUMN IF NOT EXISTS queue VARCHAR(100) DEFAULT 'default';
+ALTER TABLE collection_tasks ADD COLUMN IF NOT EXISTS priority INT DEFAULT 0;
+ALTER TABLE collection_tasks ADD COLUMN IF NOT EXISTS tenant VARCHAR(100) DEFAULT 'default';
+ALTER TABLE collection_tasks ADD COLUMN IF NOT EXISTS selector JSONB;
+ALTER TABLE collection_tasks ADD COLUMN IF NOT EXISTS timezone VARCHAR(64);
+ALTER TABLE collection_tasks ADD COLUMN IF NOT EXISTS catch_up VARCHAR(20) DEFAULT 'once';
+ALTER TABLE collection_tasks ADD COLUMN IF NOT EXISTS jitter_seconds INT DEFAULT 0;
+ALTER TABLE collection_tasks ADD COLUMN IF NOT EXISTS calendar VARCHAR(100);
+ALTER TABLE collection_tasks ADD COLUMN IF NOT EXISTS retry_policy JSONB;
+ALTER TABLE task_executions ADD COLUMN IF NOT EXISTS attempts JSONB;
+ALTER TABLE dead_letter_records ADD COLUMN IF NOT EXISTS pii_protected BOOLEAN DEFAULT FALSE;
+ALTER TABLE dead_letter_records ADD COLUMN IF NOT EXISTS worker_pod VARCHAR(255);
+ALTER TABLE dead_letter_records ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMP;
+ALTER TABLE dead_letter_records ADD COLUMN IF NOT EXISTS stage_name VARCHAR(255);
+ALTER TABLE dead_letter_records ADD COLUMN IF NOT EXISTS stage_index INT;
+-- 旧版本按 Worker 本地时间写入 next_run_time，转换时按数据库会话时区解释，
+-- Worker 与数据库时区不同时先 SET TIME ZONE 为 Worker 的时区再执行
+ALTER TABLE collection_tasks ALTER COLUMN next_run_time TYPE TIMESTAMPTZ;
+
+-- 为没有版本记录的清洗规则补充当前版本
+INSERT INTO cleaning_rule_versions (rule_id, version, name, description, rule_type, config)
+SELECT id, COALESCE(version, 1), name, description, rule_type, config FROM cleaning_rules
+ON CONFLICT (rule_id, version) DO NOTHING;
+
 -- 完成
 SELECT 'DataFusion Control Database initialized successfully!' as message;
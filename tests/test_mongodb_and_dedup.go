@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/datafusion/worker/internal/models"
 	"github.com/datafusion/worker/internal/processor"
 	"github.com/datafusion/worker/internal/storage/mongodb"
 )
@@ -66,7 +67,12 @@ func testMongoDBStorage() {
 
 	// 存储数据
 	ctx := context.Background()
-	err = storage.Store(ctx, testData)
+	storageConfig := &models.StorageConfig{
+		Target: "mongodb",
+		Table:  "test_data",
+		Keys:   []string{"id"},
+	}
+	err = storage.Store(ctx, storageConfig, testData)
 	if err != nil {
 		fmt.Printf("❌ 存储数据失败: %v\n", err)
 	} else {
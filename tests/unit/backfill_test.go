@@ -0,0 +1,174 @@
+package unit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/datafusion/worker/internal/database"
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/schedule"
+)
+
+func TestSplitWindows(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(50 * time.Hour)
+
+	windows := schedule.SplitWindows(start, end, 24*time.Hour)
+	if len(windows) != 3 {
+		t.Fatalf("窗口数 = %d, 期望 3", len(windows))
+	}
+	if !windows[1].Start.Equal(start.Add(24*time.Hour)) || !windows[1].End.Equal(start.Add(48*time.Hour)) {
+		t.Errorf("第 2 个窗口 = %v ~ %v", windows[1].Start, windows[1].End)
+	}
+	// 最后一个窗口截止到 end
+	if !windows[2].End.Equal(end) {
+		t.Errorf("最后一个窗口截止时间 = %v, 期望 %v", windows[2].End, end)
+	}
+
+	if got := schedule.SplitWindows(end, start, time.Hour); got != nil {
+		t.Errorf("start 晚于 end 时应返回空, 得到 %v", got)
+	}
+	if got := schedule.SplitWindows(start, end, 0); got != nil {
+		t.Errorf("interval 为 0 时应返回空, 得到 %v", got)
+	}
+}
+
+func TestCountWindows(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		end      time.Time
+		interval time.Duration
+	}{
+		{start.Add(72 * time.Hour), 24 * time.Hour},
+		{start.Add(73 * time.Hour), 24 * time.Hour},
+		{start.Add(time.Minute), time.Hour},
+		{start, time.Hour},
+		{start.Add(time.Hour), 0},
+	}
+	for _, c := range cases {
+		want := int64(len(schedule.SplitWindows(start, c.end, c.interval)))
+		if got := schedule.CountWindows(start, c.end, c.interval); got != want {
+			t.Errorf("CountWindows(%v, %v) = %d, 期望 %d", c.end.Sub(start), c.interval, got, want)
+		}
+	}
+
+	// 跨度很大时直接计算，不生成窗口
+	end := start.AddDate(100, 0, 0)
+	if got := schedule.CountWindows(start, end, time.Minute); got != int64(end.Sub(start)/time.Minute) {
+		t.Errorf("100 年按分钟切分的窗口数 = %d", got)
+	}
+}
+
+func TestCronWindow(t *testing.T) {
+	end := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+
+	w, err := schedule.CronWindow("0 * * * *", end)
+	if err != nil {
+		t.Fatalf("计算时间窗口失败: %v", err)
+	}
+	if !w.Start.Equal(end.Add(-time.Hour)) || !w.End.Equal(end) {
+		t.Errorf("每小时执行的窗口 = %v ~ %v", w.Start, w.End)
+	}
+
+	// 工作日 9 点执行：周一的窗口从上周五 9 点开始，周二的窗口从周一 9 点开始
+	monday := time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC)
+	w, err = schedule.CronWindow("0 9 * * 1-5", monday)
+	if err != nil {
+		t.Fatalf("计算时间窗口失败: %v", err)
+	}
+	if friday := time.Date(2024, 1, 5, 9, 0, 0, 0, time.UTC); !w.Start.Equal(friday) || !w.End.Equal(monday) {
+		t.Errorf("周一的窗口 = %v ~ %v，期望从 %v 开始", w.Start, w.End, friday)
+	}
+	w, _ = schedule.CronWindow("0 9 * * 1-5", monday.AddDate(0, 0, 1))
+	if !w.Start.Equal(monday) {
+		t.Errorf("周二的窗口从 %v 开始，期望 %v", w.Start, monday)
+	}
+
+	// 不在计划时间执行时（如手动触发）从上一次计划时间开始
+	w, _ = schedule.CronWindow("0 0 1 * *", time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC))
+	if !w.Start.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("每月执行的窗口从 %v 开始，期望 2024-03-01", w.Start)
+	}
+
+	w, err = schedule.CronWindow("", end)
+	if err != nil {
+		t.Fatalf("计算时间窗口失败: %v", err)
+	}
+	if w.End.Sub(w.Start) != schedule.DefaultWindow {
+		t.Errorf("没有 Cron 时窗口长度 = %v, 期望 %v", w.End.Sub(w.Start), schedule.DefaultWindow)
+	}
+
+	if _, err := schedule.CronWindow("invalid", end); err == nil {
+		t.Error("无效的 Cron 表达式应返回错误")
+	}
+}
+
+func TestRenderWindow(t *testing.T) {
+	w := schedule.Window{
+		Start: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+
+	got, err := schedule.RenderWindow(`https://api.example.com/orders?from={{.WindowStart}}&day={{ .WindowStart.Format "2006-01-02" }}&to={{.WindowEnd.Unix}}&id={{id}}`, w)
+	if err != nil {
+		t.Fatalf("渲染失败: %v", err)
+	}
+	want := "https://api.example.com/orders?from=2024-01-01T00:00:00Z&day=2024-01-01&to=1704153600&id={{id}}"
+	if got != want {
+		t.Errorf("RenderWindow = %s, 期望 %s", got, want)
+	}
+
+	if !schedule.HasWindowParams("SELECT * FROM t WHERE ts >= '{{.WindowStart}}'") {
+		t.Error("应识别出时间窗口参数")
+	}
+	if schedule.HasWindowParams("{{id}}") {
+		t.Error("上游字段占位符不是时间窗口参数")
+	}
+
+	if _, err := schedule.RenderWindow("{{.Foo}}", w); err == nil {
+		t.Error("未知参数应返回错误")
+	}
+}
+
+func TestCancelBackfillBeforeExecution(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	taskID := createTestTask(t, db, "补数取消", `{}`)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	backfill := &models.Backfill{TaskID: taskID, StartTime: start, EndTime: start.Add(48 * time.Hour),
+		IntervalSeconds: 86400, Concurrency: 1, CreatedBy: "admin"}
+	if err := db.CreateBackfill(ctx, backfill, schedule.SplitWindows(backfill.StartTime, backfill.EndTime, 24*time.Hour)); err != nil {
+		t.Fatalf("创建补数失败: %v", err)
+	}
+	claimed, err := db.ClaimBackfillWindows(ctx, database.ClaimFilter{WorkerType: "all", WorkerPod: "worker-a"}, 1, time.Minute)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("领取补数窗口失败: %v, %v", claimed, err)
+	}
+
+	// 领取后、记录执行 ID 前取消：取消时找不到执行，Worker 记录执行 ID 时得知补数已取消
+	ok, executionIDs, err := db.CancelBackfill(ctx, backfill.ID, "admin")
+	if err != nil || !ok || len(executionIDs) != 0 {
+		t.Fatalf("取消补数结果 = %v, %v, %v", ok, executionIDs, err)
+	}
+	executionID, err := db.CreateExecution(taskID, "worker-a")
+	if err != nil {
+		t.Fatalf("创建执行记录失败: %v", err)
+	}
+	cancelled, err := db.SetBackfillWindowExecution(ctx, claimed[0].Window.ID, executionID)
+	if err != nil || !cancelled {
+		t.Errorf("补数已取消时应返回 cancelled: %v, %v", cancelled, err)
+	}
+
+	// 窗口结束后补数为 cancelled
+	if ok, err := db.FinishBackfillWindow(ctx, claimed[0].Window.ID, "worker-a", models.BackfillWindowCancelled, executionID, 0, "执行已取消"); err != nil || !ok {
+		t.Fatalf("结束补数窗口失败: %v, %v", ok, err)
+	}
+	var status string
+	var finished bool
+	db.QueryRow("SELECT status, finished_at IS NOT NULL FROM backfills WHERE id = $1", backfill.ID).Scan(&status, &finished)
+	if status != models.BackfillCancelled || !finished {
+		t.Errorf("补数状态 = %s (结束: %v)，期望 cancelled", status, finished)
+	}
+}
@@ -0,0 +1,114 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/datafusion/worker/internal/schedule"
+)
+
+func TestSpecTimezone(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skipf("缺少时区数据: %v", err)
+	}
+	spec := schedule.Spec{Cron: "0 9 * * *", Location: shanghai}
+
+	// UTC 2024-01-01 02:00 为上海 10:00，下次执行为上海次日 09:00
+	next, err := spec.Next(time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("计算下次执行时间失败: %v", err)
+	}
+	want := time.Date(2024, 1, 2, 1, 0, 0, 0, time.UTC)
+	if !next.Equal(want) {
+		t.Errorf("Next = %v, 期望 %v", next.UTC(), want)
+	}
+}
+
+func TestSpecCalendar(t *testing.T) {
+	// 2024-10-01 ~ 2024-10-07 国庆假期，2024-10-12（周六）调休上班
+	cal, err := schedule.NewCalendar(nil, []string{"2024-10-01", "2024-10-02", "2024-10-03", "2024-10-04", "2024-10-07"},
+		[]string{"2024-10-12"})
+	if err != nil {
+		t.Fatalf("创建日历失败: %v", err)
+	}
+	spec := schedule.Spec{Cron: "0 9 * * *", Location: time.UTC, Calendar: cal}
+
+	next, err := spec.Next(time.Date(2024, 9, 30, 10, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("计算下次执行时间失败: %v", err)
+	}
+	if want := time.Date(2024, 10, 8, 9, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("假期后的下次执行 = %v, 期望 %v", next, want)
+	}
+
+	next, err = spec.Next(time.Date(2024, 10, 11, 10, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("计算下次执行时间失败: %v", err)
+	}
+	if want := time.Date(2024, 10, 12, 9, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("调休日的执行 = %v, 期望 %v", next, want)
+	}
+
+	if _, err := schedule.NewCalendar([]int64{7}, nil, nil); err == nil {
+		t.Error("无效的星期应返回错误")
+	}
+	if _, err := schedule.NewCalendar(nil, []string{"2024/10/01"}, nil); err == nil {
+		t.Error("无效的日期应返回错误")
+	}
+
+	// 没有任何工作日的日历找不到下次执行时间
+	empty, _ := schedule.NewCalendar([]int64{0}, nil, nil)
+	never := schedule.Spec{Cron: "0 9 * * 1", Location: time.UTC, Calendar: empty}
+	if _, err := never.Next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Error("日历中没有可执行的日期时应返回错误")
+	}
+}
+
+func TestSpecCatchUp(t *testing.T) {
+	scheduled := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := scheduled.Add(3*time.Hour + 30*time.Minute)
+	spec := schedule.Spec{Cron: "0 * * * *", Location: time.UTC}
+
+	missed, err := spec.Missed(scheduled, now)
+	if err != nil || !missed {
+		t.Errorf("停机 3 小时后应判断为错过: %v, %v", missed, err)
+	}
+	if missed, _ := spec.Missed(scheduled, scheduled.Add(5*time.Minute)); missed {
+		t.Error("延迟不到一个周期不应判断为错过")
+	}
+
+	// once、skip 从当前时间起算
+	spec.CatchUp = schedule.CatchUpOnce
+	next, _ := spec.After(&scheduled, now)
+	if want := time.Date(2024, 1, 1, 4, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("once: After = %v, 期望 %v", next, want)
+	}
+
+	// all 从计划时间起算，逐个补执行
+	spec.CatchUp = schedule.CatchUpAll
+	next, _ = spec.After(&scheduled, now)
+	if want := scheduled.Add(time.Hour); !next.Equal(want) {
+		t.Errorf("all: After = %v, 期望 %v", next, want)
+	}
+
+	if !schedule.ValidCatchUp("") || schedule.ValidCatchUp("later") {
+		t.Error("ValidCatchUp 结果错误")
+	}
+}
+
+func TestSpecJitter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC)
+	spec := schedule.Spec{Cron: "0 * * * *", Location: time.UTC, Jitter: 10 * time.Minute}
+	base := time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 50; i++ {
+		next, err := spec.After(nil, now)
+		if err != nil {
+			t.Fatalf("计算下次执行时间失败: %v", err)
+		}
+		if next.Before(base) || !next.Before(base.Add(spec.Jitter)) {
+			t.Fatalf("抖动后的执行时间 %v 不在 [%v, %v) 内", next, base, base.Add(spec.Jitter))
+		}
+	}
+}
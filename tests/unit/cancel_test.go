@@ -0,0 +1,184 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/datafusion/worker/internal/api"
+	"github.com/datafusion/worker/internal/database"
+	"github.com/datafusion/worker/internal/logger"
+	"github.com/datafusion/worker/internal/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func newExecutionRouter(db *database.PostgresDB) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	handler := api.NewExecutionHandler(db.DB, &logger.Logger{Logger: zap.NewNop()})
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("username", "admin")
+	})
+	router.GET("/executions/:id", handler.Get)
+	router.POST("/executions/:id/cancel", handler.Cancel)
+	return router
+}
+
+// startLeasedExecution 领取任务并创建执行记录，模拟 workerPod 正在执行任务
+func startLeasedExecution(t *testing.T, db *database.PostgresDB, name, workerPod string) (taskID, executionID int64) {
+	t.Helper()
+	taskID = createTestTask(t, db, name, `{}`)
+	claimed, err := db.ClaimTasks(context.Background(), database.ClaimFilter{WorkerType: "all", WorkerPod: workerPod}, 1, time.Minute)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("领取任务失败: %v, %v", claimed, err)
+	}
+	executionID, err = db.CreateExecution(taskID, workerPod)
+	if err != nil {
+		t.Fatalf("创建执行记录失败: %v", err)
+	}
+	return taskID, executionID
+}
+
+func executionStatus(t *testing.T, db *database.PostgresDB, id int64) string {
+	t.Helper()
+	var status string
+	if err := db.QueryRow("SELECT status FROM task_executions WHERE id = $1", id).Scan(&status); err != nil {
+		t.Fatalf("查询执行状态失败: %v", err)
+	}
+	return status
+}
+
+func TestCancelExecution(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	_, executionID := startLeasedExecution(t, db, "取消执行", "worker-a")
+	router := newExecutionRouter(db)
+
+	// Worker 持有租约时标记为 cancelling，等待 Worker 停止
+	resp := serveJSON(router, http.MethodPost, fmt.Sprintf("/executions/%d/cancel", executionID), "")
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("取消执行返回 %d: %s", resp.Code, resp.Body.String())
+	}
+	var result struct {
+		Status string `json:"status"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &result)
+	if result.Status != models.ExecutionStatusCancelling {
+		t.Errorf("取消后状态 = %s, 期望 cancelling", result.Status)
+	}
+
+	resp = serveJSON(router, http.MethodGet, fmt.Sprintf("/executions/%d", executionID), "")
+	var execution api.Execution
+	json.Unmarshal(resp.Body.Bytes(), &execution)
+	if execution.Status != models.ExecutionStatusCancelling || execution.CancelRequestedAt == nil ||
+		execution.CancelRequestedBy == nil || *execution.CancelRequestedBy != "admin" {
+		t.Errorf("执行记录 = %+v", execution)
+	}
+
+	// 心跳兜底：只返回本 Worker 上待取消的执行
+	ids, err := db.CancellingExecutions(ctx, "worker-a")
+	if err != nil || len(ids) != 1 || ids[0] != executionID {
+		t.Errorf("worker-a 待取消的执行 = %v, %v", ids, err)
+	}
+	if ids, err := db.CancellingExecutions(ctx, "worker-b"); err != nil || len(ids) != 0 {
+		t.Errorf("worker-b 待取消的执行 = %v, %v", ids, err)
+	}
+
+	// Worker 停止执行后记录为 cancelled，不再出现在待取消列表中，也不能再次取消
+	if err := db.UpdateExecutionStatus(executionID, models.ExecutionStatusCancelled, 5, "执行已取消"); err != nil {
+		t.Fatalf("更新执行状态失败: %v", err)
+	}
+	if status := executionStatus(t, db, executionID); status != models.ExecutionStatusCancelled {
+		t.Errorf("执行状态 = %s, 期望 cancelled", status)
+	}
+	if ids, err := db.CancellingExecutions(ctx, "worker-a"); err != nil || len(ids) != 0 {
+		t.Errorf("已取消的执行仍待取消: %v, %v", ids, err)
+	}
+	resp = serveJSON(router, http.MethodPost, fmt.Sprintf("/executions/%d/cancel", executionID), "")
+	if resp.Code != http.StatusConflict {
+		t.Errorf("取消已结束的执行返回 %d, 期望 409", resp.Code)
+	}
+}
+
+func TestCancelExecutionWithoutLease(t *testing.T) {
+	db := openTestDB(t)
+	taskID, executionID := startLeasedExecution(t, db, "取消无租约执行", "worker-a")
+	if err := db.ReleaseTaskLease(context.Background(), taskID, "worker-a"); err != nil {
+		t.Fatalf("释放租约失败: %v", err)
+	}
+
+	// Worker 已不在运行时直接记录为 cancelled
+	resp := serveJSON(newExecutionRouter(db), http.MethodPost, fmt.Sprintf("/executions/%d/cancel", executionID), "")
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("取消执行返回 %d: %s", resp.Code, resp.Body.String())
+	}
+	if status := executionStatus(t, db, executionID); status != models.ExecutionStatusCancelled {
+		t.Errorf("执行状态 = %s, 期望 cancelled", status)
+	}
+}
+
+func TestRecoverCancellingExecution(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	taskID, executionID := startLeasedExecution(t, db, "回收取消中执行", "worker-a")
+	if resp := serveJSON(newExecutionRouter(db), http.MethodPost, fmt.Sprintf("/executions/%d/cancel", executionID), ""); resp.Code != http.StatusAccepted {
+		t.Fatalf("取消执行返回 %d", resp.Code)
+	}
+
+	// Worker 在停止执行前失联，租约过期后执行记录为 failed
+	if _, err := db.Exec("UPDATE task_leases SET expires_at = NOW() - INTERVAL '1 second' WHERE task_id = $1", taskID); err != nil {
+		t.Fatalf("设置租约过期失败: %v", err)
+	}
+	if _, executions, err := db.RecoverExpiredLeases(ctx); err != nil || executions != 1 {
+		t.Fatalf("回收结果 = %d, %v", executions, err)
+	}
+	if status := executionStatus(t, db, executionID); status != models.ExecutionStatusFailed {
+		t.Errorf("执行状态 = %s, 期望 failed", status)
+	}
+}
+
+func TestListenExecutionCancels(t *testing.T) {
+	db := openTestDB(t)
+	cfg := testDatabaseConfig(t)
+	_, executionID := startLeasedExecution(t, db, "取消通知", "worker-a")
+	router := newExecutionRouter(db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	notices := make(chan models.ExecutionCancelNotice, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- database.ListenExecutionCancels(ctx, cfg, func(notice models.ExecutionCancelNotice) {
+			notices <- notice
+		})
+	}()
+
+	// 监听建立前发出的通知会丢失，重复请求取消直到收到通知（cancelling 状态可以再次通知）
+	deadline := time.After(10 * time.Second)
+	for received := false; !received; {
+		if resp := serveJSON(router, http.MethodPost, fmt.Sprintf("/executions/%d/cancel", executionID), ""); resp.Code != http.StatusAccepted {
+			t.Fatalf("取消执行返回 %d: %s", resp.Code, resp.Body.String())
+		}
+		select {
+		case notice := <-notices:
+			if notice.ExecutionID != executionID || notice.WorkerPod != "worker-a" {
+				t.Errorf("取消通知 = %+v", notice)
+			}
+			received = true
+		case err := <-done:
+			t.Fatalf("监听取消通知失败: %v", err)
+		case <-time.After(200 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("未收到取消通知")
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("监听结束返回错误: %v", err)
+	}
+}
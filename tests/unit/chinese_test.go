@@ -0,0 +1,125 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/processor"
+)
+
+func TestChineseCleaning(t *testing.T) {
+	clean := func(t *testing.T, rules []models.CleaningRule, record map[string]interface{}) map[string]interface{} {
+		t.Helper()
+		result, err := processor.NewEnhancedCleaner(rules).Clean([]map[string]interface{}{record})
+		if err != nil {
+			t.Fatalf("清洗失败: %v", err)
+		}
+		return result[0]
+	}
+
+	t.Run("全角半角转换", func(t *testing.T) {
+		result := clean(t, []models.CleaningRule{
+			{Field: "title", Type: "to_halfwidth"},
+			{Field: "code", Type: "to_fullwidth"},
+		}, map[string]interface{}{"title": "ｉＰｈｏｎｅ　１５，售价：５９９９元！", "code": "A1 "})
+
+		if result["title"] != "iPhone 15,售价:5999元!" {
+			t.Errorf("全角转半角失败: %v", result["title"])
+		}
+		if result["code"] != "Ａ１　" {
+			t.Errorf("半角转全角失败: %v", result["code"])
+		}
+	})
+
+	t.Run("全角空格规范化", func(t *testing.T) {
+		result := clean(t, []models.CleaningRule{
+			{Field: "title", Type: "normalize_whitespace"},
+		}, map[string]interface{}{"title": "　新品　　上市 \t 促销　"})
+
+		if result["title"] != "新品 上市 促销" {
+			t.Errorf("空白规范化失败: %q", result["title"])
+		}
+	})
+
+	t.Run("简繁转换", func(t *testing.T) {
+		result := clean(t, []models.CleaningRule{
+			{Field: "t", Type: "t2s"},
+			{Field: "s", Type: "s2t"},
+			{Field: "tw", Type: "s2t", Pattern: "s2tw"},
+		}, map[string]interface{}{"t": "網絡數據採集與處理", "s": "头发理发", "tw": "软件"})
+
+		if result["t"] != "网络数据采集与处理" {
+			t.Errorf("繁转简失败: %v", result["t"])
+		}
+		if result["s"] != "頭髮理髮" {
+			t.Errorf("简转繁失败: %v", result["s"])
+		}
+		if result["tw"] == "软件" {
+			t.Errorf("台湾正体转换失败: %v", result["tw"])
+		}
+
+		_, rejected := processor.NewEnhancedCleaner([]models.CleaningRule{
+			{Field: "t", Type: "t2s", Pattern: "unknown"},
+		}).CleanEach([]map[string]interface{}{{"t": "數據"}})
+		if len(rejected) != 1 {
+			t.Error("不支持的转换应拒绝记录")
+		}
+	})
+
+	t.Run("拼音", func(t *testing.T) {
+		result := clean(t, []models.CleaningRule{
+			{Field: "name", Type: "pinyin", TargetField: "name_pinyin"},
+			{Field: "name", Type: "pinyin", Pattern: "tone", TargetField: "name_tone"},
+			{Field: "name", Type: "pinyin", Pattern: "initials", TargetField: "name_initials"},
+		}, map[string]interface{}{"name": "小米Mate 60手机"})
+
+		if result["name"] != "小米Mate 60手机" {
+			t.Errorf("配置 target_field 时不应修改原字段: %v", result["name"])
+		}
+		if result["name_pinyin"] != "xiao mi Mate 60 shou ji" {
+			t.Errorf("拼音生成失败: %v", result["name_pinyin"])
+		}
+		if result["name_tone"] != "xiǎo mǐ Mate 60 shǒu jī" {
+			t.Errorf("带声调拼音生成失败: %v", result["name_tone"])
+		}
+		if result["name_initials"] != "x m Mate 60 s j" {
+			t.Errorf("拼音首字母生成失败: %v", result["name_initials"])
+		}
+	})
+
+	t.Run("分词与关键词", func(t *testing.T) {
+		text := "北京市发布了新能源汽车补贴政策，新能源汽车销量持续增长，汽车厂商纷纷推出新能源车型。"
+		result := clean(t, []models.CleaningRule{
+			{Field: "content", Type: "segment", TargetField: "words"},
+			{Field: "content", Type: "keywords", Pattern: "3", TargetField: "keywords"},
+		}, map[string]interface{}{"content": text})
+
+		words, ok := result["words"].([]interface{})
+		if !ok || len(words) == 0 {
+			t.Fatalf("分词结果错误: %v", result["words"])
+		}
+		if !containsValue(words, "新能源") || !containsValue(words, "汽车") {
+			t.Errorf("分词结果缺少预期词语: %v", words)
+		}
+		if containsValue(words, "，") || containsValue(words, "。") {
+			t.Errorf("分词结果不应包含标点: %v", words)
+		}
+
+		keywords, ok := result["keywords"].([]interface{})
+		if !ok || len(keywords) != 3 {
+			t.Fatalf("关键词结果错误: %v", result["keywords"])
+		}
+		if !containsValue(keywords, "新能源") {
+			t.Errorf("关键词应包含 新能源: %v", keywords)
+		}
+	})
+}
+
+func containsValue(values []interface{}, want interface{}) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
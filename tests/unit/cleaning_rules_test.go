@@ -0,0 +1,125 @@
+package unit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/datafusion/worker/internal/database"
+	"github.com/datafusion/worker/internal/models"
+)
+
+func TestApplyCleaningRuleConfig(t *testing.T) {
+	rule := models.CleaningRule{Name: "发布时间", Type: "date_format", Field: "published"}
+	config := `{"format": "2006-01-02", "target_field": "published_date", "locale": "zh-CN", "timezone": "Asia/Shanghai"}`
+	if err := database.ApplyCleaningRuleConfig(&rule, config); err != nil {
+		t.Fatalf("转换规则配置失败: %v", err)
+	}
+	// format 等同于 pattern
+	if rule.Pattern != "2006-01-02" || rule.TargetField != "published_date" || rule.Locale != "zh-CN" || rule.Timezone != "Asia/Shanghai" {
+		t.Errorf("转换结果 = %+v", rule)
+	}
+
+	rule = models.CleaningRule{Name: "去空格", Type: "regex"}
+	if err := database.ApplyCleaningRuleConfig(&rule, `{"pattern": "\\s+", "replacement": " ", "format": "忽略"}`); err != nil {
+		t.Fatalf("转换规则配置失败: %v", err)
+	}
+	if rule.Pattern != `\s+` || rule.Replacement != " " {
+		t.Errorf("pattern 应优先于 format: %+v", rule)
+	}
+
+	if err := database.ApplyCleaningRuleConfig(&rule, `{"pattern": 1}`); err == nil {
+		t.Error("无效的规则配置应返回错误")
+	}
+}
+
+func TestPrependCleaningRules(t *testing.T) {
+	inline := []models.CleaningRule{{Name: "inline", Field: "title", Type: "trim"}}
+	config := models.ProcessorConfig{CleaningRules: inline}
+
+	config.PrependCleaningRules(nil)
+	if len(config.CleaningRules) != 1 {
+		t.Fatalf("没有绑定规则时不应修改配置: %+v", config.CleaningRules)
+	}
+
+	bound := []models.CleaningRule{
+		{Name: "saved-1", Field: "title", Type: "remove_html", RuleID: 1, Version: 3},
+		{Name: "saved-2", Field: "price", Type: "number_format", RuleID: 2, Version: 1},
+	}
+	config.PrependCleaningRules(bound)
+	var names []string
+	for _, rule := range config.CleaningRules {
+		names = append(names, rule.Name)
+	}
+	if len(names) != 3 || names[0] != "saved-1" || names[1] != "saved-2" || names[2] != "inline" {
+		t.Errorf("规则顺序 = %v, 期望已保存规则在前", names)
+	}
+	// 不修改传入的已保存规则
+	if len(bound) != 2 || bound[1].Name != "saved-2" {
+		t.Errorf("已保存规则被修改: %+v", bound)
+	}
+
+	revisions := config.AppliedCleaningRules()
+	if len(revisions) != 2 {
+		t.Fatalf("应用的规则版本 = %+v, 期望只包含已保存规则", revisions)
+	}
+	want := models.CleaningRuleRevision{RuleID: 1, Name: "saved-1", Version: 3, Field: "title"}
+	if revisions[0] != want || revisions[1].RuleID != 2 || revisions[1].Version != 1 {
+		t.Errorf("应用的规则版本 = %+v", revisions)
+	}
+	if revisions := (&models.ProcessorConfig{CleaningRules: inline}).AppliedCleaningRules(); len(revisions) != 0 {
+		t.Errorf("配置中的规则不记录版本: %+v", revisions)
+	}
+}
+
+func TestGetTaskCleaningRules(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	taskID := createTestTask(t, db, "任务清洗规则", `{}`)
+
+	createRule := func(name, ruleType, config string, version int) int64 {
+		t.Helper()
+		var id int64
+		if err := db.QueryRow(`
+			INSERT INTO cleaning_rules (name, rule_type, config, version)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id
+		`, name, ruleType, config, version).Scan(&id); err != nil {
+			t.Fatalf("创建清洗规则失败: %v", err)
+		}
+		return id
+	}
+	dateRule := createRule("发布时间", "date_format", `{"format": "2006-01-02", "timezone": "Asia/Shanghai"}`, 4)
+	trimRule := createRule("去空格", "trim", `{}`, 1)
+
+	for _, binding := range []struct {
+		ruleID int64
+		field  string
+		order  int
+	}{
+		{dateRule, "published", 2},
+		{trimRule, "title", 1},
+		{trimRule, "", 0}, // 未指定字段的绑定被跳过
+	} {
+		if _, err := db.Exec(`
+			INSERT INTO task_cleaning_rules (task_id, cleaning_rule_id, field_name, order_index)
+			VALUES ($1, $2, NULLIF($3, ''), $4)
+		`, taskID, binding.ruleID, binding.field, binding.order); err != nil {
+			t.Fatalf("绑定清洗规则失败: %v", err)
+		}
+	}
+
+	rules, err := db.GetTaskCleaningRules(ctx, taskID)
+	if err != nil {
+		t.Fatalf("获取任务清洗规则失败: %v", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("任务清洗规则 = %+v", rules)
+	}
+	if rules[0].RuleID != trimRule || rules[0].Field != "title" || rules[0].Version != 1 {
+		t.Errorf("第一条规则 = %+v, 期望按 order_index 排序", rules[0])
+	}
+	if rules[1].RuleID != dateRule || rules[1].Field != "published" || rules[1].Version != 4 ||
+		rules[1].Pattern != "2006-01-02" || rules[1].Timezone != "Asia/Shanghai" {
+		t.Errorf("第二条规则 = %+v", rules[1])
+	}
+}
@@ -0,0 +1,303 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/datafusion/worker/internal/api"
+	"github.com/datafusion/worker/internal/database"
+	"github.com/datafusion/worker/internal/logger"
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/processor"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// deadLetterStatus 查询死信记录的状态和重放信息
+func deadLetterStatus(t *testing.T, db *database.PostgresDB, id int64) (status string, workerPod string, replayCount int, errMsg string) {
+	t.Helper()
+	if err := db.QueryRow(`
+		SELECT status, COALESCE(worker_pod, ''), replay_count, COALESCE(error, '')
+		FROM dead_letter_records WHERE id = $1
+	`, id).Scan(&status, &workerPod, &replayCount, &errMsg); err != nil {
+		t.Fatalf("查询死信记录失败: %v", err)
+	}
+	return
+}
+
+// saveTestDeadLetters 写入死信记录并请求重放，返回记录 ID
+func saveTestDeadLetters(t *testing.T, db *database.PostgresDB, taskID int64, n int) []int64 {
+	t.Helper()
+	ctx := context.Background()
+	records := make([]models.DeadLetterRecord, n)
+	for i := range records {
+		records[i] = models.DeadLetterRecord{
+			TaskID:     taskID,
+			Stage:      models.DeadLetterStageValidate,
+			StageName:  "validate",
+			StageIndex: 2,
+			Rule:       "金额非负",
+			Error:      "amount 小于 0",
+			Record:     map[string]interface{}{"amount": float64(-i - 1)},
+		}
+	}
+	if err := db.SaveDeadLetters(ctx, records); err != nil {
+		t.Fatalf("写入死信记录失败: %v", err)
+	}
+
+	var ids []int64
+	rows, err := db.Query(`UPDATE dead_letter_records SET status = $1 WHERE task_id = $2 RETURNING id`,
+		models.DeadLetterStatusReplayRequested, taskID)
+	if err != nil {
+		t.Fatalf("请求重放失败: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestDeadLetterReplayLease(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	taskID := createTestTask(t, db, "死信重放", `{}`)
+	ids := saveTestDeadLetters(t, db, taskID, 2)
+
+	claimed, err := db.ClaimReplayDeadLetters(ctx, "worker-a", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("领取重放记录失败: %v", err)
+	}
+	if len(claimed) != 2 {
+		t.Fatalf("期望领取 2 条记录，实际 %d 条", len(claimed))
+	}
+	if claimed[0].StageName != "validate" || claimed[0].StageIndex != 2 {
+		t.Errorf("领取的记录缺少拒绝阶段: %+v", claimed[0])
+	}
+	if status, pod, _, _ := deadLetterStatus(t, db, ids[0]); status != models.DeadLetterStatusReplaying || pod != "worker-a" {
+		t.Errorf("领取后状态 = %s/%s，期望 replaying/worker-a", status, pod)
+	}
+
+	// 已领取的记录不会被其他 Worker 领取，租约有效时不会被回收
+	if again, _ := db.ClaimReplayDeadLetters(ctx, "worker-b", 10, time.Minute); len(again) != 0 {
+		t.Errorf("其他 Worker 不应领取到正在重放的记录: %v", again)
+	}
+	if recovered, err := db.RecoverDeadLetterReplays(ctx); err != nil || recovered != 0 {
+		t.Errorf("租约有效时不应回收: %d, %v", recovered, err)
+	}
+
+	// 续期只对持有租约的 Worker 生效
+	renewed, err := db.RenewDeadLetterLeases(ctx, "worker-b", ids, time.Minute)
+	if err != nil || len(renewed) != 0 {
+		t.Errorf("其他 Worker 不应续期成功: %v, %v", renewed, err)
+	}
+	renewed, err = db.RenewDeadLetterLeases(ctx, "worker-a", ids, time.Minute)
+	if err != nil || !renewed[ids[0]] || !renewed[ids[1]] {
+		t.Errorf("续期失败: %v, %v", renewed, err)
+	}
+
+	// 第一条重放成功
+	if owned, err := db.FinishDeadLetterReplay(ctx, ids[0], "worker-a", nil); err != nil || !owned {
+		t.Fatalf("记录重放结果失败: %v, %v", owned, err)
+	}
+	if status, pod, count, _ := deadLetterStatus(t, db, ids[0]); status != models.DeadLetterStatusReplayed || pod != "" || count != 1 {
+		t.Errorf("重放成功后状态 = %s/%s/%d，期望 replayed//1", status, pod, count)
+	}
+
+	// Worker 在重放第二条时退出，租约过期后退回 pending
+	db.Exec(`UPDATE dead_letter_records SET lease_expires_at = NOW() - INTERVAL '1 second' WHERE id = $1`, ids[1])
+	recovered, err := db.RecoverDeadLetterReplays(ctx)
+	if err != nil || recovered != 1 {
+		t.Fatalf("回收数 = %d, %v，期望 1", recovered, err)
+	}
+	status, pod, count, errMsg := deadLetterStatus(t, db, ids[1])
+	if status != models.DeadLetterStatusPending || pod != "" || count != 1 || !strings.Contains(errMsg, "worker-a") {
+		t.Errorf("回收后状态 = %s/%s/%d/%s", status, pod, count, errMsg)
+	}
+
+	// 原 Worker 之后写入的结果不生效
+	if owned, err := db.FinishDeadLetterReplay(ctx, ids[1], "worker-a", errors.New("写入失败")); err != nil || owned {
+		t.Errorf("租约已回收时不应更新重放结果: %v, %v", owned, err)
+	}
+	if status, _, _, _ := deadLetterStatus(t, db, ids[1]); status != models.DeadLetterStatusPending {
+		t.Errorf("租约已回收的记录状态被覆盖为 %s", status)
+	}
+}
+
+func TestDeadLetterReplayFailure(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	taskID := createTestTask(t, db, "死信重放失败", `{}`)
+	ids := saveTestDeadLetters(t, db, taskID, 1)
+
+	if _, err := db.ClaimReplayDeadLetters(ctx, "worker-a", 10, time.Minute); err != nil {
+		t.Fatalf("领取重放记录失败: %v", err)
+	}
+	if owned, err := db.FinishDeadLetterReplay(ctx, ids[0], "worker-a", errors.New("amount 仍小于 0")); err != nil || !owned {
+		t.Fatalf("记录重放结果失败: %v, %v", owned, err)
+	}
+	status, pod, count, errMsg := deadLetterStatus(t, db, ids[0])
+	if status != models.DeadLetterStatusPending || pod != "" || count != 1 || errMsg != "amount 仍小于 0" {
+		t.Errorf("重放失败后状态 = %s/%s/%d/%s", status, pod, count, errMsg)
+	}
+}
+
+// newDeadLetterRouter 注册死信队列接口（不含认证）
+func newDeadLetterRouter(db *database.PostgresDB) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	handler := api.NewDeadLetterHandler(db.DB, &logger.Logger{Logger: zap.NewNop()})
+	router := gin.New()
+	router.GET("/dead-letters", handler.List)
+	router.GET("/dead-letters/:id", handler.Get)
+	router.PUT("/dead-letters/:id", handler.Update)
+	router.POST("/dead-letters/:id/replay", handler.Replay)
+	router.POST("/dead-letters/:id/discard", handler.Discard)
+	router.POST("/dead-letters/replay", handler.ReplayBatch)
+	return router
+}
+
+func serveJSON(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestDeadLetterHandler(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	taskID := createTestTask(t, db, "死信接口", `{}`)
+	if err := db.SaveDeadLetters(ctx, []models.DeadLetterRecord{
+		{TaskID: taskID, Stage: models.DeadLetterStageValidate, Error: "手机号格式错误",
+			Record: map[string]interface{}{"phone": "139****4321"}, PIIProtected: true},
+		{TaskID: taskID, Stage: models.DeadLetterStageClean, Error: "无法解析日期",
+			Record: map[string]interface{}{"date": "昨天"}},
+	}); err != nil {
+		t.Fatalf("写入死信记录失败: %v", err)
+	}
+	router := newDeadLetterRouter(db)
+
+	resp := serveJSON(router, http.MethodGet, fmt.Sprintf("/dead-letters?task_id=%d&stage=validate", taskID), "")
+	var list struct {
+		Items      []api.DeadLetter `json:"items"`
+		Pagination struct {
+			Total int `json:"total"`
+		} `json:"pagination"`
+	}
+	if resp.Code != http.StatusOK {
+		t.Fatalf("列表接口返回 %d: %s", resp.Code, resp.Body.String())
+	}
+	json.Unmarshal(resp.Body.Bytes(), &list)
+	if list.Pagination.Total != 1 || len(list.Items) != 1 {
+		t.Fatalf("按阶段过滤结果错误: %s", resp.Body.String())
+	}
+	item := list.Items[0]
+	if !item.PIIProtected || item.TaskName == nil || *item.TaskName != "死信接口" {
+		t.Errorf("死信记录字段错误: %+v", item)
+	}
+	path := fmt.Sprintf("/dead-letters/%d", item.ID)
+
+	if resp := serveJSON(router, http.MethodGet, "/dead-letters/999999", ""); resp.Code != http.StatusNotFound {
+		t.Errorf("不存在的记录应返回 404，实际 %d", resp.Code)
+	}
+
+	// 修改内容后清除脱敏标记，重放时重新经过 PII 阶段
+	if resp := serveJSON(router, http.MethodPut, path, `{"record": {"phone": "13987654321"}}`); resp.Code != http.StatusOK {
+		t.Fatalf("修改接口返回 %d: %s", resp.Code, resp.Body.String())
+	}
+	resp = serveJSON(router, http.MethodGet, path, "")
+	var updated api.DeadLetter
+	json.Unmarshal(resp.Body.Bytes(), &updated)
+	if updated.PIIProtected || !strings.Contains(string(updated.Record), "13987654321") {
+		t.Errorf("修改后的记录错误: %s", resp.Body.String())
+	}
+
+	// pending → replay_requested，重复请求返回 404
+	if resp := serveJSON(router, http.MethodPost, path+"/replay", ""); resp.Code != http.StatusOK {
+		t.Fatalf("重放接口返回 %d: %s", resp.Code, resp.Body.String())
+	}
+	if status, _, _, _ := deadLetterStatus(t, db, item.ID); status != models.DeadLetterStatusReplayRequested {
+		t.Errorf("请求重放后状态 = %s", status)
+	}
+	if resp := serveJSON(router, http.MethodPost, path+"/replay", ""); resp.Code != http.StatusNotFound {
+		t.Errorf("重复请求重放应返回 404，实际 %d", resp.Code)
+	}
+
+	// 正在重放的记录不能修改或丢弃
+	if _, err := db.ClaimReplayDeadLetters(ctx, "worker-a", 10, time.Minute); err != nil {
+		t.Fatalf("领取重放记录失败: %v", err)
+	}
+	if resp := serveJSON(router, http.MethodPut, path, `{"record": {}}`); resp.Code != http.StatusNotFound {
+		t.Errorf("正在重放的记录不应允许修改，实际 %d", resp.Code)
+	}
+	if resp := serveJSON(router, http.MethodPost, path+"/discard", ""); resp.Code != http.StatusNotFound {
+		t.Errorf("正在重放的记录不应允许丢弃，实际 %d", resp.Code)
+	}
+
+	// 批量重放只选择 pending 的记录
+	if resp := serveJSON(router, http.MethodPost, "/dead-letters/replay", `{}`); resp.Code != http.StatusBadRequest {
+		t.Errorf("未指定条件时应返回 400，实际 %d", resp.Code)
+	}
+	resp = serveJSON(router, http.MethodPost, "/dead-letters/replay", fmt.Sprintf(`{"task_id": %d}`, taskID))
+	var batch struct {
+		Count int64 `json:"count"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &batch)
+	if resp.Code != http.StatusOK || batch.Count != 1 {
+		t.Errorf("批量重放结果错误: %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestDeadLetterReplayEditedStorageRecord(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	taskID := createTestTask(t, db, "死信修改后重放", `{}`)
+	if err := db.SaveDeadLetters(ctx, []models.DeadLetterRecord{
+		{TaskID: taskID, Stage: models.DeadLetterStageStorage, Target: "postgresql:orders", Error: "字段过长",
+			Record: map[string]interface{}{"phone": "139****4321"}, PIIProtected: true},
+	}); err != nil {
+		t.Fatalf("写入死信记录失败: %v", err)
+	}
+	var id int64
+	if err := db.QueryRow(`SELECT id FROM dead_letter_records WHERE task_id = $1`, taskID).Scan(&id); err != nil {
+		t.Fatalf("查询死信记录失败: %v", err)
+	}
+
+	// 修改为明文手机号后请求重放
+	router := newDeadLetterRouter(db)
+	path := fmt.Sprintf("/dead-letters/%d", id)
+	if resp := serveJSON(router, http.MethodPut, path, `{"record": {"phone": "13987654321"}}`); resp.Code != http.StatusOK {
+		t.Fatalf("修改接口返回 %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := serveJSON(router, http.MethodPost, path+"/replay", ""); resp.Code != http.StatusOK {
+		t.Fatalf("重放接口返回 %d: %s", resp.Code, resp.Body.String())
+	}
+
+	claimed, err := db.ClaimReplayDeadLetters(ctx, "worker-a", 10, time.Minute)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("领取重放记录失败: %v, %v", claimed, err)
+	}
+	if claimed[0].Stage != models.DeadLetterStageStorage || claimed[0].PIIProtected {
+		t.Fatalf("领取的记录 = %+v", claimed[0])
+	}
+
+	// 存储阶段的记录写入前经过任务的 PII 阶段
+	config := &models.ProcessorConfig{PII: &models.PIIConfig{Fields: []models.PIIFieldPolicy{{Field: "phone", Type: models.PIITypePhone}}}}
+	data, err := processor.NewProcessor(config).Replay(&claimed[0])
+	if err != nil {
+		t.Fatalf("重放处理失败: %v", err)
+	}
+	if len(data) != 1 || data[0]["phone"] != "139****4321" {
+		t.Errorf("修改后的明文 PII 未脱敏: %v", data)
+	}
+}
@@ -0,0 +1,154 @@
+package unit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/storage"
+)
+
+func TestElasticsearchStorage(t *testing.T) {
+	var mu sync.Mutex
+	var template map[string]interface{}
+	var actions []map[string]map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/_index_template/"):
+			json.Unmarshal(body, &template)
+			w.Write([]byte(`{"acknowledged":true}`))
+
+		case r.URL.Path == "/_bulk":
+			var items []string
+			scanner := bufio.NewScanner(bytes.NewReader(body))
+			for i := 0; scanner.Scan(); i++ {
+				if i%2 == 1 {
+					continue
+				}
+				var action map[string]map[string]interface{}
+				json.Unmarshal(scanner.Bytes(), &action)
+				actions = append(actions, action)
+				// 主键为 bad 的文档模拟映射冲突
+				if action["index"]["_id"] == "bad" {
+					items = append(items, `{"index":{"_index":"articles","_id":"bad","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}`)
+				} else {
+					items = append(items, `{"index":{"_index":"articles","status":201}}`)
+				}
+			}
+			hasErrors := strings.Contains(strings.Join(items, ","), `"error"`)
+			w.Write([]byte(`{"errors":` + map[bool]string{true: "true", false: "false"}[hasErrors] + `,"items":[` + strings.Join(items, ",") + `]}`))
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	s, err := storage.NewElasticsearchStorage(&storage.ElasticsearchConfig{Address: server.URL, BulkSize: 2})
+	if err != nil {
+		t.Fatalf("创建 Elasticsearch 存储失败: %v", err)
+	}
+
+	config := &models.StorageConfig{
+		Target:   "elasticsearch",
+		Table:    "articles",
+		Keys:     []string{"url"},
+		Mapping:  map[string]string{"content": "body:text", "published": ":date"},
+		Rollover: "daily",
+	}
+	ctx := storage.WithExecutionInfo(context.Background(), storage.ExecutionInfo{
+		StartTime: time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC),
+	})
+
+	t.Run("按主键写入并生成索引模板", func(t *testing.T) {
+		data := []map[string]interface{}{
+			{"url": "a", "content": "x"},
+			{"url": "b", "content": "y"},
+			{"url": "c", "content": "z"},
+		}
+		if err := s.Store(ctx, config, data); err != nil {
+			t.Fatalf("存储失败: %v", err)
+		}
+
+		if len(actions) != 3 {
+			t.Fatalf("期望 3 条 bulk 操作，得到 %d 条", len(actions))
+		}
+		if actions[0]["index"]["_index"] != "articles-2026.10.18" || actions[0]["index"]["_id"] != "a" {
+			t.Errorf("bulk 操作错误: %v", actions[0])
+		}
+
+		properties := template["template"].(map[string]interface{})["mappings"].(map[string]interface{})["properties"].(map[string]interface{})
+		if properties["body"].(map[string]interface{})["type"] != "text" ||
+			properties["published"].(map[string]interface{})["type"] != "date" ||
+			properties["url"].(map[string]interface{})["type"] != "keyword" {
+			t.Errorf("索引模板映射错误: %v", properties)
+		}
+	})
+
+	t.Run("单条文档失败时拒绝该文档", func(t *testing.T) {
+		data := []map[string]interface{}{
+			{"url": "ok", "content": "x"},
+			{"url": "bad", "content": "y"},
+		}
+		rejects := storage.NewRejectCollector()
+		if err := s.Store(storage.WithRejectCollector(ctx, rejects), config, data); err != nil {
+			t.Fatalf("部分文档失败不应返回错误: %v", err)
+		}
+
+		rejected := rejects.Records()
+		if len(rejected) != 1 || rejected[0].Record["url"] != "bad" || !strings.Contains(rejected[0].Error, "mapper_parsing_exception") {
+			t.Errorf("拒绝记录不正确: %+v", rejected)
+		}
+	})
+
+	t.Run("全部文档失败时返回错误", func(t *testing.T) {
+		rejects := storage.NewRejectCollector()
+		err := s.Store(storage.WithRejectCollector(ctx, rejects), config, []map[string]interface{}{{"url": "bad", "content": "y"}})
+
+		var bulkErr *storage.BulkError
+		if !errors.As(err, &bulkErr) {
+			t.Fatalf("期望 BulkError，得到 %v", err)
+		}
+		if len(bulkErr.Failed) != 1 || bulkErr.Failed[0].Position != 0 || bulkErr.Failed[0].Type != "mapper_parsing_exception" {
+			t.Errorf("错误信息不正确: %+v", bulkErr.Failed)
+		}
+	})
+
+	t.Run("按 UTC 日期滚动", func(t *testing.T) {
+		mu.Lock()
+		actions = nil
+		mu.Unlock()
+		// 东八区 10-19 02:00 即 UTC 10-18 18:00
+		local := storage.WithExecutionInfo(context.Background(), storage.ExecutionInfo{
+			StartTime: time.Date(2026, 10, 19, 2, 0, 0, 0, time.FixedZone("CST", 8*3600)),
+		})
+		if err := s.Store(local, config, []map[string]interface{}{{"url": "d", "content": "x"}}); err != nil {
+			t.Fatalf("存储失败: %v", err)
+		}
+		if len(actions) != 1 || actions[0]["index"]["_index"] != "articles-2026.10.18" {
+			t.Errorf("期望写入 UTC 日期的索引: %v", actions)
+		}
+	})
+
+	t.Run("缺少主键字段", func(t *testing.T) {
+		data := []map[string]interface{}{{"content": "x"}}
+		if err := s.Store(ctx, config, data); err == nil {
+			t.Error("缺少主键字段应该返回错误")
+		}
+	})
+}
@@ -0,0 +1,208 @@
+package unit
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/processor"
+)
+
+// fakeReferenceLoader 内存参考数据，记录每种数据源的加载次数
+type fakeReferenceLoader struct {
+	rows      []map[string]interface{}
+	files     map[string]string
+	hashes    map[string]map[string]string
+	queries   int
+	databases []string
+}
+
+func (l *fakeReferenceLoader) QuerySQL(database, query string, maxRows int) ([]map[string]interface{}, error) {
+	l.queries++
+	l.databases = append(l.databases, database)
+	return l.rows, nil
+}
+
+func (l *fakeReferenceLoader) OpenFile(path string) (io.ReadCloser, error) {
+	content, ok := l.files[path]
+	if !ok {
+		return nil, fmt.Errorf("文件 %s 不存在", path)
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+func (l *fakeReferenceLoader) GetAllHash(key string) (map[string]string, error) {
+	return l.hashes[key], nil
+}
+
+func runEnrich(t *testing.T, config *models.ProcessorConfig, loader processor.ReferenceLoader, data []map[string]interface{}) ([]map[string]interface{}, *processor.Processor) {
+	t.Helper()
+	proc := processor.NewProcessor(config)
+	proc.SetReferenceLoader(loader)
+	result, err := proc.Process(data)
+	if err != nil {
+		t.Fatalf("处理失败: %v", err)
+	}
+	return result, proc
+}
+
+func TestEnrichSQL(t *testing.T) {
+	loader := &fakeReferenceLoader{rows: []map[string]interface{}{
+		{"name": "阿里巴巴(中国)有限公司", "id": int64(1001), "industry": "互联网"},
+		{"name": "Tencent Holdings", "id": int64(1002), "industry": "互联网"},
+	}}
+	query := "SELECT name, id, industry FROM companies"
+	config := &models.ProcessorConfig{Enrichments: []models.EnrichmentConfig{
+		{Name: "company_id", Source: "sql", Query: query, KeyFields: []string{"company"}, LookupFields: []string{"name"},
+			Match: "normalized", Fields: map[string]string{"company_id": "id"}},
+		{Name: "industry", Source: "sql", Query: query, KeyFields: []string{"company"}, LookupFields: []string{"name"},
+			Match: "normalized", Fields: map[string]string{"meta.industry": "industry"}},
+	}}
+
+	result, _ := runEnrich(t, config, loader, []map[string]interface{}{
+		{"company": "阿里巴巴（中国） 有限公司"},
+		{"company": "TENCENT holdings"},
+		{"company": "未知公司"},
+	})
+
+	if len(result) != 3 {
+		t.Fatalf("默认应保留未匹配的记录, got %d", len(result))
+	}
+	if result[0]["company_id"] != int64(1001) || result[1]["company_id"] != int64(1002) {
+		t.Errorf("规范化匹配失败: %v", result)
+	}
+	if result[0]["meta"].(map[string]interface{})["industry"] != "互联网" {
+		t.Errorf("嵌套目标字段写入失败: %v", result[0])
+	}
+	if _, ok := result[2]["company_id"]; ok {
+		t.Errorf("未匹配的记录不应补充字段: %v", result[2])
+	}
+	if loader.queries != 1 {
+		t.Errorf("同一次处理中相同查询只应执行一次, got %d", loader.queries)
+	}
+	if len(loader.databases) != 1 || loader.databases[0] != "data" {
+		t.Errorf("默认应查询数据存储数据库, got %v", loader.databases)
+	}
+
+	exact := *config
+	exact.Enrichments = []models.EnrichmentConfig{config.Enrichments[0]}
+	exact.Enrichments[0].Match = ""
+	result, _ = runEnrich(t, &exact, loader, []map[string]interface{}{{"company": "TENCENT holdings"}})
+	if _, ok := result[0]["company_id"]; ok {
+		t.Error("精确匹配不应忽略大小写")
+	}
+}
+
+func TestEnrichCSVAndCache(t *testing.T) {
+	loader := &fakeReferenceLoader{
+		files: map[string]string{
+			"regions.csv": "\ufeffprovince,city,code\n广东,深圳,440300\n广东,广州,440100\n",
+		},
+		hashes: map[string]map[string]string{
+			"ref:sku": {
+				"A1:red": `{"sku_id": 11, "price": 9.9}`,
+				"B2:red": "discontinued",
+			},
+		},
+	}
+
+	config := &models.ProcessorConfig{Enrichments: []models.EnrichmentConfig{
+		{Source: "csv", Path: "regions.csv", KeyFields: []string{"addr.province", "addr.city"}, LookupFields: []string{"province", "city"},
+			Target: "region"},
+		{Source: "cache", CacheKey: "ref:sku", KeyFields: []string{"sku", "color"}, Fields: map[string]string{"sku_id": "sku_id", "status": "value"}},
+	}}
+	result, _ := runEnrich(t, config, loader, []map[string]interface{}{
+		{"addr": map[string]interface{}{"province": "广东", "city": "深圳"}, "sku": "A1", "color": "red"},
+		{"addr": map[string]interface{}{"province": "广东", "city": "广州"}, "sku": "B2", "color": "red"},
+	})
+
+	region, ok := result[0]["region"].(map[string]interface{})
+	if !ok || region["code"] != "440300" {
+		t.Errorf("CSV 联合键匹配失败: %v", result[0])
+	}
+	if result[0]["sku_id"] != float64(11) {
+		t.Errorf("缓存 JSON 值匹配失败: %v", result[0])
+	}
+	if result[1]["status"] != "discontinued" {
+		t.Errorf("缓存字符串值应写入 value 列: %v", result[1])
+	}
+}
+
+func TestEnrichMissPolicy(t *testing.T) {
+	loader := &fakeReferenceLoader{rows: []map[string]interface{}{{"code": "CN", "name": "中国"}}}
+	data := []map[string]interface{}{{"country": "CN"}, {"country": "XX"}, {"other": 1}}
+	enrichment := models.EnrichmentConfig{Name: "country", Source: "sql", Query: "SELECT code, name FROM countries",
+		KeyFields: []string{"country"}, LookupFields: []string{"code"}, Fields: map[string]string{"country_name": "name"}}
+
+	run := func(onMiss string, defaults map[string]interface{}) ([]map[string]interface{}, *processor.Processor) {
+		e := enrichment
+		e.OnMiss = onMiss
+		e.Defaults = defaults
+		return runEnrich(t, &models.ProcessorConfig{Enrichments: []models.EnrichmentConfig{e}}, loader, data)
+	}
+
+	result, _ := run("default", map[string]interface{}{"country_name": "未知"})
+	if len(result) != 3 || result[1]["country_name"] != "未知" || result[2]["country_name"] != "未知" {
+		t.Errorf("default 应写入默认值: %v", result)
+	}
+
+	result, _ = run("drop", nil)
+	if len(result) != 1 || result[0]["country_name"] != "中国" {
+		t.Errorf("drop 应丢弃未匹配的记录: %v", result)
+	}
+
+	result, proc := run("reject", nil)
+	rejected := proc.Rejected()
+	if len(result) != 1 || len(rejected) != 2 {
+		t.Fatalf("reject 应将未匹配的记录放入死信队列: %v, %v", result, rejected)
+	}
+	if rejected[0].Stage != models.DeadLetterStageEnrich || rejected[0].Rule != "country" {
+		t.Errorf("死信记录的阶段或规则错误: %+v", rejected[0])
+	}
+}
+
+func TestEnrichBeforeValidate(t *testing.T) {
+	loader := &fakeReferenceLoader{rows: []map[string]interface{}{{"name": "ACME", "id": "c-1"}}}
+	config := &models.ProcessorConfig{
+		Enrichments: []models.EnrichmentConfig{{Source: "sql", Query: "SELECT name, id FROM companies",
+			KeyFields: []string{"company"}, LookupFields: []string{"name"}, Fields: map[string]string{"company_id": "id"}}},
+		ValidationRules: []models.ValidationRule{{Name: "company_id_required", Field: "company_id", Type: "required"}},
+	}
+	result, proc := runEnrich(t, config, loader, []map[string]interface{}{{"company": "ACME"}, {"company": "Other"}})
+	if len(result) != 1 || len(proc.Rejected()) != 1 {
+		t.Errorf("关联补充应在校验之前执行: %v, %v", result, proc.Rejected())
+	}
+}
+
+func TestValidateEnrichments(t *testing.T) {
+	invalid := []models.EnrichmentConfig{
+		{Source: "http", KeyFields: []string{"a"}, Target: "t"},
+		{Source: "sql", Query: "DELETE FROM users", KeyFields: []string{"a"}, Target: "t"},
+		{Source: "sql", Database: "control", Query: "SELECT password_hash FROM users", KeyFields: []string{"a"}, Target: "t"},
+		{Source: "csv", Path: "../../etc/passwd", KeyFields: []string{"a"}, Target: "t"},
+		{Source: "cache", CacheKey: "k", Target: "t"},
+		{Source: "cache", CacheKey: "k", KeyFields: []string{"a"}},
+		{Source: "sql", Query: "SELECT 1", KeyFields: []string{"a", "b"}, LookupFields: []string{"x"}, Target: "t"},
+		{Source: "sql", Query: "SELECT 1", KeyFields: []string{"a"}, Target: "t", OnMiss: "default"},
+	}
+	for i, e := range invalid {
+		if err := processor.ValidateEnrichments([]models.EnrichmentConfig{e}); err == nil {
+			t.Errorf("第 %d 个配置应返回错误", i+1)
+		}
+	}
+
+	if err := processor.ValidateEnrichments([]models.EnrichmentConfig{
+		{Source: "csv", Path: "ref/companies.csv", KeyFields: []string{"company"}, Fields: map[string]string{"company_id": "id"}, OnMiss: "reject"},
+	}); err != nil {
+		t.Errorf("合法配置不应返回错误: %v", err)
+	}
+
+	proc := processor.NewProcessor(&models.ProcessorConfig{Enrichments: []models.EnrichmentConfig{
+		{Source: "sql", Query: "SELECT 1", KeyFields: []string{"a"}, Target: "t"},
+	}})
+	if _, err := proc.Process([]map[string]interface{}{{"a": 1}}); err == nil {
+		t.Error("未配置参考数据加载器时应返回错误")
+	}
+}
@@ -0,0 +1,128 @@
+package unit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/datafusion/worker/internal/schedule"
+)
+
+func TestExecutorSlots(t *testing.T) {
+	e := schedule.NewExecutor[int64](2)
+	if e.Free() != 2 {
+		t.Fatalf("空闲槽位 = %d, 期望 2", e.Free())
+	}
+
+	now := time.Now()
+	if n := e.Add(1, func() {}, now.Add(time.Minute)); n != 1 {
+		t.Errorf("运行任务数 = %d, 期望 1", n)
+	}
+	e.Add(2, func() {}, now.Add(time.Minute))
+	if e.Free() != 0 {
+		t.Errorf("空闲槽位 = %d, 期望 0", e.Free())
+	}
+
+	if lost, count := e.Remove(1); lost || count != 1 {
+		t.Errorf("移除结果 = %v, %d", lost, count)
+	}
+	e.Done()
+	select {
+	case <-e.Wake():
+	default:
+		t.Error("任务完成后应唤醒主循环")
+	}
+
+	// 停止领取后不再有空闲槽位
+	e.Drain()
+	if !e.Stopped() || e.Free() != 0 {
+		t.Errorf("停止领取后空闲槽位 = %d", e.Free())
+	}
+}
+
+func TestExecutorLeaseExpiry(t *testing.T) {
+	e := schedule.NewExecutor[int64](2)
+	now := time.Now()
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	defer cancel1()
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	e.Add(1, cancel1, now.Add(30*time.Second))
+	e.Add(2, cancel2, now.Add(30*time.Second))
+
+	// 任务 2 续期成功，任务 1 续期失败
+	e.Renew(2, now.Add(90*time.Second))
+	// 续期时间不会倒退
+	e.Renew(2, now.Add(10*time.Second))
+
+	if expired := e.ExpireLeases(now.Add(10 * time.Second)); len(expired) != 0 {
+		t.Errorf("租约未到期时不应取消任务: %v", expired)
+	}
+
+	expired := e.ExpireLeases(now.Add(time.Minute))
+	if len(expired) != 1 || expired[0] != 1 {
+		t.Fatalf("过期任务 = %v, 期望 [1]", expired)
+	}
+	if ctx1.Err() == nil {
+		t.Error("租约过期的任务应被取消")
+	}
+	if ctx2.Err() != nil {
+		t.Error("续期成功的任务不应被取消")
+	}
+	// 已过期的任务不重复返回
+	if expired := e.ExpireLeases(now.Add(time.Minute)); len(expired) != 0 {
+		t.Errorf("重复返回过期任务: %v", expired)
+	}
+
+	if lost, _ := e.Remove(1); !lost {
+		t.Error("租约过期的任务应标记为租约丢失")
+	}
+	if lost, _ := e.Remove(2); lost {
+		t.Error("续期成功的任务不应标记为租约丢失")
+	}
+}
+
+func TestExecutorCancelExecution(t *testing.T) {
+	e := schedule.NewExecutor[int64](1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e.Add(1, cancel, time.Now().Add(time.Minute))
+	e.SetExecution(1, 100)
+
+	if e.CancelExecution(200) {
+		t.Error("不在执行器上的执行不应取消")
+	}
+	if !e.CancelExecution(100) {
+		t.Fatal("应取消执行 100")
+	}
+	if ctx.Err() == nil || !e.CancelRequested(1) {
+		t.Error("取消后任务应停止并记录取消请求")
+	}
+	// 取消请求不是租约丢失
+	if lost, _ := e.Remove(1); lost {
+		t.Error("取消的任务不应标记为租约丢失")
+	}
+}
+
+func TestExecutorWait(t *testing.T) {
+	e := schedule.NewExecutor[int64](1)
+	ctx, cancel := context.WithCancel(context.Background())
+	e.Add(1, cancel, time.Now().Add(time.Minute))
+
+	timeout, timeoutCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer timeoutCancel()
+	if e.Wait(timeout) {
+		t.Fatal("任务未结束时 Wait 应超时返回 false")
+	}
+
+	go func() {
+		<-ctx.Done()
+		e.Remove(1)
+		e.Done()
+	}()
+	e.CancelAll()
+	if !e.Wait(context.Background()) {
+		t.Error("任务结束后 Wait 应返回 true")
+	}
+}
@@ -0,0 +1,113 @@
+package unit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/datafusion/worker/internal/database"
+	"github.com/datafusion/worker/internal/models"
+)
+
+func TestClaimTasksLease(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	taskID := createTestTask(t, db, "租约领取", `{}`)
+	filter := database.ClaimFilter{WorkerType: "all", WorkerPod: "worker-a"}
+
+	claimed, err := db.ClaimTasks(ctx, filter, 2, time.Minute)
+	if err != nil || len(claimed) != 1 || claimed[0].ID != taskID {
+		t.Fatalf("领取结果 = %v, %v", claimed, err)
+	}
+
+	// 租约有效期内其他 Worker 不能领取
+	filter.WorkerPod = "worker-b"
+	if claimed, err := db.ClaimTasks(ctx, filter, 2, time.Minute); err != nil || len(claimed) != 0 {
+		t.Errorf("租约有效期内被重复领取: %v, %v", claimed, err)
+	}
+
+	// 只有持有租约的 Worker 能续期
+	renewed, err := db.RenewTaskLeases(ctx, "worker-b", []int64{taskID}, time.Minute)
+	if err != nil || renewed[taskID] {
+		t.Errorf("其他 Worker 续期结果 = %v, %v", renewed, err)
+	}
+	renewed, err = db.RenewTaskLeases(ctx, "worker-a", []int64{taskID}, time.Minute)
+	if err != nil || !renewed[taskID] {
+		t.Errorf("续期结果 = %v, %v", renewed, err)
+	}
+
+	// 释放后可以被其他 Worker 领取
+	if err := db.ReleaseTaskLease(ctx, taskID, "worker-a"); err != nil {
+		t.Fatalf("释放租约失败: %v", err)
+	}
+	if claimed, err := db.ClaimTasks(ctx, filter, 2, time.Minute); err != nil || len(claimed) != 1 {
+		t.Errorf("释放后领取结果 = %v, %v", claimed, err)
+	}
+}
+
+func TestRecoverExpiredLeases(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	taskID := createTestTask(t, db, "租约回收", `{}`)
+
+	if claimed, err := db.ClaimTasks(ctx, database.ClaimFilter{WorkerType: "all", WorkerPod: "worker-a"}, 1, time.Minute); err != nil || len(claimed) != 1 {
+		t.Fatalf("领取结果 = %v, %v", claimed, err)
+	}
+	executionID, err := db.CreateExecution(taskID, "worker-a")
+	if err != nil {
+		t.Fatalf("创建执行记录失败: %v", err)
+	}
+
+	// 未过期的租约不回收
+	if leases, executions, err := db.RecoverExpiredLeases(ctx); err != nil || leases != 0 || executions != 0 {
+		t.Errorf("回收结果 = %d, %d, %v", leases, executions, err)
+	}
+
+	if _, err := db.Exec("UPDATE task_leases SET expires_at = NOW() - INTERVAL '1 second' WHERE task_id = $1", taskID); err != nil {
+		t.Fatalf("设置租约过期失败: %v", err)
+	}
+	leases, executions, err := db.RecoverExpiredLeases(ctx)
+	if err != nil || leases != 1 || executions != 1 {
+		t.Fatalf("回收结果 = %d, %d, %v", leases, executions, err)
+	}
+
+	var status string
+	db.QueryRow("SELECT status FROM task_executions WHERE id = $1", executionID).Scan(&status)
+	if status != models.ExecutionStatusFailed {
+		t.Errorf("中断的执行状态 = %s, 期望 failed", status)
+	}
+	// 回收后原 Worker 不能再续期
+	renewed, err := db.RenewTaskLeases(ctx, "worker-a", []int64{taskID}, time.Minute)
+	if err != nil || renewed[taskID] {
+		t.Errorf("回收后续期结果 = %v, %v", renewed, err)
+	}
+}
+
+func TestNextRunTimeTimezone(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	taskID := createTestTask(t, db, "下次执行时间时区", `{}`)
+	filter := database.ClaimFilter{WorkerType: "all", WorkerPod: "worker-a"}
+
+	// 写入时的时区不影响与 NOW() 的比较
+	east := time.FixedZone("UTC+14", 14*3600)
+	west := time.FixedZone("UTC-12", -12*3600)
+	if err := db.UpdateTaskNextRunTime(taskID, time.Now().In(east).Add(30*time.Minute)); err != nil {
+		t.Fatalf("更新下次执行时间失败: %v", err)
+	}
+	if claimed, err := db.ClaimTasks(ctx, filter, 1, time.Minute); err != nil || len(claimed) != 0 {
+		t.Fatalf("未到期的任务被领取: %v, %v", claimed, err)
+	}
+
+	next := time.Now().In(west).Add(-time.Minute).Truncate(time.Second)
+	if err := db.UpdateTaskNextRunTime(taskID, next); err != nil {
+		t.Fatalf("更新下次执行时间失败: %v", err)
+	}
+	claimed, err := db.ClaimTasks(ctx, filter, 1, time.Minute)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("到期的任务未被领取: %v, %v", claimed, err)
+	}
+	if claimed[0].NextRunTime == nil || !claimed[0].NextRunTime.Equal(next) {
+		t.Errorf("读出的下次执行时间 = %v, 期望 %v", claimed[0].NextRunTime, next)
+	}
+}
@@ -0,0 +1,167 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/processor"
+)
+
+func TestLocalizedDateFormat(t *testing.T) {
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	collectedAt := time.Date(2026, 10, 18, 15, 0, 0, 0, shanghai)
+
+	tests := []struct {
+		name     string
+		value    string
+		locale   string
+		timezone string
+		pattern  string
+		want     string
+	}{
+		{"相对小时", "3小时前", "", "Asia/Shanghai", time.RFC3339, "2026-10-18T04:00:00Z"},
+		{"半小时", "半小时前", "", "Asia/Shanghai", time.RFC3339, "2026-10-18T06:30:00Z"},
+		{"中文数字", "两天前", "", "Asia/Shanghai", "2006-01-02", "2026-10-16"},
+		{"昨天带时间", "昨天 14:20", "", "Asia/Shanghai", time.RFC3339, "2026-10-17T06:20:00Z"},
+		{"下午", "今天下午3点05分", "", "Asia/Shanghai", time.RFC3339, "2026-10-18T07:05:00Z"},
+		{"刚刚", "刚刚", "", "Asia/Shanghai", time.RFC3339, "2026-10-18T07:00:00Z"},
+		{"英文相对时间", "2 hours ago", "", "", time.RFC3339, "2026-10-18T05:00:00Z"},
+		{"中文日期", "2026年10月18日", "", "Asia/Shanghai", "2006-01-02", "2026-10-18"},
+		{"中文日期带星期和时间", "2026年10月18日 星期日 09:30", "", "Asia/Shanghai", time.RFC3339, "2026-10-18T01:30:00Z"},
+		{"省略年份", "10月17日", "", "Asia/Shanghai", "2006-01-02", "2026-10-17"},
+		{"省略年份跨年", "12-31 23:00", "", "Asia/Shanghai", time.RFC3339, "2025-12-31T15:00:00Z"},
+		{"斜线短日期", "10/18 14:20", "", "Asia/Shanghai", time.RFC3339, "2026-10-18T06:20:00Z"},
+		{"中文斜线短日期", "10/18 14:20", "zh-CN", "Asia/Shanghai", time.RFC3339, "2026-10-18T06:20:00Z"},
+		{"日文斜线短日期", "10/17", "ja_JP", "Asia/Shanghai", "2006-01-02", "2026-10-17"},
+		{"日在前的斜线短日期", "17/10", "en-GB", "Asia/Shanghai", "2006-01-02", "2026-10-17"},
+		{"带时区转 UTC", "2024-01-15T10:00:00+08:00", "", "", time.RFC3339, "2024-01-15T02:00:00Z"},
+		{"按时区解析", "2024-01-15 10:00:00", "", "Asia/Shanghai", time.RFC3339, "2024-01-15T02:00:00Z"},
+		{"时间戳", "1700000000", "", "", time.RFC3339, "2023-11-14T22:13:20Z"},
+		{"英文日期", "Oct 18, 2026", "en-US", "", "2006-01-02", "2026-10-18"},
+		{"美式日期", "10/12/2026", "en-US", "", "2006-01-02", "2026-10-12"},
+		{"日在前", "10/12/2026", "en-GB", "", "2006-01-02", "2026-12-10"},
+		{"兼容原格式", "2024-01-15", "", "", "2006/01/02", "2024/01/15"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := models.CleaningRule{Field: "date", Type: "date_format", Pattern: tt.pattern, Locale: tt.locale, Timezone: tt.timezone}
+			cleaner := processor.NewEnhancedCleaner([]models.CleaningRule{rule}).WithCollectedAt(collectedAt)
+			result, err := cleaner.Clean([]map[string]interface{}{{"date": tt.value}})
+			if err != nil {
+				t.Fatalf("解析 %q 失败: %v", tt.value, err)
+			}
+			if result[0]["date"] != tt.want {
+				t.Errorf("解析 %q: got %v, want %s", tt.value, result[0]["date"], tt.want)
+			}
+		})
+	}
+
+	t.Run("无效值和时区进入死信队列", func(t *testing.T) {
+		cleaned, rejected := processor.NewEnhancedCleaner([]models.CleaningRule{
+			{Field: "date", Type: "date_format", Timezone: "Mars/Olympus"},
+		}).CleanEach([]map[string]interface{}{{"date": "2024-01-15"}})
+		if len(cleaned) != 0 || len(rejected) != 1 {
+			t.Error("无效时区应拒绝记录")
+		}
+		_, rejected = processor.NewEnhancedCleaner([]models.CleaningRule{
+			{Field: "date", Type: "date_format"},
+		}).CleanEach([]map[string]interface{}{{"date": "13月45日"}, {"date": "2月30日"}})
+		if len(rejected) != 2 {
+			t.Errorf("无效日期应拒绝记录, got %d", len(rejected))
+		}
+	})
+
+	t.Run("处理器使用采集时间", func(t *testing.T) {
+		proc := processor.NewProcessor(&models.ProcessorConfig{CleaningRules: []models.CleaningRule{
+			{Field: "date", Type: "date_format", Pattern: time.RFC3339},
+		}})
+		proc.SetCollectedAt(time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC))
+		result, err := proc.Process([]map[string]interface{}{{"date": "1天前"}})
+		if err != nil {
+			t.Fatalf("处理失败: %v", err)
+		}
+		if result[0]["date"] != "2025-12-31T12:00:00Z" {
+			t.Errorf("相对时间应以采集时间为基准: %v", result[0]["date"])
+		}
+	})
+}
+
+func TestLocalizedNumberFormat(t *testing.T) {
+	tests := []struct {
+		value  string
+		locale string
+		want   float64
+	}{
+		{"1,234.56", "", 1234.56},
+		{"1.2万", "", 12000},
+		{"3.5亿", "", 350000000},
+		{"10万+", "", 100000},
+		{"2.3k", "", 2300},
+		{"1.5w", "", 15000},
+		{"¥3,499.00", "", 3499},
+		{"12.5%", "", 0.125},
+		{"(1,234.50)", "", -1234.5},
+		{"-¥12.50", "", -12.5},
+		{"１２，３４５", "", 12345},
+		{"1.234,56", "de-DE", 1234.56},
+		{"1 234,5", "fr-FR", 1234.5},
+	}
+
+	for _, tt := range tests {
+		rule := models.CleaningRule{Field: "n", Type: "number_format", Locale: tt.locale}
+		result, err := processor.NewEnhancedCleaner([]models.CleaningRule{rule}).Clean([]map[string]interface{}{{"n": tt.value}})
+		if err != nil {
+			t.Errorf("解析 %q 失败: %v", tt.value, err)
+			continue
+		}
+		if result[0]["n"] != tt.want {
+			t.Errorf("解析 %q: got %v, want %v", tt.value, result[0]["n"], tt.want)
+		}
+	}
+
+	_, rejected := processor.NewEnhancedCleaner([]models.CleaningRule{{Field: "n", Type: "number_format"}}).
+		CleanEach([]map[string]interface{}{{"n": "面议"}})
+	if len(rejected) != 1 {
+		t.Error("无法解析的数字应拒绝记录")
+	}
+}
+
+func TestCurrencyCleaning(t *testing.T) {
+	tests := []struct {
+		value    string
+		locale   string
+		fallback string
+		amount   float64
+		currency string
+	}{
+		{"¥3,499.00", "", "", 3499, "CNY"},
+		{"US$12.99", "", "", 12.99, "USD"},
+		{"1.2万元", "", "", 12000, "CNY"},
+		{"EUR 1.234,50", "de-DE", "", 1234.5, "EUR"},
+		{"£20", "", "", 20, "GBP"},
+		{"$5", "zh-HK", "", 5, "HKD"},
+		{"¥1,200", "ja-JP", "", 1200, "JPY"},
+		{"99", "", "cny", 99, "CNY"},
+	}
+
+	for _, tt := range tests {
+		rule := models.CleaningRule{Field: "price", Type: "currency", Locale: tt.locale, Pattern: tt.fallback, TargetField: "price_parsed"}
+		result, err := processor.NewEnhancedCleaner([]models.CleaningRule{rule}).Clean([]map[string]interface{}{{"price": tt.value}})
+		if err != nil {
+			t.Errorf("解析 %q 失败: %v", tt.value, err)
+			continue
+		}
+		parsed, ok := result[0]["price_parsed"].(map[string]interface{})
+		if !ok || parsed["amount"] != tt.amount || parsed["currency"] != tt.currency {
+			t.Errorf("解析 %q: got %v, want %v %s", tt.value, result[0]["price_parsed"], tt.amount, tt.currency)
+		}
+	}
+
+	_, rejected := processor.NewEnhancedCleaner([]models.CleaningRule{{Field: "price", Type: "currency"}}).
+		CleanEach([]map[string]interface{}{{"price": "99"}})
+	if len(rejected) != 1 {
+		t.Error("无法确定货币时应拒绝记录")
+	}
+}
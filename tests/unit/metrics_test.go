@@ -0,0 +1,26 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/datafusion/worker/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetricsRegistration(t *testing.T) {
+	// 每个注册表可以独立创建指标收集器
+	for i := 0; i < 2; i++ {
+		registry := prometheus.NewRegistry()
+		m := metrics.NewMetrics(registry)
+		m.RecordValidation("task", "rule", "drop", "worker", 3, 1)
+		families, err := registry.Gather()
+		if err != nil || len(families) == 0 {
+			t.Fatalf("收集指标失败: %v", err)
+		}
+	}
+
+	// 全局指标收集器只注册一次，多个 Worker 共享
+	if metrics.Default() != metrics.Default() {
+		t.Error("Default 应返回同一个指标收集器")
+	}
+}
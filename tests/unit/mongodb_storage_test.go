@@ -0,0 +1,217 @@
+package unit
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/datafusion/worker/internal/config"
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/storage/mongodb"
+	"github.com/datafusion/worker/internal/worker"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// newMockMongoStorage 创建连接到模拟部署的 MongoDB 存储，默认数据库 datafusion、默认集合 collected_data
+func newMockMongoStorage(mt *mtest.T) *mongodb.MongoDBStorage {
+	mt.Helper()
+	s, err := mongodb.NewMongoDBStorageWithClient(mt.Client, mongodb.DefaultConfig())
+	if err != nil {
+		mt.Fatalf("创建 MongoDB 存储失败: %v", err)
+	}
+	return s
+}
+
+// sentDocuments 返回命令中的文档数组
+func sentDocuments(mt *mtest.T, command bson.Raw, key string) []bson.Raw {
+	mt.Helper()
+	values, err := command.Lookup(key).Array().Values()
+	if err != nil {
+		mt.Fatalf("读取命令中的 %s 失败: %v", key, err)
+	}
+	docs := make([]bson.Raw, len(values))
+	for i, value := range values {
+		docs[i] = value.Document()
+	}
+	return docs
+}
+
+func TestMongoDBStorage(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	ctx := context.Background()
+
+	mt.Run("未声明主键时批量插入", func(mt *mtest.T) {
+		s := newMockMongoStorage(mt)
+		if s.Type() != "mongodb" {
+			mt.Errorf("存储类型 = %s", s.Type())
+		}
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		config := &models.StorageConfig{Target: "mongodb", Database: "news", Table: "articles", Mapping: map[string]string{"title": "headline"}}
+		if err := s.Store(ctx, config, []map[string]interface{}{{"title": "a", "url": "u1"}, {"title": "b", "url": "u2"}}); err != nil {
+			mt.Fatalf("存储失败: %v", err)
+		}
+
+		event := mt.GetStartedEvent()
+		if event.CommandName != "insert" || event.DatabaseName != "news" || event.Command.Lookup("insert").StringValue() != "articles" {
+			mt.Fatalf("命令 = %s %s.%s", event.CommandName, event.DatabaseName, event.Command.Lookup("insert"))
+		}
+		docs := sentDocuments(mt, event.Command, "documents")
+		if len(docs) != 2 {
+			mt.Fatalf("插入 %d 条文档", len(docs))
+		}
+		if docs[0].Lookup("headline").StringValue() != "a" || docs[0].Lookup("url").StringValue() != "u1" {
+			mt.Errorf("字段映射错误: %s", docs[0])
+		}
+		if _, err := docs[0].LookupErr("title"); err == nil {
+			mt.Errorf("映射后不应保留原字段: %s", docs[0])
+		}
+		for _, field := range []string{"_created_at", "_updated_at"} {
+			if _, err := docs[0].LookupErr(field); err != nil {
+				mt.Errorf("缺少时间戳 %s: %s", field, docs[0])
+			}
+		}
+	})
+
+	mt.Run("未指定集合时使用默认集合", func(mt *mtest.T) {
+		s := newMockMongoStorage(mt)
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		if err := s.Store(ctx, &models.StorageConfig{Target: "mongodb"}, []map[string]interface{}{{"id": 1}}); err != nil {
+			mt.Fatalf("存储失败: %v", err)
+		}
+		event := mt.GetStartedEvent()
+		if event.DatabaseName != "datafusion" || event.Command.Lookup("insert").StringValue() != "collected_data" {
+			mt.Errorf("写入 %s.%s", event.DatabaseName, event.Command.Lookup("insert"))
+		}
+	})
+
+	mt.Run("声明主键时按主键 upsert", func(mt *mtest.T) {
+		s := newMockMongoStorage(mt)
+		config := &models.StorageConfig{Target: "mongodb", Table: "items", Keys: []string{"id"}, Mapping: map[string]string{"id": "item_id"}}
+		data := []map[string]interface{}{{"id": "1", "price": 10}}
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+		if err := s.Store(ctx, config, data); err != nil {
+			mt.Fatalf("存储失败: %v", err)
+		}
+
+		// 先在映射后的主键字段上创建唯一索引
+		event := mt.GetStartedEvent()
+		if event.CommandName != "createIndexes" {
+			mt.Fatalf("第一条命令 = %s, 期望 createIndexes", event.CommandName)
+		}
+		index := sentDocuments(mt, event.Command, "indexes")[0]
+		if _, err := index.Lookup("key").Document().LookupErr("item_id"); err != nil || !index.Lookup("unique").Boolean() {
+			mt.Errorf("索引 = %s", index)
+		}
+
+		event = mt.GetStartedEvent()
+		if event.CommandName != "update" {
+			mt.Fatalf("第二条命令 = %s, 期望 update", event.CommandName)
+		}
+		update := sentDocuments(mt, event.Command, "updates")[0]
+		if update.Lookup("q").Document().Lookup("item_id").StringValue() != "1" || !update.Lookup("upsert").Boolean() {
+			mt.Errorf("upsert 条件 = %s", update)
+		}
+		if _, err := update.Lookup("u").Document().Lookup("$setOnInsert").Document().LookupErr("_created_at"); err != nil {
+			mt.Errorf("_created_at 应只在插入时写入: %s", update)
+		}
+
+		// 同一集合的索引只创建一次
+		mt.ClearEvents()
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		if err := s.Store(ctx, config, data); err != nil {
+			mt.Fatalf("存储失败: %v", err)
+		}
+		if event := mt.GetStartedEvent(); event.CommandName != "update" {
+			mt.Errorf("重复存储的命令 = %s, 期望 update", event.CommandName)
+		}
+	})
+
+	mt.Run("缺少主键字段时返回错误", func(mt *mtest.T) {
+		s := newMockMongoStorage(mt)
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		config := &models.StorageConfig{Target: "mongodb", Table: "items", Keys: []string{"id"}}
+		if err := s.Store(ctx, config, []map[string]interface{}{{"price": 10}}); err == nil {
+			mt.Error("缺少主键字段应返回错误")
+		}
+	})
+
+	mt.Run("写入失败时返回错误", func(mt *mtest.T) {
+		s := newMockMongoStorage(mt)
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 13, Name: "Unauthorized", Message: "未授权"}))
+		if err := s.Store(ctx, &models.StorageConfig{Target: "mongodb"}, []map[string]interface{}{{"id": 1}}); err == nil {
+			mt.Error("写入失败应返回错误")
+		}
+	})
+}
+
+func TestMongoDBConfig(t *testing.T) {
+	defaults := mongodb.NewConfig(config.MongoDBConfig{URI: "mongodb://mongo:27017"})
+	if defaults.URI != "mongodb://mongo:27017" || defaults.Database != "datafusion" || defaults.Collection != "collected_data" || defaults.Timeout != 30*time.Second {
+		t.Errorf("默认配置 = %+v", defaults)
+	}
+
+	cfg := mongodb.NewConfig(config.MongoDBConfig{URI: "mongodb://mongo:27017", Database: "news", Collection: "raw", Timeout: 5, MaxPoolSize: 20, MinPoolSize: 2})
+	if cfg.Database != "news" || cfg.Collection != "raw" || cfg.Timeout != 5*time.Second || cfg.MaxPoolSize != 20 || cfg.MinPoolSize != 2 {
+		t.Errorf("配置 = %+v", cfg)
+	}
+}
+
+func TestStorageFactoryRegistration(t *testing.T) {
+	cfg := &config.Config{}
+	factory := worker.NewStorageFactory(cfg)
+	for _, storageType := range []string{"file", "webhook"} {
+		if _, ok := factory.Get(storageType); !ok {
+			t.Errorf("未注册 %s 存储", storageType)
+		}
+	}
+	if _, ok := factory.Get("mongodb"); ok {
+		t.Error("未配置 MongoDB 时不应注册 mongodb 存储")
+	}
+
+	// 连接失败时只记录警告，不影响其他存储
+	cfg.Storage.MongoDB = config.MongoDBConfig{URI: "mongodb://127.0.0.1:1/?serverSelectionTimeoutMS=200", Timeout: 1}
+	factory = worker.NewStorageFactory(cfg)
+	if _, ok := factory.Get("mongodb"); ok {
+		t.Error("连接失败时不应注册 mongodb 存储")
+	}
+	if _, ok := factory.Get("file"); !ok {
+		t.Error("MongoDB 连接失败不应影响其他存储")
+	}
+}
+
+// TestStorageFactoryRegistersMongoDB 需要设置 DATAFUSION_TEST_MONGODB_URI 指向可写的 MongoDB
+func TestStorageFactoryRegistersMongoDB(t *testing.T) {
+	uri := os.Getenv("DATAFUSION_TEST_MONGODB_URI")
+	if uri == "" {
+		t.Skip("未设置 DATAFUSION_TEST_MONGODB_URI，跳过 MongoDB 测试")
+	}
+
+	// 每次测试使用新的默认集合，任务未指定 table 时写入默认集合
+	collection := "unit_" + time.Now().Format("20060102150405.000000")
+	cfg := &config.Config{}
+	cfg.Storage.MongoDB = config.MongoDBConfig{URI: uri, Database: "datafusion_unit", Collection: collection, Timeout: 5}
+	s, ok := worker.NewStorageFactory(cfg).Get("mongodb")
+	if !ok {
+		t.Fatal("配置了 MongoDB 时应注册 mongodb 存储")
+	}
+	mongoStorage := s.(*mongodb.MongoDBStorage)
+	defer mongoStorage.Close()
+
+	ctx := context.Background()
+	defer mongoStorage.Delete(ctx, map[string]interface{}{})
+
+	// 同一主键重复写入时更新已有文档
+	config := &models.StorageConfig{Target: "mongodb", Keys: []string{"id"}}
+	for i := 0; i < 2; i++ {
+		if err := s.Store(ctx, config, []map[string]interface{}{{"id": "1", "n": i}}); err != nil {
+			t.Fatalf("存储失败: %v", err)
+		}
+	}
+	if count, err := mongoStorage.Count(ctx, map[string]interface{}{"id": "1"}); err != nil || count != 1 {
+		t.Errorf("文档数 = %d, %v, 期望 1", count, err)
+	}
+}
@@ -0,0 +1,317 @@
+package unit
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/processor"
+)
+
+// fakeTokenVault 内存令牌库，记录每次 Tokenize 调用
+type fakeTokenVault struct {
+	tokens map[string]string
+	calls  int
+}
+
+func (v *fakeTokenVault) Tokenize(piiType string, values []string) (map[string]string, error) {
+	v.calls++
+	result := make(map[string]string)
+	for _, value := range values {
+		key := piiType + ":" + value
+		if _, ok := v.tokens[key]; !ok {
+			v.tokens[key] = fmt.Sprintf("tok_%s_%d", piiType, len(v.tokens)+1)
+		}
+		result[value] = v.tokens[key]
+	}
+	return result, nil
+}
+
+func runPII(t *testing.T, config *models.PIIConfig, options *processor.PIIOptions, records []map[string]interface{}) ([]map[string]interface{}, *processor.Processor, error) {
+	t.Helper()
+	proc := processor.NewProcessor(&models.ProcessorConfig{PII: config})
+	proc.SetPIIOptions(options)
+	result, err := proc.Process(records)
+	return result, proc, err
+}
+
+func TestPIIMask(t *testing.T) {
+	records := []map[string]interface{}{{
+		"remark": "联系人电话 138-1234-5678，身份证 11010519491231002X，银行卡 4111 1111 1111 1111，邮箱 zhang.san@example.com",
+		"phone":  float64(13912345678),
+	}}
+	result, proc, err := runPII(t, &models.PIIConfig{Fields: []models.PIIFieldPolicy{
+		{Field: "remark"},
+		{Field: "phone", Type: models.PIITypePhone},
+	}}, nil, records)
+	if err != nil {
+		t.Fatalf("处理失败: %v", err)
+	}
+
+	want := "联系人电话 138-****-5678，身份证 110105********002X，银行卡 4111 11** **** 1111，邮箱 z***@example.com"
+	if result[0]["remark"] != want {
+		t.Errorf("文本脱敏结果错误:\n got %v\nwant %v", result[0]["remark"], want)
+	}
+	if result[0]["phone"] != "139****5678" {
+		t.Errorf("整字段脱敏结果错误: %v", result[0]["phone"])
+	}
+	if !strings.Contains(records[0]["remark"].(string), "138-1234-5678") {
+		t.Error("不应修改原始记录")
+	}
+	if len(proc.PIIResults()) != 5 {
+		t.Errorf("PII 处理结果数量错误: %+v", proc.PIIResults())
+	}
+}
+
+func TestPIIDetectionValidation(t *testing.T) {
+	records := []map[string]interface{}{{
+		// 校验码错误的身份证号、不满足 Luhn 的卡号、订单号中的数字不应被识别
+		"remark": "身份证 110105194912310021，卡号 4111111111111112，订单号 2023100113812345678",
+	}}
+	result, proc, err := runPII(t, &models.PIIConfig{Fields: []models.PIIFieldPolicy{{Field: "remark"}}}, nil, records)
+	if err != nil {
+		t.Fatalf("处理失败: %v", err)
+	}
+	if result[0]["remark"] != records[0]["remark"] {
+		t.Errorf("无效号码不应被脱敏: %v", result[0]["remark"])
+	}
+	if len(proc.PIIResults()) != 0 {
+		t.Errorf("不应有 PII 处理结果: %+v", proc.PIIResults())
+	}
+}
+
+func TestPIIHash(t *testing.T) {
+	config := &models.PIIConfig{Fields: []models.PIIFieldPolicy{{Field: "phone", Type: models.PIITypePhone, Action: models.PIIActionHash}}}
+	records := []map[string]interface{}{{"phone": "138 1234 5678"}, {"phone": "+86 13812345678"}, {"phone": "13987654321"}}
+
+	result, _, err := runPII(t, config, &processor.PIIOptions{HashSalt: []byte("salt")}, records)
+	if err != nil {
+		t.Fatalf("处理失败: %v", err)
+	}
+	if result[0]["phone"] != result[1]["phone"] {
+		t.Error("相同号码的不同写法应得到相同哈希")
+	}
+	if result[0]["phone"] == result[2]["phone"] || len(result[0]["phone"].(string)) != 64 {
+		t.Errorf("哈希结果错误: %v", result)
+	}
+
+	other, _, _ := runPII(t, config, &processor.PIIOptions{HashSalt: []byte("other")}, records[:1])
+	if other[0]["phone"] == result[0]["phone"] {
+		t.Error("不同的盐应得到不同的哈希")
+	}
+
+	if _, _, err := runPII(t, config, nil, records); err == nil {
+		t.Error("未配置哈希盐时应返回错误")
+	}
+}
+
+func TestPIITokenize(t *testing.T) {
+	vault := &fakeTokenVault{tokens: make(map[string]string)}
+	config := &models.PIIConfig{Fields: []models.PIIFieldPolicy{{Field: "contact", Action: models.PIIActionTokenize}}}
+	records := []map[string]interface{}{
+		{"contact": "电话 13812345678"},
+		{"contact": "电话 138-1234-5678，邮箱 Li@Example.com"},
+	}
+
+	result, _, err := runPII(t, config, &processor.PIIOptions{Vault: vault}, records)
+	if err != nil {
+		t.Fatalf("处理失败: %v", err)
+	}
+	if !strings.HasPrefix(result[0]["contact"].(string), "电话 tok_phone_") {
+		t.Errorf("令牌化结果错误: %v", result[0]["contact"])
+	}
+	first := strings.TrimPrefix(result[0]["contact"].(string), "电话 ")
+	if !strings.HasPrefix(result[1]["contact"].(string), "电话 "+first+"，邮箱 tok_email_") {
+		t.Errorf("相同号码应得到相同令牌: %v", result[1]["contact"])
+	}
+	if vault.calls != 2 {
+		t.Errorf("每种类型应只调用一次令牌库, got %d", vault.calls)
+	}
+
+	if _, _, err := runPII(t, config, nil, records); err == nil {
+		t.Error("未配置令牌库时应返回错误")
+	}
+}
+
+func TestPIIScanAll(t *testing.T) {
+	records := []map[string]interface{}{{
+		"name":  "张三",
+		"email": "zhangsan@example.com",
+		"profile": map[string]interface{}{
+			"phones": []interface{}{"13812345678", "13987654321"},
+		},
+		"note": "手机 13700001111",
+	}}
+	result, proc, err := runPII(t, &models.PIIConfig{
+		Fields:  []models.PIIFieldPolicy{{Field: "note", Types: []string{models.PIITypeEmail}}},
+		ScanAll: true,
+	}, nil, records)
+	if err != nil {
+		t.Fatalf("处理失败: %v", err)
+	}
+
+	if result[0]["email"] != "z***@example.com" {
+		t.Errorf("邮箱未脱敏: %v", result[0]["email"])
+	}
+	phones := result[0]["profile"].(map[string]interface{})["phones"].([]interface{})
+	if phones[0] != "138****5678" || phones[1] != "139****4321" {
+		t.Errorf("嵌套数组未脱敏: %v", phones)
+	}
+	if result[0]["note"] != "手机 13700001111" {
+		t.Errorf("已配置策略的字段不应被 scan_all 处理: %v", result[0]["note"])
+	}
+
+	var phoneResult *models.PIIResult
+	for i, r := range proc.PIIResults() {
+		if r.Field == "profile.phones[*]" {
+			phoneResult = &proc.PIIResults()[i]
+		}
+	}
+	if phoneResult == nil || phoneResult.Count != 2 || phoneResult.Type != models.PIITypePhone {
+		t.Errorf("嵌套数组的处理结果错误: %+v", proc.PIIResults())
+	}
+}
+
+func TestPIIRejectedRecords(t *testing.T) {
+	min := float64(0)
+	config := &models.ProcessorConfig{
+		ValidationRules: []models.ValidationRule{{Name: "金额非负", Field: "amount", Type: "range", Min: &min}},
+		PII: &models.PIIConfig{Fields: []models.PIIFieldPolicy{
+			{Field: "phone", Type: models.PIITypePhone},
+			{Field: "email", Type: models.PIITypeEmail, Action: models.PIIActionHash},
+		}},
+	}
+	records := []map[string]interface{}{
+		{"phone": "13812345678", "email": "zhangsan@example.com", "amount": float64(10)},
+		{"phone": "13987654321", "email": "lisi@example.com", "amount": float64(-1)},
+	}
+
+	proc := processor.NewProcessor(config)
+	proc.SetPIIOptions(&processor.PIIOptions{HashSalt: []byte("salt")})
+	result, err := proc.Process(records)
+	if err != nil {
+		t.Fatalf("处理失败: %v", err)
+	}
+	if len(result) != 1 || result[0]["phone"] != "138****5678" {
+		t.Fatalf("通过校验的记录处理结果错误: %v", result)
+	}
+
+	// 校验阶段在 PII 阶段之前，被拒绝的记录写入死信队列前也要脱敏
+	rejected := proc.Rejected()
+	if len(rejected) != 1 {
+		t.Fatalf("期望 1 条被拒绝的记录，实际 %d 条", len(rejected))
+	}
+	if rejected[0].Record["phone"] != "139****4321" {
+		t.Errorf("死信记录的手机号未脱敏: %v", rejected[0].Record["phone"])
+	}
+	if email, _ := rejected[0].Record["email"].(string); email == "lisi@example.com" || len(email) != 64 {
+		t.Errorf("死信记录的邮箱未哈希: %v", rejected[0].Record["email"])
+	}
+	if !rejected[0].PIIProtected {
+		t.Error("脱敏后的死信记录应标记为 pii_protected")
+	}
+	if records[1]["phone"] != "13987654321" {
+		t.Error("不应修改原始记录")
+	}
+
+	// 哈希盐不可用时退化为遮盖，不能保存明文
+	proc = processor.NewProcessor(config)
+	if _, err := proc.Process(records); err == nil {
+		t.Fatal("未配置哈希盐时处理应失败")
+	}
+	rejected = proc.Rejected()
+	if len(rejected) != 1 || rejected[0].Record["email"] != "l***@example.com" || rejected[0].Record["phone"] != "139****4321" {
+		t.Errorf("处理失败时死信记录未遮盖: %+v", rejected)
+	}
+
+	// 重放已脱敏的记录时跳过 PII 阶段，不会对哈希值再次哈希
+	replay := map[string]interface{}{"phone": "139****4321", "email": rejected[0].Record["email"], "amount": float64(1)}
+	proc = processor.NewProcessor(config)
+	proc.SetPIIApplied(true)
+	result, err = proc.Validate([]map[string]interface{}{replay})
+	if err != nil {
+		t.Fatalf("重放失败: %v", err)
+	}
+	if len(result) != 1 || result[0]["email"] != replay["email"] || len(proc.PIIResults()) != 0 {
+		t.Errorf("重放已脱敏的记录不应再经过 PII 阶段: %v", result)
+	}
+}
+
+func TestReplayStorageDeadLetter(t *testing.T) {
+	config := &models.ProcessorConfig{
+		CleaningRules: []models.CleaningRule{{Field: "title", Type: "trim"}},
+		PII:           &models.PIIConfig{Fields: []models.PIIFieldPolicy{{Field: "phone", Type: models.PIITypePhone}}},
+	}
+	record := &models.DeadLetterRecord{
+		Stage:  models.DeadLetterStageStorage,
+		Record: map[string]interface{}{"title": " a ", "phone": "13987654321"},
+	}
+
+	// 通过 API 修改过的记录未脱敏，重放时只经过 PII 阶段，不重复清洗
+	result, err := processor.NewProcessor(config).Replay(record)
+	if err != nil {
+		t.Fatalf("重放失败: %v", err)
+	}
+	if len(result) != 1 || result[0]["phone"] != "139****4321" || result[0]["title"] != " a " {
+		t.Errorf("重放结果错误: %v", result)
+	}
+
+	// 已脱敏的记录原样写入
+	record.PIIProtected = true
+	record.Record = map[string]interface{}{"phone": "139****4321"}
+	proc := processor.NewProcessor(config)
+	result, err = proc.Replay(record)
+	if err != nil {
+		t.Fatalf("重放失败: %v", err)
+	}
+	if len(result) != 1 || result[0]["phone"] != "139****4321" || len(proc.PIIResults()) != 0 {
+		t.Errorf("已脱敏的记录不应再经过 PII 阶段: %v", result)
+	}
+}
+
+func TestValidatePIIConfig(t *testing.T) {
+	if err := processor.ValidatePIIConfig(&models.PIIConfig{}); err == nil {
+		t.Error("未配置字段时应返回错误")
+	}
+	if err := processor.ValidatePIIConfig(&models.PIIConfig{Fields: []models.PIIFieldPolicy{{Field: "a", Action: "encrypt"}}}); err == nil {
+		t.Error("不支持的处理方式应返回错误")
+	}
+	if err := processor.ValidatePIIConfig(&models.PIIConfig{Fields: []models.PIIFieldPolicy{{Field: "a", Type: "passport"}}}); err == nil {
+		t.Error("不支持的类型应返回错误")
+	}
+}
+
+func TestVaultCipher(t *testing.T) {
+	key, err := processor.ParseVaultKey("MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	if err != nil {
+		t.Fatalf("解析密钥失败: %v", err)
+	}
+	cipher, err := processor.NewVaultCipher(key)
+	if err != nil {
+		t.Fatalf("创建加密器失败: %v", err)
+	}
+
+	sealed, err := cipher.Seal("13812345678")
+	if err != nil {
+		t.Fatalf("加密失败: %v", err)
+	}
+	if strings.Contains(sealed, "13812345678") {
+		t.Error("密文不应包含原值")
+	}
+	plain, err := cipher.Open(sealed)
+	if err != nil || plain != "13812345678" {
+		t.Errorf("解密结果错误: %v, %v", plain, err)
+	}
+
+	other, _ := processor.NewVaultCipher([]byte(strings.Repeat("k", 32)))
+	if _, err := other.Open(sealed); err == nil {
+		t.Error("使用其他密钥解密应失败")
+	}
+	if cipher.LookupHash("phone", "13812345678") != cipher.LookupHash("phone", "13812345678") {
+		t.Error("查找哈希应是确定的")
+	}
+	if _, err := processor.ParseVaultKey("short"); err == nil {
+		t.Error("长度错误的密钥应返回错误")
+	}
+}
@@ -1,9 +1,11 @@
 package unit
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/datafusion/worker/internal/cache"
 	"github.com/datafusion/worker/internal/models"
 	"github.com/datafusion/worker/internal/processor"
 )
@@ -33,6 +35,41 @@ func TestEnhancedCleaner(t *testing.T) {
 		}
 	})
 
+	t.Run("嵌套字段与数组通配", func(t *testing.T) {
+		rules := []models.CleaningRule{
+			{Name: "trim_author", Field: "author.name", Type: "trim"},
+			{Name: "trim_tags", Field: "$.tags[*]", Type: "trim"},
+			{Name: "missing", Field: "meta.none", Type: "trim"},
+		}
+
+		cleaner := processor.NewEnhancedCleaner(rules)
+		data := []map[string]interface{}{
+			{
+				"author": map[string]interface{}{"name": "  Alice "},
+				"tags":   []interface{}{" a ", "b  "},
+			},
+		}
+
+		result, err := cleaner.Clean(data)
+		if err != nil {
+			t.Fatalf("清洗失败: %v", err)
+		}
+
+		if name := result[0]["author"].(map[string]interface{})["name"]; name != "Alice" {
+			t.Errorf("嵌套字段清洗失败，得到 '%v'", name)
+		}
+		tags := result[0]["tags"].([]interface{})
+		if tags[0] != "a" || tags[1] != "b" {
+			t.Errorf("数组通配清洗失败，得到 %v", tags)
+		}
+		if _, ok := result[0]["meta"]; ok {
+			t.Error("不存在的字段不应被创建")
+		}
+		if data[0]["author"].(map[string]interface{})["name"] != "  Alice " {
+			t.Error("清洗修改了原始记录")
+		}
+	})
+
 	t.Run("移除 HTML 标签", func(t *testing.T) {
 		rules := []models.CleaningRule{
 			{
@@ -269,4 +306,278 @@ func TestProcessor(t *testing.T) {
 			t.Errorf("处理空数据失败，期望 0 条记录，得到 %d 条", len(result))
 		}
 	})
+
+	t.Run("清洗失败的记录进入拒绝列表", func(t *testing.T) {
+		config := &models.ProcessorConfig{
+			CleaningRules: []models.CleaningRule{
+				{Name: "trim_name", Field: "name", Type: "trim"},
+				{Name: "format_date", Field: "date", Type: "date_format", Pattern: "2006-01-02"},
+			},
+		}
+		proc := processor.NewProcessor(config)
+
+		data := []map[string]interface{}{
+			{"name": " Alice ", "date": "2024-01-15"},
+			{"name": " Bob ", "date": "not a date"},
+		}
+		result, err := proc.Process(data)
+		if err != nil {
+			t.Fatalf("处理失败: %v", err)
+		}
+		if len(result) != 1 || result[0]["name"] != "Alice" {
+			t.Fatalf("期望保留 1 条清洗后的记录，得到 %v", result)
+		}
+
+		rejected := proc.Rejected()
+		if len(rejected) != 1 {
+			t.Fatalf("期望 1 条拒绝记录，得到 %d 条", len(rejected))
+		}
+		if rejected[0].Stage != models.DeadLetterStageClean || rejected[0].Rule != "format_date" {
+			t.Errorf("拒绝记录的阶段或规则错误: %+v", rejected[0])
+		}
+		// 拒绝记录保留清洗前的原始数据，便于修改后重放
+		if rejected[0].Record["name"] != " Bob " {
+			t.Errorf("拒绝记录应保留原始数据，得到 %v", rejected[0].Record)
+		}
+		if rejected[0].Error == "" {
+			t.Error("拒绝记录缺少错误信息")
+		}
+
+		// 再次处理时重置拒绝列表
+		if _, err := proc.Process(data[:1]); err != nil {
+			t.Fatalf("处理失败: %v", err)
+		}
+		if len(proc.Rejected()) != 0 {
+			t.Errorf("期望拒绝列表被重置，得到 %d 条", len(proc.Rejected()))
+		}
+	})
+}
+
+func TestPersistentDeduplicator(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("去重键在提交后跨批次生效", func(t *testing.T) {
+		store := processor.NewCacheDedupStore(cache.NewMemoryCache(time.Minute))
+		config := &models.DeduplicationConfig{Strategy: "field_based", Fields: []string{"user.email"}}
+		dedup, err := processor.NewPersistentDeduplicator(config, store, "task:1")
+		if err != nil {
+			t.Fatalf("创建去重器失败: %v", err)
+		}
+
+		batch := []map[string]interface{}{
+			{"id": 1, "user": map[string]interface{}{"email": "a@example.com"}},
+			{"id": 2, "user": map[string]interface{}{"email": "b@example.com"}},
+			{"id": 3, "user": map[string]interface{}{"email": "a@example.com"}}, // 批次内重复
+		}
+
+		result, err := dedup.Deduplicate(ctx, batch)
+		if err != nil {
+			t.Fatalf("去重失败: %v", err)
+		}
+		if len(result.Records) != 2 || result.Duplicates != 1 {
+			t.Fatalf("期望保留 2 条、去除 1 条，得到 %d 条、去除 %d 条", len(result.Records), result.Duplicates)
+		}
+
+		// 未提交时（如写入失败）重试不应被判为重复
+		if retry, _ := dedup.Deduplicate(ctx, batch); len(retry.Records) != 2 {
+			t.Errorf("未提交的去重键不应生效，得到 %d 条", len(retry.Records))
+		}
+
+		if err := dedup.Commit(ctx, result); err != nil {
+			t.Fatalf("提交去重键失败: %v", err)
+		}
+
+		// 使用同一存储的新去重器（模拟重启或其他副本）
+		other, _ := processor.NewPersistentDeduplicator(config, store, "task:1")
+		next, err := other.Deduplicate(ctx, append(batch, map[string]interface{}{
+			"id": 4, "user": map[string]interface{}{"email": "c@example.com"},
+		}))
+		if err != nil {
+			t.Fatalf("去重失败: %v", err)
+		}
+		if len(next.Records) != 1 || next.Duplicates != 3 {
+			t.Errorf("期望只保留新记录，得到 %d 条、去除 %d 条", len(next.Records), next.Duplicates)
+		}
+
+		// 不同任务的去重键互不影响
+		another, _ := processor.NewPersistentDeduplicator(config, store, "task:2")
+		if result, _ := another.Deduplicate(ctx, batch); len(result.Records) != 2 {
+			t.Errorf("不同任务不应共享去重键，得到 %d 条", len(result.Records))
+		}
+	})
+
+	t.Run("时间窗口过期后不再去重", func(t *testing.T) {
+		store := processor.NewCacheDedupStore(cache.NewMemoryCache(time.Minute))
+		dedup, err := processor.NewPersistentDeduplicator(&models.DeduplicationConfig{
+			Strategy:   "time_window",
+			TimeWindow: "50ms",
+		}, store, "task:1")
+		if err != nil {
+			t.Fatalf("创建去重器失败: %v", err)
+		}
+
+		data := []map[string]interface{}{{"id": 1}}
+		first, _ := dedup.Deduplicate(ctx, data)
+		dedup.Commit(ctx, first)
+
+		if result, _ := dedup.Deduplicate(ctx, data); len(result.Records) != 0 {
+			t.Errorf("时间窗口内应被去重，得到 %d 条", len(result.Records))
+		}
+		time.Sleep(100 * time.Millisecond)
+		if result, _ := dedup.Deduplicate(ctx, data); len(result.Records) != 1 {
+			t.Errorf("超过时间窗口后不应被去重，得到 %d 条", len(result.Records))
+		}
+	})
+
+	t.Run("近似重复文本", func(t *testing.T) {
+		article := "The city council approved the new public transport plan on Monday, adding twelve bus routes " +
+			"and extending the metro line to the airport. Officials said construction will begin next spring and " +
+			"the project is expected to reduce traffic congestion in the downtown area significantly. According to " +
+			"the transport department, the expansion will cost roughly four billion dollars over five years, funded " +
+			"jointly by the municipal budget and national infrastructure grants. Residents in the northern districts, " +
+			"who currently face commutes of more than an hour, welcomed the decision, while some business owners " +
+			"along the planned route expressed concern about disruption during construction. The mayor promised " +
+			"that detailed timetables and compensation schemes for affected shops would be published before the " +
+			"end of the month, and that public hearings would be held in every district."
+		store := processor.NewCacheDedupStore(cache.NewMemoryCache(time.Minute))
+		config := &models.DeduplicationConfig{
+			Strategy:  "near_duplicate",
+			Fields:    []string{"title", "content"},
+			Threshold: intPtr(6),
+			Action:    "annotate",
+		}
+		dedup, err := processor.NewPersistentDeduplicator(config, store, "task:1")
+		if err != nil {
+			t.Fatalf("创建去重器失败: %v", err)
+		}
+
+		first, err := dedup.Deduplicate(ctx, []map[string]interface{}{
+			{"id": "a1", "title": "Transport plan approved", "content": article + " Published 2024-01-01 08:00."},
+		})
+		if err != nil {
+			t.Fatalf("去重失败: %v", err)
+		}
+		if err := dedup.Commit(ctx, first); err != nil {
+			t.Fatalf("提交指纹失败: %v", err)
+		}
+
+		// 转载：只有发布时间不同；另一篇内容完全不同
+		result, err := dedup.Deduplicate(ctx, []map[string]interface{}{
+			{"id": "b7", "title": "Transport plan approved", "content": article + " Published 2024-01-02 10:30."},
+			{"id": "c3", "title": "Local team wins championship", "content": "The home team won the final match " +
+				"by three goals, securing the league title for the first time in a decade amid celebrations."},
+		})
+		if err != nil {
+			t.Fatalf("去重失败: %v", err)
+		}
+		if len(result.Records) != 2 || result.Duplicates != 1 {
+			t.Fatalf("annotate 应保留全部记录并标注 1 条，得到 %d 条、重复 %d 条", len(result.Records), result.Duplicates)
+		}
+		if result.Records[0]["near_duplicate_of"] != "a1" {
+			t.Errorf("转载文章应标注原文 ID，得到 %v", result.Records[0]["near_duplicate_of"])
+		}
+		if _, ok := result.Records[1]["near_duplicate_of"]; ok {
+			t.Error("不相关的文章不应被标注")
+		}
+
+		// drop 模式丢弃近似重复
+		config.Action = "drop"
+		dropper, _ := processor.NewPersistentDeduplicator(config, store, "task:1")
+		result, _ = dropper.Deduplicate(ctx, []map[string]interface{}{
+			{"id": "d9", "title": "Transport plan approved", "content": article + " Advertisement: subscribe now to get fifty percent off!"},
+		})
+		if len(result.Records) != 0 || result.Duplicates != 1 {
+			t.Errorf("drop 应丢弃近似重复，得到 %d 条", len(result.Records))
+		}
+	})
+
+	t.Run("阈值为 0 时只去除指纹相同的文本", func(t *testing.T) {
+		store := processor.NewCacheDedupStore(cache.NewMemoryCache(time.Minute))
+		dedup, err := processor.NewPersistentDeduplicator(&models.DeduplicationConfig{
+			Strategy:  "near_duplicate",
+			Fields:    []string{"content"},
+			Threshold: intPtr(0),
+		}, store, "task:1")
+		if err != nil {
+			t.Fatalf("创建去重器失败: %v", err)
+		}
+
+		text := "国务院常务会议今天召开，会议部署进一步推动大规模设备更新和消费品以旧换新，加快培育新质生产力，推动经济高质量发展。"
+		first, _ := dedup.Deduplicate(ctx, []map[string]interface{}{{"id": "a1", "content": text + "来源：新华社 2024-03-01"}})
+		if err := dedup.Commit(ctx, first); err != nil {
+			t.Fatalf("提交指纹失败: %v", err)
+		}
+		result, err := dedup.Deduplicate(ctx, []map[string]interface{}{
+			{"id": "b1", "content": text + "来源：新华社 2024-03-01"},
+			{"id": "b2", "content": text + "来源：新华社 2024-03-02"},
+		})
+		if err != nil {
+			t.Fatalf("去重失败: %v", err)
+		}
+		if len(result.Records) != 1 || result.Records[0]["id"] != "b2" {
+			t.Errorf("阈值为 0 时只应去除相同文本，得到 %v", result.Records)
+		}
+	})
+
+	t.Run("指纹分段随时间窗口过期", func(t *testing.T) {
+		memory := cache.NewMemoryCache(time.Minute)
+		dedup, err := processor.NewPersistentDeduplicator(&models.DeduplicationConfig{
+			Strategy:   "near_duplicate",
+			Fields:     []string{"content"},
+			TimeWindow: "50ms",
+		}, processor.NewCacheDedupStore(memory), "task:1")
+		if err != nil {
+			t.Fatalf("创建去重器失败: %v", err)
+		}
+
+		first, _ := dedup.Deduplicate(ctx, []map[string]interface{}{{"id": "a1", "content": "今日天气晴朗，气温回升，适合户外活动。"}})
+		if err := dedup.Commit(ctx, first); err != nil {
+			t.Fatalf("提交指纹失败: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		stats, _ := memory.GetStats()
+		if stats["item_count"] == 0 || stats["expired_count"] != stats["item_count"] {
+			t.Errorf("指纹分段键应随时间窗口过期: %v", stats)
+		}
+	})
+
+	t.Run("保存时报告无效配置", func(t *testing.T) {
+		invalid := []*models.DeduplicationConfig{
+			{Strategy: "unknown"},
+			{Strategy: "field_based"},
+			{Strategy: "time_window", TimeWindow: "1 day"},
+			{Strategy: "near_duplicate"},
+			{Strategy: "near_duplicate", Fields: []string{"content"}, Threshold: intPtr(40)},
+			{Strategy: "near_duplicate", Fields: []string{"content"}, Action: "merge"},
+		}
+		for _, cfg := range invalid {
+			if err := processor.ValidateDeduplicationConfig(cfg); err == nil {
+				t.Errorf("配置 %+v 应校验失败", cfg)
+			}
+		}
+	})
 }
+
+func TestDeduplicatorNearDuplicate(t *testing.T) {
+	dedup := processor.NewDeduplicator(&processor.DeduplicatorConfig{
+		Strategy:  processor.StrategyNearDuplicate,
+		Fields:    []string{"content"},
+		CacheSize: 1000,
+	})
+	defer dedup.Close()
+
+	text := "国务院常务会议今天召开，会议部署进一步推动大规模设备更新和消费品以旧换新，加快培育新质生产力，推动经济高质量发展。"
+	result, err := dedup.Deduplicate([]map[string]interface{}{
+		{"content": text + "来源：新华社 2024-03-01"},
+		{"content": text + "来源：新华社 2024-03-02"},
+		{"content": "今日天气晴朗，气温回升，适合户外活动，市民纷纷走出家门踏青赏花。"},
+	})
+	if err != nil {
+		t.Fatalf("去重失败: %v", err)
+	}
+	if len(result) != 2 {
+		t.Errorf("期望去除 1 条近似重复的中文文本，得到 %d 条", len(result))
+	}
+}
+
+func intPtr(v int) *int { return &v }
@@ -0,0 +1,96 @@
+package unit
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/datafusion/worker/internal/config"
+	"github.com/datafusion/worker/internal/schedule"
+)
+
+func pickedIDs(picked []schedule.Candidate) []int64 {
+	ids := make([]int64, len(picked))
+	for i, c := range picked {
+		ids[i] = c.ID
+	}
+	return ids
+}
+
+func TestPickByPriority(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	candidates := []schedule.Candidate{
+		{ID: 1, Queue: "rpa", Tenant: "a", Due: base},
+		{ID: 2, Queue: "api", Tenant: "a", QueuePriority: 10, Due: base.Add(time.Minute)},
+		{ID: 3, Queue: "rpa", Tenant: "a", Priority: 5, Due: base.Add(time.Hour)},
+		{ID: 4, Queue: "api", Tenant: "a", QueuePriority: 10, Due: base},
+	}
+
+	got := pickedIDs(schedule.Pick(candidates, 4, nil, nil))
+	// 队列优先级 > 任务优先级 > 到期时间
+	want := []int64{4, 2, 3, 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Pick = %v, 期望 %v", got, want)
+	}
+}
+
+func TestPickFairAcrossTenants(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var candidates []schedule.Candidate
+	// 租户 a 的任务更早到期且数量多，租户 b 只有两个
+	for i := 1; i <= 4; i++ {
+		candidates = append(candidates, schedule.Candidate{ID: int64(i), Queue: "default", Tenant: "a", Due: base.Add(time.Duration(i) * time.Second)})
+	}
+	candidates = append(candidates,
+		schedule.Candidate{ID: 10, Queue: "default", Tenant: "b", Due: base.Add(time.Hour)},
+		schedule.Candidate{ID: 11, Queue: "default", Tenant: "b", Due: base.Add(2 * time.Hour)},
+	)
+
+	got := pickedIDs(schedule.Pick(candidates, 4, nil, nil))
+	want := []int64{1, 10, 2, 11}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Pick = %v, 期望租户交替 %v", got, want)
+	}
+
+	// 租户 a 已有 2 个任务在执行，先补足租户 b
+	got = pickedIDs(schedule.Pick(candidates, 3, nil, map[string]int{"a": 2}))
+	want = []int64{10, 11, 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Pick = %v, 期望 %v", got, want)
+	}
+}
+
+func TestPickQueueCapacity(t *testing.T) {
+	candidates := []schedule.Candidate{
+		{ID: 1, Queue: "rpa", Tenant: "a", QueuePriority: 10},
+		{ID: 2, Queue: "rpa", Tenant: "b", QueuePriority: 10},
+		{ID: 3, Queue: "rpa", Tenant: "c", QueuePriority: 10},
+		{ID: 4, Queue: "api", Tenant: "a"},
+		{ID: 5, Queue: "full", Tenant: "a", QueuePriority: 20},
+	}
+	free := map[string]int{"rpa": 2, "full": 0}
+
+	got := pickedIDs(schedule.Pick(candidates, 5, free, nil))
+	want := []int64{1, 2, 4}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Pick = %v, 期望 %v", got, want)
+	}
+	if free["rpa"] != 2 {
+		t.Error("Pick 不应修改传入的 queueFree")
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := config.ParseLabels(" chrome=true, region = cn ,,")
+	if err != nil {
+		t.Fatalf("解析标签失败: %v", err)
+	}
+	want := map[string]string{"chrome": "true", "region": "cn"}
+	if !reflect.DeepEqual(labels, want) {
+		t.Errorf("ParseLabels = %v, 期望 %v", labels, want)
+	}
+
+	if _, err := config.ParseLabels("chrome"); err == nil {
+		t.Error("缺少 = 的标签应返回错误")
+	}
+}
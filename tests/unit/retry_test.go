@@ -0,0 +1,218 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/retry"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func TestRetryHTTPStatus(t *testing.T) {
+	base := errors.New("API 返回错误状态码")
+	cases := []struct {
+		code int
+		want retry.Class
+	}{
+		{http.StatusUnauthorized, retry.ClassAuth},
+		{http.StatusForbidden, retry.ClassAuth},
+		{http.StatusTooManyRequests, retry.ClassRateLimited},
+		{http.StatusRequestTimeout, retry.ClassTransient},
+		{http.StatusBadGateway, retry.ClassTransient},
+		{http.StatusBadRequest, retry.ClassConfig},
+		{http.StatusNotFound, retry.ClassConfig},
+	}
+	for _, c := range cases {
+		// 外层包装后仍能识别分类
+		err := fmt.Errorf("数据采集失败: %w", retry.HTTPStatus(c.code, "", base))
+		if got := retry.ClassOf(err); got != c.want {
+			t.Errorf("HTTP %d 分类 = %s, 期望 %s", c.code, got, c.want)
+		}
+		if !errors.Is(err, base) {
+			t.Errorf("HTTP %d 分类后应保留原始错误", c.code)
+		}
+	}
+
+	err := retry.HTTPStatus(http.StatusTooManyRequests, "30", base)
+	if got := retry.RetryAfterOf(err); got != 30*time.Second {
+		t.Errorf("Retry-After = %v, 期望 30s", got)
+	}
+
+	if retry.Retryable(retry.ClassAuth) || retry.Retryable(retry.ClassConfig) {
+		t.Error("认证错误和配置错误不应重试")
+	}
+	if !retry.Retryable(retry.ClassTransient) || !retry.Retryable(retry.ClassRateLimited) || !retry.Retryable(retry.ClassUnknown) {
+		t.Error("临时错误、限流和未分类错误应重试")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if got := retry.ParseRetryAfter("120", now); got != 2*time.Minute {
+		t.Errorf("秒数格式 = %v, 期望 2m", got)
+	}
+	if got := retry.ParseRetryAfter("Mon, 01 Jan 2024 00:00:45 GMT", now); got != 45*time.Second {
+		t.Errorf("HTTP 日期格式 = %v, 期望 45s", got)
+	}
+	for _, value := range []string{"", "-1", "soon", "Sun, 31 Dec 2023 23:59:00 GMT"} {
+		if got := retry.ParseRetryAfter(value, now); got != 0 {
+			t.Errorf("ParseRetryAfter(%q) = %v, 期望 0", value, got)
+		}
+	}
+}
+
+func TestRetryClassOf(t *testing.T) {
+	if got := retry.ClassOf(errors.New("未知错误")); got != retry.ClassUnknown {
+		t.Errorf("普通错误分类 = %s, 期望 unknown", got)
+	}
+	if got := retry.ClassOf(fmt.Errorf("执行超时: %w", context.DeadlineExceeded)); got != retry.ClassTransient {
+		t.Errorf("超时分类 = %s, 期望 transient", got)
+	}
+	if got := retry.ClassOf(nil); got != "" {
+		t.Errorf("nil 分类 = %s, 期望为空", got)
+	}
+
+	sqlCases := []struct {
+		err  error
+		want retry.Class
+	}{
+		{&pq.Error{Code: "42601"}, retry.ClassConfig},    // 语法错误
+		{&pq.Error{Code: "42P01"}, retry.ClassConfig},    // 表不存在
+		{&pq.Error{Code: "28P01"}, retry.ClassAuth},      // 密码错误
+		{&pq.Error{Code: "42501"}, retry.ClassAuth},      // 权限不足
+		{&pq.Error{Code: "40001"}, retry.ClassTransient}, // 序列化失败
+		{&pq.Error{Code: "57P01"}, retry.ClassTransient}, // 服务端关闭
+		{&mysql.MySQLError{Number: 1064}, retry.ClassConfig},
+		{&mysql.MySQLError{Number: 1045}, retry.ClassAuth},
+		{&mysql.MySQLError{Number: 1213}, retry.ClassTransient},
+	}
+	for _, c := range sqlCases {
+		if got := retry.ClassOf(retry.SQL(c.err)); got != c.want {
+			t.Errorf("SQL 错误 %v 分类 = %s, 期望 %s", c.err, got, c.want)
+		}
+	}
+}
+
+func TestRetryCombine(t *testing.T) {
+	auth := retry.Auth(errors.New("401"))
+	limited := retry.RateLimited(errors.New("429"), 10*time.Second)
+	config := retry.Config(errors.New("400"))
+
+	// 任一目标可重试时整体可重试，并保留最长的 Retry-After
+	err := retry.Combine(errors.New("2 个目标失败"), []error{auth, limited})
+	if got := retry.ClassOf(err); got != retry.ClassRateLimited {
+		t.Errorf("合并分类 = %s, 期望 rate_limited", got)
+	}
+	if got := retry.RetryAfterOf(err); got != 10*time.Second {
+		t.Errorf("合并后的 Retry-After = %v, 期望 10s", got)
+	}
+
+	// 全部不可重试时取第一个目标的分类
+	err = retry.Combine(errors.New("2 个目标失败"), []error{config, auth})
+	if got := retry.ClassOf(err); got != retry.ClassConfig {
+		t.Errorf("合并分类 = %s, 期望 config", got)
+	}
+}
+
+func TestNewRetryPolicy(t *testing.T) {
+	// 未配置时使用默认策略
+	policy := retry.NewPolicy(0, nil)
+	if policy.MaxRetries != 3 || policy.InitialDelay != 5*time.Second || policy.MaxDelay != time.Minute {
+		t.Errorf("默认策略 = %+v", policy)
+	}
+
+	// max_retries 覆盖默认重试次数
+	if policy := retry.NewPolicy(5, nil); policy.MaxRetries != 5 {
+		t.Errorf("max_retries=5 时重试次数 = %d", policy.MaxRetries)
+	}
+
+	// max_attempts 优先于 max_retries，1 表示不重试
+	if policy := retry.NewPolicy(5, &models.RetryPolicy{MaxAttempts: 1}); policy.MaxRetries != 0 {
+		t.Errorf("max_attempts=1 时重试次数 = %d, 期望 0", policy.MaxRetries)
+	}
+	if policy := retry.NewPolicy(5, &models.RetryPolicy{MaxAttempts: 3}); policy.MaxRetries != 2 {
+		t.Errorf("max_attempts=3 时重试次数 = %d, 期望 2", policy.MaxRetries)
+	}
+	// 只配置了其他字段时仍使用 max_retries
+	if policy := retry.NewPolicy(5, &models.RetryPolicy{InitialDelaySeconds: 1}); policy.MaxRetries != 5 {
+		t.Errorf("未配置 max_attempts 时重试次数 = %d, 期望 5", policy.MaxRetries)
+	}
+
+	// 最大延迟不小于初始延迟，无效的退避因子和抖动使用默认值
+	policy = retry.NewPolicy(0, &models.RetryPolicy{InitialDelaySeconds: 120, MaxDelaySeconds: 30, BackoffFactor: 0.5, Jitter: 2})
+	if policy.MaxDelay != 2*time.Minute || policy.BackoffFactor != 2 || policy.Jitter != 0 {
+		t.Errorf("策略 = %+v", policy)
+	}
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	policy := retry.NewPolicy(2, nil)
+	base := errors.New("采集失败")
+
+	if policy.ShouldRetry(0, nil) {
+		t.Error("没有错误时不应重试")
+	}
+	if !policy.ShouldRetry(0, base) || !policy.ShouldRetry(1, base) {
+		t.Error("未分类错误在重试次数内应重试")
+	}
+	if policy.ShouldRetry(2, base) {
+		t.Error("超过重试次数后不应重试")
+	}
+	if policy.ShouldRetry(0, retry.HTTPStatus(http.StatusUnauthorized, "", base)) {
+		t.Error("认证错误不应重试")
+	}
+	if policy.ShouldRetry(0, retry.HTTPStatus(http.StatusNotFound, "", base)) {
+		t.Error("配置错误不应重试")
+	}
+	if !policy.ShouldRetry(0, retry.HTTPStatus(http.StatusTooManyRequests, "", base)) {
+		t.Error("限流错误应重试")
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := retry.NewPolicy(0, &models.RetryPolicy{InitialDelaySeconds: 1, MaxDelaySeconds: 10, BackoffFactor: 2})
+	base := errors.New("采集失败")
+
+	// 指数退避，不超过最大延迟
+	if d := policy.Delay(2); d != 4*time.Second {
+		t.Errorf("第 3 次尝试失败后延迟 = %v, 期望 4s", d)
+	}
+	if d := policy.Delay(10); d != 10*time.Second {
+		t.Errorf("延迟 = %v, 期望不超过 10s", d)
+	}
+
+	// 限流时至少等待 Retry-After
+	if d, ok := policy.RetryDelay(0, retry.HTTPStatus(http.StatusTooManyRequests, "30", base)); !ok || d != 30*time.Second {
+		t.Errorf("Retry-After=30 时延迟 = %v, %v", d, ok)
+	}
+
+	// Retry-After 超过上限时不再重试，而不是等待一天
+	if d, ok := policy.RetryDelay(0, retry.HTTPStatus(http.StatusTooManyRequests, "86400", base)); ok {
+		t.Errorf("Retry-After=86400 时应不再重试, 得到延迟 %v", d)
+	}
+	if policy.MaxRetryAfter() != retry.DefaultMaxRetryAfter {
+		t.Errorf("Retry-After 上限 = %v", policy.MaxRetryAfter())
+	}
+
+	// 配置了最长重试时间时上限不超过它
+	policy = retry.NewPolicy(0, &models.RetryPolicy{MaxElapsedSeconds: 60})
+	if policy.MaxRetryAfter() != time.Minute {
+		t.Errorf("Retry-After 上限 = %v, 期望 1m", policy.MaxRetryAfter())
+	}
+	if _, ok := policy.RetryDelay(0, retry.HTTPStatus(http.StatusTooManyRequests, "120", base)); ok {
+		t.Error("Retry-After 超过最长重试时间时应不再重试")
+	}
+	if !policy.ExceedsElapsed(time.Now().Add(-50*time.Second), 20*time.Second) {
+		t.Error("等待后超过最长重试时间时应返回 true")
+	}
+	if policy.ExceedsElapsed(time.Now(), 20*time.Second) {
+		t.Error("等待后未超过最长重试时间时应返回 false")
+	}
+}
@@ -0,0 +1,236 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/storage"
+)
+
+// fakeS3 进程内的最小 S3 服务，支持 PutObject、分片上传和 DeleteObject
+type fakeS3 struct {
+	mu         sync.Mutex
+	objects    map[string][]byte
+	headers    map[string]http.Header
+	uploads    map[string]map[int][]byte
+	multiparts int
+	denyPrefix string // key 以此开头的 PutObject 返回 AccessDenied
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		objects: make(map[string][]byte),
+		headers: make(map[string]http.Header),
+		uploads: make(map[string]map[int][]byte),
+	}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+	if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		body = decodeAWSChunked(body)
+	}
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		uploadID := fmt.Sprintf("upload-%d", len(f.uploads)+1)
+		f.uploads[uploadID] = make(map[int][]byte)
+		f.headers[key] = r.Header.Clone()
+		parts := strings.SplitN(key, "/", 2)
+		fmt.Fprintf(w, `<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>`,
+			parts[0], parts[1], uploadID)
+
+	case r.Method == http.MethodPut && query.Get("uploadId") != "":
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		f.uploads[query.Get("uploadId")][partNumber] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, partNumber))
+
+	case r.Method == http.MethodPost && query.Get("uploadId") != "":
+		var complete struct {
+			Parts []struct {
+				PartNumber int `xml:"PartNumber"`
+			} `xml:"Part"`
+		}
+		xml.Unmarshal(body, &complete)
+		sort.Slice(complete.Parts, func(i, j int) bool { return complete.Parts[i].PartNumber < complete.Parts[j].PartNumber })
+		var data []byte
+		for _, part := range complete.Parts {
+			data = append(data, f.uploads[query.Get("uploadId")][part.PartNumber]...)
+		}
+		f.objects[key] = data
+		f.multiparts++
+		parts := strings.SplitN(key, "/", 2)
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><ETag>"etag"</ETag></CompleteMultipartUploadResult>`,
+			parts[0], parts[1])
+
+	case r.Method == http.MethodPut && f.denyPrefix != "" && strings.HasPrefix(key, f.denyPrefix):
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, `<Error><Code>AccessDenied</Code><Message>Access Denied</Message><Key>%s</Key></Error>`, key)
+
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+		f.headers[key] = r.Header.Clone()
+		w.Header().Set("ETag", `"etag"`)
+
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// decodeAWSChunked 解码 aws-chunked 流式签名请求体：<hex 长度>;chunk-signature=...\r\n<数据>\r\n
+func decodeAWSChunked(body []byte) []byte {
+	var data []byte
+	for len(body) > 0 {
+		lineEnd := strings.Index(string(body), "\r\n")
+		if lineEnd < 0 {
+			break
+		}
+		sizeHex := strings.SplitN(string(body[:lineEnd]), ";", 2)[0]
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil || size == 0 {
+			break
+		}
+		start := lineEnd + 2
+		data = append(data, body[start:start+int(size)]...)
+		body = body[start+int(size)+2:]
+	}
+	return data
+}
+
+func (f *fakeS3) keys(prefix string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var keys []string
+	for k := range f.objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func newTestS3Storage(t *testing.T, sse string) (*storage.S3Storage, *fakeS3) {
+	fake := newFakeS3()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	s, err := storage.NewS3Storage(&storage.S3Config{
+		Endpoint:  server.URL,
+		Region:    "us-east-1",
+		Bucket:    "lake",
+		Prefix:    "raw",
+		PathStyle: true,
+		AccessKey: "test",
+		SecretKey: "testtesttest",
+		SSE:       sse,
+		PartSize:  5 * 1024 * 1024,
+	})
+	if err != nil {
+		t.Fatalf("创建 S3 存储失败: %v", err)
+	}
+	return s, fake
+}
+
+func TestS3Storage(t *testing.T) {
+	t.Run("分区写入和清单", func(t *testing.T) {
+		s, fake := newTestS3Storage(t, "sse-s3")
+		ctx := storage.WithExecutionInfo(context.Background(), storage.ExecutionInfo{TaskID: 7, ExecutionID: 99})
+
+		config := &models.StorageConfig{
+			Target:      "s3",
+			Table:       "articles",
+			Format:      "jsonl",
+			Compression: "gzip",
+			PartitionBy: []string{"task"},
+		}
+		data := []map[string]interface{}{{"id": 1}, {"id": 2}}
+		if err := s.Store(ctx, config, data); err != nil {
+			t.Fatalf("存储失败: %v", err)
+		}
+
+		objects := fake.keys("lake/raw/articles/task=7/")
+		if len(objects) != 1 || !strings.HasSuffix(objects[0], ".jsonl.gz") {
+			t.Fatalf("对象 key 错误: %v", objects)
+		}
+		if got := fake.headers[objects[0]].Get("X-Amz-Server-Side-Encryption"); got != "AES256" {
+			t.Errorf("期望 SSE 请求头 AES256，得到 %q", got)
+		}
+
+		var manifest storage.Manifest
+		if err := json.Unmarshal(fake.objects["lake/raw/_manifests/articles_execution_99.json"], &manifest); err != nil {
+			t.Fatalf("解析清单失败: %v", err)
+		}
+		if manifest.Records != 2 || len(manifest.Files) != 1 {
+			t.Errorf("清单内容错误: %+v", manifest)
+		}
+	})
+
+	t.Run("大文件分片上传", func(t *testing.T) {
+		s, fake := newTestS3Storage(t, "")
+
+		payload := strings.Repeat("x", 1024)
+		data := make([]map[string]interface{}, 0, 6000)
+		for i := 0; i < 6000; i++ {
+			data = append(data, map[string]interface{}{"id": i, "payload": payload})
+		}
+
+		config := &models.StorageConfig{Target: "s3", Table: "big", Format: "jsonl"}
+		if err := s.Store(context.Background(), config, data); err != nil {
+			t.Fatalf("存储失败: %v", err)
+		}
+
+		objects := fake.keys("lake/raw/big/")
+		if len(objects) != 1 {
+			t.Fatalf("期望 1 个对象，得到 %v", objects)
+		}
+		if fake.multiparts != 1 {
+			t.Errorf("期望使用分片上传，实际 %d 次", fake.multiparts)
+		}
+		if lines := strings.Count(string(fake.objects[objects[0]]), "\n"); lines != len(data) {
+			t.Errorf("期望 %d 行数据，得到 %d 行", len(data), lines)
+		}
+	})
+
+	t.Run("写入清单失败时删除已上传的对象", func(t *testing.T) {
+		s, fake := newTestS3Storage(t, "")
+		fake.denyPrefix = "lake/raw/_manifests/"
+
+		config := &models.StorageConfig{Target: "s3", Table: "articles", Format: "jsonl", MaxRecordsPerFile: 1}
+		data := []map[string]interface{}{{"id": 1}, {"id": 2}}
+		if err := s.Store(context.Background(), config, data); err == nil {
+			t.Fatal("写入清单失败应返回错误")
+		}
+		if objects := fake.keys("lake/raw/articles/"); len(objects) != 0 {
+			t.Errorf("失败后仍残留对象: %v", objects)
+		}
+	})
+
+	t.Run("不支持的加密方式", func(t *testing.T) {
+		_, err := storage.NewS3Storage(&storage.S3Config{Endpoint: "127.0.0.1:9000", SSE: "rot13"})
+		if err == nil {
+			t.Error("不支持的加密方式应该返回错误")
+		}
+	})
+}
@@ -0,0 +1,199 @@
+package unit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/processor"
+)
+
+func TestScriptStage(t *testing.T) {
+	script := `
+def process(record):
+    if record.get("skip"):
+        return None
+    if "tags" in record:
+        return [{"id": record["id"], "tag": tag} for tag in record["tags"]]
+    record["title"] = record["title"].upper()
+    record["length"] = len(record["title"])
+    print("processed", record["id"])
+    return record
+`
+	proc := processor.NewProcessor(&models.ProcessorConfig{
+		Stages: []models.StageConfig{{Type: "script", Name: "custom", Script: script}},
+	})
+	result, err := proc.Process([]map[string]interface{}{
+		{"id": "1", "title": "hello"},
+		{"id": "2", "skip": true},
+		{"id": "3", "tags": []interface{}{"a", "b"}},
+		{"id": "4"},
+	})
+	if err != nil {
+		t.Fatalf("处理失败: %v", err)
+	}
+
+	if len(result) != 3 {
+		t.Fatalf("期望 3 条记录，实际 %d: %v", len(result), result)
+	}
+	if result[0]["title"] != "HELLO" || result[0]["length"] != int64(5) {
+		t.Errorf("修改记录错误: %v", result[0])
+	}
+	if result[1]["tag"] != "a" || result[2]["tag"] != "b" {
+		t.Errorf("展开记录错误: %v", result[1:])
+	}
+
+	rejected := proc.Rejected()
+	if len(rejected) != 1 || rejected[0].Stage != models.DeadLetterStageScript || rejected[0].Rule != "custom" {
+		t.Fatalf("缺少 title 的记录应进入死信队列: %v", rejected)
+	}
+}
+
+func TestScriptStageLimits(t *testing.T) {
+	script := `
+def process(record):
+    n = 0
+    for i in range(100000000):
+        n += i
+    return record
+`
+	proc := processor.NewProcessor(&models.ProcessorConfig{
+		Stages: []models.StageConfig{{Type: "script", Script: script, MaxSteps: 10000}},
+	})
+	result, err := proc.Process([]map[string]interface{}{{"id": "1"}})
+	if err != nil {
+		t.Fatalf("处理失败: %v", err)
+	}
+	if len(result) != 0 || len(proc.Rejected()) != 1 {
+		t.Fatalf("超出步数限制的记录应被拒绝: %v %v", result, proc.Rejected())
+	}
+	if !strings.Contains(proc.Rejected()[0].Error, "too many steps") {
+		t.Errorf("错误信息应说明超出步数: %s", proc.Rejected()[0].Error)
+	}
+}
+
+func TestValidateStages(t *testing.T) {
+	invalid := []models.StageConfig{
+		{Type: "script", Script: "def process(record):\n    return record +"},
+		{Type: "script", Script: "x = 1"},
+		{Type: "script", Script: `load("os.star", "exec")`},
+		{Type: "script", Script: "def process(record):\n    return open('/etc/passwd')"},
+		{Type: "transform", TransformRules: []models.TransformRule{{Type: "unknown"}}},
+		{Type: "unknown"},
+	}
+	for _, stage := range invalid {
+		config := &models.ProcessorConfig{Stages: []models.StageConfig{stage}}
+		if err := processor.ValidateStages(config); err == nil {
+			t.Errorf("阶段配置应校验失败: %+v", stage)
+		}
+	}
+
+	valid := &models.ProcessorConfig{Stages: []models.StageConfig{
+		{Type: "clean"},
+		{Type: "script", Script: "def process(record):\n    return record"},
+	}}
+	if err := processor.ValidateStages(valid); err != nil {
+		t.Errorf("阶段配置应校验通过: %v", err)
+	}
+}
+
+// tagStage 测试用自定义阶段，为每条记录添加标记
+type tagStage struct {
+	tag string
+}
+
+func (s *tagStage) Name() string { return "tag" }
+
+func (s *tagStage) Process(_ *processor.StageContext, data []map[string]interface{}) ([]map[string]interface{}, error) {
+	for _, record := range data {
+		record["tags"] = append(toStrings(record["tags"]), s.tag)
+	}
+	return data, nil
+}
+
+// toStrings 读取标记列表，经过脚本阶段后列表类型为 []interface{}
+func toStrings(v interface{}) []string {
+	switch s := v.(type) {
+	case []string:
+		return s
+	case []interface{}:
+		out := make([]string, len(s))
+		for i, item := range s {
+			out[i], _ = item.(string)
+		}
+		return out
+	}
+	return nil
+}
+
+func TestCustomStageOrder(t *testing.T) {
+	processor.RegisterStage("test_tag", func(config *models.StageConfig, _ *models.ProcessorConfig) (processor.Stage, error) {
+		return &tagStage{tag: config.Options["tag"].(string)}, nil
+	})
+
+	proc := processor.NewProcessor(&models.ProcessorConfig{
+		CleaningRules: []models.CleaningRule{{Field: "title", Type: "trim"}},
+		Stages: []models.StageConfig{
+			{Type: "test_tag", Options: map[string]interface{}{"tag": "first"}},
+			{Type: "clean"},
+			{Type: "script", Script: "def process(record):\n    record['title'] = record['title'] + '!'\n    return record"},
+			{Type: "test_tag", Options: map[string]interface{}{"tag": "last"}},
+		},
+	})
+	result, err := proc.Process([]map[string]interface{}{{"title": "  hi  "}})
+	if err != nil {
+		t.Fatalf("处理失败: %v", err)
+	}
+	if len(result) != 1 {
+		t.Fatalf("期望 1 条记录，实际 %d", len(result))
+	}
+	if result[0]["title"] != "hi!" {
+		t.Errorf("阶段顺序错误，title = %v", result[0]["title"])
+	}
+	tags := toStrings(result[0]["tags"])
+	if len(tags) != 2 || tags[0] != "first" || tags[1] != "last" {
+		t.Errorf("自定义阶段未按顺序执行: %v", result[0]["tags"])
+	}
+}
+
+func TestResumeFromRejectingStage(t *testing.T) {
+	proc := func() *processor.Processor {
+		return processor.NewProcessor(&models.ProcessorConfig{
+			Stages: []models.StageConfig{
+				{Type: "script", Name: "tag", Script: "def process(record):\n    record['title'] = record['title'] + '-t'\n    return record"},
+				{Type: "script", Name: "check", Script: "def process(record):\n    if record['amount'] < 0:\n        fail('amount 小于 0')\n    return record"},
+				{Type: "script", Name: "mark", Script: "def process(record):\n    record['checked'] = True\n    return record"},
+			},
+		})
+	}
+
+	p := proc()
+	if _, err := p.Process([]map[string]interface{}{{"title": "a", "amount": -1}}); err != nil {
+		t.Fatalf("处理失败: %v", err)
+	}
+	rejected := p.Rejected()
+	if len(rejected) != 1 || rejected[0].StageName != "check" || rejected[0].StageIndex != 1 {
+		t.Fatalf("死信记录应记录拒绝它的阶段: %+v", rejected)
+	}
+
+	// 修正后从 check 阶段重放，tag 阶段不会再次执行
+	record := rejected[0].Record
+	record["amount"] = 1
+	p = proc()
+	result, err := p.Resume([]map[string]interface{}{record}, rejected[0].StageName, rejected[0].StageIndex)
+	if err != nil {
+		t.Fatalf("重放失败: %v", err)
+	}
+	if len(result) != 1 || result[0]["title"] != "a-t" || result[0]["checked"] != true {
+		t.Errorf("重放结果错误: %v", result)
+	}
+
+	// 阶段下标变化时按名称查找，阶段不存在时返回错误
+	p = proc()
+	if result, err := p.Resume([]map[string]interface{}{record}, "check", 5); err != nil || result[0]["title"] != "a-t" {
+		t.Errorf("按名称重放失败: %v, %v", result, err)
+	}
+	if _, err := proc().Resume([]map[string]interface{}{record}, "removed", 1); err == nil {
+		t.Error("阶段不存在时应返回错误")
+	}
+}
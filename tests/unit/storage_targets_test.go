@@ -0,0 +1,143 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/retry"
+	"github.com/datafusion/worker/internal/storage"
+)
+
+// fakeStorage 按表名返回预设错误的存储，记录每张表的写入次数
+type fakeStorage struct {
+	errs   map[string]error
+	reject map[string]bool // 拒绝第一条记录的表
+	writes map[string]int
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{errs: map[string]error{}, reject: map[string]bool{}, writes: map[string]int{}}
+}
+
+func (s *fakeStorage) Type() string { return "fake" }
+
+func (s *fakeStorage) Store(ctx context.Context, config *models.StorageConfig, data []map[string]interface{}) error {
+	s.writes[config.Table]++
+	if s.reject[config.Table] {
+		storage.RejectRecord(ctx, data[0], errors.New("字段超长"))
+	}
+	return s.errs[config.Table]
+}
+
+func newTargetsFactory(s *fakeStorage) *storage.StorageFactory {
+	factory := storage.NewStorageFactory()
+	factory.Register(s)
+	return factory
+}
+
+func targetsConfig(policy string, required ...bool) *models.TaskConfig {
+	config := &models.TaskConfig{StoragePolicy: policy}
+	for i, table := range []string{"a", "b"} {
+		target := models.StorageConfig{Target: "fake", Table: table}
+		if i < len(required) {
+			target.Required = required[i]
+		}
+		config.Targets = append(config.Targets, target)
+	}
+	return config
+}
+
+func TestStoreTargetsPolicies(t *testing.T) {
+	data := []map[string]interface{}{{"id": 1}, {"id": 2}}
+	failure := retry.HTTPStatus(http.StatusBadGateway, "", errors.New("写入失败"))
+
+	cases := []struct {
+		name     string
+		config   *models.TaskConfig
+		wantFail bool
+	}{
+		{"all 任一失败即失败", targetsConfig(models.StoragePolicyAll), true},
+		{"默认策略为 all", targetsConfig(""), true},
+		{"any 有成功即成功", targetsConfig(models.StoragePolicyAny), false},
+		{"required 非必需目标失败时成功", targetsConfig(models.StoragePolicyRequired, true, false), false},
+		{"required 必需目标失败时失败", targetsConfig(models.StoragePolicyRequired, false, true), true},
+	}
+	for _, c := range cases {
+		s := newFakeStorage()
+		s.errs["b"] = failure
+		results, _, err := newTargetsFactory(s).StoreTargets(context.Background(), c.config, data, nil)
+		if (err != nil) != c.wantFail {
+			t.Errorf("%s: 错误 = %v", c.name, err)
+		}
+		if len(results) != 2 || results[0].Status != models.StorageResultSuccess || results[1].Status != models.StorageResultFailed {
+			t.Errorf("%s: 写入结果 = %+v", c.name, results)
+		}
+		// 失败目标的错误可以重试时整体可以重试
+		if err != nil && retry.ClassOf(err) != retry.ClassTransient {
+			t.Errorf("%s: 错误分类 = %s", c.name, retry.ClassOf(err))
+		}
+	}
+
+	// 全部失败时 any 策略也失败
+	s := newFakeStorage()
+	s.errs["a"] = failure
+	s.errs["b"] = failure
+	if _, _, err := newTargetsFactory(s).StoreTargets(context.Background(), targetsConfig(models.StoragePolicyAny), data, nil); err == nil {
+		t.Error("全部目标失败时应返回错误")
+	}
+}
+
+func TestStoreTargetsRetrySkipsStored(t *testing.T) {
+	data := []map[string]interface{}{{"id": 1}, {"id": 2}}
+	s := newFakeStorage()
+	s.errs["b"] = errors.New("连接中断")
+	s.reject["a"] = true
+	factory := newTargetsFactory(s)
+	config := targetsConfig(models.StoragePolicyAll)
+
+	results, rejected, err := factory.StoreTargets(context.Background(), config, data, nil)
+	if err == nil {
+		t.Fatal("目标 b 失败时应返回错误")
+	}
+	if len(rejected) != 1 || rejected[0].Target != "fake:a" || results[0].Records != 1 {
+		t.Fatalf("拒绝记录 = %+v, 写入结果 = %+v", rejected, results)
+	}
+
+	// 重试时已写入成功的目标 a 不再写入，保留它拒绝的记录
+	kept := storage.StoredRejects(rejected, results)
+	if len(kept) != 1 || kept[0].Target != "fake:a" {
+		t.Errorf("保留的拒绝记录 = %+v", kept)
+	}
+
+	delete(s.errs, "b")
+	results, rejected, err = factory.StoreTargets(context.Background(), config, data, results)
+	if err != nil {
+		t.Fatalf("重试失败: %v", err)
+	}
+	if s.writes["a"] != 1 || s.writes["b"] != 2 {
+		t.Errorf("写入次数 a=%d b=%d, 期望 a=1 b=2", s.writes["a"], s.writes["b"])
+	}
+	if len(rejected) != 0 || results[0].Records != 1 || results[1].Status != models.StorageResultSuccess {
+		t.Errorf("重试结果 = %+v, 拒绝记录 = %+v", results, rejected)
+	}
+
+	// 目标配置变化时不沿用之前的结果
+	config.Targets[0].Table = "c"
+	if _, _, err := factory.StoreTargets(context.Background(), config, data, results); err != nil || s.writes["c"] != 1 {
+		t.Errorf("目标变化后应重新写入: %v, 写入次数 %d", err, s.writes["c"])
+	}
+}
+
+func TestValidateStoragePolicy(t *testing.T) {
+	for _, policy := range []string{"", models.StoragePolicyAll, models.StoragePolicyAny, models.StoragePolicyRequired} {
+		if err := storage.ValidateStoragePolicy(&models.TaskConfig{StoragePolicy: policy}); err != nil {
+			t.Errorf("策略 %q 应有效: %v", policy, err)
+		}
+	}
+	if err := storage.ValidateStoragePolicy(&models.TaskConfig{StoragePolicy: "majority"}); err == nil {
+		t.Error("未知的 storage_policy 应返回错误")
+	}
+}
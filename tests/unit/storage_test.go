@@ -1,9 +1,20 @@
 package unit
 
 import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/datafusion/worker/internal/models"
 	"github.com/datafusion/worker/internal/storage"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
 )
 
 func TestStorageFactory(t *testing.T) {
@@ -52,3 +63,237 @@ func TestFileStorage(t *testing.T) {
 		}
 	})
 }
+
+func TestFileStorageFormats(t *testing.T) {
+	data := []map[string]interface{}{
+		{"id": 1, "title": "a", "category": "news"},
+		{"id": 2, "title": "b", "category": "sports"},
+		{"id": 3, "title": "c", "category": "news"},
+	}
+
+	t.Run("JSON Lines 分区与清单", func(t *testing.T) {
+		baseDir := t.TempDir()
+		s := storage.NewFileStorage(baseDir)
+		ctx := storage.WithExecutionInfo(context.Background(), storage.ExecutionInfo{
+			TaskID:      12,
+			ExecutionID: 34,
+			StartTime:   time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC),
+		})
+
+		config := &models.StorageConfig{
+			Target:      "file",
+			Database:    "lake",
+			Table:       "articles",
+			Format:      "jsonl",
+			PartitionBy: []string{"dt", "task", "category"},
+		}
+		if err := s.Store(ctx, config, data); err != nil {
+			t.Fatalf("存储失败: %v", err)
+		}
+
+		newsDir := filepath.Join(baseDir, "lake", "articles", "dt=2026-10-18", "task=12", "category=news")
+		files, _ := filepath.Glob(filepath.Join(newsDir, "*.jsonl"))
+		if len(files) != 1 {
+			t.Fatalf("期望 news 分区下 1 个文件，得到 %d 个", len(files))
+		}
+		content, _ := os.ReadFile(files[0])
+		if lines := strings.Count(string(content), "\n"); lines != 2 {
+			t.Errorf("期望 2 行数据，得到 %d 行", lines)
+		}
+
+		manifestData, err := os.ReadFile(filepath.Join(baseDir, "lake", "_manifests", "articles_execution_34.json"))
+		if err != nil {
+			t.Fatalf("读取清单失败: %v", err)
+		}
+		var manifest storage.Manifest
+		if err := json.Unmarshal(manifestData, &manifest); err != nil {
+			t.Fatalf("解析清单失败: %v", err)
+		}
+		if len(manifest.Files) != 2 || manifest.Records != 3 {
+			t.Errorf("清单内容错误，文件 %d 个，记录 %d 条", len(manifest.Files), manifest.Records)
+		}
+	})
+
+	t.Run("CSV gzip 滚动写入", func(t *testing.T) {
+		baseDir := t.TempDir()
+		s := storage.NewFileStorage(baseDir)
+
+		config := &models.StorageConfig{
+			Target:            "file",
+			Database:          "lake",
+			Table:             "articles",
+			Format:            "csv",
+			Compression:       "gzip",
+			MaxRecordsPerFile: 2,
+		}
+		if err := s.Store(context.Background(), config, data); err != nil {
+			t.Fatalf("存储失败: %v", err)
+		}
+
+		files, _ := filepath.Glob(filepath.Join(baseDir, "lake", "articles_*.csv.gz"))
+		if len(files) != 2 {
+			t.Fatalf("期望滚动生成 2 个文件，得到 %d 个", len(files))
+		}
+
+		f, _ := os.Open(files[0])
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("解压失败: %v", err)
+		}
+		rows, err := csv.NewReader(gz).ReadAll()
+		if err != nil {
+			t.Fatalf("解析 CSV 失败: %v", err)
+		}
+		if len(rows) != 3 || strings.Join(rows[0], ",") != "category,id,title" {
+			t.Errorf("CSV 内容错误: %v", rows)
+		}
+	})
+
+	t.Run("多次写入不覆盖", func(t *testing.T) {
+		baseDir := t.TempDir()
+		s := storage.NewFileStorage(baseDir)
+		config := &models.StorageConfig{Target: "file", Database: "lake", Table: "articles"}
+
+		for i := 0; i < 3; i++ {
+			if err := s.Store(context.Background(), config, data); err != nil {
+				t.Fatalf("存储失败: %v", err)
+			}
+		}
+
+		files, _ := filepath.Glob(filepath.Join(baseDir, "lake", "articles_*.json"))
+		if len(files) != 3 {
+			t.Errorf("期望 3 个文件，得到 %d 个", len(files))
+		}
+	})
+
+	t.Run("dt 和 hour 分区按 UTC 计算", func(t *testing.T) {
+		baseDir := t.TempDir()
+		s := storage.NewFileStorage(baseDir)
+		// 东八区 10-18 01:00 即 UTC 10-17 17:00
+		ctx := storage.WithExecutionInfo(context.Background(), storage.ExecutionInfo{
+			TaskID:      12,
+			ExecutionID: 35,
+			StartTime:   time.Date(2026, 10, 18, 1, 0, 0, 0, time.FixedZone("CST", 8*3600)),
+		})
+
+		config := &models.StorageConfig{Target: "file", Database: "lake", Table: "articles", Format: "jsonl", PartitionBy: []string{"dt", "hour"}}
+		if err := s.Store(ctx, config, data); err != nil {
+			t.Fatalf("存储失败: %v", err)
+		}
+
+		files, _ := filepath.Glob(filepath.Join(baseDir, "lake", "articles", "dt=2026-10-17", "hour=17", "articles_20261017_170000_*.jsonl"))
+		if len(files) != 1 {
+			all, _ := filepath.Glob(filepath.Join(baseDir, "lake", "articles", "*", "*", "*"))
+			t.Errorf("期望写入 UTC 分区，实际文件: %v", all)
+		}
+	})
+
+	t.Run("Parquet 字段名不改写列定义", func(t *testing.T) {
+		baseDir := t.TempDir()
+		s := storage.NewFileStorage(baseDir)
+		config := &models.StorageConfig{Target: "file", Database: "lake", Table: "articles", Format: "parquet"}
+		records := []map[string]interface{}{
+			{"id": 1, "a=b": "x", "title, type=INT32, repetitiontype=REQUIRED": "c"},
+			{"id": 2, "Id": "大写"},
+		}
+		if err := s.Store(context.Background(), config, records); err != nil {
+			t.Fatalf("存储失败: %v", err)
+		}
+
+		files, _ := filepath.Glob(filepath.Join(baseDir, "lake", "articles_*.parquet"))
+		if len(files) != 1 {
+			t.Fatalf("期望 1 个文件，得到 %d 个", len(files))
+		}
+		fr, err := local.NewLocalFileReader(files[0])
+		if err != nil {
+			t.Fatalf("打开文件失败: %v", err)
+		}
+		defer fr.Close()
+		pr, err := reader.NewParquetColumnReader(fr, 1)
+		if err != nil {
+			t.Fatalf("读取 Parquet 失败: %v", err)
+		}
+		defer pr.ReadStop()
+
+		// 列按字段名排序，全部为可空字符串（读取器把 Footer 中的列名换成了内部名称，原始列名在 ExName 中）
+		want := []string{"Id", "a=b", "id", "title, type=INT32, repetitiontype=REQUIRED"}
+		schema := pr.Footer.Schema[1:]
+		if len(schema) != len(want) {
+			t.Fatalf("列数 = %d, 期望 %d", len(schema), len(want))
+		}
+		for i, element := range schema {
+			name := pr.SchemaHandler.Infos[i+1].ExName
+			if name != want[i] || element.GetType().String() != "BYTE_ARRAY" || element.GetRepetitionType().String() != "OPTIONAL" {
+				t.Errorf("第 %d 列 = %s %s %s", i, name, element.GetType(), element.GetRepetitionType())
+			}
+		}
+		values, _, _, err := pr.ReadColumnByIndex(3, 2)
+		if err != nil {
+			t.Fatalf("读取列失败: %v", err)
+		}
+		if len(values) != 2 || values[0] != "c" || values[1] != nil {
+			t.Errorf("列值 = %v", values)
+		}
+
+		if err := s.Store(context.Background(), config, []map[string]interface{}{{"a\x01b": 1}}); err == nil {
+			t.Error("字段名包含控制字符时应返回错误")
+		}
+	})
+
+	t.Run("写入失败时删除已写入的文件", func(t *testing.T) {
+		baseDir := t.TempDir()
+		s := storage.NewFileStorage(baseDir)
+		// 清单目录被同名文件占用，数据文件写入后清单写入失败
+		if err := os.MkdirAll(filepath.Join(baseDir, "lake"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(baseDir, "lake", "_manifests"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		config := &models.StorageConfig{Target: "file", Database: "lake", Table: "articles", MaxRecordsPerFile: 1}
+		if err := s.Store(context.Background(), config, data); err == nil {
+			t.Fatal("清单写入失败应返回错误")
+		}
+		if files, _ := filepath.Glob(filepath.Join(baseDir, "lake", "articles_*")); len(files) != 0 {
+			t.Errorf("失败后仍残留文件: %v", files)
+		}
+	})
+
+	t.Run("死信重放不覆盖原执行的清单", func(t *testing.T) {
+		baseDir := t.TempDir()
+		s := storage.NewFileStorage(baseDir)
+		config := &models.StorageConfig{Target: "file", Database: "lake", Table: "articles"}
+		info := storage.ExecutionInfo{TaskID: 12, ExecutionID: 36}
+		if err := s.Store(storage.WithExecutionInfo(context.Background(), info), config, data); err != nil {
+			t.Fatalf("存储失败: %v", err)
+		}
+		info.ReplayID = 5
+		if err := s.Store(storage.WithExecutionInfo(context.Background(), info), config, data[:1]); err != nil {
+			t.Fatalf("重放存储失败: %v", err)
+		}
+
+		for name, records := range map[string]int{"articles_execution_36.json": 3, "articles_execution_36_replay_5.json": 1} {
+			content, err := os.ReadFile(filepath.Join(baseDir, "lake", "_manifests", name))
+			if err != nil {
+				t.Fatalf("读取清单 %s 失败: %v", name, err)
+			}
+			var manifest storage.Manifest
+			if err := json.Unmarshal(content, &manifest); err != nil {
+				t.Fatalf("解析清单失败: %v", err)
+			}
+			if manifest.Records != records || len(manifest.Files) != 1 {
+				t.Errorf("清单 %s 内容错误: %+v", name, manifest)
+			}
+		}
+	})
+
+	t.Run("不支持的格式", func(t *testing.T) {
+		s := storage.NewFileStorage(t.TempDir())
+		config := &models.StorageConfig{Target: "file", Table: "articles", Format: "xml"}
+		if err := s.Store(context.Background(), config, data); err == nil {
+			t.Error("不支持的格式应该返回错误")
+		}
+	})
+}
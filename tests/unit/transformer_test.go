@@ -0,0 +1,296 @@
+package unit
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/processor"
+)
+
+func TestTransformer(t *testing.T) {
+	t.Run("组合规则", func(t *testing.T) {
+		rules := []models.TransformRule{
+			{Name: "price", Type: "convert", SourceField: "price", DataType: "float"},
+			{Name: "qty", Type: "convert", SourceField: "qty", DataType: "int"},
+			{Name: "total", Type: "expression", TargetField: "total", Expression: "price * qty"},
+			{Name: "level", Type: "expression", TargetField: "level", Expression: `total > 100 ? "high" : "low"`},
+			{Name: "title", Type: "template", TargetField: "title", Template: "{brand} - {model}"},
+			{Name: "tags", Type: "split", SourceField: "tags", Separator: ","},
+			{Name: "city", Type: "lookup", SourceField: "city", Lookup: map[string]interface{}{"BJ": "北京"}, Default: "未知"},
+			{Name: "full", Type: "concat", SourceFields: []string{"brand", "model"}, Separator: "/", TargetField: "full"},
+			{Name: "source", Type: "constant", TargetField: "source", Value: "crawler"},
+			{Name: "note", Type: "default", SourceField: "note", Value: "无"},
+			{Name: "rename", SourceField: "brand", TargetField: "maker"},
+			{Name: "drop", Type: "drop", SourceFields: []string{"model", "qty"}},
+		}
+
+		transformer, err := processor.NewTransformer(rules)
+		if err != nil {
+			t.Fatalf("创建转换引擎失败: %v", err)
+		}
+
+		rows, err := transformer.Transform(map[string]interface{}{
+			"price": "12.5",
+			"qty":   "10",
+			"brand": "Acme",
+			"model": "X1",
+			"tags":  "a, b,c",
+			"city":  "SH",
+			"note":  "",
+		})
+		if err != nil {
+			t.Fatalf("转换失败: %v", err)
+		}
+		if len(rows) != 1 {
+			t.Fatalf("期望 1 行，得到 %d 行", len(rows))
+		}
+		result := rows[0]
+
+		expected := map[string]interface{}{
+			"price":  12.5,
+			"total":  125.0,
+			"level":  "high",
+			"title":  "Acme - X1",
+			"city":   "未知",
+			"full":   "Acme/X1",
+			"source": "crawler",
+			"note":   "无",
+			"maker":  "Acme",
+		}
+		for field, want := range expected {
+			if result[field] != want {
+				t.Errorf("字段 %s 期望 %v，得到 %v (%T)", field, want, result[field], result[field])
+			}
+		}
+		for _, field := range []string{"brand", "model", "qty"} {
+			if _, ok := result[field]; ok {
+				t.Errorf("字段 %s 应被删除", field)
+			}
+		}
+		tags, ok := result["tags"].([]interface{})
+		if !ok || len(tags) != 3 || tags[1] != "b" {
+			t.Errorf("拆分结果错误: %v", result["tags"])
+		}
+	})
+
+	t.Run("保存时报告无效表达式", func(t *testing.T) {
+		err := processor.ValidateTransformRules([]models.TransformRule{
+			{Name: "bad", Type: "expression", TargetField: "x", Expression: "price * (qty"},
+		})
+		if err == nil {
+			t.Fatal("期望表达式语法错误")
+		}
+
+		err = processor.ValidateTransformRules([]models.TransformRule{
+			{Name: "unknown", Type: "explode_everything", SourceField: "x"},
+		})
+		if err == nil {
+			t.Fatal("期望不支持的转换类型错误")
+		}
+	})
+
+	t.Run("单条记录转换失败时进入拒绝列表", func(t *testing.T) {
+		proc := processor.NewProcessor(&models.ProcessorConfig{
+			TransformRules: []models.TransformRule{
+				{Name: "to_int", Type: "convert", SourceField: "n", DataType: "int"},
+			},
+		})
+
+		result, err := proc.Process([]map[string]interface{}{{"n": "1"}, {"n": "abc"}})
+		if err != nil {
+			t.Fatalf("处理失败: %v", err)
+		}
+		if len(result) != 1 || result[0]["n"] != int64(1) {
+			t.Errorf("期望 1 条转换后的记录，得到 %v", result)
+		}
+		rejected := proc.Rejected()
+		if len(rejected) != 1 || rejected[0].Stage != models.DeadLetterStageTransform || rejected[0].Rule != "to_int" {
+			t.Errorf("拒绝记录错误: %+v", rejected)
+		}
+	})
+
+	t.Run("未指定类型的 convert 按字段映射处理", func(t *testing.T) {
+		transformer, err := processor.NewTransformer([]models.TransformRule{
+			{Name: "legacy", Type: "convert", SourceField: "price", TargetField: "amount"},
+		})
+		if err != nil {
+			t.Fatalf("创建转换引擎失败: %v", err)
+		}
+		rows, err := transformer.Transform(map[string]interface{}{"price": 12.5})
+		if err != nil {
+			t.Fatalf("转换失败: %v", err)
+		}
+		if _, ok := rows[0]["price"]; ok || rows[0]["amount"] != 12.5 {
+			t.Errorf("期望移动字段并保留原值，得到 %v", rows[0])
+		}
+	})
+
+	t.Run("表达式执行限制", func(t *testing.T) {
+		items := make([]interface{}, 300)
+		for i := range items {
+			items[i] = i
+		}
+		transformer, err := processor.NewTransformer([]models.TransformRule{
+			{Name: "slow", Type: "expression", TargetField: "ok", Expression: "all(items, {all(items, {all(items, {# >= 0})})})"},
+		})
+		if err != nil {
+			t.Fatalf("创建转换引擎失败: %v", err)
+		}
+		if _, err := transformer.Transform(map[string]interface{}{"items": items}); err == nil || !strings.Contains(err.Error(), "超时") {
+			t.Errorf("期望执行超时，得到 %v", err)
+		}
+		// 超时后本批次不再计算该表达式
+		start := time.Now()
+		if _, err := transformer.Transform(map[string]interface{}{"items": items[:1]}); err == nil || time.Since(start) > 100*time.Millisecond {
+			t.Errorf("超时的表达式应直接返回错误，得到 %v", err)
+		}
+
+		transformer, _ = processor.NewTransformer([]models.TransformRule{
+			{Name: "huge", Type: "expression", TargetField: "n", Expression: "len(1..100000000)"},
+		})
+		if _, err := transformer.Transform(map[string]interface{}{}); err == nil {
+			t.Error("期望超出内存预算")
+		}
+	})
+
+	t.Run("嵌套字段路径", func(t *testing.T) {
+		transformer, err := processor.NewTransformer([]models.TransformRule{
+			{Name: "author", SourceField: "$.author.name", TargetField: "author_name"},
+			{Name: "first_price", Type: "convert", SourceField: "items[0].price", TargetField: "first_price", DataType: "float"},
+			{Name: "meta", Type: "constant", TargetField: "meta.source", Value: "api"},
+			{Name: "title", Type: "template", TargetField: "title", Template: "{author_name}: {items[1].name}"},
+		})
+		if err != nil {
+			t.Fatalf("创建转换引擎失败: %v", err)
+		}
+
+		record := map[string]interface{}{
+			"author": map[string]interface{}{"name": "Alice", "id": 1.0},
+			"items": []interface{}{
+				map[string]interface{}{"name": "a", "price": "1.5"},
+				map[string]interface{}{"name": "b", "price": "2"},
+			},
+		}
+		rows, err := transformer.Transform(record)
+		if err != nil {
+			t.Fatalf("转换失败: %v", err)
+		}
+		result := rows[0]
+
+		if result["author_name"] != "Alice" || result["first_price"] != 1.5 || result["title"] != "Alice: b" {
+			t.Errorf("嵌套字段转换错误: %v", result)
+		}
+		if _, ok := result["author"].(map[string]interface{})["name"]; ok {
+			t.Error("重命名后应删除原嵌套字段")
+		}
+		if meta, ok := result["meta"].(map[string]interface{}); !ok || meta["source"] != "api" {
+			t.Errorf("写入嵌套字段失败: %v", result["meta"])
+		}
+		// 原始记录不应被修改
+		if record["author"].(map[string]interface{})["name"] != "Alice" {
+			t.Error("转换修改了原始记录")
+		}
+	})
+
+	t.Run("通配路径逐元素转换", func(t *testing.T) {
+		transformer, err := processor.NewTransformer([]models.TransformRule{
+			{Name: "price", Type: "convert", SourceField: "items[*].price", DataType: "float"},
+			{Name: "rename", SourceField: "items[*].name", TargetField: "items[*].title"},
+			{Name: "status", Type: "lookup", SourceField: "items[*].status", TargetField: "items[*].status_name",
+				Lookup: map[string]interface{}{"1": "在售"}, Default: "下架"},
+			{Name: "tags", Type: "lookup", SourceField: "tags[*]", Lookup: map[string]interface{}{"a": "A"}},
+		})
+		if err != nil {
+			t.Fatalf("创建转换引擎失败: %v", err)
+		}
+
+		rows, err := transformer.Transform(map[string]interface{}{
+			"items": []interface{}{
+				map[string]interface{}{"name": "a", "price": "1.5", "status": 1.0},
+				map[string]interface{}{"name": "b", "price": "2", "status": 0.0},
+			},
+			"tags": []interface{}{"a", "b"},
+		})
+		if err != nil {
+			t.Fatalf("转换失败: %v", err)
+		}
+		items := rows[0]["items"].([]interface{})
+		first := items[0].(map[string]interface{})
+		second := items[1].(map[string]interface{})
+		if first["price"] != 1.5 || second["price"] != 2.0 {
+			t.Errorf("逐元素类型转换错误: %v", items)
+		}
+		if first["title"] != "a" || second["title"] != "b" {
+			t.Errorf("逐元素重命名错误: %v", items)
+		}
+		if _, ok := first["name"]; ok {
+			t.Error("重命名后应删除元素中的原字段")
+		}
+		if first["status_name"] != "在售" || second["status_name"] != "下架" {
+			t.Errorf("逐元素映射错误: %v", items)
+		}
+		if tags := rows[0]["tags"].([]interface{}); tags[0] != "A" || tags[1] != "b" {
+			t.Errorf("数组元素本身的映射错误: %v", tags)
+		}
+
+		// 目标字段不在同一数组元素内时拒绝
+		for _, rule := range []models.TransformRule{
+			{Name: "bad", SourceField: "items[*].price", TargetField: "price"},
+			{Name: "bad", Type: "convert", SourceField: "items[*].price", TargetField: "others[*].price", DataType: "float"},
+			{Name: "bad", SourceField: "tags[*]", TargetField: "tags[*].name"},
+		} {
+			if _, err := processor.NewTransformer([]models.TransformRule{rule}); err == nil {
+				t.Errorf("规则 %s -> %s 应返回错误", rule.SourceField, rule.TargetField)
+			}
+		}
+	})
+
+	t.Run("展开数组与扁平化", func(t *testing.T) {
+		transformer, err := processor.NewTransformer([]models.TransformRule{
+			{Name: "explode", Type: "explode", SourceField: "items", TargetField: "item"},
+			{Name: "flatten", Type: "flatten", Separator: "_"},
+		})
+		if err != nil {
+			t.Fatalf("创建转换引擎失败: %v", err)
+		}
+
+		rows, err := transformer.Transform(map[string]interface{}{
+			"order": "A1",
+			"items": []interface{}{
+				map[string]interface{}{"sku": "x", "qty": 1.0},
+				map[string]interface{}{"sku": "y", "qty": 2.0},
+			},
+		})
+		if err != nil {
+			t.Fatalf("转换失败: %v", err)
+		}
+		if len(rows) != 2 {
+			t.Fatalf("期望展开为 2 行，得到 %d 行", len(rows))
+		}
+		if rows[1]["order"] != "A1" || rows[1]["item_sku"] != "y" || rows[1]["item_qty"] != 2.0 {
+			t.Errorf("展开或扁平化结果错误: %v", rows[1])
+		}
+		if _, ok := rows[0]["items"]; ok {
+			t.Error("展开后应删除原数组字段")
+		}
+
+		unflatten, err := processor.NewTransformer([]models.TransformRule{
+			{Name: "unflatten", Type: "unflatten", Separator: "_"},
+		})
+		if err != nil {
+			t.Fatalf("创建转换引擎失败: %v", err)
+		}
+		restored, err := unflatten.Transform(map[string]interface{}{"a_b": 1.0, "tags_0": "x", "tags_1": "y"})
+		if err != nil {
+			t.Fatalf("转换失败: %v", err)
+		}
+		if a, ok := restored[0]["a"].(map[string]interface{}); !ok || a["b"] != 1.0 {
+			t.Errorf("还原嵌套对象失败: %v", restored[0])
+		}
+		if tags, ok := restored[0]["tags"].([]interface{}); !ok || len(tags) != 2 || tags[1] != "y" {
+			t.Errorf("还原数组失败: %v", restored[0]["tags"])
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/processor"
+)
+
+func TestValidator(t *testing.T) {
+	float := func(v float64) *float64 { return &v }
+
+	t.Run("规则与处理方式", func(t *testing.T) {
+		validator, err := processor.NewValidator([]models.ValidationRule{
+			{Name: "id_required", Field: "id", Type: "required", Action: "drop"},
+			{Name: "price_range", Field: "price", Type: "range", Min: float(0), Max: float(1000)},
+			{Name: "email", Field: "contact.email", Type: "regex", Pattern: `^[^@]+@[^@]+$`, Action: "warn"},
+			{Name: "status", Field: "status", Type: "enum", Values: []interface{}{"on", "off"}},
+			{Name: "id_unique", Field: "id", Type: "unique", Action: "drop"},
+			{Name: "price_type", Field: "price", Type: "type", DataType: "number"},
+			{Name: "period", Type: "expression", Expression: "end >= start", Message: "结束时间早于开始时间"},
+		})
+		if err != nil {
+			t.Fatalf("创建校验器失败: %v", err)
+		}
+
+		data := []map[string]interface{}{
+			{"id": "1", "price": 10.0, "status": "on", "start": 1.0, "end": 2.0, "contact": map[string]interface{}{"email": "a@b.c"}},
+			{"id": "", "price": 10.0, "status": "on", "start": 1.0, "end": 2.0},                                                    // 缺少 id -> drop
+			{"id": "2", "price": 5000.0, "status": "on", "start": 1.0, "end": 2.0},                                                 // 超出范围 -> quarantine
+			{"id": "3", "price": 1.0, "status": "on", "start": 1.0, "end": 2.0, "contact": map[string]interface{}{"email": "bad"}}, // 邮箱错误 -> warn
+			{"id": "1", "price": 1.0, "status": "on", "start": 1.0, "end": 2.0},                                                    // 重复 -> drop
+			{"id": "4", "price": 1.0, "status": "maybe", "start": 1.0, "end": 2.0},                                                 // 枚举错误 -> quarantine
+			{"id": "5", "price": 1.0, "status": "off", "start": 3.0, "end": 2.0},                                                   // 跨字段 -> quarantine
+		}
+
+		passed, quarantined, results, err := validator.Validate(data)
+		if err != nil {
+			t.Fatalf("校验失败: %v", err)
+		}
+
+		if len(passed) != 2 {
+			t.Errorf("期望 2 条通过（含告警），得到 %d 条", len(passed))
+		}
+		if len(quarantined) != 3 {
+			t.Fatalf("期望 3 条进入死信队列，得到 %d 条", len(quarantined))
+		}
+		if quarantined[0].Rule != "price_range" || quarantined[0].Stage != models.DeadLetterStageValidate {
+			t.Errorf("死信记录错误: %+v", quarantined[0])
+		}
+		if quarantined[2].Error != "结束时间早于开始时间" {
+			t.Errorf("自定义错误信息未生效: %s", quarantined[2].Error)
+		}
+
+		counts := map[string][2]int{}
+		for _, r := range results {
+			counts[r.Rule] = [2]int{r.Passed, r.Failed}
+		}
+		if counts["id_required"] != [2]int{6, 1} {
+			t.Errorf("id_required 统计错误: %v", counts["id_required"])
+		}
+		if counts["id_unique"] != [2]int{6, 1} {
+			t.Errorf("id_unique 统计错误: %v", counts["id_unique"])
+		}
+		if counts["email"] != [2]int{6, 1} {
+			t.Errorf("email 统计错误: %v", counts["email"])
+		}
+	})
+
+	t.Run("unique 跳过缺失的字段", func(t *testing.T) {
+		validator, err := processor.NewValidator([]models.ValidationRule{
+			{Name: "sku_unique", Fields: []string{"shop", "sku"}, Type: "unique", Action: "drop"},
+		})
+		if err != nil {
+			t.Fatalf("创建校验器失败: %v", err)
+		}
+		passed, _, results, err := validator.Validate([]map[string]interface{}{
+			{"shop": "a", "sku": "1"},
+			{"shop": "a"},
+			{"shop": "a", "sku": nil},
+			{"shop": "a", "sku": "1"}, // 重复 -> drop
+			{"sku": "1"},
+		})
+		if err != nil {
+			t.Fatalf("校验失败: %v", err)
+		}
+		if len(passed) != 4 || results[0].Failed != 1 {
+			t.Errorf("缺失值不应被判为重复，通过 %d 条，失败 %d 条", len(passed), results[0].Failed)
+		}
+	})
+
+	t.Run("fail 规则使执行失败", func(t *testing.T) {
+		proc := processor.NewProcessor(&models.ProcessorConfig{
+			ValidationRules: []models.ValidationRule{
+				{Name: "must_have_title", Field: "title", Type: "required", Action: "fail"},
+			},
+		})
+		_, err := proc.Process([]map[string]interface{}{{"title": "a"}, {"body": "b"}})
+		if err == nil {
+			t.Fatal("期望执行失败")
+		}
+		results := proc.ValidationResults()
+		if len(results) != 1 || results[0].Failed != 1 {
+			t.Errorf("失败时也应记录校验结果: %+v", results)
+		}
+	})
+
+	t.Run("保存时报告无效规则", func(t *testing.T) {
+		invalid := [][]models.ValidationRule{
+			{{Name: "bad_regex", Field: "a", Type: "regex", Pattern: "(["}},
+			{{Name: "bad_expr", Type: "expression", Expression: "a >"}},
+			{{Name: "bad_action", Field: "a", Type: "required", Action: "explode"}},
+			{{Name: "no_bounds", Field: "a", Type: "range"}},
+		}
+		for _, rules := range invalid {
+			if err := processor.ValidateValidationRules(rules); err == nil {
+				t.Errorf("规则 %s 应校验失败", rules[0].Name)
+			}
+		}
+	})
+}
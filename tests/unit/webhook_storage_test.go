@@ -0,0 +1,260 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/storage"
+)
+
+func TestWebhookStorage(t *testing.T) {
+	data := []map[string]interface{}{{"id": 1}, {"id": 2}, {"id": 3}}
+
+	t.Run("分批推送并签名", func(t *testing.T) {
+		var batches [][]map[string]interface{}
+		var signatureOK int32 = 1
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			expected := "sha256=" + storage.SignWebhook("s3cret", r.Header.Get(storage.WebhookHeaderTimestamp), body)
+			if r.Header.Get(storage.WebhookHeaderSignature) != expected {
+				atomic.StoreInt32(&signatureOK, 0)
+			}
+			var batch []map[string]interface{}
+			json.Unmarshal(body, &batch)
+			batches = append(batches, batch)
+		}))
+		defer server.Close()
+
+		s := storage.NewWebhookStorage(t.TempDir())
+		config := &models.StorageConfig{
+			Target:  "webhook",
+			Webhook: &models.WebhookConfig{URL: server.URL, BatchSize: 2, Secret: "s3cret"},
+		}
+		if err := s.Store(context.Background(), config, data); err != nil {
+			t.Fatalf("推送失败: %v", err)
+		}
+		if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 {
+			t.Errorf("批次划分错误: %v", batches)
+		}
+		if atomic.LoadInt32(&signatureOK) != 1 {
+			t.Error("签名校验失败")
+		}
+	})
+
+	t.Run("5xx 重试后成功", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			if r.Header.Get("Content-Type") != "application/x-ndjson" {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}))
+		defer server.Close()
+
+		s := storage.NewWebhookStorage(t.TempDir())
+		s.SetRetryDelay(time.Millisecond, 5*time.Millisecond)
+		config := &models.StorageConfig{
+			Target:  "webhook",
+			Webhook: &models.WebhookConfig{URL: server.URL, Format: "ndjson"},
+		}
+		if err := s.Store(context.Background(), config, data); err != nil {
+			t.Fatalf("推送失败: %v", err)
+		}
+		if calls != 3 {
+			t.Errorf("期望请求 3 次，实际 %d 次", calls)
+		}
+	})
+
+	t.Run("重试耗尽写入死信", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		deadLetterDir := t.TempDir()
+		s := storage.NewWebhookStorage(deadLetterDir)
+		s.SetRetryDelay(time.Millisecond, 5*time.Millisecond)
+		config := &models.StorageConfig{
+			Target:  "webhook",
+			Name:    "consumer",
+			Webhook: &models.WebhookConfig{URL: server.URL, MaxRetries: 2},
+		}
+		if err := s.Store(context.Background(), config, data); err == nil {
+			t.Fatal("重试耗尽应该返回错误")
+		}
+		if calls != 3 {
+			t.Errorf("期望请求 3 次，实际 %d 次", calls)
+		}
+
+		files, _ := filepath.Glob(filepath.Join(deadLetterDir, "consumer", "*.json"))
+		if len(files) != 1 {
+			t.Fatalf("期望 1 个死信文件，得到 %d 个", len(files))
+		}
+		content, _ := os.ReadFile(files[0])
+		if !strings.Contains(string(content), `"attempts": 3`) {
+			t.Errorf("死信内容错误: %s", content)
+		}
+	})
+
+	t.Run("死信重放使用单独的推送标识", func(t *testing.T) {
+		var deliveries []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			deliveries = append(deliveries, r.Header.Get(storage.WebhookHeaderDelivery))
+		}))
+		defer server.Close()
+
+		s := storage.NewWebhookStorage(t.TempDir())
+		config := &models.StorageConfig{Target: "webhook", Webhook: &models.WebhookConfig{URL: server.URL}}
+		info := storage.ExecutionInfo{TaskID: 1, ExecutionID: 10}
+		if err := s.Store(storage.WithExecutionInfo(context.Background(), info), config, data[:1]); err != nil {
+			t.Fatalf("推送失败: %v", err)
+		}
+		info.ReplayID = 7
+		if err := s.Store(storage.WithExecutionInfo(context.Background(), info), config, data[:1]); err != nil {
+			t.Fatalf("重放推送失败: %v", err)
+		}
+		if len(deliveries) != 2 || deliveries[0] != "1-10-0" || deliveries[1] != "1-10-r7-0" {
+			t.Errorf("推送标识 = %v", deliveries)
+		}
+	})
+
+	t.Run("4xx 不重试", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer server.Close()
+
+		s := storage.NewWebhookStorage(t.TempDir())
+		s.SetRetryDelay(time.Millisecond, 5*time.Millisecond)
+		config := &models.StorageConfig{Target: "webhook", Webhook: &models.WebhookConfig{URL: server.URL}}
+		s.Store(context.Background(), config, data)
+		if calls != 1 {
+			t.Errorf("4xx 不应重试，实际请求 %d 次", calls)
+		}
+	})
+}
+
+func TestWebhookStorageRetry(t *testing.T) {
+	data := []map[string]interface{}{{"id": 1}, {"id": 2}, {"id": 3}}
+
+	t.Run("整体重试时跳过已送达的批次", func(t *testing.T) {
+		var calls int32
+		var failSecond int32 = 1
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			if strings.HasSuffix(r.Header.Get(storage.WebhookHeaderDelivery), "-1") && atomic.LoadInt32(&failSecond) == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+			}
+		}))
+		defer server.Close()
+
+		s := storage.NewWebhookStorage(t.TempDir())
+		s.SetRetryDelay(time.Millisecond, time.Millisecond)
+		config := &models.StorageConfig{Target: "webhook",
+			Webhook: &models.WebhookConfig{URL: server.URL, BatchSize: 2, MaxRetries: 1}}
+		ctx := storage.WithExecutionInfo(context.Background(), storage.ExecutionInfo{TaskID: 1, ExecutionID: 10})
+
+		// 批次 0 送达，批次 1 重试耗尽
+		if err := s.Store(ctx, config, data); err == nil {
+			t.Fatal("批次 1 失败时应返回错误")
+		}
+		if calls != 3 {
+			t.Fatalf("期望请求 3 次，实际 %d 次", calls)
+		}
+
+		// 同一执行重试时已送达和已写入死信的批次都不再推送
+		atomic.StoreInt32(&failSecond, 0)
+		atomic.StoreInt32(&calls, 0)
+		if err := s.Store(ctx, config, data); err != nil {
+			t.Fatalf("重试推送失败: %v", err)
+		}
+		if calls != 0 {
+			t.Errorf("重试时期望不推送，实际请求 %d 次", calls)
+		}
+
+		// 数据内容变化的批次重新推送
+		atomic.StoreInt32(&calls, 0)
+		if err := s.Store(ctx, config, []map[string]interface{}{{"id": 4}}); err != nil || calls != 1 {
+			t.Errorf("内容变化的批次应重新推送: %v, 请求 %d 次", err, calls)
+		}
+
+		// 其他执行不受影响
+		atomic.StoreInt32(&calls, 0)
+		other := storage.WithExecutionInfo(context.Background(), storage.ExecutionInfo{TaskID: 1, ExecutionID: 11})
+		if err := s.Store(other, config, data); err != nil || calls != 2 {
+			t.Errorf("其他执行应推送全部批次: %v, 请求 %d 次", err, calls)
+		}
+	})
+
+	t.Run("整体重试时跳过已写入死信的批次", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		deadLetterDir := t.TempDir()
+		s := storage.NewWebhookStorage(deadLetterDir)
+		s.SetRetryDelay(time.Millisecond, time.Millisecond)
+		config := &models.StorageConfig{Target: "webhook", Name: "consumer",
+			Webhook: &models.WebhookConfig{URL: server.URL, BatchSize: 2, MaxRetries: 1}}
+		ctx := storage.WithExecutionInfo(context.Background(), storage.ExecutionInfo{TaskID: 1, ExecutionID: 12})
+
+		if err := s.Store(ctx, config, data); err == nil {
+			t.Fatal("批次写入死信时应返回错误")
+		}
+		atomic.StoreInt32(&calls, 0)
+		if err := s.Store(ctx, config, data); err != nil {
+			t.Fatalf("重试时已写入死信的批次应视为已处理: %v", err)
+		}
+		if calls != 0 {
+			t.Errorf("重试时不应再推送已写入死信的批次，实际请求 %d 次", calls)
+		}
+		if files, _ := filepath.Glob(filepath.Join(deadLetterDir, "consumer", "*.json")); len(files) != 2 {
+			t.Errorf("期望 2 个死信文件，得到 %d 个", len(files))
+		}
+	})
+
+	t.Run("死信目录不能越界", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		root := t.TempDir()
+		deadLetterDir := filepath.Join(root, "dead")
+		s := storage.NewWebhookStorage(deadLetterDir)
+		s.SetRetryDelay(time.Millisecond, time.Millisecond)
+		config := &models.StorageConfig{Target: "webhook", Name: "../escape",
+			Webhook: &models.WebhookConfig{URL: server.URL, MaxRetries: 1}}
+		if err := s.Store(context.Background(), config, data); err == nil {
+			t.Fatal("推送失败应返回错误")
+		}
+
+		files, _ := filepath.Glob(filepath.Join(deadLetterDir, "escape", "*.json"))
+		if len(files) != 1 {
+			t.Errorf("死信文件应写入死信目录下的 escape 子目录，得到 %v", files)
+		}
+		if escaped, _ := filepath.Glob(filepath.Join(root, "escape")); len(escaped) != 0 {
+			t.Errorf("死信文件写到了死信目录之外: %v", escaped)
+		}
+	})
+}
@@ -0,0 +1,188 @@
+package unit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/datafusion/worker/internal/api"
+	"github.com/datafusion/worker/internal/logger"
+	"github.com/datafusion/worker/internal/models"
+	"github.com/datafusion/worker/internal/workflow"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// diamondWorkflow a -> b（成功）、a -> c（失败）、b -> d、c -> d（总是）
+func diamondWorkflow() models.WorkflowDefinition {
+	return models.WorkflowDefinition{
+		Nodes: []models.WorkflowNode{
+			{Name: "a", TaskID: 1},
+			{Name: "b", TaskID: 2},
+			{Name: "c", TaskID: 3},
+			{Name: "d", TaskID: 4},
+		},
+		Edges: []models.WorkflowEdge{
+			{From: "a", To: "b"},
+			{From: "a", To: "c", Condition: models.WorkflowConditionFailure},
+			{From: "b", To: "d", Condition: models.WorkflowConditionAlways},
+			{From: "c", To: "d", Condition: models.WorkflowConditionAlways},
+		},
+	}
+}
+
+func TestValidateWorkflow(t *testing.T) {
+	if err := workflow.Validate(diamondWorkflow()); err != nil {
+		t.Fatalf("合法的工作流校验失败: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(def *models.WorkflowDefinition)
+		wantErr string
+	}{
+		{"没有节点", func(def *models.WorkflowDefinition) { def.Nodes = nil }, "至少需要一个节点"},
+		{"节点重名", func(def *models.WorkflowDefinition) { def.Nodes[1].Name = "a" }, "重复"},
+		{"缺少任务", func(def *models.WorkflowDefinition) { def.Nodes[0].TaskID = 0 }, "task_id"},
+		{"未知节点", func(def *models.WorkflowDefinition) {
+			def.Edges = append(def.Edges, models.WorkflowEdge{From: "d", To: "x"})
+		}, "不存在的节点 x"},
+		{"无效条件", func(def *models.WorkflowDefinition) { def.Edges[0].Condition = "maybe" }, "条件 maybe 无效"},
+		{"依赖自身", func(def *models.WorkflowDefinition) {
+			def.Edges = append(def.Edges, models.WorkflowEdge{From: "b", To: "b"})
+		}, "不能依赖自身"},
+		{"循环依赖", func(def *models.WorkflowDefinition) {
+			def.Edges = append(def.Edges, models.WorkflowEdge{From: "d", To: "a"})
+		}, "循环依赖"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def := diamondWorkflow()
+			tt.modify(&def)
+			err := workflow.Validate(def)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("期望错误包含 %q，实际 %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestAdvanceWorkflow(t *testing.T) {
+	def := diamondWorkflow()
+	pending := func(overrides map[string]string) map[string]string {
+		statuses := map[string]string{"a": "pending", "b": "pending", "c": "pending", "d": "pending"}
+		for k, v := range overrides {
+			statuses[k] = v
+		}
+		return statuses
+	}
+
+	tests := []struct {
+		name      string
+		statuses  map[string]string
+		wantQueue []string
+		wantSkip  []string
+	}{
+		{"开始时只执行没有上游的节点", pending(nil), []string{"a"}, nil},
+		{"上游执行中时等待", pending(map[string]string{"a": "running"}), nil, nil},
+		{"上游成功时执行 success 分支，跳过 failure 分支", pending(map[string]string{"a": "success"}),
+			[]string{"b"}, []string{"c"}},
+		{"上游失败时执行 failure 分支，跳过的节点继续推进下游", pending(map[string]string{"a": "failed"}),
+			[]string{"c"}, []string{"b"}},
+		{"always 在上游结束后执行", pending(map[string]string{"a": "success", "b": "failed", "c": "skipped"}),
+			[]string{"d"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue, skip := workflow.Advance(def, tt.statuses)
+			if !reflect.DeepEqual(queue, tt.wantQueue) {
+				t.Errorf("queue = %v, 期望 %v", queue, tt.wantQueue)
+			}
+			if !reflect.DeepEqual(skip, tt.wantSkip) {
+				t.Errorf("skip = %v, 期望 %v", skip, tt.wantSkip)
+			}
+		})
+	}
+
+	// 跳过沿 success 边传播：a 失败时 b、c 都被跳过
+	chain := models.WorkflowDefinition{
+		Nodes: []models.WorkflowNode{{Name: "a", TaskID: 1}, {Name: "b", TaskID: 2}, {Name: "c", TaskID: 3}},
+		Edges: []models.WorkflowEdge{{From: "a", To: "b"}, {From: "b", To: "c"}},
+	}
+	queue, skip := workflow.Advance(chain, map[string]string{"a": "failed", "b": "pending", "c": "pending"})
+	if len(queue) != 0 || !reflect.DeepEqual(skip, []string{"b", "c"}) {
+		t.Errorf("跳过未传播到下游: queue=%v skip=%v", queue, skip)
+	}
+}
+
+func TestWorkflowRunStatus(t *testing.T) {
+	def := diamondWorkflow()
+	tests := []struct {
+		statuses map[string]string
+		want     string
+	}{
+		{map[string]string{"a": "success", "b": "running", "c": "skipped", "d": "pending"}, models.WorkflowRunRunning},
+		{map[string]string{"a": "success", "b": "success", "c": "skipped", "d": "success"}, models.WorkflowRunSuccess},
+		{map[string]string{"a": "failed", "b": "skipped", "c": "success", "d": "success"}, models.WorkflowRunFailed},
+	}
+	for _, tt := range tests {
+		if got := workflow.RunStatus(def, tt.statuses); got != tt.want {
+			t.Errorf("RunStatus(%v) = %s, 期望 %s", tt.statuses, got, tt.want)
+		}
+	}
+}
+
+func TestRenderUpstreamPlaceholders(t *testing.T) {
+	record := map[string]interface{}{
+		"id":    float64(42),
+		"price": 9.5,
+		"item":  map[string]interface{}{"slug": "book"},
+	}
+
+	got := workflow.Render("https://example.com/{{ item.slug }}/{{id}}?p={{price}}&x={{missing}}", record)
+	want := "https://example.com/book/42?p=9.5&x="
+	if got != want {
+		t.Errorf("Render = %s, 期望 %s", got, want)
+	}
+	if !workflow.HasPlaceholder("/items/{{id}}") || workflow.HasPlaceholder("/items/{id}") {
+		t.Error("HasPlaceholder 判断错误")
+	}
+}
+
+func TestWorkflowHandlerPagination(t *testing.T) {
+	db := openTestDB(t)
+	var id int64
+	if err := db.QueryRow(`INSERT INTO workflows (name, definition) VALUES ('分页', '{"nodes": [], "edges": []}') RETURNING id`).Scan(&id); err != nil {
+		t.Fatalf("创建工作流失败: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO workflow_runs (workflow_id, status, trigger, definition) VALUES ($1, 'success', 'manual', '{}')`, id); err != nil {
+		t.Fatalf("创建运行记录失败: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	handler := api.NewWorkflowHandler(db.DB, &logger.Logger{Logger: zap.NewNop()})
+	router := gin.New()
+	router.GET("/workflows", handler.List)
+	router.GET("/workflows/:id/runs", handler.ListRuns)
+
+	// 无效的分页参数按第 1 页、每页 20 条处理
+	for _, path := range []string{"/workflows", fmt.Sprintf("/workflows/%d/runs", id)} {
+		for _, query := range []string{"?page=0", "?page=abc", "?page=-1&page_size=0", "?page_size=x"} {
+			resp := serveJSON(router, http.MethodGet, path+query, "")
+			var body struct {
+				Data     []json.RawMessage `json:"data"`
+				Page     int               `json:"page"`
+				PageSize int               `json:"page_size"`
+			}
+			json.Unmarshal(resp.Body.Bytes(), &body)
+			if resp.Code != http.StatusOK || len(body.Data) != 1 || body.Page != 1 || body.PageSize != 20 {
+				t.Errorf("%s%s 返回 %d: %s", path, query, resp.Code, resp.Body.String())
+			}
+		}
+	}
+}